@@ -0,0 +1,61 @@
+// Фейковый сервер API ЮMoney для локальной разработки: YOOMONEY_BASE_URL=http://localhost:8090.
+// Оплата ссылки: curl -X POST http://localhost:8090/fake/invoices/<payment_id>/pay
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"paymentgo/internal/cmd/yoomoney/fake"
+	dto "paymentgo/internal/entity"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	token := flag.String("token", "", "required OAuth token for /api requests (empty accepts any)")
+	account := flag.String("account", dto.CoreAccount, "wallet number payment links are issued to")
+	balance := flag.String("balance", "1000000.00", "initial wallet balance in RUB")
+	notifyURL := flag.String("notify-url", "", "URL for incoming payment notifications, e.g. http://localhost:8081/yoomoney/notifications")
+	notifySecret := flag.String("notify-secret", "", "notification secret used to sign sha1_hash")
+	flag.Parse()
+
+	initial, err := dto.ParseMoney(*balance, "RUB")
+	if err != nil {
+		log.Fatalf("invalid balance: %v", err)
+	}
+
+	opts := []fake.Option{fake.WithAccount(*account), fake.WithBalance(initial)}
+	if *token != "" {
+		opts = append(opts, fake.WithToken(*token))
+	}
+	if *notifyURL != "" {
+		opts = append(opts, fake.WithNotifications(*notifyURL, *notifySecret))
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           fake.New(opts...),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Fake YooMoney listening on %s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("fake YooMoney server failed: %v", err)
+	}
+}
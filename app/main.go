@@ -3,22 +3,36 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"expvar"
 	"fmt"
 	"io/fs"
 	"net"
+	"net/http"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"paymentgo/internal/cmd/auth"
 	"paymentgo/internal/cmd/convert"
 	"paymentgo/internal/cmd/yoomoney"
 	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/outbox"
 	"paymentgo/internal/repository/postgres"
 	paymentsDemon "paymentgo/internal/server_demon"
 	"paymentgo/internal/transport/grpc/proto"
 	handlers "paymentgo/internal/transport/http"
+	"paymentgo/internal/usecase"
 	"paymentgo/internal/usecase/service"
 	db "paymentgo/utils/connector"
 	log "paymentgo/utils/logger"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
@@ -34,20 +48,15 @@ func main() {
 	logger := log.NewLogger(cfg)
 	defer logger.Sync()
 
-	ctx := context.WithValue(context.Background(), "logger", logger)
+	// SIGTERM/SIGINT отменяет ctx: сервер перестаёт принимать запросы, демон новые платежи
+	ctx, stop := signal.NotifyContext(context.WithValue(context.Background(), "logger", logger), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	dbConn, err := db.NewPostgres(ctx, cfg, logger)
 	if err != nil {
 		logger.Fatal("Failed to initialize PostgreSQL", zap.Error(err))
 	}
 
-	defer func() {
-		if dbConn != nil {
-			dbConn.Close()
-			logger.Info("Database connection closed")
-		}
-	}()
-
 	if err := fs.WalkDir(migrations, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -64,38 +73,268 @@ func main() {
 		logger.Fatal("Failed to apply migrations", zap.Error(err))
 	}
 
-	const grpcServerAddress = "localhost:8888"
-
-	authClient, err := auth.NewAuthClient(grpcServerAddress)
+	authClient, err := auth.NewAuthClient(cfg.Auth.Client, logger)
 	if err != nil {
-		logger.Fatal("Failed to create AuthClient")
+		logger.Fatal("Failed to create AuthClient", zap.Error(err))
 	}
-	defer authClient.Close()
 
 	rdb := db.InitRedis(cfg, logger)
-	defer rdb.Close()
 
-	paymentsQueue := db.NewPaymentsQueue()
+	var paymentsQueue db.Queue
+	switch cfg.Queue.Driver {
+	case "memory":
+		// In-memory очередь продолжает задачи, сохранённые в payment_queue при прошлой остановке
+		memoryQueue := db.NewPaymentsQueue()
+		tasks, err := db.NewPostgresQueue(dbConn, logger, 0, 0).TakeTasks(ctx)
+		if err != nil {
+			logger.Fatal("Failed to restore payment queue", zap.Error(err))
+		}
+		memoryQueue.Restore(tasks)
+		logger.Info("Payment queue restored from database", zap.Int("payments", len(tasks)))
+		paymentsQueue = memoryQueue
+	default:
+		paymentsQueue = db.NewPostgresQueue(dbConn, logger, cfg.Queue.VisibilityTimeout, cfg.Queue.MaxDeliveries)
+	}
 
-	converter := convert.NewForexClient(cfg)
-	paymentClient := yoomoney.New(cfg)
+	rateSources, err := convert.NewRateSources(cfg)
+	if err != nil {
+		logger.Fatal("Failed to configure rate sources", zap.Error(err))
+	}
+	converter := convert.NewForexClient(cfg, rateSources, rdb, logger)
+	// Курсы используемых валют держатся в кеше свежими, GetPaymentLink не ждёт источники курсов
+	go converter.Run(ctx)
+
+	var paymentProviders []usecase.PaymentProvider
+	for _, name := range cfg.Provider.Enabled {
+		switch name {
+		case yoomoney.ProviderName:
+			receiver := dto.CoreAccount
+			if cfg.Yoomoney.Receiver != 0 {
+				receiver = strconv.Itoa(cfg.Yoomoney.Receiver)
+			}
+			paymentProviders = append(paymentProviders, yoomoney.NewProvider(yoomoney.New(cfg), receiver))
+		default:
+			logger.Fatal("Unknown payment provider", zap.String("provider", name))
+		}
+	}
+	providers, err := usecase.NewProviderRegistry(cfg.Provider.Default, paymentProviders...)
+	if err != nil {
+		logger.Fatal("Failed to configure payment providers", zap.Error(err))
+	}
+
+	// История курсов для пересчёта на дату расчёта (GetExchangeRate)
+	rateHistory := convert.NewRateHistory(converter, postgres.NewRateRepository(dbConn, logger), cfg, logger)
+	go rateHistory.Run(ctx)
 
 	repo := postgres.NewPaymentRepository(dbConn, rdb, logger)
-	svc := service.NewPaymentService(repo, logger, converter, paymentClient, paymentsQueue)
+	svc := service.NewPaymentService(repo, logger, converter, providers, paymentsQueue)
 
-	demon := paymentsDemon.NewDaemon(*svc, repo, paymentClient, paymentsQueue, logger, authClient)
+	deadLetters := postgres.NewDeadLetterRepository(dbConn, logger)
+	adminSvc := service.NewAdminService(deadLetters, repo, paymentsQueue, logger)
+
+	var elector db.LeaderElector = db.AlwaysLeader{}
+	if cfg.Daemon.Leader.Enabled {
+		elector = db.NewPostgresLeaderElector(dbConn, logger, cfg.Daemon.Leader.LockKey, cfg.Daemon.Leader.RetryInterval, cfg.Daemon.Leader.CheckInterval)
+	}
+
+	// Получатели выплат кешируются в Redis: повторные выплаты и сбои сервиса авторизации не блокируют демон
+	users := auth.NewUserCache(authClient, rdb, cfg.Auth.Users, logger)
+	go users.RunInvalidations(ctx)
+
+	demon := paymentsDemon.NewDaemon(*svc, repo, providers, paymentsQueue, logger, users, deadLetters, elector, cfg.Daemon)
 	go demon.Run(ctx)
 
-	grpcServer := grpc.NewServer()
-	paymentHandler := handlers.NewPaymentHandler(svc, logger)
+	events := postgres.NewPaymentEventRepository(dbConn, logger)
+	// Подписки WatchPayment этой реплики; события приходят от relay получателя pubsub с любой реплики.
+	// Hub останавливается вместе с ctx, и стримы завершаются, не задерживая GracefulStop
+	hub := outbox.NewHub(rdb, cfg.Outbox.PubSubChannel, cfg.Outbox.WatchBuffer, logger)
+	go hub.Run(ctx)
+	watchSvc := service.NewWatchService(repo, events, hub, logger)
+
+	// Hub подключён всегда, поэтому relay pubsub запускается, даже если его нет в Sinks:
+	// иначе подписчики WatchPayment молча остаются без событий
+	sinks := cfg.Outbox.Sinks
+	if !slices.Contains(sinks, "pubsub") {
+		logger.Info("Outbox pubsub sink is required by WatchPayment, enabling it", zap.Strings("sinks", sinks))
+		sinks = append(slices.Clone(sinks), "pubsub")
+	}
+
+	var relays sync.WaitGroup
+	for i, name := range sinks {
+		var sink outbox.Sink
+		switch name {
+		case "redis":
+			sink = outbox.NewRedisStreamSink(rdb, cfg.Outbox.RedisStream, cfg.Outbox.RedisMaxLen)
+		case "pubsub":
+			sink = outbox.NewPubSubSink(rdb, cfg.Outbox.PubSubChannel)
+		case "webhook":
+			if cfg.Outbox.WebhookURL == "" {
+				logger.Fatal("OUTBOX_WEBHOOK_URL is required for webhook sink")
+			}
+			sink = outbox.NewWebhookSink(cfg.Outbox.WebhookURL, cfg.Outbox.WebhookSecret, &http.Client{Timeout: cfg.Outbox.WebhookTimeout})
+		default:
+			logger.Fatal("Unknown outbox sink", zap.String("sink", name))
+		}
+
+		var relayElector db.LeaderElector = db.AlwaysLeader{}
+		if cfg.Daemon.Leader.Enabled {
+			relayElector = db.NewPostgresLeaderElector(dbConn, logger, cfg.Outbox.LockKey+int64(i), cfg.Daemon.Leader.RetryInterval, cfg.Daemon.Leader.CheckInterval)
+		}
+		relay := outbox.NewRelay(events, sink, relayElector, cfg.Outbox.BatchSize, cfg.Outbox.PollInterval, logger)
+		relays.Add(1)
+		go func() {
+			defer relays.Done()
+			relay.Run(ctx)
+		}()
+	}
+
+	idempotencyRepo := postgres.NewIdempotencyRepository(dbConn, logger)
+
+	// Правила доступа к RPC: кто из участников платежа, администратор или сервисный аккаунт может его вызвать
+	policy, err := auth.NewPolicy(cfg.Auth)
+	if err != nil {
+		logger.Fatal("Failed to configure access policy", zap.Error(err))
+	}
+
+	// Некорректный запрос отклоняется до резервирования ключа идемпотентности
+	unaryInterceptors := []grpc.UnaryServerInterceptor{handlers.NewValidationInterceptor(), handlers.NewIdempotencyInterceptor(idempotencyRepo, cfg.Server.IdempotencyTimeout, logger)}
+	streamInterceptors := []grpc.StreamServerInterceptor{handlers.NewValidationStreamInterceptor()}
+	var authenticator *auth.Authenticator
+	if cfg.Auth.Enabled {
+		// Токен проверяется до идемпотентности: ключи идемпотентности принадлежат вызывающему,
+		// поэтому сохранённый ответ повторяется только тому пользователю, чей запрос прошёл проверку доступа
+		authenticator = auth.NewAuthenticator(authClient, cfg.Auth.CacheTTL)
+		unaryInterceptors = append([]grpc.UnaryServerInterceptor{handlers.NewAuthUnaryInterceptor(authenticator, logger)}, unaryInterceptors...)
+		streamInterceptors = append([]grpc.StreamServerInterceptor{handlers.NewAuthStreamInterceptor(authenticator, logger)}, streamInterceptors...)
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+	paymentHandler := handlers.NewPaymentHandler(svc, watchSvc, rateHistory, policy, logger)
 	proto.RegisterPaymentServiceServer(grpcServer, paymentHandler)
+	proto.RegisterPaymentAdminServiceServer(grpcServer, handlers.NewAdminHandler(adminSvc, policy, logger))
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.Port))
 	if err != nil {
 		logger.Fatal("Failed to start gRPC listener", zap.Error(err))
 	}
-	logger.Info(fmt.Sprintf("Starting gRPC server on port %d", cfg.Server.Port))
-	if err := grpcServer.Serve(listener); err != nil {
-		logger.Fatal("Failed to start gRPC server", zap.Error(err))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info(fmt.Sprintf("Starting gRPC server on port %d", cfg.Server.Port))
+		serveErr <- grpcServer.Serve(listener)
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	serveHTTP := false
+	if cfg.Yoomoney.NotificationSecret != "" {
+		notificationSvc := service.NewNotificationService(svc, repo, postgres.NewNotificationRepository(dbConn, logger), paymentsQueue, logger)
+		mux.Handle(cfg.Yoomoney.NotificationPath, handlers.NewNotificationHandler(notificationSvc, cfg.Yoomoney.NotificationSecret, logger))
+		serveHTTP = true
+	} else {
+		logger.Warn("YOOMONEY_NOTIFICATION_SECRET is not set, payment notifications are disabled")
+	}
+
+	// Статусы платежей для браузера: те же подписки, что и WatchPayment, по тому же токену
+	var socket *handlers.PaymentSocket
+	if cfg.WebSocket.Enabled {
+		socket = handlers.NewPaymentSocket(authenticator, svc, watchSvc, policy, cfg.WebSocket, logger)
+		mux.Handle(cfg.WebSocket.Path, socket)
+		serveHTTP = true
+	}
+
+	var httpServer *http.Server
+	if serveHTTP {
+		httpServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.Server.HTTPPort),
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		// Shutdown не ждёт WebSocket-соединений, их закрывает сам шлюз
+		if socket != nil {
+			httpServer.RegisterOnShutdown(socket.Shutdown)
+		}
+
+		go func() {
+			logger.Info(fmt.Sprintf("Starting HTTP server on port %d", cfg.Server.HTTPPort))
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received", zap.Duration("drain_timeout", cfg.Server.ShutdownTimeout))
+	case err := <-serveErr:
+		logger.Error("Server stopped unexpectedly", zap.Error(err))
+		stop()
+	}
+
+	shutdown(logger, cfg.Server.ShutdownTimeout, grpcServer, httpServer, demon, &relays, paymentsQueue, dbConn, rdb, authClient)
+}
+
+// shutdown останавливает сервис за drainTimeout: gRPC- и HTTP-серверы дорабатывают начатые вызовы,
+// демон доделывает текущие платежи (или возвращает их в очередь по истечении срока),
+// in-memory очередь сохраняется в payment_queue (при запуске она загружается обратно), затем закрываются соединения
+func shutdown(logger *zap.Logger, drainTimeout time.Duration, grpcServer *grpc.Server, httpServer *http.Server, demon *paymentsDemon.Daemon, relays *sync.WaitGroup, paymentsQueue db.Queue, dbConn *pgxpool.Pool, rdb *redis.Client, authClient *auth.AuthClient) {
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	if httpServer != nil {
+		if err := httpServer.Shutdown(drainCtx); err != nil {
+			logger.Warn("HTTP server drain deadline exceeded", zap.Error(err))
+		}
+		logger.Info("HTTP server stopped")
+	}
+
+	if err := demon.Shutdown(drainCtx); err != nil {
+		logger.Warn("Payment daemon drain deadline exceeded, in-flight payments were requeued", zap.Error(err))
+	}
+
+	// Relay остановлены вместе с ctx, ждём только текущую публикацию
+	relays.Wait()
+
+	select {
+	case <-stopped:
+		logger.Info("gRPC server stopped")
+	case <-drainCtx.Done():
+		grpcServer.Stop()
+		logger.Warn("gRPC drain deadline exceeded, remaining calls were cancelled")
+	}
+
+	if memoryQueue, ok := paymentsQueue.(*db.LockFreeQueue); ok {
+		// Задачи пишутся одной транзакцией в оставшийся срок остановки: при ошибке не сохранена ни одна,
+		// и их платежи перечисляются в логе для ручной постановки
+		pending := memoryQueue.Drain()
+		if err := db.NewPostgresQueue(dbConn, logger, 0, 0).SaveTasks(drainCtx, pending); err != nil {
+			lost := make([]string, 0, len(pending))
+			for _, task := range pending {
+				lost = append(lost, task.Payment.ID)
+			}
+			logger.Error("Failed to flush in-memory payment queue to database", zap.Strings("payment_ids", lost), zap.Error(err))
+		} else {
+			logger.Info("In-memory payment queue flushed to database", zap.Int("payments", len(pending)))
+		}
 	}
+
+	authClient.Close()
+	logger.Info("Auth client closed")
+
+	if err := rdb.Close(); err != nil {
+		logger.Warn("Failed to close Redis connection", zap.Error(err))
+	}
+	logger.Info("Redis connection closed")
+
+	dbConn.Close()
+	logger.Info("Database connection closed")
 }
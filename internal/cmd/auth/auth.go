@@ -2,10 +2,23 @@ package auth
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure" // Import insecure package
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 
+	"paymentgo/internal/config"
 	pb "paymentgo/internal/transport/grpc/proto"
 )
 
@@ -14,8 +27,35 @@ type AuthClient struct {
 	conn   *grpc.ClientConn
 }
 
-func NewAuthClient(grpcServerAddress string) (*AuthClient, error) {
-	conn, err := grpc.NewClient(grpcServerAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewAuthClient подключение к сервису авторизации по настройкам cfg: TLS, таймаут вызова,
+// повторы через service config, keepalive и размыкатель цепи
+func NewAuthClient(cfg config.AuthClient, logger *zap.Logger) (*AuthClient, error) {
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	serviceConfig, err := retryServiceConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		// Размыкатель стоит перед таймаутом: истечение собственного таймаута вызова считается сбоем сервиса
+		grpc.WithChainUnaryInterceptor(
+			newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logger.With(zap.String("component", "auth_client"))).unaryInterceptor,
+			timeoutInterceptor(cfg.Timeout),
+		),
+	}
+	if cfg.KeepaliveTime > 0 {
+		options = append(options, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}))
+	}
+
+	conn, err := grpc.NewClient(cfg.Address, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -40,3 +80,100 @@ func (a *AuthClient) GetUserById(ctx context.Context, id string) (*pb.GetUserByI
 	}
 	return a.client.GetUserById(ctx, request)
 }
+
+// ValidateToken проверка токена сервисом авторизации; отклонённый токен возвращается как ErrInvalidToken
+func (a *AuthClient) ValidateToken(ctx context.Context, token string) error {
+	_, err := a.client.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: token})
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.Unauthenticated, codes.PermissionDenied, codes.InvalidArgument, codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrInvalidToken, status.Convert(err).Message())
+	}
+	return err
+}
+
+func transportCredentials(cfg config.AuthClient) (credentials.TransportCredentials, error) {
+	if !cfg.TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in auth CA file %s", cfg.CAFile)
+		}
+	}
+	switch {
+	case cfg.CertFile != "" && cfg.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load auth client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		return nil, errors.New("auth client certificate requires both cert and key files")
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// retryServiceConfig service config с повторами вызовов сервиса авторизации, завершившихся UNAVAILABLE
+func retryServiceConfig(cfg config.AuthClient) (string, error) {
+	method := methodConfig{Name: []methodName{{Service: "auth.Auth"}}}
+	if cfg.MaxAttempts > 1 {
+		if cfg.InitialBackoff <= 0 || cfg.MaxBackoff <= 0 {
+			return "", errors.New("auth client retries require positive initial and max backoff")
+		}
+		method.RetryPolicy = &retryPolicy{
+			MaxAttempts:          cfg.MaxAttempts,
+			InitialBackoff:       serviceConfigDuration(cfg.InitialBackoff),
+			MaxBackoff:           serviceConfigDuration(cfg.MaxBackoff),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+	}
+	data, err := json.Marshal(map[string][]methodConfig{"methodConfig": {method}})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// serviceConfigDuration длительность в формате service config ("0.100s")
+func serviceConfigDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// timeoutInterceptor ограничивает вызов вместе с повторами timeout, если у вызывающего дедлайн дальше
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
+	"paymentgo/internal/config"
 	"paymentgo/internal/transport/grpc/proto"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 )
 
 const bufSize = 1024 * 1024
@@ -41,17 +48,116 @@ func (m *MockAuthServer) GetUserById(ctx context.Context, req *proto.GetUserById
 	return nil, errors.New("user not found")
 }
 
+func (m *MockAuthServer) ValidateToken(ctx context.Context, req *proto.ValidateTokenRequest) (*proto.ValidateTokenResponse, error) {
+	switch req.Token {
+	case "valid-token":
+		return &proto.ValidateTokenResponse{}, nil
+	case "revoked-token":
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
+	}
+	return nil, status.Error(codes.Unavailable, "token store unavailable")
+}
+
 func bufDialer(ctx context.Context, s string) (net.Conn, error) {
 	return listener.Dial()
 }
 
 func TestNewAuthClient(t *testing.T) {
-	client, err := NewAuthClient("")
+	client, err := NewAuthClient(config.AuthClient{Address: "localhost:8888", MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, zaptest.NewLogger(t))
 	assert.NoError(t, err)
 	assert.NotNil(t, client)
 	defer client.Close()
 }
 
+func TestNewAuthClient_InvalidTLS(t *testing.T) {
+	_, err := NewAuthClient(config.AuthClient{Address: "localhost:8888", TLS: true, CAFile: "missing-ca.pem"}, zaptest.NewLogger(t))
+	assert.Error(t, err)
+
+	_, err = NewAuthClient(config.AuthClient{Address: "localhost:8888", TLS: true, CertFile: "client.pem"}, zaptest.NewLogger(t))
+	assert.Error(t, err)
+
+	_, err = NewAuthClient(config.AuthClient{Address: "localhost:8888", MaxAttempts: 3}, zaptest.NewLogger(t))
+	assert.Error(t, err)
+}
+
+// flakyAuthServer отвечает UNAVAILABLE на первые failures вызовов, затем отвечает после delay
+type flakyAuthServer struct {
+	proto.UnimplementedAuthServer
+	failures int32
+	delay    time.Duration
+	calls    atomic.Int32
+}
+
+func (s *flakyAuthServer) GetUserById(ctx context.Context, req *proto.GetUserByIdRequest) (*proto.GetUserByIdResponse, error) {
+	if s.calls.Add(1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "restarting")
+	}
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &proto.GetUserByIdResponse{YoomoneyId: req.Id}, nil
+}
+
+func startAuthServer(t *testing.T, server proto.AuthServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer()
+	proto.RegisterAuthServer(grpcServer, server)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+func clientConfig(address string) config.AuthClient {
+	return config.AuthClient{
+		Address:          address,
+		Timeout:          time.Second,
+		MaxAttempts:      3,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       50 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func TestAuthClient_RetriesUnavailable(t *testing.T) {
+	server := &flakyAuthServer{failures: 2}
+	client, err := NewAuthClient(clientConfig(startAuthServer(t, server)), zaptest.NewLogger(t))
+	require.NoError(t, err)
+	defer client.Close()
+
+	user, err := client.GetUserById(context.Background(), "user1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "user1", user.YoomoneyId)
+	assert.EqualValues(t, 3, server.calls.Load())
+}
+
+func TestAuthClient_DeadlineAndBreaker(t *testing.T) {
+	server := &flakyAuthServer{delay: time.Minute}
+	cfg := clientConfig(startAuthServer(t, server))
+	cfg.Timeout = 50 * time.Millisecond
+	client, err := NewAuthClient(cfg, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Зависший сервис не держит вызов дольше Timeout
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err = client.GetUserById(context.Background(), "user1")
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		assert.Less(t, time.Since(start), time.Second)
+	}
+
+	// После BreakerThreshold сбоев вызовы отклоняются без обращения к сервису
+	_, err = client.GetUserById(context.Background(), "user1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.EqualValues(t, 2, server.calls.Load())
+}
+
 func TestAuthClient_GetUserById_ValidID(t *testing.T) {
 	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	assert.NoError(t, err)
@@ -86,3 +192,22 @@ func TestAuthClient_GetUserById_InvalidID(t *testing.T) {
 	assert.Nil(t, response)
 	assert.Contains(t, err.Error(), "user not found")
 }
+
+func TestAuthClient_ValidateToken(t *testing.T) {
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	authClient := &AuthClient{client: proto.NewAuthClient(conn), conn: conn}
+
+	assert.NoError(t, authClient.ValidateToken(context.Background(), "valid-token"))
+
+	err = authClient.ValidateToken(context.Background(), "revoked-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Сбой сервиса авторизации не означает, что токен недействителен
+	err = authClient.ValidateToken(context.Background(), "other-token")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
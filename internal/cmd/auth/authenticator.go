@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxCachedTokens сколько подтверждённых токенов держит кеш; при переполнении удаляются истёкшие
+const maxCachedTokens = 10000
+
+// TokenValidator проверка токена сервисом авторизации
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) error
+}
+
+type cachedIdentity struct {
+	identity Identity
+	expires  time.Time
+}
+
+// Authenticator проверяет токены через TokenValidator и кеширует подтверждённые на ttl
+// (но не дольше срока действия токена). Отклонённые токены не кешируются
+type Authenticator struct {
+	validator TokenValidator
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedIdentity
+	now   func() time.Time
+}
+
+func NewAuthenticator(validator TokenValidator, ttl time.Duration) *Authenticator {
+	return &Authenticator{
+		validator: validator,
+		ttl:       ttl,
+		cache:     make(map[string]cachedIdentity),
+		now:       time.Now,
+	}
+}
+
+// Authenticate вызывающий по токену. ErrInvalidToken означает, что токен не принят;
+// остальные ошибки это недоступность сервиса авторизации
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, fmt.Errorf("%w: empty token", ErrInvalidToken)
+	}
+
+	key := tokenKey(token)
+	now := a.now()
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.identity, nil
+	}
+
+	identity, err := ParseToken(token)
+	if err != nil {
+		return Identity{}, err
+	}
+	if !identity.ExpiresAt.IsZero() && !now.Before(identity.ExpiresAt) {
+		return Identity{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+
+	if err := a.validator.ValidateToken(ctx, token); err != nil {
+		return Identity{}, err
+	}
+
+	expires := now.Add(a.ttl)
+	if !identity.ExpiresAt.IsZero() && identity.ExpiresAt.Before(expires) {
+		expires = identity.ExpiresAt
+	}
+	a.store(key, cachedIdentity{identity: identity, expires: expires}, now)
+	return identity, nil
+}
+
+func (a *Authenticator) store(key string, entry cachedIdentity, now time.Time) {
+	if a.ttl <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cache) >= maxCachedTokens {
+		for k, cached := range a.cache {
+			if !now.Before(cached.expires) {
+				delete(a.cache, k)
+			}
+		}
+	}
+	if len(a.cache) < maxCachedTokens {
+		a.cache[key] = entry
+	}
+}
+
+// tokenKey ключ кеша: сами токены в памяти не хранятся
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingValidator struct {
+	calls int
+	err   error
+}
+
+func (v *countingValidator) ValidateToken(ctx context.Context, token string) error {
+	v.calls++
+	return v.err
+}
+
+// testToken JWT с claims; подпись не проверяется локально
+func testToken(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestParseToken(t *testing.T) {
+	identity, err := ParseToken(testToken(t, map[string]any{"sub": "user1", "roles": []string{"admin"}, "role": "payer", "exp": 1736510400}))
+	require.NoError(t, err)
+	assert.Equal(t, "user1", identity.UserID)
+	assert.Equal(t, []string{"admin", "payer"}, identity.Roles)
+	assert.True(t, identity.HasRole("admin"))
+	assert.Equal(t, time.Unix(1736510400, 0), identity.ExpiresAt)
+
+	identity, err = ParseToken(testToken(t, map[string]any{"user_id": "user2"}))
+	require.NoError(t, err)
+	assert.Equal(t, "user2", identity.UserID)
+	assert.True(t, identity.ExpiresAt.IsZero())
+
+	for _, token := range []string{"opaque", "a.!!!.c", testToken(t, map[string]any{"roles": []string{"admin"}})} {
+		_, err := ParseToken(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, token)
+	}
+}
+
+func TestAuthenticator_CachesValidTokens(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	validator := &countingValidator{}
+	authenticator := NewAuthenticator(validator, 30*time.Second)
+	authenticator.now = func() time.Time { return now }
+	token := testToken(t, map[string]any{"sub": "user1", "exp": now.Add(time.Hour).Unix()})
+
+	identity, err := authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", identity.UserID)
+
+	_, err = authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, validator.calls)
+
+	now = now.Add(30 * time.Second)
+	_, err = authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 2, validator.calls)
+}
+
+func TestAuthenticator_CacheBoundedByExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	validator := &countingValidator{}
+	authenticator := NewAuthenticator(validator, time.Minute)
+	authenticator.now = func() time.Time { return now }
+	token := testToken(t, map[string]any{"sub": "user1", "exp": now.Add(10 * time.Second).Unix()})
+
+	_, err := authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+
+	// Истёкший токен не отдаётся из кеша и не отправляется на проверку
+	now = now.Add(10 * time.Second)
+	_, err = authenticator.Authenticate(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 1, validator.calls)
+}
+
+func TestAuthenticator_RejectionsAreNotCached(t *testing.T) {
+	validator := &countingValidator{err: ErrInvalidToken}
+	authenticator := NewAuthenticator(validator, time.Minute)
+	token := testToken(t, map[string]any{"sub": "user1"})
+
+	_, err := authenticator.Authenticate(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	validator.err = errors.New("auth service unavailable")
+	_, err = authenticator.Authenticate(context.Background(), token)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+
+	validator.err = nil
+	_, err = authenticator.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 3, validator.calls)
+
+	_, err = authenticator.Authenticate(context.Background(), "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen сервис авторизации недавно не отвечал, вызов отклонён без обращения к нему
+var ErrCircuitOpen = errors.New("auth service circuit is open")
+
+// breaker размыкается после threshold сбоев подряд на cooldown. По истечении cooldown
+// пропускается один пробный вызов: успех замыкает цепь, сбой размыкает её снова
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration, logger *zap.Logger) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, logger: logger, now: time.Now}
+}
+
+// allow можно ли выполнить вызов; при разомкнутой цепи ErrCircuitOpen
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return fmt.Errorf("%w: retry in %s", ErrCircuitOpen, b.openUntil.Sub(now).Round(time.Millisecond))
+	}
+	if b.probing {
+		return fmt.Errorf("%w: probe in progress", ErrCircuitOpen)
+	}
+	b.probing = true
+	return nil
+}
+
+// record учитывает результат вызова; ответы сервиса вроде NotFound сбоем не считаются
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.failures >= b.threshold
+	b.probing = false
+	if !isOutage(err) {
+		if wasOpen {
+			b.logger.Info("Auth service circuit closed")
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+		if !wasOpen {
+			b.logger.Warn("Auth service circuit opened", zap.Int("failures", b.failures), zap.Duration("cooldown", b.cooldown), zap.Error(err))
+		}
+	}
+}
+
+// isOutage ошибка говорит о недоступности сервиса, а не об ответе на запрос
+func isOutage(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
+
+func (b *breaker) unaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	// Отмена или дедлайн вызывающего ничего не говорят о сервисе; свой таймаут вызова
+	// добавляется позже в цепочке и сюда не попадает
+	if err != nil && ctx.Err() != nil {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return err
+	}
+	b.record(err)
+	return err
+}
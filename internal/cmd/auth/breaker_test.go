@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(2, time.Minute, zaptest.NewLogger(t))
+	b.now = func() time.Time { return now }
+	outage := status.Error(codes.Unavailable, "connection refused")
+
+	// Ответы сервиса сбоями не считаются
+	b.record(status.Error(codes.NotFound, "user not found"))
+	b.record(errors.New("unknown"))
+	b.record(outage)
+	assert.NoError(t, b.allow())
+
+	b.record(outage)
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// После cooldown пропускается один пробный вызов
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.allow())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	b.record(status.Error(codes.DeadlineExceeded, "timeout"))
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.allow())
+	b.record(nil)
+	assert.NoError(t, b.allow())
+	assert.NoError(t, b.allow())
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := newBreaker(0, time.Minute, zaptest.NewLogger(t))
+	for i := 0; i < 10; i++ {
+		b.record(status.Error(codes.Unavailable, "down"))
+	}
+	assert.NoError(t, b.allow())
+}
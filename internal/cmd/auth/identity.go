@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken токен отсутствует, не разбирается или отклонён сервисом авторизации
+var ErrInvalidToken = errors.New("invalid token")
+
+// Identity вызывающий API: claims JWT, который подтвердил сервис авторизации
+type Identity struct {
+	UserID string
+	Roles  []string
+	// ExpiresAt срок действия токена (claim exp); нулевой, если токен бессрочный
+	ExpiresAt time.Time
+}
+
+// HasRole у вызывающего есть роль role
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// WithIdentity кладёт вызывающего в контекст запроса
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext вызывающий из контекста; false, если запрос не проходил проверку токена
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// tokenClaims поля JWT: пользователь в sub (или user_id), роли массивом roles или строкой role
+type tokenClaims struct {
+	Subject   string      `json:"sub"`
+	UserID    string      `json:"user_id"`
+	Roles     []string    `json:"roles"`
+	Role      string      `json:"role"`
+	ExpiresAt json.Number `json:"exp"`
+}
+
+// ParseToken читает claims JWT без проверки подписи: подпись проверяет сервис авторизации в ValidateToken
+func ParseToken(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed payload: %v", ErrInvalidToken, err)
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+
+	identity := Identity{UserID: claims.Subject, Roles: claims.Roles}
+	if identity.UserID == "" {
+		identity.UserID = claims.UserID
+	}
+	if identity.UserID == "" {
+		return Identity{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	if claims.Role != "" && !identity.HasRole(claims.Role) {
+		identity.Roles = append(identity.Roles, claims.Role)
+	}
+	if claims.ExpiresAt != "" {
+		exp, err := claims.ExpiresAt.Float64()
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: malformed exp: %v", ErrInvalidToken, err)
+		}
+		identity.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return identity, nil
+}
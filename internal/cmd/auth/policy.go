@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"paymentgo/internal/config"
+)
+
+// ErrPermissionDenied политика не разрешает вызывающему RPC над этим платежом
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Relation кто может вызвать RPC
+type Relation string
+
+const (
+	// RelationAny любой пользователь с действующим токеном
+	RelationAny Relation = "any"
+	// RelationParticipant плательщик или получатель платежа
+	RelationParticipant Relation = "participant"
+	// RelationPayer только плательщик
+	RelationPayer Relation = "payer"
+	// RelationAdmin только администратор
+	RelationAdmin Relation = "admin"
+)
+
+// Resource стороны платежа, над которым выполняется RPC; для RPC от имени пользователя
+// (создание платежа, история) это пользователь из запроса
+type Resource struct {
+	PayerID string
+	PayeeID string
+}
+
+// Policy правила доступа к RPC из конфигурации: отношение вызывающего к платежу для каждого RPC.
+// Администратору доступны все RPC с правилом, сервисному аккаунту только ServiceMethods.
+// RPC без правила не доступен никому
+type Policy struct {
+	rules          map[string]Relation
+	adminRole      string
+	serviceRole    string
+	serviceMethods map[string]bool
+}
+
+func NewPolicy(cfg config.Auth) (*Policy, error) {
+	if cfg.AdminRole == "" {
+		return nil, errors.New("admin role is not configured")
+	}
+
+	policy := &Policy{
+		rules:          make(map[string]Relation, len(cfg.Rules)),
+		adminRole:      cfg.AdminRole,
+		serviceRole:    cfg.ServiceRole,
+		serviceMethods: make(map[string]bool, len(cfg.ServiceMethods)),
+	}
+	for method, relation := range cfg.Rules {
+		switch Relation(relation) {
+		case RelationAny, RelationParticipant, RelationPayer, RelationAdmin:
+			policy.rules[method] = Relation(relation)
+		default:
+			return nil, fmt.Errorf("unknown relation %q for %s", relation, method)
+		}
+	}
+	for _, method := range cfg.ServiceMethods {
+		if _, ok := policy.rules[method]; !ok {
+			return nil, fmt.Errorf("service method %s has no rule", method)
+		}
+		policy.serviceMethods[method] = true
+	}
+	return policy, nil
+}
+
+// Authorize разрешён ли identity вызов method (полное имя gRPC-метода или имя RPC) над resource
+func (p *Policy) Authorize(identity Identity, method string, resource Resource) error {
+	name := path.Base(method)
+	relation, ok := p.rules[name]
+	if !ok {
+		return fmt.Errorf("%w: %s has no access rule", ErrPermissionDenied, name)
+	}
+
+	switch {
+	case identity.HasRole(p.adminRole):
+		return nil
+	case p.serviceRole != "" && identity.HasRole(p.serviceRole):
+		if p.serviceMethods[name] {
+			return nil
+		}
+		return fmt.Errorf("%w: service account cannot call %s", ErrPermissionDenied, name)
+	}
+
+	isPayer := identity.UserID != "" && identity.UserID == resource.PayerID
+	isPayee := identity.UserID != "" && identity.UserID == resource.PayeeID
+	switch {
+	case relation == RelationAny,
+		relation == RelationParticipant && (isPayer || isPayee),
+		relation == RelationPayer && isPayer:
+		return nil
+	}
+	return fmt.Errorf("%w: %s requires %s", ErrPermissionDenied, name, relation)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"paymentgo/internal/config"
+	"paymentgo/internal/transport/grpc/proto"
+)
+
+// defaultPolicy политика из значений конфигурации по умолчанию
+func defaultPolicy(t *testing.T) *Policy {
+	t.Helper()
+	var cfg config.Config
+	require.NoError(t, cleanenv.ReadEnv(&cfg))
+	policy, err := NewPolicy(cfg.Auth)
+	require.NoError(t, err)
+	return policy
+}
+
+func TestPolicy_CoversEveryRPC(t *testing.T) {
+	policy := defaultPolicy(t)
+
+	services := proto.File_proto_payment_proto.Services()
+	for i := 0; i < services.Len(); i++ {
+		methods := services.Get(i).Methods()
+		for j := 0; j < methods.Len(); j++ {
+			name := string(methods.Get(j).Name())
+			assert.Contains(t, policy.rules, name, "no access rule for %s", name)
+		}
+	}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	policy := defaultPolicy(t)
+	payment := Resource{PayerID: "payer", PayeeID: "payee"}
+
+	callers := map[string]Identity{
+		"payer":    {UserID: "payer"},
+		"payee":    {UserID: "payee"},
+		"stranger": {UserID: "stranger"},
+		"admin":    {UserID: "operator", Roles: []string{"admin"}},
+		"service":  {UserID: "billing", Roles: []string{"service"}},
+	}
+
+	tests := []struct {
+		method   string
+		resource Resource
+		allowed  []string
+	}{
+		// Создание платежа и история только от своего имени
+		{method: proto.PaymentService_CreatePayment_FullMethodName, resource: Resource{PayerID: "payer"}, allowed: []string{"payer", "admin"}},
+		{method: proto.PaymentService_GetPaymentHistory_FullMethodName, resource: Resource{PayerID: "payer"}, allowed: []string{"payer", "admin"}},
+		{method: proto.PaymentService_GetActivePayments_FullMethodName, resource: Resource{PayerID: "payee", PayeeID: "payee"}, allowed: []string{"payee", "admin"}},
+		// Платёж читают обе стороны, оплачивает и возвращает плательщик
+		{method: proto.PaymentService_GetPayment_FullMethodName, resource: payment, allowed: []string{"payer", "payee", "admin", "service"}},
+		{method: proto.PaymentService_GetPaymentByID_FullMethodName, resource: payment, allowed: []string{"payer", "payee", "admin", "service"}},
+		{method: proto.PaymentService_GetPaymentLink_FullMethodName, resource: payment, allowed: []string{"payer", "admin"}},
+		{method: proto.PaymentService_RefundPayment_FullMethodName, resource: payment, allowed: []string{"payer", "admin"}},
+		{method: proto.PaymentService_GetExchangeRate_FullMethodName, allowed: []string{"payer", "payee", "stranger", "admin", "service"}},
+		{method: proto.PaymentAdminService_ListDeadLetters_FullMethodName, allowed: []string{"admin"}},
+		{method: proto.PaymentAdminService_RequeueDeadLetter_FullMethodName, resource: payment, allowed: []string{"admin"}},
+		// RPC без правила закрыт для всех
+		{method: "/payment.PaymentService/DeletePayment", resource: payment},
+	}
+	for _, tt := range tests {
+		for name, identity := range callers {
+			t.Run(tt.method+"/"+name, func(t *testing.T) {
+				err := policy.Authorize(identity, tt.method, tt.resource)
+				if contains(tt.allowed, name) {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrPermissionDenied)
+				}
+			})
+		}
+	}
+}
+
+func TestPolicy_EmptyUserIsNotParticipant(t *testing.T) {
+	policy := defaultPolicy(t)
+
+	err := policy.Authorize(Identity{}, proto.PaymentService_GetPayment_FullMethodName, Resource{PayerID: "payer"})
+
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+}
+
+func TestNewPolicy_InvalidConfig(t *testing.T) {
+	_, err := NewPolicy(config.Auth{AdminRole: "admin", Rules: map[string]string{"GetPayment": "owner"}})
+	assert.ErrorContains(t, err, "owner")
+
+	_, err = NewPolicy(config.Auth{AdminRole: "admin", Rules: map[string]string{"GetPayment": "any"}, ServiceMethods: []string{"RefundPayment"}})
+	assert.ErrorContains(t, err, "RefundPayment")
+
+	_, err = NewPolicy(config.Auth{Rules: map[string]string{"GetPayment": "any"}})
+	assert.Error(t, err)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"paymentgo/internal/config"
+	pb "paymentgo/internal/transport/grpc/proto"
+)
+
+// ErrUserNotFound сервис авторизации не знает пользователя (ответ мог быть взят из кеша)
+var ErrUserNotFound = errors.New("user not found")
+
+// userMetrics счётчики кеша пользователей, доступны через expvar (/debug/vars) под именем auth_users:
+// hits, negative_hits, misses, stale_served, fetch_errors, invalidations
+var userMetrics = expvar.NewMap("auth_users")
+
+// UserLookup получение данных пользователя из сервиса авторизации
+type UserLookup interface {
+	GetUserById(ctx context.Context, id string) (*pb.GetUserByIdResponse, error)
+}
+
+// cachedUser запись кеша: данные пользователя или отметка, что пользователя нет
+type cachedUser struct {
+	User      []byte    `json:"user,omitempty"`
+	NotFound  bool      `json:"not_found,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// UserCache read-through кеш GetUserById в Redis. Данные моложе TTL отдаются без обращения к сервису,
+// отсутствие пользователя помнится NegativeTTL. Более старые данные, пока им не больше MaxStale,
+// отдаются, если сервис авторизации недоступен. Без Redis запросы идут в сервис напрямую
+type UserCache struct {
+	lookup      UserLookup
+	redis       *redis.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxStale    time.Duration
+	channel     string
+	group       singleflight.Group
+	logger      *zap.Logger
+	now         func() time.Time
+}
+
+func NewUserCache(lookup UserLookup, rdb *redis.Client, cfg config.AuthUsers, logger *zap.Logger) *UserCache {
+	return &UserCache{
+		lookup:      lookup,
+		redis:       rdb,
+		ttl:         cfg.TTL,
+		negativeTTL: cfg.NegativeTTL,
+		maxStale:    max(cfg.MaxStale, cfg.TTL),
+		channel:     cfg.InvalidationChannel,
+		logger:      logger.With(zap.String("component", "auth_users")),
+		now:         time.Now,
+	}
+}
+
+func userCacheKey(id string) string {
+	return fmt.Sprintf("auth:user:%s", id)
+}
+
+// GetUserById данные пользователя id из кеша или сервиса авторизации
+func (c *UserCache) GetUserById(ctx context.Context, id string) (*pb.GetUserByIdResponse, error) {
+	if c.redis == nil {
+		return c.lookup.GetUserById(ctx, id)
+	}
+
+	cached, ok := c.get(ctx, id)
+	if ok {
+		age := c.now().Sub(cached.FetchedAt)
+		switch {
+		case cached.NotFound && age < c.negativeTTL:
+			userMetrics.Add("negative_hits", 1)
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+		case !cached.NotFound && age < c.ttl:
+			if user, err := decodeUser(cached); err == nil {
+				userMetrics.Add("hits", 1)
+				return user, nil
+			}
+		}
+	}
+	userMetrics.Add("misses", 1)
+
+	user, err, _ := c.group.Do(id, func() (any, error) {
+		return c.fetch(context.WithoutCancel(ctx), id)
+	})
+	if err == nil {
+		return user.(*pb.GetUserByIdResponse), nil
+	}
+	if errors.Is(err, ErrUserNotFound) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// Сервис авторизации недоступен: выплата не ждёт его восстановления, если получатель недавно известен
+	if ok && !cached.NotFound && c.now().Sub(cached.FetchedAt) < c.maxStale {
+		if stale, decodeErr := decodeUser(cached); decodeErr == nil {
+			userMetrics.Add("stale_served", 1)
+			c.logger.Warn("Serving stale user", zap.String("user_id", id), zap.Time("fetched_at", cached.FetchedAt), zap.Error(err))
+			return stale, nil
+		}
+	}
+	return nil, err
+}
+
+// fetch запрашивает пользователя у сервиса авторизации и сохраняет ответ в кеш
+func (c *UserCache) fetch(ctx context.Context, id string) (*pb.GetUserByIdResponse, error) {
+	user, err := c.lookup.GetUserById(ctx, id)
+	if status.Code(err) == codes.NotFound {
+		c.set(ctx, id, &cachedUser{NotFound: true, FetchedAt: c.now()}, c.negativeTTL)
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+	}
+	if err != nil {
+		userMetrics.Add("fetch_errors", 1)
+		return nil, err
+	}
+
+	data, err := protobuf.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	c.set(ctx, id, &cachedUser{User: data, FetchedAt: c.now()}, c.maxStale)
+	return user, nil
+}
+
+// Invalidate удаляет пользователя из кеша: следующий запрос пойдёт в сервис авторизации
+func (c *UserCache) Invalidate(ctx context.Context, id string) error {
+	if c.redis == nil {
+		return nil
+	}
+	userMetrics.Add("invalidations", 1)
+	if err := c.redis.Del(ctx, userCacheKey(id)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate user %s: %w", id, err)
+	}
+	return nil
+}
+
+// RunInvalidations удаляет из кеша пользователей, чьи id публикуются в канал InvalidationChannel
+// (например, сервисом авторизации при смене кошелька), пока не отменён ctx
+func (c *UserCache) RunInvalidations(ctx context.Context) {
+	if c.redis == nil || c.channel == "" {
+		return
+	}
+	pubsub := c.redis.Subscribe(ctx, c.channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := c.Invalidate(ctx, msg.Payload); err != nil {
+				c.logger.Warn("Failed to invalidate user", zap.String("user_id", msg.Payload), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (c *UserCache) get(ctx context.Context, id string) (*cachedUser, bool) {
+	data, err := c.redis.Get(ctx, userCacheKey(id)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.Warn("Failed to read cached user", zap.String("user_id", id), zap.Error(err))
+		}
+		return nil, false
+	}
+	var cached cachedUser
+	if err := json.Unmarshal(data, &cached); err != nil {
+		c.logger.Warn("Failed to decode cached user", zap.String("user_id", id), zap.Error(err))
+		return nil, false
+	}
+	return &cached, true
+}
+
+func (c *UserCache) set(ctx context.Context, id string, cached *cachedUser, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err := c.redis.Set(ctx, userCacheKey(id), data, ttl).Err(); err != nil {
+		c.logger.Warn("Failed to cache user", zap.String("user_id", id), zap.Error(err))
+	}
+}
+
+func decodeUser(cached *cachedUser) (*pb.GetUserByIdResponse, error) {
+	user := &pb.GetUserByIdResponse{}
+	if err := protobuf.Unmarshal(cached.User, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/config"
+	pb "paymentgo/internal/transport/grpc/proto"
+)
+
+// fakeUsers сервис авторизации в памяти: неизвестный пользователь NotFound, err имитирует сбой
+type fakeUsers struct {
+	mu      sync.Mutex
+	wallets map[string]string
+	err     error
+	calls   int
+}
+
+func (f *fakeUsers) GetUserById(ctx context.Context, id string) (*pb.GetUserByIdResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	wallet, ok := f.wallets[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &pb.GetUserByIdResponse{YoomoneyId: wallet, Name: id}, nil
+}
+
+func (f *fakeUsers) set(id, wallet string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id != "" {
+		f.wallets[id] = wallet
+	}
+	f.err = err
+}
+
+func newTestUserCache(t *testing.T) (*UserCache, *fakeUsers, *miniredis.Miniredis, *time.Time) {
+	t.Helper()
+	mockRedis := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mockRedis.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	users := &fakeUsers{wallets: map[string]string{"user1": "4100111122223333"}}
+	cache := NewUserCache(users, rdb, config.AuthUsers{
+		TTL:                 10 * time.Minute,
+		NegativeTTL:         time.Minute,
+		MaxStale:            time.Hour,
+		InvalidationChannel: "auth:users:invalidate",
+	}, zaptest.NewLogger(t))
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, users, mockRedis, &now
+}
+
+func TestUserCache_ReadThrough(t *testing.T) {
+	cache, users, _, now := newTestUserCache(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		user, err := cache.GetUserById(ctx, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, "4100111122223333", user.YoomoneyId)
+	}
+	assert.Equal(t, 1, users.calls)
+
+	// По истечении TTL данные запрашиваются заново
+	users.set("user1", "4100999988887777", nil)
+	*now = now.Add(10 * time.Minute)
+	user, err := cache.GetUserById(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "4100999988887777", user.YoomoneyId)
+	assert.Equal(t, 2, users.calls)
+}
+
+func TestUserCache_NegativeCaching(t *testing.T) {
+	cache, users, _, now := newTestUserCache(t)
+	ctx := context.Background()
+
+	_, err := cache.GetUserById(ctx, "user2")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = cache.GetUserById(ctx, "user2")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Equal(t, 1, users.calls)
+
+	users.set("user2", "4100555566667777", nil)
+	*now = now.Add(time.Minute)
+	user, err := cache.GetUserById(ctx, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, "4100555566667777", user.YoomoneyId)
+}
+
+func TestUserCache_ServesStaleWhenAuthIsDown(t *testing.T) {
+	cache, users, _, now := newTestUserCache(t)
+	ctx := context.Background()
+
+	_, err := cache.GetUserById(ctx, "user1")
+	require.NoError(t, err)
+
+	users.set("", "", status.Error(codes.Unavailable, "connection refused"))
+	*now = now.Add(30 * time.Minute)
+	user, err := cache.GetUserById(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "4100111122223333", user.YoomoneyId)
+
+	// Старше MaxStale данные не отдаются
+	*now = now.Add(30 * time.Minute)
+	_, err = cache.GetUserById(ctx, "user1")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// Неизвестного пользователя нечем подменить
+	_, err = cache.GetUserById(ctx, "user3")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestUserCache_Invalidate(t *testing.T) {
+	cache, users, mockRedis, _ := newTestUserCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := cache.GetUserById(ctx, "user1")
+	require.NoError(t, err)
+	require.NoError(t, cache.Invalidate(ctx, "user1"))
+	_, err = cache.GetUserById(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, users.calls)
+
+	// Id, опубликованный в канал инвалидации, удаляется из кеша
+	done := make(chan struct{})
+	go func() {
+		cache.RunInvalidations(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return mockRedis.Publish("auth:users:invalidate", "user1") > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return !mockRedis.Exists(userCacheKey("user1"))
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestUserCache_WithoutRedis(t *testing.T) {
+	users := &fakeUsers{wallets: map[string]string{"user1": "4100111122223333"}}
+	cache := NewUserCache(users, nil, config.AuthUsers{TTL: time.Minute}, zaptest.NewLogger(t))
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.GetUserById(context.Background(), "user1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, users.calls)
+	assert.NoError(t, cache.Invalidate(context.Background(), "user1"))
+}
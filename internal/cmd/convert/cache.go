@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// metrics счётчики кеша курсов, доступны через expvar (/debug/vars) под именем forex_rates:
+// hits, misses, stale_served, fetches, fetch_errors, а также source_errors (ошибки отдельных источников)
+// и fallbacks (курсы получены не от первого источника цепочки)
+var metrics = expvar.NewMap("forex_rates")
+
+// Rates курсы валюты Base: сколько единиц валюты-ключа стоит одна единица Base.
+// Курсы хранятся строками big.Rat (76.5 или 10000/925073) без потери точности
+type Rates struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+	// Sources имя источника курса каждой валюты
+	Sources map[string]string `json:"sources,omitempty"`
+	// Fetched время загрузки курса каждой валюты: если источники вернули не все валюты, ранее
+	// загруженные курсы остаются в записи со своим временем. Для валют без отметки действует FetchedAt
+	Fetched   map[string]time.Time `json:"fetched,omitempty"`
+	FetchedAt time.Time            `json:"fetched_at"`
+}
+
+// fetchedAt время загрузки курса currency
+func (r *Rates) fetchedAt(currency string) time.Time {
+	if fetchedAt, ok := r.Fetched[currency]; ok {
+		return fetchedAt
+	}
+	return r.FetchedAt
+}
+
+// mergeRates дополняет fresh курсами из previous, которых нет в fresh и которые загружены не раньше notBefore
+func mergeRates(previous, fresh *Rates, notBefore time.Time) *Rates {
+	if fresh.Fetched == nil {
+		fresh.Fetched = make(map[string]time.Time, len(previous.Rates))
+	}
+	if fresh.Sources == nil {
+		fresh.Sources = make(map[string]string, len(previous.Rates))
+	}
+	for currency, rate := range previous.Rates {
+		if _, ok := fresh.Rates[currency]; ok {
+			continue
+		}
+		fetchedAt := previous.fetchedAt(currency)
+		if fetchedAt.Before(notBefore) {
+			continue
+		}
+		fresh.Rates[currency] = rate
+		fresh.Sources[currency] = previous.Sources[currency]
+		fresh.Fetched[currency] = fetchedAt
+	}
+	return fresh
+}
+
+// rateCache курсы по базовой валюте: в памяти процесса и в Redis, общем для реплик
+type rateCache struct {
+	mu     sync.RWMutex
+	local  map[string]*Rates
+	redis  *redis.Client
+	ttl    time.Duration
+	logger *zap.Logger
+}
+
+func newRateCache(rdb *redis.Client, ttl time.Duration, logger *zap.Logger) *rateCache {
+	return &rateCache{
+		local:  make(map[string]*Rates),
+		redis:  rdb,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+func rateCacheKey(base string) string {
+	return fmt.Sprintf("forex:rates:%s", base)
+}
+
+// get курсы base из памяти, иначе из Redis; возраст курсов проверяет вызывающий
+func (c *rateCache) get(ctx context.Context, base string) (*Rates, bool) {
+	c.mu.RLock()
+	rates, ok := c.local[base]
+	c.mu.RUnlock()
+	if ok || c.redis == nil {
+		return rates, ok
+	}
+
+	data, err := c.redis.Get(ctx, rateCacheKey(base)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.Warn("Failed to read cached rates", zap.String("base", base), zap.Error(err))
+		}
+		return nil, false
+	}
+
+	rates = &Rates{}
+	if err := json.Unmarshal(data, rates); err != nil {
+		c.logger.Warn("Failed to decode cached rates", zap.String("base", base), zap.Error(err))
+		return nil, false
+	}
+
+	c.mu.Lock()
+	if current, ok := c.local[base]; !ok || current.FetchedAt.Before(rates.FetchedAt) {
+		c.local[base] = rates
+	}
+	c.mu.Unlock()
+	return rates, true
+}
+
+// set сохраняет курсы; в Redis они живут ttl (MaxStale), дольше их отдавать нельзя
+func (c *rateCache) set(ctx context.Context, rates *Rates) {
+	c.mu.Lock()
+	c.local[rates.Base] = rates
+	c.mu.Unlock()
+
+	if c.redis == nil {
+		return
+	}
+	data, err := json.Marshal(rates)
+	if err != nil {
+		return
+	}
+	if err := c.redis.Set(ctx, rateCacheKey(rates.Base), data, c.ttl).Err(); err != nil {
+		c.logger.Warn("Failed to cache rates", zap.String("base", rates.Base), zap.Error(err))
+	}
+}
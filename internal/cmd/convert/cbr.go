@@ -0,0 +1,115 @@
+package convert
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"paymentgo/internal/config"
+)
+
+const CBRSourceName = "cbr"
+
+// CBRSource официальные курсы ЦБ РФ из ежедневной XML-выгрузки (XML_daily.asp).
+// ЦБ публикует курсы к рублю, курсы между остальными валютами считаются через рубль
+type CBRSource struct {
+	URL    string
+	Client *http.Client
+}
+
+// cbrValCurs выгрузка XML_daily.asp: Value рублей за Nominal единиц валюты, десятичный разделитель запятая
+type cbrValCurs struct {
+	Date    string `xml:"Date,attr"`
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Value    string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+func NewCBRSource(cfg *config.Config) *CBRSource {
+	return &CBRSource{
+		URL:    cfg.Forex.CBRURL,
+		Client: &http.Client{Timeout: cfg.Forex.Timeout},
+	}
+}
+
+func (s *CBRSource) Name() string {
+	return CBRSourceName
+}
+
+func (s *CBRSource) Rates(ctx context.Context, base string, targets []string) (map[string]*big.Rat, error) {
+	rubles, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]*big.Rat, len(targets))
+	baseRubles, ok := rubles[base]
+	if !ok {
+		return rates, nil
+	}
+	for _, currency := range targets {
+		if targetRubles, ok := rubles[currency]; ok {
+			rates[currency] = new(big.Rat).Quo(baseRubles, targetRubles)
+		}
+	}
+	return rates, nil
+}
+
+// fetch рублёвые курсы единицы каждой валюты выгрузки, включая сам рубль
+func (s *CBRSource) fetch(ctx context.Context) (map[string]*big.Rat, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch CBR rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: received non-OK HTTP status %d", resp.StatusCode)
+	}
+	return parseCBR(resp.Body)
+}
+
+func parseCBR(r io.Reader) (map[string]*big.Rat, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if !strings.EqualFold(charset, "windows-1251") {
+			return nil, fmt.Errorf("unsupported charset %q", charset)
+		}
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+
+	var valCurs cbrValCurs
+	if err := decoder.Decode(&valCurs); err != nil {
+		return nil, fmt.Errorf("failed to decode CBR rates: %w", err)
+	}
+	if len(valCurs.Valutes) == 0 {
+		return nil, fmt.Errorf("no rates in CBR feed for %q", valCurs.Date)
+	}
+
+	rubles := map[string]*big.Rat{"RUB": big.NewRat(1, 1)}
+	for _, valute := range valCurs.Valutes {
+		value, ok := new(big.Rat).SetString(strings.Replace(strings.TrimSpace(valute.Value), ",", ".", 1))
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid CBR %s rate %q", valute.CharCode, valute.Value)
+		}
+		nominal, ok := new(big.Rat).SetString(strings.TrimSpace(valute.Nominal))
+		if !ok || nominal.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid CBR %s nominal %q", valute.CharCode, valute.Nominal)
+		}
+		rubles[valute.CharCode] = value.Quo(value, nominal)
+	}
+	return rubles, nil
+}
@@ -1,68 +1,227 @@
 package convert
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
 	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
 )
 
-const baseURL = "https://api.fastforex.io/convert"
+// ErrUnknownCurrency валюта не поддерживается или ни один источник не вернул её курс
+var ErrUnknownCurrency = dto.ErrUnknownCurrency
 
+// ForexClient курсы валют из цепочки источников RateSource с кешем
 type ForexClient struct {
-	APIKey string
-	Client *http.Client
+	sources    *sourceChain
+	timeout    time.Duration
+	cache      *rateCache
+	rateTTL    time.Duration
+	maxStale   time.Duration
+	quoteTTL   time.Duration
+	currencies []string
+	group      singleflight.Group
+	logger     *zap.Logger
+	now        func() time.Time
 }
 
-type ConversionResponse struct {
-	Base   string             `json:"base"`
-	Amount float64            `json:"amount"`
-	Result map[string]float64 `json:"result"`
-	Ms     int64              `json:"ms"`
+// NewForexClient клиент курсов с кешем поверх sources, опрашиваемых по порядку;
+// rdb может быть nil, тогда курсы кешируются только в памяти
+func NewForexClient(cfg *config.Config, sources []RateSource, rdb *redis.Client, logger *zap.Logger) *ForexClient {
+	logger = logger.With(zap.String("component", "forex"))
+	fc := &ForexClient{
+		// Фоновое обновление может обойти всю цепочку источников
+		timeout:    cfg.Forex.Timeout * time.Duration(max(len(sources), 1)),
+		cache:      newRateCache(rdb, cfg.Forex.MaxStale, logger),
+		rateTTL:    cfg.Forex.RateTTL,
+		maxStale:   cfg.Forex.MaxStale,
+		quoteTTL:   cfg.Forex.QuoteTTL,
+		currencies: cfg.Forex.Currencies,
+		logger:     logger,
+		now:        time.Now,
+	}
+	fc.sources = newSourceChain(sources, cfg.Forex.FailureThreshold, cfg.Forex.Cooldown, logger, func() time.Time { return fc.now() })
+	return fc
 }
 
-func NewForexClient(cfg *config.Config) *ForexClient {
-	return &ForexClient{
-		APIKey: cfg.Forex.Key,
-		Client: &http.Client{Timeout: 10 * time.Second},
+// ConvertCurrency переводит сумму в валюту to; результат округляется до точности целевой валюты
+func (fc *ForexClient) ConvertCurrency(ctx context.Context, amount dto.Money, to string) (dto.Money, error) {
+	if amount.Currency == to {
+		return amount, nil
+	}
+
+	rate, err := fc.Rate(ctx, amount.Currency, to)
+	if err != nil {
+		return dto.Money{}, err
 	}
+	return amount.Convert(rate, to)
 }
 
-func (fc *ForexClient) ConvertCurrency(from string, to string, amount float64) (float64, error) {
-	url := fmt.Sprintf("%s?from=%s&to=%s&amount=%f&api_key=%s", baseURL, from, to, amount, fc.APIKey)
+func (fc *ForexClient) ConvertToRub(ctx context.Context, amount dto.Money) (dto.Money, error) {
+	return fc.ConvertCurrency(ctx, amount, "RUB")
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return -1, err
+// Rate курс from -> to. Свежий курс берётся из кеша, устаревший не больше чем на MaxStale
+// отдаётся сразу и обновляется в фоне, остальные загружаются из источников
+func (fc *ForexClient) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	rate, _, err := fc.rate(ctx, from, to)
+	return rate, err
+}
+
+// rate курс from -> to и имя источника, от которого он получен
+func (fc *ForexClient) rate(ctx context.Context, from, to string) (*big.Rat, string, error) {
+	for _, currency := range []string{from, to} {
+		if _, err := dto.CurrencyExponent(currency); err != nil {
+			return nil, "", err
+		}
+	}
+	if from == to {
+		return big.NewRat(1, 1), "", nil
 	}
 
-	resp, err := fc.Client.Do(req)
-	if err != nil {
-		return -1, err
+	rates, ok := fc.cache.get(ctx, from)
+	if ok && rates.Rates[to] != "" {
+		age := fc.now().Sub(rates.fetchedAt(to))
+		switch {
+		case age < fc.rateTTL:
+			metrics.Add("hits", 1)
+			return parseRate(rates, to)
+		case age < fc.maxStale:
+			metrics.Add("stale_served", 1)
+			fc.logger.Warn("Serving stale exchange rate",
+				zap.String("from", from),
+				zap.String("to", to),
+				zap.Duration("age", age))
+			fc.revalidate(from)
+			return parseRate(rates, to)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	metrics.Add("misses", 1)
+	rates, err := fc.refresh(ctx, from, to)
 	if err != nil {
-		return -1, err
+		return nil, "", err
+	}
+	if rates.Rates[to] == "" {
+		return nil, "", fmt.Errorf("%w: no %s rate for %s", ErrUnknownCurrency, to, from)
+	}
+	return parseRate(rates, to)
+}
+
+// Health состояние источников курсов в порядке опроса из конфигурации
+func (fc *ForexClient) Health() []SourceHealth {
+	return fc.sources.health()
+}
+
+// Prefetch загружает пачкой курсы между всеми валютами Currencies
+func (fc *ForexClient) Prefetch(ctx context.Context) error {
+	var errs []error
+	for _, base := range fc.currencies {
+		if _, err := fc.refresh(ctx, base); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to prefetch rates: %v", errs)
+	}
+	return nil
+}
+
+// Run обновляет курсы Currencies при старте и каждые RateTTL/2, пока не отменён ctx
+func (fc *ForexClient) Run(ctx context.Context) {
+	interval := max(fc.rateTTL/2, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if resp.StatusCode != http.StatusOK {
-		return -1, fmt.Errorf("error: received non-OK HTTP status %d", resp.StatusCode)
+	for {
+		if err := fc.Prefetch(ctx); err != nil && ctx.Err() == nil {
+			fc.logger.Warn("Exchange rates prefetch failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	var response ConversionResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return -1, err
+// current курсы base моложе RateTTL: из кеша или свежезагруженные
+func (fc *ForexClient) current(ctx context.Context, base string) (*Rates, error) {
+	if rates, ok := fc.cache.get(ctx, base); ok && fc.fresh(rates) {
+		return rates, nil
 	}
+	return fc.refresh(ctx, base)
+}
 
-	return response.Result[to], nil
+// fresh каждый курс rates моложе RateTTL. После частичного обновления FetchedAt записи новее
+// оставшихся в ней прежних курсов, поэтому возраст проверяется по времени загрузки каждой валюты
+func (fc *ForexClient) fresh(rates *Rates) bool {
+	for currency := range rates.Rates {
+		if fc.now().Sub(rates.fetchedAt(currency)) >= fc.rateTTL {
+			return false
+		}
+	}
+	return true
 }
 
-func (fc *ForexClient) ConvertToRub(amount float64, currency string) (float64, error) {
-	return fc.ConvertCurrency(currency, "RUB", amount)
+// revalidate обновляет курсы base в фоне; одновременные обновления одной валюты схлопываются
+func (fc *ForexClient) revalidate(base string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fc.timeout+time.Second)
+		defer cancel()
+		if _, err := fc.refresh(ctx, base); err != nil {
+			fc.logger.Warn("Background exchange rate refresh failed", zap.String("base", base), zap.Error(err))
+		}
+	}()
+}
+
+// refresh загружает курсы base к Currencies, уже известным валютам и extra одним обходом источников.
+// Курсы, которые источники не вернули, остаются в кеше со своим временем загрузки, пока не старше MaxStale
+func (fc *ForexClient) refresh(ctx context.Context, base string, extra ...string) (*Rates, error) {
+	targets := slices.Clone(fc.currencies)
+	targets = append(targets, extra...)
+	if cached, ok := fc.cache.get(ctx, base); ok {
+		for currency := range cached.Rates {
+			targets = append(targets, currency)
+		}
+	}
+	sort.Strings(targets)
+	targets = slices.Compact(slices.DeleteFunc(targets, func(currency string) bool { return currency == base }))
+
+	result, err, _ := fc.group.Do(base+":"+strings.Join(targets, ","), func() (any, error) {
+		metrics.Add("fetches", 1)
+		rates, err := fc.sources.fetch(ctx, base, targets)
+		if err != nil {
+			metrics.Add("fetch_errors", 1)
+			return nil, err
+		}
+		if cached, ok := fc.cache.get(ctx, base); ok {
+			rates = mergeRates(cached, rates, fc.now().Add(-fc.maxStale))
+		}
+		fc.cache.set(ctx, rates)
+		return rates, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Rates), nil
+}
+
+// parseRate курс base -> to из rates и его источник
+func parseRate(rates *Rates, to string) (*big.Rat, string, error) {
+	rate, ok := new(big.Rat).SetString(rates.Rates[to])
+	if !ok {
+		return nil, "", fmt.Errorf("invalid %s/%s rate %q", rates.Base, to, rates.Rates[to])
+	}
+	return rate, rates.Sources[to], nil
 }
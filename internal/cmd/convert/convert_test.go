@@ -1,81 +1,342 @@
 package convert
 
 import (
-	"bytes"
-	"io/ioutil"
+	"context"
+	"expvar"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"paymentgo/internal/config"
-
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
 )
 
-type MockRoundTripper struct {
-	Response *http.Response
-	Err      error
+// fakeForex fastforex /fetch-multi с курсами из rates[base][to]
+type fakeForex struct {
+	mu      sync.Mutex
+	rates   map[string]map[string]string
+	fail    bool
+	fetches int
+	queries []string
 }
 
-func (m *MockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	return m.Response, m.Err
+func (f *fakeForex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches++
+	f.queries = append(f.queries, r.URL.RawQuery)
+	if f.fail || r.URL.Path != "/fetch-multi" {
+		http.Error(w, `{"error": "unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	base := r.URL.Query().Get("from")
+	var results []string
+	for _, to := range strings.Split(r.URL.Query().Get("to"), ",") {
+		if rate, ok := f.rates[base][to]; ok {
+			results = append(results, fmt.Sprintf("%q: %s", to, rate))
+		}
+	}
+	fmt.Fprintf(w, `{"base": %q, "results": {%s}, "updated": "2025-01-01 00:00:00", "ms": 3}`, base, strings.Join(results, ", "))
 }
 
-func createMockHTTPClient(responseBody string, statusCode int, err error) *http.Client {
-	mockTransport := &MockRoundTripper{
-		Response: &http.Response{
-			StatusCode: statusCode,
-			Body:       ioutil.NopCloser(bytes.NewBufferString(responseBody)),
-			Header:     make(http.Header),
-		},
-		Err: err,
+func (f *fakeForex) set(base, to, rate string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rates[base] == nil {
+		f.rates[base] = make(map[string]string)
 	}
-	return &http.Client{
-		Transport: mockTransport,
-		Timeout:   10 * time.Second,
+	f.rates[base][to] = rate
+}
+
+func (f *fakeForex) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakeForex) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches
+}
+
+type testClock struct {
+	now atomic.Int64
+}
+
+func (c *testClock) Now() time.Time {
+	return time.Unix(0, c.now.Load())
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now.Add(int64(d))
+}
+
+func newTestForex(t *testing.T, rdb *redis.Client) (*ForexClient, *fakeForex, *testClock) {
+	t.Helper()
+	forex := &fakeForex{rates: map[string]map[string]string{
+		"USD": {"RUB": "76.0", "EUR": "0.92"},
+		"EUR": {"RUB": "76.0", "USD": "1.087"},
+	}}
+	server := httptest.NewServer(forex)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Forex: config.Forex{
+		Key:        "mock-api-key",
+		BaseURL:    server.URL,
+		Timeout:    time.Second,
+		RateTTL:    10 * time.Minute,
+		MaxStale:   time.Hour,
+		Currencies: []string{"RUB", "USD", "EUR"},
+		QuoteTTL:   15 * time.Minute,
+	}}
+	clock := &testClock{}
+	clock.now.Store(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+
+	client := NewForexClient(cfg, []RateSource{NewFastforexSource(cfg)}, rdb, zaptest.NewLogger(t))
+	client.now = clock.Now
+	return client, forex, clock
+}
+
+func metric(name string) int64 {
+	if value, ok := metrics.Get(name).(*expvar.Int); ok {
+		return value.Value()
 	}
+	return 0
 }
 
 func TestConvertCurrency_ResponseCheck(t *testing.T) {
-	mockResponse := `{
-		"base": "USD",
-		"amount": 100.0,
-		"result": { "RUB": 7600.0 },
-		"ms": 123
-	}`
-
-	cfg := &config.Config{
-		Forex: config.Forex{Key: "mock-api-key"},
-	}
-	mockClient := createMockHTTPClient(mockResponse, http.StatusOK, nil)
-	forexClient := &ForexClient{
-		APIKey: cfg.Forex.Key,
-		Client: mockClient,
-	}
+	forexClient, _, _ := newTestForex(t, nil)
 
-	_, err := forexClient.ConvertCurrency("USD", "RUB", 100)
+	converted, err := forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 10000, Currency: "USD"}, "RUB")
 
 	assert.NoError(t, err)
+	assert.Equal(t, dto.Money{Minor: 760000, Currency: "RUB"}, converted)
 }
 
 func TestConvertToRub_ResponseCheck(t *testing.T) {
-	mockResponse := `{
-		"base": "EUR",
-		"amount": 50.0,
-		"result": { "RUB": 3800.0 },
-		"ms": 123
-	}`
-
-	cfg := &config.Config{
-		Forex: config.Forex{Key: "mock-api-key"},
-	}
-	mockClient := createMockHTTPClient(mockResponse, http.StatusOK, nil)
-	forexClient := &ForexClient{
-		APIKey: cfg.Forex.Key,
-		Client: mockClient,
-	}
+	forexClient, _, _ := newTestForex(t, nil)
+
+	converted, err := forexClient.ConvertToRub(context.Background(), dto.Money{Minor: 5000, Currency: "EUR"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "3800.00", converted.String())
+}
 
-	_, err := forexClient.ConvertToRub(50, "EUR")
+func TestConvertCurrency_SameCurrency(t *testing.T) {
+	forexClient, forex, _ := newTestForex(t, nil)
+
+	converted, err := forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 5000, Currency: "RUB"}, "RUB")
 
 	assert.NoError(t, err)
+	assert.Equal(t, dto.Money{Minor: 5000, Currency: "RUB"}, converted)
+	assert.Zero(t, forex.count())
+}
+
+func TestRate_CachedWithinTTL(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+
+	for i := 0; i < 3; i++ {
+		_, err := forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 10000, Currency: "USD"}, "RUB")
+		require.NoError(t, err)
+		clock.Advance(time.Minute)
+	}
+	// Курс EUR загружен тем же запросом fetch-multi
+	_, err := forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 10000, Currency: "USD"}, "EUR")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, forex.count())
+}
+
+func TestRate_StaleWhileRevalidate(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+	ctx := context.Background()
+
+	_, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+
+	forex.set("USD", "RUB", "80.0")
+	clock.Advance(15 * time.Minute)
+	staleBefore := metric("stale_served")
+
+	// Устаревший курс отдаётся сразу, обновление идёт в фоне
+	rate, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "76", rate.FloatString(0))
+	assert.Equal(t, staleBefore+1, metric("stale_served"))
+
+	require.Eventually(t, func() bool {
+		rate, err := forexClient.Rate(ctx, "USD", "RUB")
+		return err == nil && rate.FloatString(0) == "80"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, forex.count())
+}
+
+func TestRate_StaleServedWhileProviderDown(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+	ctx := context.Background()
+
+	_, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+
+	forex.setFail(true)
+	clock.Advance(30 * time.Minute)
+	rate, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "76", rate.FloatString(0))
+
+	// Старше MaxStale курс не отдаётся
+	clock.Advance(time.Hour)
+	_, err = forexClient.Rate(ctx, "USD", "RUB")
+	assert.Error(t, err)
+}
+
+func TestRate_PartialRefreshKeepsStaleRates(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+	ctx := context.Background()
+
+	_, err := forexClient.Rate(ctx, "USD", "EUR")
+	require.NoError(t, err)
+
+	// Источник перестал отдавать курс EUR: обновление частичное, прежний курс EUR остаётся в кеше
+	forex.mu.Lock()
+	delete(forex.rates["USD"], "EUR")
+	forex.mu.Unlock()
+	forex.set("USD", "RUB", "80.0")
+	clock.Advance(20 * time.Minute)
+	require.NoError(t, forexClient.Prefetch(ctx))
+	fetches := forex.count()
+
+	rate, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "80", rate.FloatString(0))
+
+	rate, err = forexClient.Rate(ctx, "USD", "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "0.92", rate.FloatString(2))
+	// Устаревший курс EUR обновляется в фоне
+	require.Eventually(t, func() bool { return forex.count() > fetches }, time.Second, 5*time.Millisecond)
+
+	// Старше MaxStale курс не отдаётся, даже если запись базы обновлялась
+	clock.Advance(time.Hour)
+	_, err = forexClient.Rate(ctx, "USD", "EUR")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestRate_UnknownCurrency(t *testing.T) {
+	forexClient, forex, _ := newTestForex(t, nil)
+
+	_, err := forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 10000, Currency: "USD"}, "XYZ")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	assert.Zero(t, forex.count())
+
+	// Валюта известна, но провайдер не вернул её курс: ошибка, а не нулевая сумма
+	_, err = forexClient.ConvertCurrency(context.Background(), dto.Money{Minor: 10000, Currency: "USD"}, "JPY")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestRate_ExtraCurrencyIsFetched(t *testing.T) {
+	forexClient, forex, _ := newTestForex(t, nil)
+	forex.set("USD", "GBP", "0.79")
+
+	_, err := forexClient.Rate(context.Background(), "USD", "RUB")
+	require.NoError(t, err)
+
+	rate, err := forexClient.Rate(context.Background(), "USD", "GBP")
+	require.NoError(t, err)
+	assert.Equal(t, "0.79", rate.FloatString(2))
+	assert.Equal(t, 2, forex.count())
+}
+
+func TestRate_SharedThroughRedis(t *testing.T) {
+	mockRedis := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mockRedis.Addr()})
+	defer rdb.Close()
+
+	first, firstForex, _ := newTestForex(t, rdb)
+	_, err := first.Rate(context.Background(), "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, 1, firstForex.count())
+
+	// Вторая реплика берёт курс из Redis
+	second, secondForex, _ := newTestForex(t, rdb)
+	rate, err := second.Rate(context.Background(), "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "76", rate.FloatString(0))
+	assert.Zero(t, secondForex.count())
+
+	assert.Equal(t, time.Hour, mockRedis.TTL(rateCacheKey("USD")))
+}
+
+func TestPrefetch_BulkPerBase(t *testing.T) {
+	forexClient, forex, _ := newTestForex(t, nil)
+
+	// По одному запросу fetch-multi на каждую валюту ко всем остальным
+	require.NoError(t, forexClient.Prefetch(context.Background()))
+	assert.Equal(t, 3, forex.count())
+	assert.Contains(t, forex.queries, "api_key=mock-api-key&from=USD&to=EUR%2CRUB")
+
+	_, err := forexClient.Rate(context.Background(), "EUR", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, 3, forex.count())
+}
+
+func TestQuote_LocksRateAndAmount(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+	ctx := context.Background()
+
+	quote, err := forexClient.Quote(ctx, dto.Money{Minor: 10000, Currency: "USD"}, "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, dto.Money{Minor: 760000, Currency: "RUB"}, quote.Amount)
+	assert.Equal(t, "76", quote.Rate)
+	assert.Equal(t, FastforexSourceName, quote.Source)
+	assert.Equal(t, clock.Now(), quote.QuotedAt)
+	assert.Equal(t, clock.Now().Add(15*time.Minute), quote.ExpiresAt)
+
+	// Сумма считается по округлённому курсу котировки
+	forex.set("EUR", "USD", "1.0873456789")
+	clock.Advance(time.Hour)
+	quote, err = forexClient.Quote(ctx, dto.Money{Minor: 100000000, Currency: "EUR"}, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, "1.08734568", quote.Rate)
+	assert.Equal(t, dto.Money{Minor: 108734568, Currency: "USD"}, quote.Amount)
+}
+
+func TestCurrent_RefreshesStaleRateAfterPartialRefresh(t *testing.T) {
+	forexClient, forex, clock := newTestForex(t, nil)
+	ctx := context.Background()
+
+	_, err := forexClient.Rate(ctx, "USD", "EUR")
+	require.NoError(t, err)
+
+	// Частичное обновление: запись свежая, но курс EUR остался прежним
+	forex.mu.Lock()
+	delete(forex.rates["USD"], "EUR")
+	forex.mu.Unlock()
+	clock.Advance(11 * time.Minute)
+	_, err = forexClient.refresh(ctx, "USD")
+	require.NoError(t, err)
+	fetches := forex.count()
+
+	forex.set("USD", "EUR", "0.95")
+	clock.Advance(time.Minute)
+	rates, err := forexClient.current(ctx, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, fetches+1, forex.count())
+	rate, _, err := parseRate(rates, "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "0.95", rate.FloatString(2))
+	assert.Equal(t, clock.Now(), rates.fetchedAt("EUR"))
 }
@@ -0,0 +1,90 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"paymentgo/internal/config"
+)
+
+const FastforexSourceName = "fastforex"
+
+// FastforexSource курсы fastforex.io: один запрос /fetch-multi на базовую валюту
+type FastforexSource struct {
+	APIKey  string
+	Client  *http.Client
+	BaseURL string
+}
+
+// fetchMultiResponse ответ fastforex /fetch-multi: курсы base ко всем валютам из to
+type fetchMultiResponse struct {
+	Base    string                 `json:"base"`
+	Results map[string]json.Number `json:"results"`
+	Error   string                 `json:"error"`
+}
+
+func NewFastforexSource(cfg *config.Config) *FastforexSource {
+	return &FastforexSource{
+		APIKey:  cfg.Forex.Key,
+		Client:  &http.Client{Timeout: cfg.Forex.Timeout},
+		BaseURL: strings.TrimSuffix(cfg.Forex.BaseURL, "/"),
+	}
+}
+
+func (s *FastforexSource) Name() string {
+	return FastforexSourceName
+}
+
+func (s *FastforexSource) Rates(ctx context.Context, base string, targets []string) (map[string]*big.Rat, error) {
+	query := url.Values{}
+	query.Set("from", base)
+	query.Set("to", strings.Join(targets, ","))
+	query.Set("api_key", s.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/fetch-multi?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s rates: %w", base, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: received non-OK HTTP status %d", resp.StatusCode)
+	}
+
+	var response fetchMultiResponse
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("fastforex error: %s", response.Error)
+	}
+
+	rates := make(map[string]*big.Rat, len(response.Results))
+	for currency, value := range response.Results {
+		rate, ok := new(big.Rat).SetString(value.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid %s/%s rate %q", base, currency, value)
+		}
+		rates[currency] = rate
+	}
+	return rates, nil
+}
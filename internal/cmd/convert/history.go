@@ -0,0 +1,257 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"go.uber.org/zap"
+
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+)
+
+var (
+	// ErrRateNotFound в истории нет курса на дату по выбранному правилу
+	ErrRateNotFound = errors.New("exchange rate not found")
+	// ErrFutureDate курс запрошен на день, который ещё не наступил
+	ErrFutureDate = errors.New("exchange rate date is in the future")
+)
+
+// Interpolation правило для дня, за который курс не записан
+type Interpolation int
+
+const (
+	// InterpolationPrevious курс последнего записанного дня, как для выходных и праздников у ЦБ
+	InterpolationPrevious Interpolation = iota
+	// InterpolationLinear линейная интерполяция между соседними записанными днями;
+	// после последнего записанного дня курс берётся как в InterpolationPrevious
+	InterpolationLinear
+	// InterpolationNone только курс, записанный за этот день
+	InterpolationNone
+)
+
+// RateMethod как получен курс на дату
+type RateMethod string
+
+const (
+	// RateCurrent текущий курс ForexClient: сегодняшний день ещё не записан или дата не указана
+	RateCurrent RateMethod = "current"
+	// RateExact курс, записанный за этот день
+	RateExact RateMethod = "exact"
+	// RatePrevious курс последнего записанного дня
+	RatePrevious RateMethod = "previous"
+	// RateInterpolated линейная интерполяция между соседними записанными днями
+	RateInterpolated RateMethod = "interpolated"
+)
+
+// HistoricalRate курс From -> To на день Date
+type HistoricalRate struct {
+	From   string
+	To     string
+	Date   time.Time
+	Rate   *big.Rat
+	Source string
+	Method RateMethod
+}
+
+// RateHistory история курсов в fx_rates: курсы Currencies записываются раз в HistoryInterval,
+// за день хранится последний полученный курс
+type RateHistory struct {
+	forex      *ForexClient
+	repo       repository.RateRepository
+	currencies []string
+	interval   time.Duration
+	maxGap     time.Duration
+	logger     *zap.Logger
+}
+
+func NewRateHistory(forex *ForexClient, repo repository.RateRepository, cfg *config.Config, logger *zap.Logger) *RateHistory {
+	return &RateHistory{
+		forex:      forex,
+		repo:       repo,
+		currencies: cfg.Forex.Currencies,
+		interval:   cfg.Forex.HistoryInterval,
+		maxGap:     cfg.Forex.HistoryMaxGap,
+		logger:     logger.With(zap.String("component", "rate_history")),
+	}
+}
+
+// Run записывает курсы при старте и каждые HistoryInterval, пока не отменён ctx
+func (h *RateHistory) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(h.interval, time.Second))
+	defer ticker.Stop()
+
+	for {
+		if err := h.Record(ctx); err != nil && ctx.Err() == nil {
+			h.logger.Warn("Failed to record exchange rates", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Record записывает текущие курсы между Currencies за сегодняшний день
+func (h *RateHistory) Record(ctx context.Context) error {
+	var (
+		history []*dto.FXRate
+		errs    []error
+	)
+	for _, base := range h.currencies {
+		rates, err := h.forex.current(ctx, base)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for currency, rate := range rates.Rates {
+			fetchedAt := rates.fetchedAt(currency)
+			history = append(history, &dto.FXRate{
+				Base:      base,
+				Currency:  currency,
+				Date:      dto.RateDate(fetchedAt),
+				Rate:      rate,
+				Source:    rates.Sources[currency],
+				FetchedAt: fetchedAt,
+			})
+		}
+	}
+
+	if len(history) > 0 {
+		if err := h.repo.SaveRates(ctx, history); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to record rates: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// RateAt курс from -> to на день date (UTC). Без даты и за сегодняшний день, пока он не записан,
+// отдаётся текущий курс; пропущенные дни восполняются по правилу interpolation, но не дальше
+// HistoryMaxGap от записанного дня
+func (h *RateHistory) RateAt(ctx context.Context, from, to string, date time.Time, interpolation Interpolation) (*HistoricalRate, error) {
+	for _, currency := range []string{from, to} {
+		if _, err := dto.CurrencyExponent(currency); err != nil {
+			return nil, err
+		}
+	}
+
+	today := dto.RateDate(h.forex.now())
+	if date.IsZero() {
+		return h.current(ctx, from, to, today)
+	}
+	day := dto.RateDate(date)
+	if day.After(today) {
+		return nil, fmt.Errorf("%w: %s", ErrFutureDate, day.Format(time.DateOnly))
+	}
+	if from == to {
+		return &HistoricalRate{From: from, To: to, Date: day, Rate: big.NewRat(1, 1), Method: RateExact}, nil
+	}
+
+	rate, err := h.stored(ctx, from, to, day, interpolation)
+	// Пока сегодняшний курс не записан, текущий курс точнее восполненного
+	if day.Equal(today) && (errors.Is(err, ErrRateNotFound) || err == nil && rate.Method != RateExact) {
+		return h.current(ctx, from, to, today)
+	}
+	return rate, err
+}
+
+// ConvertAt переводит amount в валюту to по курсу на день date с правилом InterpolationPrevious
+func (h *RateHistory) ConvertAt(ctx context.Context, amount dto.Money, to string, date time.Time) (dto.Money, error) {
+	if amount.Currency == to {
+		return amount, nil
+	}
+	rate, err := h.RateAt(ctx, amount.Currency, to, date, InterpolationPrevious)
+	if err != nil {
+		return dto.Money{}, err
+	}
+	return amount.Convert(rate.Rate, to)
+}
+
+func (h *RateHistory) current(ctx context.Context, from, to string, today time.Time) (*HistoricalRate, error) {
+	rate, source, err := h.forex.rate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoricalRate{From: from, To: to, Date: today, Rate: rate, Source: source, Method: RateCurrent}, nil
+}
+
+// stored курс из истории: записанный from -> to или обратный к записанному to -> from
+func (h *RateHistory) stored(ctx context.Context, from, to string, day time.Time, interpolation Interpolation) (*HistoricalRate, error) {
+	before, after, err := h.repo.RatesAround(ctx, from, to, day)
+	if err != nil {
+		return nil, err
+	}
+	inverse := false
+	if before == nil && after == nil {
+		if before, after, err = h.repo.RatesAround(ctx, to, from, day); err != nil {
+			return nil, err
+		}
+		inverse = true
+	}
+
+	rate, err := interpolate(before, after, day, interpolation, h.maxGap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s/%s on %s", err, from, to, day.Format(time.DateOnly))
+	}
+	if inverse {
+		rate.Rate.Inv(rate.Rate)
+	}
+	rate.From, rate.To = from, to
+	return rate, nil
+}
+
+// interpolate курс на день day по соседним записанным дням: before не позже day, after позже day
+func interpolate(before, after *dto.FXRate, day time.Time, interpolation Interpolation, maxGap time.Duration) (*HistoricalRate, error) {
+	if before == nil {
+		return nil, ErrRateNotFound
+	}
+	beforeRate, err := parseStoredRate(before)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &HistoricalRate{Date: day, Rate: beforeRate, Source: before.Source}
+	switch {
+	case before.Date.Equal(day):
+		result.Method = RateExact
+		return result, nil
+	case interpolation == InterpolationNone, day.Sub(before.Date) > maxGap:
+		return nil, ErrRateNotFound
+	}
+
+	if interpolation == InterpolationLinear && after != nil && after.Date.Sub(day) <= maxGap {
+		afterRate, err := parseStoredRate(after)
+		if err != nil {
+			return nil, err
+		}
+		// before + (after - before) * (day - before.Date) / (after.Date - before.Date)
+		weight := big.NewRat(int64(day.Sub(before.Date)/(24*time.Hour)), int64(after.Date.Sub(before.Date)/(24*time.Hour)))
+		delta := new(big.Rat).Sub(afterRate, beforeRate)
+		result.Rate = new(big.Rat).Add(beforeRate, delta.Mul(delta, weight))
+		if after.Source != before.Source {
+			result.Source = before.Source + "," + after.Source
+		}
+		result.Method = RateInterpolated
+		return result, nil
+	}
+
+	result.Method = RatePrevious
+	return result, nil
+}
+
+func parseStoredRate(rate *dto.FXRate) (*big.Rat, error) {
+	parsed, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok || parsed.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid stored %s/%s rate %q", rate.Base, rate.Currency, rate.Rate)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,151 @@
+package convert
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+)
+
+type memoryRateRepo struct {
+	mu    sync.Mutex
+	rates map[string]*dto.FXRate
+}
+
+func (m *memoryRateRepo) SaveRates(ctx context.Context, rates []*dto.FXRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rate := range rates {
+		stored := *rate
+		stored.Date = dto.RateDate(rate.Date)
+		m.rates[stored.Base+stored.Currency+stored.Date.Format(time.DateOnly)] = &stored
+	}
+	return nil
+}
+
+func (m *memoryRateRepo) RatesAround(ctx context.Context, base, currency string, date time.Time) (*dto.FXRate, *dto.FXRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rates []*dto.FXRate
+	for _, rate := range m.rates {
+		if rate.Base == base && rate.Currency == currency {
+			rates = append(rates, rate)
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Date.Before(rates[j].Date) })
+
+	var before, after *dto.FXRate
+	for _, rate := range rates {
+		if !rate.Date.After(date) {
+			before = rate
+		} else if after == nil {
+			after = rate
+		}
+	}
+	return before, after, nil
+}
+
+func day(value string) time.Time {
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return date
+}
+
+func newTestHistory(t *testing.T) (*RateHistory, *memoryRateRepo, *testClock) {
+	t.Helper()
+	forexClient, _, clock := newTestForex(t, nil)
+	clock.now.Store(time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC).UnixNano())
+
+	repo := &memoryRateRepo{rates: make(map[string]*dto.FXRate)}
+	cfg := &config.Config{Forex: config.Forex{
+		Currencies:    []string{"RUB", "USD", "EUR"},
+		HistoryMaxGap: 7 * 24 * time.Hour,
+	}}
+	return NewRateHistory(forexClient, repo, cfg, zaptest.NewLogger(t)), repo, clock
+}
+
+func TestRateHistory_Record(t *testing.T) {
+	history, repo, clock := newTestHistory(t)
+
+	require.NoError(t, history.Record(context.Background()))
+
+	// У фейкового fastforex нет курсов от RUB: записаны только USD и EUR
+	require.Len(t, repo.rates, 4)
+	rate := repo.rates["USDRUB2025-01-10"]
+	require.NotNil(t, rate)
+	assert.Equal(t, "76", rate.Rate)
+	assert.Equal(t, FastforexSourceName, rate.Source)
+	assert.Equal(t, day("2025-01-10"), rate.Date)
+	assert.Equal(t, clock.Now(), rate.FetchedAt)
+}
+
+func TestRateHistory_RateAt(t *testing.T) {
+	history, repo, _ := newTestHistory(t)
+	require.NoError(t, repo.SaveRates(context.Background(), []*dto.FXRate{
+		{Base: "USD", Currency: "RUB", Date: day("2024-12-01"), Rate: "90", Source: "cbr"},
+		{Base: "USD", Currency: "RUB", Date: day("2025-01-03"), Rate: "100", Source: "cbr"},
+		{Base: "USD", Currency: "RUB", Date: day("2025-01-06"), Rate: "103", Source: "fastforex"},
+	}))
+
+	tests := []struct {
+		name          string
+		from, to      string
+		date          time.Time
+		interpolation Interpolation
+		rate          *big.Rat
+		source        string
+		method        RateMethod
+		err           error
+	}{
+		{"exact", "USD", "RUB", day("2025-01-03"), InterpolationPrevious, big.NewRat(100, 1), "cbr", RateExact, nil},
+		{"weekend takes friday rate", "USD", "RUB", day("2025-01-04"), InterpolationPrevious, big.NewRat(100, 1), "cbr", RatePrevious, nil},
+		{"linear between known days", "USD", "RUB", day("2025-01-04"), InterpolationLinear, big.NewRat(101, 1), "cbr,fastforex", RateInterpolated, nil},
+		{"linear after last known day", "USD", "RUB", day("2025-01-08"), InterpolationLinear, big.NewRat(103, 1), "fastforex", RatePrevious, nil},
+		{"none requires exact day", "USD", "RUB", day("2025-01-04"), InterpolationNone, nil, "", "", ErrRateNotFound},
+		{"gap longer than max", "USD", "RUB", day("2024-12-20"), InterpolationPrevious, nil, "", "", ErrRateNotFound},
+		{"before first known day", "USD", "RUB", day("2024-11-30"), InterpolationLinear, nil, "", "", ErrRateNotFound},
+		{"inverse of stored rate", "RUB", "USD", day("2025-01-03"), InterpolationPrevious, big.NewRat(1, 100), "cbr", RateExact, nil},
+		{"unrecorded today is current", "USD", "RUB", day("2025-01-10"), InterpolationPrevious, big.NewRat(76, 1), FastforexSourceName, RateCurrent, nil},
+		{"no date is current", "USD", "RUB", time.Time{}, InterpolationPrevious, big.NewRat(76, 1), FastforexSourceName, RateCurrent, nil},
+		{"future date", "USD", "RUB", day("2025-01-11"), InterpolationPrevious, nil, "", "", ErrFutureDate},
+		{"unknown currency", "USD", "XYZ", day("2025-01-03"), InterpolationPrevious, nil, "", "", ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := history.RateAt(context.Background(), tt.from, tt.to, tt.date, tt.interpolation)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rate, rate.Rate)
+			assert.Equal(t, tt.source, rate.Source)
+			assert.Equal(t, tt.method, rate.Method)
+			assert.Equal(t, tt.from, rate.From)
+			assert.Equal(t, tt.to, rate.To)
+		})
+	}
+}
+
+func TestRateHistory_ConvertAt(t *testing.T) {
+	history, repo, _ := newTestHistory(t)
+	require.NoError(t, repo.SaveRates(context.Background(), []*dto.FXRate{
+		{Base: "USD", Currency: "RUB", Date: day("2025-01-03"), Rate: "100.5", Source: "cbr"},
+	}))
+
+	converted, err := history.ConvertAt(context.Background(), dto.Money{Minor: 1050, Currency: "USD"}, "RUB", day("2025-01-05"))
+
+	require.NoError(t, err)
+	assert.Equal(t, dto.Money{Minor: 105525, Currency: "RUB"}, converted)
+}
@@ -0,0 +1,35 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+
+	dto "paymentgo/internal/entity"
+)
+
+// Quote котировка пересчёта amount в валюту to по текущему курсу, действующая QuoteTTL.
+// Курс округляется до dto.FXQuoteDecimals знаков, сумма считается по округлённому курсу
+func (fc *ForexClient) Quote(ctx context.Context, amount dto.Money, to string) (dto.FXQuote, error) {
+	rate, source, err := fc.rate(ctx, amount.Currency, to)
+	if err != nil {
+		return dto.FXQuote{}, err
+	}
+
+	locked, text := dto.QuoteRate(rate)
+	if locked.Sign() <= 0 {
+		return dto.FXQuote{}, fmt.Errorf("%s/%s rate %s is too small to quote", amount.Currency, to, rate.RatString())
+	}
+	converted, err := amount.Convert(locked, to)
+	if err != nil {
+		return dto.FXQuote{}, err
+	}
+
+	now := fc.now()
+	return dto.FXQuote{
+		Amount:    converted,
+		Rate:      text,
+		Source:    source,
+		QuotedAt:  now,
+		ExpiresAt: now.Add(fc.quoteTTL),
+	}, nil
+}
@@ -0,0 +1,214 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"paymentgo/internal/config"
+)
+
+// RateSource источник курсов валют
+type RateSource interface {
+	// Name имя источника из FOREX_SOURCES
+	Name() string
+	// Rates курсы base к targets: сколько единиц валюты-ключа стоит одна единица base.
+	// Валюты, которых источник не знает, в ответе отсутствуют
+	Rates(ctx context.Context, base string, targets []string) (map[string]*big.Rat, error)
+}
+
+// NewRateSources источники курсов в порядке cfg.Forex.Sources
+func NewRateSources(cfg *config.Config) ([]RateSource, error) {
+	sources := make([]RateSource, 0, len(cfg.Forex.Sources))
+	for _, name := range cfg.Forex.Sources {
+		switch name {
+		case FastforexSourceName:
+			sources = append(sources, NewFastforexSource(cfg))
+		case CBRSourceName:
+			sources = append(sources, NewCBRSource(cfg))
+		case StaticSourceName:
+			source, err := LoadStaticSource(cfg.Forex.StaticFile)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("unknown rate source %q", name)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("no rate sources configured")
+	}
+	return sources, nil
+}
+
+// SourceHealth состояние источника курсов
+type SourceHealth struct {
+	Name    string
+	Healthy bool
+	// Failures ошибок подряд с последнего успешного запроса
+	Failures    int
+	LastError   string
+	LastSuccess time.Time
+	// DownUntil до какого момента источник пропускается
+	DownUntil time.Time
+}
+
+// trackedSource источник с учётом ошибок: после threshold ошибок подряд он пропускается на cooldown
+type trackedSource struct {
+	RateSource
+
+	mu          sync.Mutex
+	failures    int
+	lastError   string
+	lastSuccess time.Time
+	downUntil   time.Time
+}
+
+func (s *trackedSource) healthy(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.downUntil)
+}
+
+func (s *trackedSource) success(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+	s.lastError = ""
+	s.lastSuccess = now
+	s.downUntil = time.Time{}
+}
+
+// failure учитывает ошибку и возвращает true, если источник только что выведен из цепочки
+func (s *trackedSource) failure(err error, now time.Time, threshold int, cooldown time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	s.lastError = err.Error()
+	if s.failures < threshold {
+		return false
+	}
+	down := now.Before(s.downUntil)
+	s.downUntil = now.Add(cooldown)
+	return !down
+}
+
+func (s *trackedSource) health(now time.Time) SourceHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SourceHealth{
+		Name:        s.Name(),
+		Healthy:     !now.Before(s.downUntil),
+		Failures:    s.failures,
+		LastError:   s.lastError,
+		LastSuccess: s.lastSuccess,
+		DownUntil:   s.downUntil,
+	}
+}
+
+// sourceChain опрашивает источники по порядку, пока не найдены курсы ко всем валютам.
+// Источники на cooldown опрашиваются последними, когда остальные не справились
+type sourceChain struct {
+	sources   []*trackedSource
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+func newSourceChain(sources []RateSource, threshold int, cooldown time.Duration, logger *zap.Logger, now func() time.Time) *sourceChain {
+	chain := &sourceChain{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		logger:    logger,
+		now:       now,
+	}
+	for _, source := range sources {
+		chain.sources = append(chain.sources, &trackedSource{RateSource: source})
+	}
+	return chain
+}
+
+// ordered здоровые источники в порядке конфигурации, за ними выведенные из цепочки
+func (c *sourceChain) ordered() []*trackedSource {
+	now := c.now()
+	healthy := make([]*trackedSource, 0, len(c.sources))
+	var down []*trackedSource
+	for _, source := range c.sources {
+		if source.healthy(now) {
+			healthy = append(healthy, source)
+		} else {
+			down = append(down, source)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// fetch курсы base к targets; каждая валюта берётся у первого источника, который её знает
+func (c *sourceChain) fetch(ctx context.Context, base string, targets []string) (*Rates, error) {
+	rates := &Rates{
+		Base:      base,
+		Rates:     make(map[string]string, len(targets)),
+		Sources:   make(map[string]string, len(targets)),
+		Fetched:   make(map[string]time.Time, len(targets)),
+		FetchedAt: c.now(),
+	}
+	missing := slices.Clone(targets)
+	var errs []error
+
+	for i, source := range c.ordered() {
+		if len(missing) == 0 {
+			break
+		}
+
+		result, err := source.Rates(ctx, base, missing)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			metrics.Add("source_errors", 1)
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			if source.failure(err, c.now(), c.threshold, c.cooldown) {
+				c.logger.Warn("Rate source marked unhealthy",
+					zap.String("source", source.Name()),
+					zap.Duration("cooldown", c.cooldown),
+					zap.Error(err))
+			}
+			continue
+		}
+		source.success(c.now())
+
+		for _, currency := range missing {
+			if rate, ok := result[currency]; ok && rate.Sign() > 0 {
+				rates.Rates[currency] = rate.RatString()
+				rates.Sources[currency] = source.Name()
+				rates.Fetched[currency] = rates.FetchedAt
+			}
+		}
+		if i > 0 && len(result) > 0 {
+			metrics.Add("fallbacks", 1)
+		}
+		missing = slices.DeleteFunc(missing, func(currency string) bool { return rates.Rates[currency] != "" })
+	}
+
+	if len(rates.Rates) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("failed to fetch %s rates: %w", base, errors.Join(errs...))
+	}
+	return rates, nil
+}
+
+func (c *sourceChain) health() []SourceHealth {
+	now := c.now()
+	health := make([]SourceHealth, 0, len(c.sources))
+	for _, source := range c.sources {
+		health = append(health, source.health(now))
+	}
+	return health
+}
@@ -0,0 +1,232 @@
+package convert
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"paymentgo/internal/config"
+)
+
+// fixtureServer отдаёт записанный ответ testdata/fixture со статусом status и считает запросы
+func fixtureServer(t *testing.T, status int, fixture string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func rat(t *testing.T, value string) *big.Rat {
+	t.Helper()
+	rate, ok := new(big.Rat).SetString(value)
+	require.True(t, ok, value)
+	return rate
+}
+
+func sourceConfig(fastforexURL, cbrURL string) *config.Config {
+	return &config.Config{Forex: config.Forex{
+		Key:              "fx_demo_1234567890abcdef",
+		BaseURL:          fastforexURL,
+		CBRURL:           cbrURL,
+		Timeout:          time.Second,
+		RateTTL:          10 * time.Minute,
+		MaxStale:         time.Hour,
+		Currencies:       []string{"RUB", "USD", "EUR"},
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+	}}
+}
+
+func TestFastforexSource_Rates(t *testing.T) {
+	server, _ := fixtureServer(t, http.StatusOK, "fastforex_fetch_multi_usd.json")
+	source := NewFastforexSource(sourceConfig(server.URL, ""))
+
+	rates, err := source.Rates(context.Background(), "USD", []string{"EUR", "RUB"})
+
+	require.NoError(t, err)
+	assert.Len(t, rates, 2)
+	assert.Equal(t, rat(t, "101.82"), rates["RUB"])
+	assert.Equal(t, rat(t, "0.95846"), rates["EUR"])
+}
+
+func TestFastforexSource_InvalidKey(t *testing.T) {
+	server, _ := fixtureServer(t, http.StatusUnauthorized, "fastforex_invalid_key.json")
+	source := NewFastforexSource(sourceConfig(server.URL, ""))
+
+	_, err := source.Rates(context.Background(), "USD", []string{"RUB"})
+
+	assert.Error(t, err)
+}
+
+func TestCBRSource_Rates(t *testing.T) {
+	server, _ := fixtureServer(t, http.StatusOK, "cbr_xml_daily.xml")
+	source := NewCBRSource(sourceConfig("", server.URL))
+	ctx := context.Background()
+
+	rates, err := source.Rates(ctx, "USD", []string{"RUB", "EUR", "JPY", "XYZ"})
+	require.NoError(t, err)
+	assert.Len(t, rates, 3)
+	assert.Equal(t, rat(t, "101.6797"), rates["RUB"])
+	assert.Equal(t, new(big.Rat).Quo(rat(t, "101.6797"), rat(t, "106.1028")), rates["EUR"])
+	// Курс иены опубликован за 100 единиц
+	assert.Equal(t, "157.26", rates["JPY"].FloatString(2))
+
+	rates, err = source.Rates(ctx, "RUB", []string{"USD"})
+	require.NoError(t, err)
+	assert.Equal(t, new(big.Rat).Inv(rat(t, "101.6797")), rates["USD"])
+
+	// Базовой валюты нет в выгрузке: источник её не знает, это не ошибка
+	rates, err = source.Rates(ctx, "XYZ", []string{"RUB"})
+	require.NoError(t, err)
+	assert.Empty(t, rates)
+}
+
+func TestCBRSource_MalformedFeed(t *testing.T) {
+	server, _ := fixtureServer(t, http.StatusOK, "fastforex_fetch_multi_usd.json")
+	source := NewCBRSource(sourceConfig("", server.URL))
+
+	_, err := source.Rates(context.Background(), "USD", []string{"RUB"})
+
+	assert.Error(t, err)
+}
+
+func TestStaticSource_Rates(t *testing.T) {
+	for _, fixture := range []string{"static_rates.yaml", "static_rates.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			source, err := LoadStaticSource(filepath.Join("testdata", fixture))
+			require.NoError(t, err)
+
+			rates, err := source.Rates(context.Background(), "RUB", []string{"USD", "EUR", "GBP"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]*big.Rat{"USD": rat(t, "0.0098"), "EUR": rat(t, "0.0094")}, rates)
+
+			// Обратный курс и кросс-курс через RUB
+			rates, err = source.Rates(context.Background(), "USD", []string{"RUB", "EUR", "CNY"})
+			require.NoError(t, err)
+			assert.Equal(t, new(big.Rat).Inv(rat(t, "0.0098")), rates["RUB"])
+			assert.Equal(t, big.NewRat(47, 49), rates["EUR"])
+			assert.Equal(t, rat(t, "7.3"), rates["CNY"])
+		})
+	}
+}
+
+func TestLoadStaticSource_Errors(t *testing.T) {
+	_, err := LoadStaticSource("")
+	assert.Error(t, err)
+
+	_, err = LoadStaticSource(filepath.Join("testdata", "cbr_xml_daily.xml"))
+	assert.Error(t, err)
+
+	_, err = LoadStaticSource(filepath.Join("testdata", "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNewRateSources(t *testing.T) {
+	cfg := sourceConfig("https://api.fastforex.io", "https://www.cbr.ru/scripts/XML_daily.asp")
+	cfg.Forex.Sources = []string{"cbr", "static", "fastforex"}
+	cfg.Forex.StaticFile = filepath.Join("testdata", "static_rates.yaml")
+
+	sources, err := NewRateSources(cfg)
+	require.NoError(t, err)
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.Name())
+	}
+	assert.Equal(t, []string{"cbr", "static", "fastforex"}, names)
+
+	cfg.Forex.Sources = []string{"fastforex", "ecb"}
+	_, err = NewRateSources(cfg)
+	assert.Error(t, err)
+}
+
+func TestForexClient_FallbackChain(t *testing.T) {
+	fastforex, fastforexRequests := fixtureServer(t, http.StatusUnauthorized, "fastforex_invalid_key.json")
+	cbr, cbrRequests := fixtureServer(t, http.StatusOK, "cbr_xml_daily.xml")
+	cfg := sourceConfig(fastforex.URL, cbr.URL)
+
+	clock := &testClock{}
+	clock.now.Store(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	forexClient := NewForexClient(cfg, []RateSource{NewFastforexSource(cfg), NewCBRSource(cfg)}, nil, zaptest.NewLogger(t))
+	forexClient.now = clock.Now
+	ctx := context.Background()
+
+	rate, err := forexClient.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, rat(t, "101.6797"), rate)
+	rates, ok := forexClient.cache.get(ctx, "USD")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"RUB": "cbr", "EUR": "cbr"}, rates.Sources)
+
+	// Вторая ошибка подряд выводит fastforex из цепочки
+	_, err = forexClient.refresh(ctx, "USD")
+	require.NoError(t, err)
+	health := forexClient.Health()
+	require.Len(t, health, 2)
+	assert.Equal(t, "fastforex", health[0].Name)
+	assert.False(t, health[0].Healthy)
+	assert.Equal(t, 2, health[0].Failures)
+	assert.NotEmpty(t, health[0].LastError)
+	assert.True(t, health[1].Healthy)
+	assert.Equal(t, clock.Now(), health[1].LastSuccess)
+
+	// На cooldown fastforex не опрашивается, пока справляется ЦБ
+	_, err = forexClient.refresh(ctx, "USD")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, fastforexRequests.Load())
+	assert.EqualValues(t, 3, cbrRequests.Load())
+
+	clock.Advance(time.Minute)
+	_, err = forexClient.refresh(ctx, "USD")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, fastforexRequests.Load())
+}
+
+func TestForexClient_FallbackFillsMissingRates(t *testing.T) {
+	fastforex, _ := fixtureServer(t, http.StatusOK, "fastforex_fetch_multi_usd.json")
+	cfg := sourceConfig(fastforex.URL, "")
+	cfg.Forex.Currencies = []string{"RUB", "USD", "EUR", "CNY"}
+	static, err := LoadStaticSource(filepath.Join("testdata", "static_rates.json"))
+	require.NoError(t, err)
+
+	forexClient := NewForexClient(cfg, []RateSource{NewFastforexSource(cfg), static}, nil, zaptest.NewLogger(t))
+	fallbacks := metric("fallbacks")
+
+	rate, err := forexClient.Rate(context.Background(), "USD", "CNY")
+	require.NoError(t, err)
+	assert.Equal(t, rat(t, "7.3"), rate)
+
+	rates, ok := forexClient.cache.get(context.Background(), "USD")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"RUB": "fastforex", "EUR": "fastforex", "CNY": "static"}, rates.Sources)
+	assert.Equal(t, fallbacks+1, metric("fallbacks"))
+}
+
+func TestForexClient_AllSourcesFailed(t *testing.T) {
+	fastforex, _ := fixtureServer(t, http.StatusUnauthorized, "fastforex_invalid_key.json")
+	cbr, _ := fixtureServer(t, http.StatusServiceUnavailable, "fastforex_invalid_key.json")
+	cfg := sourceConfig(fastforex.URL, cbr.URL)
+	forexClient := NewForexClient(cfg, []RateSource{NewFastforexSource(cfg), NewCBRSource(cfg)}, nil, zaptest.NewLogger(t))
+
+	_, err := forexClient.Rate(context.Background(), "USD", "RUB")
+
+	assert.ErrorContains(t, err, "fastforex")
+	assert.ErrorContains(t, err, "cbr")
+}
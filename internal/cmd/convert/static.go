@@ -0,0 +1,118 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const StaticSourceName = "static"
+
+// StaticSource курсы из файла (YAML или JSON по расширению) на случай, когда внешние источники недоступны:
+//
+//	rates:
+//	  USD:
+//	    RUB: 92.5
+//	    EUR: 0.92
+//
+// Обратные курсы и курсы через общую базовую валюту файла выводятся из указанных
+type StaticSource struct {
+	rates map[string]map[string]*big.Rat
+}
+
+type staticRatesJSON struct {
+	Rates map[string]map[string]json.Number `json:"rates"`
+}
+
+type staticRatesYAML struct {
+	Rates map[string]map[string]string `yaml:"rates"`
+}
+
+// LoadStaticSource читает файл курсов path
+func LoadStaticSource(path string) (*StaticSource, error) {
+	if path == "" {
+		return nil, errors.New("static rates file is not configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static rates: %w", err)
+	}
+
+	raw := make(map[string]map[string]string)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var file staticRatesJSON
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("failed to decode static rates: %w", err)
+		}
+		for base, rates := range file.Rates {
+			raw[base] = make(map[string]string, len(rates))
+			for currency, rate := range rates {
+				raw[base][currency] = rate.String()
+			}
+		}
+	case ".yaml", ".yml":
+		var file staticRatesYAML
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to decode static rates: %w", err)
+		}
+		raw = file.Rates
+	default:
+		return nil, fmt.Errorf("unsupported static rates file %q: expected .json, .yaml or .yml", path)
+	}
+
+	source := &StaticSource{rates: make(map[string]map[string]*big.Rat, len(raw))}
+	for base, rates := range raw {
+		source.rates[base] = make(map[string]*big.Rat, len(rates))
+		for currency, value := range rates {
+			rate, ok := new(big.Rat).SetString(value)
+			if !ok || rate.Sign() <= 0 {
+				return nil, fmt.Errorf("invalid static %s/%s rate %q", base, currency, value)
+			}
+			source.rates[base][currency] = rate
+		}
+	}
+	return source, nil
+}
+
+func (s *StaticSource) Name() string {
+	return StaticSourceName
+}
+
+func (s *StaticSource) Rates(_ context.Context, base string, targets []string) (map[string]*big.Rat, error) {
+	rates := make(map[string]*big.Rat, len(targets))
+	for _, currency := range targets {
+		if rate, ok := s.rate(base, currency); ok {
+			rates[currency] = rate
+		}
+	}
+	return rates, nil
+}
+
+// rate прямой курс, обратный к указанному или кросс-курс через базовую валюту файла
+func (s *StaticSource) rate(from, to string) (*big.Rat, bool) {
+	if rate, ok := s.rates[from][to]; ok {
+		return rate, true
+	}
+	if rate, ok := s.rates[to][from]; ok {
+		return new(big.Rat).Inv(rate), true
+	}
+	for _, rates := range s.rates {
+		fromRate, fromOK := rates[from]
+		toRate, toOK := rates[to]
+		if fromOK && toOK {
+			return new(big.Rat).Quo(toRate, fromRate), true
+		}
+	}
+	return nil, false
+}
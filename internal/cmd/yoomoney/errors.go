@@ -0,0 +1,99 @@
+package yoomoney
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ошибки API ЮMoney по кодам поля error (request-payment, process-payment, operation-history)
+// и HTTP-статусам авторизации. Конкретный код доступен в APIError.Code
+var (
+	// ErrIllegalParam неверное значение параметра: illegal_params и illegal_param_*
+	ErrIllegalParam = errors.New("illegal request parameter")
+	// ErrNotEnoughFunds на кошельке недостаточно средств
+	ErrNotEnoughFunds = errors.New("not enough funds")
+	// ErrPaymentRefused магазин или получатель отказал в приёме перевода
+	ErrPaymentRefused = errors.New("payment refused")
+	// ErrPayeeNotFound получатель перевода не найден
+	ErrPayeeNotFound = errors.New("payee not found")
+	// ErrAuthorizationReject ЮMoney отказал в проведении перевода (ограничения токена, кошелька или получателя)
+	ErrAuthorizationReject = errors.New("payment authorization rejected")
+	// ErrLimitExceeded превышен лимит платежей токена или кошелька
+	ErrLimitExceeded = errors.New("payment limit exceeded")
+	// ErrAccountBlocked кошелёк заблокирован
+	ErrAccountBlocked = errors.New("account blocked")
+	// ErrAccountClosed кошелёк закрыт
+	ErrAccountClosed = errors.New("account closed")
+	// ErrExtActionRequired перевод невозможен, пока владелец кошелька не выполнит действие на сайте
+	ErrExtActionRequired = errors.New("external action required")
+	// ErrContractNotFound запрос перевода request_id не найден или истёк
+	ErrContractNotFound = errors.New("payment request not found")
+	// ErrMoneySourceNotAvailable выбранный источник средств недоступен для перевода
+	ErrMoneySourceNotAvailable = errors.New("money source not available")
+	// ErrExtAuthRequired перевод требует подтверждения 3-D Secure, которое демон пройти не может
+	ErrExtAuthRequired = errors.New("external authorization required")
+	// ErrTechnicalError временная ошибка на стороне ЮMoney, запрос можно повторить
+	ErrTechnicalError = errors.New("technical error")
+	// ErrInvalidToken токен отсутствует, просрочен или отозван (HTTP 401)
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInsufficientScope у токена нет прав на операцию (HTTP 403)
+	ErrInsufficientScope = errors.New("insufficient token scope")
+	// ErrUnknownAPIError код ошибки, не описанный в документации
+	ErrUnknownAPIError = errors.New("unknown API error")
+)
+
+var apiErrors = map[string]error{
+	"illegal_params":             ErrIllegalParam,
+	"not_enough_funds":           ErrNotEnoughFunds,
+	"payment_refused":            ErrPaymentRefused,
+	"payee_not_found":            ErrPayeeNotFound,
+	"authorization_reject":       ErrAuthorizationReject,
+	"limit_exceeded":             ErrLimitExceeded,
+	"account_blocked":            ErrAccountBlocked,
+	"account_closed":             ErrAccountClosed,
+	"ext_action_required":        ErrExtActionRequired,
+	"contract_not_found":         ErrContractNotFound,
+	"money_source_not_available": ErrMoneySourceNotAvailable,
+	"ext_auth_required":          ErrExtAuthRequired,
+	"technical_error":            ErrTechnicalError,
+	"invalid_token":              ErrInvalidToken,
+	"insufficient_scope":         ErrInsufficientScope,
+}
+
+// APIError ошибка метода API ЮMoney с исходным кодом
+type APIError struct {
+	Method string
+	Code   string
+	err    error
+}
+
+func newAPIError(method, code string) *APIError {
+	err, ok := apiErrors[code]
+	if !ok && strings.HasPrefix(code, "illegal_param_") {
+		err, ok = ErrIllegalParam, true
+	}
+	if !ok {
+		err = ErrUnknownAPIError
+	}
+	return &APIError{Method: method, Code: code, err: err}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error: %s", e.Method, e.Code)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// Rejected отказ именно в этом переводе (параметры, получатель, 3-D Secure): повтор не поможет.
+// Остальные ошибки касаются кошелька или токена сервиса и проходят после пополнения, сброса лимита
+// или действий оператора
+func (e *APIError) Rejected() bool {
+	switch e.err {
+	case ErrIllegalParam, ErrPaymentRefused, ErrPayeeNotFound, ErrAuthorizationReject, ErrExtAuthRequired:
+		return true
+	}
+	return false
+}
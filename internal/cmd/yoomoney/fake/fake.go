@@ -0,0 +1,273 @@
+// Package fake фейковый сервер API ЮMoney с состоянием в памяти для локальной разработки
+// и интеграционных тестов. Реализует /api/operation-history, /api/request-payment,
+// /api/process-payment, /api/account-info и /quickpay/confirm, а также управляющее API /fake/...
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	dto "paymentgo/internal/entity"
+)
+
+// Имена эндпоинтов для сценариев (Script)
+const (
+	EndpointOperationHistory = "operation-history"
+	EndpointRequestPayment   = "request-payment"
+	EndpointProcessPayment   = "process-payment"
+	EndpointAccountInfo      = "account-info"
+	EndpointQuickpay         = "quickpay"
+)
+
+// Статусы операций ЮMoney
+const (
+	StatusSuccess         = "success"
+	StatusRefused         = "refused"
+	StatusInProgress      = "in_progress"
+	StatusExtAuthRequired = "ext_auth_required"
+)
+
+var ErrUnknownInvoice = errors.New("no payment link was issued for label")
+
+// Scenario один заскриптованный ответ эндпоинта. Шаги сценария расходуются по одному на запрос,
+// после них эндпоинт снова отвечает по состоянию сервера
+type Scenario struct {
+	// Delay задержка перед ответом, например чтобы клиент упёрся в таймаут
+	Delay time.Duration
+	// HTTPStatus ответ с этим HTTP-статусом без обработки запроса (например, 503)
+	HTTPStatus int
+	// Error код ошибки API: для платежей ответ status=refused с этим error
+	Error string
+	// Status статус операции вместо настоящего: in_progress, refused, success, ext_auth_required
+	Status string
+	// NextRetry подсказка next_retry для in_progress
+	NextRetry time.Duration
+}
+
+// Invoice ссылка на оплату, выданная через /quickpay/confirm
+type Invoice struct {
+	Label     string    `json:"label"`
+	Receiver  string    `json:"receiver"`
+	Amount    dto.Money `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Operation операция в истории кошелька: входящая оплата (deposition) или исходящий перевод (payment)
+type Operation struct {
+	OperationID string    `json:"operation_id"`
+	Label       string    `json:"label"`
+	Direction   string    `json:"direction"`
+	Type        string    `json:"type"`
+	Amount      dto.Money `json:"amount"`
+	Status      string    `json:"status"`
+	Sender      string    `json:"sender,omitempty"`
+	DateTime    time.Time `json:"datetime"`
+}
+
+// Transfer исходящий перевод, начатый через /api/request-payment
+type Transfer struct {
+	RequestID string    `json:"request_id"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	To        string    `json:"to"`
+	Label     string    `json:"label"`
+	Comment   string    `json:"comment"`
+	Amount    dto.Money `json:"amount"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type Server struct {
+	mu           sync.Mutex
+	token        string
+	account      string
+	balance      dto.Money
+	notifyURL    string
+	notifySecret string
+	httpClient   *http.Client
+	now          func() time.Time
+
+	invoices   map[string]*Invoice
+	operations []*Operation
+	transfers  map[string]*Transfer
+	order      []string
+	scenarios  map[string][]Scenario
+	nextID     int64
+
+	mux *http.ServeMux
+}
+
+type Option func(*Server)
+
+// WithToken требовать Authorization: Bearer token в запросах к /api
+func WithToken(token string) Option {
+	return func(s *Server) { s.token = token }
+}
+
+// WithAccount номер кошелька, на который выставляются ссылки QuickPay
+func WithAccount(account string) Option {
+	return func(s *Server) { s.account = account }
+}
+
+// WithBalance начальный баланс кошелька для исходящих переводов
+func WithBalance(balance dto.Money) Option {
+	return func(s *Server) { s.balance = balance }
+}
+
+// WithNotifications отправлять HTTP-уведомления о входящих оплатах на url, подписанные secret
+func WithNotifications(url, secret string) Option {
+	return func(s *Server) {
+		s.notifyURL = url
+		s.notifySecret = secret
+	}
+}
+
+// WithClock источник времени для операций
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) { s.now = now }
+}
+
+func New(opts ...Option) *Server {
+	s := &Server{
+		account:    dto.CoreAccount,
+		balance:    dto.Money{Minor: 100000000, Currency: "RUB"},
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.reset()
+
+	s.mux = http.NewServeMux()
+	s.routes()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Script добавляет шаги сценария эндпоинта endpoint (Endpoint*)
+func (s *Server) Script(endpoint string, steps ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios[endpoint] = append(s.scenarios[endpoint], steps...)
+}
+
+// Pay проводит оплату по ссылке с меткой label: деньги зачисляются, операция появляется в истории
+func (s *Server) Pay(label string) (Operation, error) {
+	return s.settle(label, StatusSuccess)
+}
+
+// Refuse записывает отклонённую оплату по ссылке с меткой label
+func (s *Server) Refuse(label string) (Operation, error) {
+	return s.settle(label, StatusRefused)
+}
+
+// Invoice ссылка на оплату с меткой label
+func (s *Server) Invoice(label string) (Invoice, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invoice, ok := s.invoices[label]
+	if !ok {
+		return Invoice{}, false
+	}
+	return *invoice, true
+}
+
+// Operations история операций кошелька от старых к новым
+func (s *Server) Operations() []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operations := make([]Operation, 0, len(s.operations))
+	for _, operation := range s.operations {
+		operations = append(operations, *operation)
+	}
+	return operations
+}
+
+// Transfers исходящие переводы в порядке запросов
+func (s *Server) Transfers() []Transfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transfers := make([]Transfer, 0, len(s.order))
+	for _, requestID := range s.order {
+		transfers = append(transfers, *s.transfers[requestID])
+	}
+	return transfers
+}
+
+// Balance текущий баланс кошелька
+func (s *Server) Balance() dto.Money {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balance
+}
+
+// Reset очищает ссылки, операции, переводы и сценарии
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+func (s *Server) reset() {
+	s.invoices = make(map[string]*Invoice)
+	s.operations = nil
+	s.transfers = make(map[string]*Transfer)
+	s.order = nil
+	s.scenarios = make(map[string][]Scenario)
+}
+
+func (s *Server) settle(label, status string) (Operation, error) {
+	s.mu.Lock()
+	invoice, ok := s.invoices[label]
+	if !ok {
+		s.mu.Unlock()
+		return Operation{}, fmt.Errorf("%w %q", ErrUnknownInvoice, label)
+	}
+
+	operation := &Operation{
+		OperationID: s.newID("op"),
+		Label:       label,
+		Direction:   "in",
+		Type:        "deposition",
+		Amount:      invoice.Amount,
+		Status:      status,
+		Sender:      "41001000040",
+		DateTime:    s.now().UTC().Truncate(time.Second),
+	}
+	s.operations = append(s.operations, operation)
+	if status == StatusSuccess {
+		s.balance.Minor += invoice.Amount.Minor
+	}
+	result := *operation
+	s.mu.Unlock()
+
+	if status == StatusSuccess && s.notifyURL != "" {
+		if err := s.notify(result); err != nil {
+			return result, fmt.Errorf("payment recorded, but notification failed: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// nextStep следующий шаг сценария эндпоинта, если он есть
+func (s *Server) nextStep(endpoint string) (Scenario, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steps := s.scenarios[endpoint]
+	if len(steps) == 0 {
+		return Scenario{}, false
+	}
+	s.scenarios[endpoint] = steps[1:]
+	return steps[0], true
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("fake-%s-%d", prefix, s.nextID)
+}
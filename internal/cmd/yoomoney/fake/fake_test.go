@@ -0,0 +1,340 @@
+package fake_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	"paymentgo/internal/cmd/yoomoney/fake"
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/usecase"
+)
+
+const (
+	testToken    = "fake-token"
+	testReceiver = "4100100000000"
+	testLabel    = "3f8a2c1e-5b7d-4e9a-8c6f-1a2b3c4d5e6f"
+)
+
+func newFake(t *testing.T, opts ...fake.Option) (*fake.Server, *httptest.Server, *yoomoney.Provider) {
+	t.Helper()
+	server := fake.New(append([]fake.Option{fake.WithToken(testToken), fake.WithAccount(testReceiver)}, opts...)...)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	cfg := &config.Config{}
+	cfg.Yoomoney.Token = testToken
+	cfg.Yoomoney.BaseURL = httpServer.URL
+	cfg.Yoomoney.Timeout = 300 * time.Millisecond
+	return server, httpServer, yoomoney.NewProvider(yoomoney.New(cfg), testReceiver)
+}
+
+func testPayment() *dto.Payment {
+	return &dto.Payment{
+		ID:       testLabel,
+		ToUserID: "user-2",
+		Amount:   dto.Money{Minor: 100000, Currency: "RUB"},
+		Status:   dto.StatusPending,
+		Provider: yoomoney.ProviderName,
+	}
+}
+
+func TestFake_PaymentLinkAndStatus(t *testing.T) {
+	server, _, provider := newFake(t)
+	ctx := context.Background()
+	payment := testPayment()
+
+	link, err := provider.CreatePaymentLink(ctx, payment, payment.Amount)
+	require.NoError(t, err)
+	assert.Contains(t, link, "label="+testLabel)
+
+	invoice, ok := server.Invoice(testLabel)
+	require.True(t, ok)
+	assert.Equal(t, payment.Amount, invoice.Amount)
+
+	// До оплаты операции в истории нет, платёж ждёт оплаты
+	status, err := provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusPending, status)
+
+	_, err = server.Pay(testLabel)
+	require.NoError(t, err)
+
+	status, err = provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusSucceeded, status)
+	assert.Equal(t, int64(100000000+100000), server.Balance().Minor)
+}
+
+func TestFake_RefusedPayment(t *testing.T) {
+	server, _, provider := newFake(t)
+	ctx := context.Background()
+	payment := testPayment()
+
+	_, err := provider.CreatePaymentLink(ctx, payment, payment.Amount)
+	require.NoError(t, err)
+	_, err = server.Refuse(testLabel)
+	require.NoError(t, err)
+
+	status, err := provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusFailed, status)
+}
+
+func TestFake_PayUnknownLabel(t *testing.T) {
+	server, _, _ := newFake(t)
+
+	_, err := server.Pay("unknown")
+	assert.ErrorIs(t, err, fake.ErrUnknownInvoice)
+}
+
+func TestFake_ScriptedStatus(t *testing.T) {
+	server, _, provider := newFake(t)
+	ctx := context.Background()
+	payment := testPayment()
+
+	_, err := provider.CreatePaymentLink(ctx, payment, payment.Amount)
+	require.NoError(t, err)
+	_, err = server.Pay(testLabel)
+	require.NoError(t, err)
+
+	server.Script(fake.EndpointOperationHistory,
+		fake.Scenario{HTTPStatus: http.StatusServiceUnavailable},
+		fake.Scenario{Status: fake.StatusInProgress},
+		fake.Scenario{Delay: time.Second},
+	)
+
+	_, err = provider.PaymentStatus(ctx, payment)
+	assert.ErrorContains(t, err, "503")
+
+	status, err := provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusPending, status)
+
+	// Задержка больше таймаута клиента
+	_, err = provider.PaymentStatus(ctx, payment)
+	assert.Error(t, err)
+
+	// Сценарий исчерпан, сервер снова отвечает по состоянию
+	status, err = provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusSucceeded, status)
+}
+
+func TestFake_RejectsInvalidToken(t *testing.T) {
+	_, httpServer, _ := newFake(t)
+
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/account-info", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer wrong")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestFake_Payout(t *testing.T) {
+	server, _, provider := newFake(t)
+	ctx := context.Background()
+	payment := testPayment()
+
+	payout, err := provider.Payout(ctx, payment, "41001000040")
+	require.NoError(t, err)
+	assert.Equal(t, usecase.PayoutRequested, payout.Status)
+	require.NotEmpty(t, payout.RequestID)
+	// Зарегистрированный перевод ещё не списывает деньги
+	assert.Equal(t, int64(100000000), server.Balance().Minor)
+
+	payment.PayoutRequestID = payout.RequestID
+	server.Script(fake.EndpointProcessPayment, fake.Scenario{Status: fake.StatusInProgress, NextRetry: 2 * time.Second})
+
+	payout, err = provider.Payout(ctx, payment, "41001000040")
+	require.NoError(t, err)
+	assert.Equal(t, usecase.PayoutInProgress, payout.Status)
+	assert.Equal(t, 2*time.Second, payout.NextRetry)
+
+	payout, err = provider.Payout(ctx, payment, "41001000040")
+	require.NoError(t, err)
+	assert.Equal(t, usecase.PayoutCompleted, payout.Status)
+	assert.NotEmpty(t, payout.PaymentID)
+
+	transfers := server.Transfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, "41001000040", transfers[0].To)
+	assert.Equal(t, testLabel, transfers[0].Label)
+	assert.Equal(t, fake.StatusSuccess, transfers[0].Status)
+	assert.Equal(t, int64(100000000-100000), server.Balance().Minor)
+
+	// Проведённая выплата не повторяется
+	payment.PayoutID = payout.PaymentID
+	payout, err = provider.Payout(ctx, payment, "41001000040")
+	require.NoError(t, err)
+	assert.Equal(t, usecase.PayoutCompleted, payout.Status)
+	assert.Len(t, server.Transfers(), 1)
+}
+
+func TestFake_PayoutExpiredRequest(t *testing.T) {
+	server, _, provider := newFake(t)
+	payment := testPayment()
+	payment.PayoutRequestID = "expired-request"
+
+	payout, err := provider.Payout(context.Background(), payment, "41001000040")
+	require.NoError(t, err)
+	assert.Equal(t, usecase.PayoutRequested, payout.Status)
+	assert.NotEqual(t, "expired-request", payout.RequestID)
+	assert.Len(t, server.Transfers(), 1)
+}
+
+func TestFake_PayoutRefused(t *testing.T) {
+	server, _, provider := newFake(t, fake.WithBalance(dto.Money{Minor: 100, Currency: "RUB"}))
+	ctx := context.Background()
+
+	_, err := provider.Payout(ctx, testPayment(), "41001000040")
+	assert.ErrorIs(t, err, yoomoney.ErrNotEnoughFunds)
+	assert.NotErrorIs(t, err, usecase.ErrPayoutRejected)
+	assert.Empty(t, server.Transfers())
+
+	small := &dto.Payment{ID: "p", ToUserID: "u", Amount: dto.Money{Minor: 1, Currency: "RUB"}}
+	server.Script(fake.EndpointRequestPayment, fake.Scenario{Error: "payee_not_found"})
+	_, err = provider.Payout(ctx, small, "41001000040")
+	assert.ErrorIs(t, err, yoomoney.ErrPayeeNotFound)
+	assert.ErrorIs(t, err, usecase.ErrPayoutRejected)
+
+	payout, err := provider.Payout(ctx, small, "41001000040")
+	require.NoError(t, err)
+	small.PayoutRequestID = payout.RequestID
+	server.Script(fake.EndpointProcessPayment, fake.Scenario{Status: fake.StatusExtAuthRequired})
+	_, err = provider.Payout(ctx, small, "41001000040")
+	assert.ErrorIs(t, err, yoomoney.ErrExtAuthRequired)
+	assert.ErrorIs(t, err, usecase.ErrPayoutRejected)
+}
+
+func postForm(t *testing.T, endpoint string, form url.Values) map[string]any {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body
+}
+
+func TestFake_ProcessPayment(t *testing.T) {
+	server, httpServer, _ := newFake(t)
+
+	requested := postForm(t, httpServer.URL+"/api/request-payment", url.Values{
+		"pattern_id": {"p2p"},
+		"to":         {"41001000040"},
+		"amount":     {"250.50"},
+		"label":      {testLabel},
+	})
+	require.Equal(t, "success", requested["status"])
+	requestID := requested["request_id"].(string)
+
+	server.Script(fake.EndpointProcessPayment, fake.Scenario{Status: fake.StatusInProgress, NextRetry: 1500 * time.Millisecond})
+
+	processed := postForm(t, httpServer.URL+"/api/process-payment", url.Values{"request_id": {requestID}})
+	assert.Equal(t, "in_progress", processed["status"])
+	assert.Equal(t, float64(1500), processed["next_retry"])
+
+	processed = postForm(t, httpServer.URL+"/api/process-payment", url.Values{"request_id": {requestID}})
+	require.Equal(t, "success", processed["status"])
+	paymentID := processed["payment_id"]
+	assert.NotEmpty(t, paymentID)
+
+	// Повтор возвращает тот же перевод и не списывает деньги второй раз
+	processed = postForm(t, httpServer.URL+"/api/process-payment", url.Values{"request_id": {requestID}})
+	assert.Equal(t, paymentID, processed["payment_id"])
+	assert.Equal(t, int64(100000000-25050), server.Balance().Minor)
+
+	processed = postForm(t, httpServer.URL+"/api/process-payment", url.Values{"request_id": {"unknown"}})
+	assert.Equal(t, "refused", processed["status"])
+	assert.Equal(t, "contract_not_found", processed["error"])
+}
+
+func TestFake_ControlAPI(t *testing.T) {
+	server, httpServer, provider := newFake(t)
+	ctx := context.Background()
+	payment := testPayment()
+
+	_, err := provider.CreatePaymentLink(ctx, payment, payment.Amount)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, httpServer.URL+"/fake/scenarios/"+fake.EndpointOperationHistory,
+		strings.NewReader(`[{"status": "in_progress"}]`))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Post(httpServer.URL+"/fake/invoices/"+testLabel+"/pay", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status, err := provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusPending, status)
+
+	status, err = provider.PaymentStatus(ctx, payment)
+	require.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusSucceeded, status)
+
+	resp, err = http.Post(httpServer.URL+"/fake/invoices/unknown/pay", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(httpServer.URL+"/fake/reset", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, server.Operations())
+}
+
+func TestFake_SendsSignedNotification(t *testing.T) {
+	const secret = "01234567890ABCDEF01234567890"
+
+	received := make(chan *yoomoney.Notification, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		notification, err := yoomoney.ParseNotification(r.PostForm)
+		require.NoError(t, err)
+		require.NoError(t, notification.Verify(secret))
+		received <- notification
+	}))
+	defer receiver.Close()
+
+	server, _, provider := newFake(t, fake.WithNotifications(receiver.URL, secret))
+	payment := testPayment()
+
+	_, err := provider.CreatePaymentLink(context.Background(), payment, payment.Amount)
+	require.NoError(t, err)
+	operation, err := server.Pay(testLabel)
+	require.NoError(t, err)
+
+	notification := <-received
+	assert.Equal(t, operation.OperationID, notification.OperationID)
+	assert.Equal(t, testLabel, notification.Label)
+	assert.Equal(t, payment.Amount, notification.WithdrawAmount)
+}
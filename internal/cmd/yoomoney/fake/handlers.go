@@ -0,0 +1,426 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "paymentgo/internal/entity"
+)
+
+// walletCurrency кошелёк ЮMoney рублёвый, код валюты в ответах API по ISO 4217
+const (
+	walletCurrency     = "RUB"
+	walletCurrencyCode = "643"
+)
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("POST /api/account-info", s.api(EndpointAccountInfo, s.accountInfo))
+	s.mux.HandleFunc("POST /api/operation-history", s.api(EndpointOperationHistory, s.operationHistory))
+	s.mux.HandleFunc("POST /api/request-payment", s.api(EndpointRequestPayment, s.requestPayment))
+	s.mux.HandleFunc("POST /api/process-payment", s.api(EndpointProcessPayment, s.processPayment))
+	s.mux.HandleFunc("/quickpay/confirm", s.scripted(EndpointQuickpay, s.quickpay))
+
+	s.mux.HandleFunc("POST /fake/invoices/{label}/pay", s.controlPay)
+	s.mux.HandleFunc("PUT /fake/scenarios/{endpoint}", s.controlScript)
+	s.mux.HandleFunc("GET /fake/transfers", s.controlList(func() any { return s.Transfers() }))
+	s.mux.HandleFunc("GET /fake/operations", s.controlList(func() any { return s.Operations() }))
+	s.mux.HandleFunc("POST /fake/reset", s.controlReset)
+}
+
+type stepHandler func(w http.ResponseWriter, r *http.Request, step Scenario)
+
+// scripted применяет очередной шаг сценария: задержку и подмену HTTP-статуса, остальное передаёт обработчику
+func (s *Server) scripted(endpoint string, next stepHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		step, _ := s.nextStep(endpoint)
+		if step.Delay > 0 {
+			select {
+			case <-time.After(step.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if step.HTTPStatus != 0 {
+			http.Error(w, http.StatusText(step.HTTPStatus), step.HTTPStatus)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "malformed form", http.StatusBadRequest)
+			return
+		}
+		next(w, r, step)
+	}
+}
+
+// api эндпоинт /api/...: как у ЮMoney, без действующего токена ответ 401 с WWW-Authenticate
+func (s *Server) api(endpoint string, next stepHandler) http.HandlerFunc {
+	handler := s.scripted(endpoint, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) accountInfo(w http.ResponseWriter, r *http.Request, step Scenario) {
+	if step.Error != "" {
+		writeJSON(w, http.StatusOK, map[string]any{"error": step.Error})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"account":        s.account,
+		"balance":        json.Number(s.balance.String()),
+		"currency":       walletCurrencyCode,
+		"account_status": "identified",
+		"account_type":   "personal",
+	})
+}
+
+func (s *Server) operationHistory(w http.ResponseWriter, r *http.Request, step Scenario) {
+	if step.Error != "" {
+		writeJSON(w, http.StatusOK, map[string]any{"error": step.Error})
+		return
+	}
+
+	records := 30
+	if raw := r.Form.Get("records"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 100 {
+			writeJSON(w, http.StatusOK, map[string]any{"error": "illegal_param_records"})
+			return
+		}
+		records = n
+	}
+	var types []string
+	if raw := r.Form.Get("type"); raw != "" {
+		types = strings.Fields(raw)
+	}
+	label := r.Form.Get("label")
+
+	s.mu.Lock()
+	var operations []map[string]any
+	// История отдаётся от новых операций к старым
+	for i := len(s.operations) - 1; i >= 0 && len(operations) < records; i-- {
+		operation := *s.operations[i]
+		if label != "" && operation.Label != label {
+			continue
+		}
+		if types != nil && !slices.Contains(types, operation.Type) {
+			continue
+		}
+		if step.Status != "" {
+			operation.Status = step.Status
+		}
+		operations = append(operations, operationJSON(operation))
+	}
+	s.mu.Unlock()
+
+	// Сценарий со статусом при пустой истории отдаёт операцию с этим статусом, как будто оплата началась
+	if len(operations) == 0 && step.Status != "" && label != "" {
+		operations = append(operations, operationJSON(Operation{
+			OperationID: "fake-scripted",
+			Label:       label,
+			Direction:   "in",
+			Type:        "deposition",
+			Status:      step.Status,
+			DateTime:    s.now().UTC().Truncate(time.Second),
+		}))
+	}
+	if operations == nil {
+		operations = []map[string]any{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"operations": operations})
+}
+
+func (s *Server) requestPayment(w http.ResponseWriter, r *http.Request, step Scenario) {
+	if r.Form.Get("pattern_id") != "p2p" {
+		refuse(w, "illegal_param_pattern_id")
+		return
+	}
+	to := r.Form.Get("to")
+	if to == "" {
+		refuse(w, "illegal_param_to")
+		return
+	}
+	raw := r.Form.Get("amount")
+	if raw == "" {
+		raw = r.Form.Get("amount_due")
+	}
+	amount, err := dto.ParseMoney(raw, walletCurrency)
+	if err != nil || !amount.IsPositive() {
+		refuse(w, "illegal_param_amount")
+		return
+	}
+	if step.Error != "" {
+		refuse(w, step.Error)
+		return
+	}
+	if step.Status == StatusRefused {
+		refuse(w, "authorization_reject")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if amount.Minor > s.balance.Minor {
+		refuse(w, "not_enough_funds")
+		return
+	}
+
+	transfer := &Transfer{
+		RequestID: s.newID("request"),
+		To:        to,
+		Label:     r.Form.Get("label"),
+		Comment:   r.Form.Get("comment"),
+		Amount:    amount,
+		Status:    "requested",
+	}
+	s.transfers[transfer.RequestID] = transfer
+	s.order = append(s.order, transfer.RequestID)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":                   StatusSuccess,
+		"request_id":               transfer.RequestID,
+		"contract_amount":          json.Number(amount.String()),
+		"balance":                  json.Number(s.balance.String()),
+		"recipient_account_status": "identified",
+		"recipient_account_type":   "personal",
+	})
+}
+
+func (s *Server) processPayment(w http.ResponseWriter, r *http.Request, step Scenario) {
+	requestID := r.Form.Get("request_id")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transfer, ok := s.transfers[requestID]
+	if !ok {
+		refuse(w, "contract_not_found")
+		return
+	}
+
+	// Повтор process-payment по завершённому переводу возвращает тот же результат
+	switch transfer.Status {
+	case StatusSuccess:
+		s.writeProcessed(w, transfer)
+		return
+	case StatusRefused:
+		refuse(w, transfer.Error)
+		return
+	}
+
+	switch {
+	case step.Error != "":
+		transfer.Status, transfer.Error = StatusRefused, step.Error
+		refuse(w, step.Error)
+		return
+	case step.Status == StatusInProgress:
+		transfer.Status = StatusInProgress
+		nextRetry := step.NextRetry
+		if nextRetry == 0 {
+			nextRetry = 5 * time.Second
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":     StatusInProgress,
+			"next_retry": nextRetry.Milliseconds(),
+		})
+		return
+	case step.Status == StatusExtAuthRequired:
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":     StatusExtAuthRequired,
+			"acs_uri":    "https://yoomoney.ru/fake/3ds",
+			"acs_params": map[string]string{"MD": requestID},
+		})
+		return
+	case step.Status == StatusRefused:
+		transfer.Status, transfer.Error = StatusRefused, "authorization_reject"
+		refuse(w, transfer.Error)
+		return
+	}
+
+	if transfer.Amount.Minor > s.balance.Minor {
+		transfer.Status, transfer.Error = StatusRefused, "not_enough_funds"
+		refuse(w, transfer.Error)
+		return
+	}
+
+	s.balance.Minor -= transfer.Amount.Minor
+	transfer.Status = StatusSuccess
+	transfer.PaymentID = s.newID("payment")
+	s.operations = append(s.operations, &Operation{
+		OperationID: transfer.PaymentID,
+		Label:       transfer.Label,
+		Direction:   "out",
+		Type:        "payment",
+		Amount:      transfer.Amount,
+		Status:      StatusSuccess,
+		DateTime:    s.now().UTC().Truncate(time.Second),
+	})
+	s.writeProcessed(w, transfer)
+}
+
+func (s *Server) writeProcessed(w http.ResponseWriter, transfer *Transfer) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        StatusSuccess,
+		"payment_id":    transfer.PaymentID,
+		"balance":       json.Number(s.balance.String()),
+		"payee":         transfer.To,
+		"credit_amount": json.Number(transfer.Amount.String()),
+	})
+}
+
+// quickpay форма оплаты: проверяет параметры и запоминает ссылку по label, чтобы её можно было оплатить
+func (s *Server) quickpay(w http.ResponseWriter, r *http.Request, step Scenario) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if step.Error != "" {
+		http.Error(w, step.Error, http.StatusBadRequest)
+		return
+	}
+
+	receiver := r.Form.Get("receiver")
+	if receiver != s.account {
+		http.Error(w, "unknown receiver", http.StatusBadRequest)
+		return
+	}
+	amount, err := dto.ParseMoney(r.Form.Get("sum"), walletCurrency)
+	if err != nil || !amount.IsPositive() {
+		http.Error(w, "invalid sum", http.StatusBadRequest)
+		return
+	}
+
+	if label := r.Form.Get("label"); label != "" {
+		s.mu.Lock()
+		s.invoices[label] = &Invoice{
+			Label:     label,
+			Receiver:  receiver,
+			Amount:    amount,
+			CreatedAt: s.now().UTC(),
+		}
+		s.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><body>Fake YooMoney: pay %s RUB to %s</body></html>", amount.String(), receiver)
+}
+
+func (s *Server) controlPay(w http.ResponseWriter, r *http.Request) {
+	settle := s.Pay
+	if r.URL.Query().Get("status") == StatusRefused {
+		settle = s.Refuse
+	}
+
+	operation, err := settle(r.PathValue("label"))
+	if errors.Is(err, ErrUnknownInvoice) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, operation)
+}
+
+// scenarioStep шаг сценария в управляющем API; длительности строками time.ParseDuration ("1500ms")
+type scenarioStep struct {
+	Delay      string `json:"delay"`
+	HTTPStatus int    `json:"http_status"`
+	Error      string `json:"error"`
+	Status     string `json:"status"`
+	NextRetry  string `json:"next_retry"`
+}
+
+func (s *Server) controlScript(w http.ResponseWriter, r *http.Request) {
+	var raw []scenarioStep
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, "expected JSON array of steps: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	steps := make([]Scenario, 0, len(raw))
+	for i, step := range raw {
+		delay, err := parseDuration(step.Delay)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("step %d: delay: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		nextRetry, err := parseDuration(step.NextRetry)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("step %d: next_retry: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		steps = append(steps, Scenario{
+			Delay:      delay,
+			HTTPStatus: step.HTTPStatus,
+			Error:      step.Error,
+			Status:     step.Status,
+			NextRetry:  nextRetry,
+		})
+	}
+
+	s.Script(r.PathValue("endpoint"), steps...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) controlList(list func() any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, list())
+	}
+}
+
+func (s *Server) controlReset(w http.ResponseWriter, r *http.Request) {
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func operationJSON(operation Operation) map[string]any {
+	result := map[string]any{
+		"operation_id": operation.OperationID,
+		"status":       operation.Status,
+		"datetime":     operation.DateTime.Format(time.RFC3339),
+		"title":        "Fake operation " + operation.OperationID,
+		"direction":    operation.Direction,
+		"type":         operation.Type,
+		"label":        operation.Label,
+	}
+	if !operation.Amount.IsZero() {
+		result["amount"] = json.Number(operation.Amount.String())
+	}
+	if operation.Type == "payment" {
+		result["pattern_id"] = "p2p"
+	}
+	return result
+}
+
+func refuse(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusOK, map[string]any{"status": StatusRefused, "error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func parseDuration(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(raw)
+}
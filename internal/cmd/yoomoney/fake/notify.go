@@ -0,0 +1,57 @@
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notify отправляет HTTP-уведомление p2p-incoming о зачислении, подписанное как у ЮMoney
+func (s *Server) notify(operation Operation) error {
+	form := url.Values{}
+	form.Set("notification_type", "p2p-incoming")
+	form.Set("operation_id", operation.OperationID)
+	form.Set("amount", operation.Amount.String())
+	form.Set("withdraw_amount", operation.Amount.String())
+	form.Set("currency", walletCurrencyCode)
+	form.Set("datetime", operation.DateTime.Format(time.RFC3339))
+	form.Set("sender", operation.Sender)
+	form.Set("codepro", "false")
+	form.Set("label", operation.Label)
+	form.Set("sha1_hash", Sign(form, s.notifySecret))
+
+	resp, err := s.httpClient.PostForm(s.notifyURL, form)
+	if err != nil {
+		return fmt.Errorf("failed to deliver notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notification endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign подпись sha1_hash уведомления по полям form и секрету уведомлений
+func Sign(form url.Values, secret string) string {
+	signed := strings.Join([]string{
+		form.Get("notification_type"),
+		form.Get("operation_id"),
+		form.Get("amount"),
+		form.Get("currency"),
+		form.Get("datetime"),
+		form.Get("sender"),
+		form.Get("codepro"),
+		secret,
+		form.Get("label"),
+	}, "&")
+
+	sum := sha1.Sum([]byte(signed))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package yoomoney
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	dto "paymentgo/internal/entity"
+)
+
+var (
+	ErrInvalidNotification = errors.New("invalid notification")
+	ErrInvalidSignature    = errors.New("notification signature mismatch")
+)
+
+// notificationCurrencies коды валют ISO 4217 из поля currency уведомления
+var notificationCurrencies = map[string]string{
+	"643": "RUB",
+}
+
+// Notification HTTP-уведомление ЮMoney о входящем переводе (p2p-incoming, card-incoming)
+type Notification struct {
+	Type        string
+	OperationID string
+	// Amount зачислено на кошелёк, WithdrawAmount списано с плательщика (до комиссии)
+	Amount         dto.Money
+	WithdrawAmount dto.Money
+	DateTime       time.Time
+	Sender         string
+	CodePro        bool
+	Label          string
+	// Test уведомление отправлено кнопкой «Протестировать» в настройках кошелька
+	Test bool
+	// Unaccepted перевод ещё не зачислен: получатель должен принять его вручную
+	Unaccepted bool
+
+	fields url.Values
+}
+
+// ParseNotification разбирает тело уведомления (application/x-www-form-urlencoded)
+func ParseNotification(form url.Values) (*Notification, error) {
+	for _, field := range []string{"notification_type", "operation_id", "amount", "currency", "datetime", "sha1_hash"} {
+		if form.Get(field) == "" {
+			return nil, fmt.Errorf("%w: %s is required", ErrInvalidNotification, field)
+		}
+	}
+
+	currency, ok := notificationCurrencies[form.Get("currency")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported currency %s", ErrInvalidNotification, form.Get("currency"))
+	}
+
+	amount, err := dto.ParseMoney(form.Get("amount"), currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: amount: %v", ErrInvalidNotification, err)
+	}
+
+	// withdraw_amount приходит не во всех уведомлениях, без него считаем списанным зачисленное
+	withdrawAmount := amount
+	if raw := form.Get("withdraw_amount"); raw != "" {
+		if withdrawAmount, err = dto.ParseMoney(raw, currency); err != nil {
+			return nil, fmt.Errorf("%w: withdraw_amount: %v", ErrInvalidNotification, err)
+		}
+	}
+
+	dateTime, err := time.Parse(time.RFC3339, form.Get("datetime"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: datetime: %v", ErrInvalidNotification, err)
+	}
+
+	return &Notification{
+		Type:           form.Get("notification_type"),
+		OperationID:    form.Get("operation_id"),
+		Amount:         amount,
+		WithdrawAmount: withdrawAmount,
+		DateTime:       dateTime,
+		Sender:         form.Get("sender"),
+		CodePro:        form.Get("codepro") == "true",
+		Label:          form.Get("label"),
+		Test:           form.Get("test_notification") == "true",
+		Unaccepted:     form.Get("unaccepted") == "true",
+		fields:         form,
+	}, nil
+}
+
+// Verify проверяет sha1_hash: SHA-1 от строки
+// notification_type&operation_id&amount&currency&datetime&sender&codepro&notification_secret&label
+// из исходных значений полей
+func (n *Notification) Verify(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("%w: notification secret is not configured", ErrInvalidSignature)
+	}
+
+	signed := strings.Join([]string{
+		n.fields.Get("notification_type"),
+		n.fields.Get("operation_id"),
+		n.fields.Get("amount"),
+		n.fields.Get("currency"),
+		n.fields.Get("datetime"),
+		n.fields.Get("sender"),
+		n.fields.Get("codepro"),
+		secret,
+		n.fields.Get("label"),
+	}, "&")
+
+	sum := sha1.Sum([]byte(signed))
+	expected := hex.EncodeToString(sum[:])
+	actual := strings.ToLower(n.fields.Get("sha1_hash"))
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
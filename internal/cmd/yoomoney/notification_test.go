@@ -0,0 +1,72 @@
+package yoomoney
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dto "paymentgo/internal/entity"
+)
+
+const testNotificationSecret = "01234567890ABCDEF01234567890"
+
+func loadNotification(t *testing.T, name string) url.Values {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	form, err := url.ParseQuery(string(body))
+	require.NoError(t, err)
+	return form
+}
+
+func TestParseNotification_P2PIncoming(t *testing.T) {
+	notification, err := ParseNotification(loadNotification(t, "notification_p2p_incoming.txt"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "p2p-incoming", notification.Type)
+	assert.Equal(t, "1234567", notification.OperationID)
+	assert.Equal(t, dto.Money{Minor: 99500, Currency: "RUB"}, notification.Amount)
+	assert.Equal(t, dto.Money{Minor: 100000, Currency: "RUB"}, notification.WithdrawAmount)
+	assert.Equal(t, time.Date(2024, 11, 5, 9, 15, 42, 0, time.UTC), notification.DateTime)
+	assert.Equal(t, "3f8a2c1e-5b7d-4e9a-8c6f-1a2b3c4d5e6f", notification.Label)
+	assert.False(t, notification.Test)
+	assert.NoError(t, notification.Verify(testNotificationSecret))
+}
+
+func TestNotification_VerifyRecordedBodies(t *testing.T) {
+	for _, name := range []string{"notification_p2p_incoming.txt", "notification_card_incoming.txt", "notification_test.txt"} {
+		notification, err := ParseNotification(loadNotification(t, name))
+		require.NoError(t, err, name)
+		assert.NoError(t, notification.Verify(testNotificationSecret), name)
+	}
+}
+
+func TestNotification_VerifyRejectsTampering(t *testing.T) {
+	form := loadNotification(t, "notification_p2p_incoming.txt")
+	form.Set("amount", "9950.00")
+
+	notification, err := ParseNotification(form)
+	require.NoError(t, err)
+	assert.ErrorIs(t, notification.Verify(testNotificationSecret), ErrInvalidSignature)
+
+	notification, err = ParseNotification(loadNotification(t, "notification_p2p_incoming.txt"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, notification.Verify("wrong-secret"), ErrInvalidSignature)
+	assert.ErrorIs(t, notification.Verify(""), ErrInvalidSignature)
+}
+
+func TestParseNotification_Invalid(t *testing.T) {
+	form := loadNotification(t, "notification_p2p_incoming.txt")
+	form.Del("sha1_hash")
+	_, err := ParseNotification(form)
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+
+	form = loadNotification(t, "notification_p2p_incoming.txt")
+	form.Set("currency", "840")
+	_, err = ParseNotification(form)
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+}
@@ -0,0 +1,99 @@
+package yoomoney
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/usecase"
+)
+
+// ProviderName ключ провайдера ЮMoney в платежах и конфигурации
+const ProviderName = "yoomoney"
+
+// Provider адаптер Client к usecase.PaymentProvider: оплата по ссылке QuickPay на кошелёк receiver,
+// статус по истории операций, выплаты переводом p2p. Возвратов API кошелька не поддерживает
+type Provider struct {
+	client   *Client
+	receiver string
+}
+
+func NewProvider(client *Client, receiver string) *Provider {
+	return &Provider{client: client, receiver: receiver}
+}
+
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+func (p *Provider) Capabilities() usecase.ProviderCapabilities {
+	return usecase.ProviderCapabilities{
+		PaymentLinks: true,
+		StatusLookup: true,
+		Payouts:      true,
+		Currency:     "RUB",
+	}
+}
+
+// CreatePaymentLink ссылка QuickPay; id платежа передаётся как label, по нему ищется операция и уведомление
+func (p *Provider) CreatePaymentLink(ctx context.Context, payment *dto.Payment, amount dto.Money) (string, error) {
+	return p.client.GenerateQuickPayURL(p.receiver, payment.ID, "AC", amount, payment.ID, payment.ID, payment.ID, "")
+}
+
+func (p *Provider) PaymentStatus(ctx context.Context, payment *dto.Payment) (usecase.ProviderStatus, error) {
+	status, err := p.client.CheckTransactionStatus(payment.ID)
+	switch status {
+	case "success":
+		return usecase.ProviderStatusSucceeded, nil
+	case "pending":
+		return usecase.ProviderStatusPending, nil
+	case "failed":
+		// Отказ провайдера это итог оплаты, а не ошибка запроса
+		return usecase.ProviderStatusFailed, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("unrecognized status: %s", status)
+	}
+	return "", err
+}
+
+// Payout перевод p2p в два шага: request-payment регистрирует перевод и выдаёт request_id,
+// process-payment по нему проводит перевод. Запрос, который ЮMoney не нашёл (истёк до проведения),
+// регистрируется заново: деньги по нему не списывались
+func (p *Provider) Payout(ctx context.Context, payment *dto.Payment, recipient string) (usecase.Payout, error) {
+	if payment.PayoutID != "" {
+		return usecase.Payout{Status: usecase.PayoutCompleted, RequestID: payment.PayoutRequestID, PaymentID: payment.PayoutID}, nil
+	}
+
+	if payment.PayoutRequestID != "" {
+		result, err := p.client.ProcessPayment(ctx, payment.PayoutRequestID)
+		switch {
+		case err == nil && result.Status == "success":
+			return usecase.Payout{Status: usecase.PayoutCompleted, RequestID: payment.PayoutRequestID, PaymentID: result.PaymentID}, nil
+		case err == nil:
+			return usecase.Payout{Status: usecase.PayoutInProgress, RequestID: payment.PayoutRequestID, NextRetry: result.NextRetry}, nil
+		case !errors.Is(err, ErrContractNotFound):
+			return usecase.Payout{}, payoutError(err)
+		}
+	}
+
+	request, err := p.client.RequestPayment(ctx, payment, recipient)
+	if err != nil {
+		return usecase.Payout{}, payoutError(err)
+	}
+	return usecase.Payout{Status: usecase.PayoutRequested, RequestID: request.RequestID}, nil
+}
+
+// payoutError помечает окончательный отказ в переводе как usecase.ErrPayoutRejected
+func payoutError(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Rejected() {
+		return fmt.Errorf("%w: %w", usecase.ErrPayoutRejected, err)
+	}
+	return err
+}
+
+func (p *Provider) Refund(ctx context.Context, payment *dto.Payment, idempotencyKey string) error {
+	return usecase.ErrNotSupported
+}
@@ -0,0 +1,55 @@
+package yoomoney
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/usecase"
+)
+
+func newMockProvider(responseBody string) *Provider {
+	client := &Client{
+		httpClient: createMockHTTPClient2(responseBody, http.StatusOK, nil),
+		authToken:  "mock-token",
+		clientID:   "mock-client-id",
+		baseURL:    "https://mock-yoomoney.ru",
+	}
+	return NewProvider(client, dto.CoreAccount)
+}
+
+func TestProvider_PaymentStatus(t *testing.T) {
+	cases := map[string]usecase.ProviderStatus{
+		"success":     usecase.ProviderStatusSucceeded,
+		"in_progress": usecase.ProviderStatusPending,
+		"refused":     usecase.ProviderStatusFailed,
+	}
+	for operationStatus, expected := range cases {
+		provider := newMockProvider(`{"operations": [{"status": "` + operationStatus + `"}]}`)
+		status, err := provider.PaymentStatus(context.Background(), &dto.Payment{ID: "payment-1"})
+		assert.NoError(t, err, operationStatus)
+		assert.Equal(t, expected, status, operationStatus)
+	}
+}
+
+func TestProvider_PaymentStatusUnpaid(t *testing.T) {
+	provider := newMockProvider(`{"operations": []}`)
+	status, err := provider.PaymentStatus(context.Background(), &dto.Payment{ID: "payment-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, usecase.ProviderStatusPending, status)
+}
+
+func TestProvider_PaymentStatusError(t *testing.T) {
+	provider := newMockProvider(`{"error": "illegal_param_label"}`)
+	_, err := provider.PaymentStatus(context.Background(), &dto.Payment{ID: "payment-1"})
+	assert.ErrorContains(t, err, "API error")
+}
+
+func TestProvider_RefundNotSupported(t *testing.T) {
+	provider := newMockProvider(`{}`)
+	assert.False(t, provider.Capabilities().Refunds)
+	assert.ErrorIs(t, provider.Refund(context.Background(), &dto.Payment{ID: "payment-1"}, "payment-1"), usecase.ErrNotSupported)
+}
@@ -1,12 +1,12 @@
 package yoomoney
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
@@ -23,10 +23,10 @@ type Client struct {
 
 func New(cfg *config.Config) *Client {
 	return &Client{
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient: &http.Client{Timeout: cfg.Yoomoney.Timeout},
 		authToken:  cfg.Yoomoney.Token,
 		clientID:   cfg.Yoomoney.ClientID,
-		baseURL:    "https://yoomoney.ru",
+		baseURL:    strings.TrimSuffix(cfg.Yoomoney.BaseURL, "/"),
 	}
 }
 
@@ -74,18 +74,19 @@ func (c *Client) CheckTransactionStatus(label string) (string, error) {
 	}
 
 	if parsed.Error != "" {
-		return "error", fmt.Errorf("API error: %s", parsed.Error)
+		return "error", newAPIError("operation-history", parsed.Error)
 	}
 
+	// Операция по метке появляется только после оплаты: ссылку ещё не оплатили
 	if len(parsed.Operations) == 0 {
-		return "error", fmt.Errorf("no transactions found for label: %s", label)
+		return "pending", nil
 	}
 
 	switch parsed.Operations[0].Status {
 	case "success":
 		return "success", nil
 	case "refused":
-		return "failed", fmt.Errorf("transaction was refused")
+		return "failed", fmt.Errorf("payment refused")
 	case "in_progress":
 		return "pending", nil
 	default:
@@ -93,29 +94,118 @@ func (c *Client) CheckTransactionStatus(label string) (string, error) {
 	}
 }
 
-// InitiateTransfer starts a payment request to a specific recipient.
-func (c *Client) InitiateTransfer(payment *dto.Payment, recipient string) (string, error) {
+// defaultNextRetry пауза перед повтором process-payment, если ЮMoney не прислал next_retry
+const defaultNextRetry = 5 * time.Second
+
+// PaymentRequest зарегистрированный у ЮMoney перевод, ещё не проведённый
+type PaymentRequest struct {
+	RequestID      string
+	ContractAmount dto.Money
+}
+
+// ProcessResult результат process-payment: Status success (PaymentID) или in_progress (NextRetry)
+type ProcessResult struct {
+	Status    string
+	PaymentID string
+	NextRetry time.Duration
+}
+
+// RequestPayment первый шаг перевода p2p: ЮMoney проверяет получателя и сумму и выдаёт request_id.
+// Деньги на этом шаге не списываются
+func (c *Client) RequestPayment(ctx context.Context, payment *dto.Payment, recipient string) (*PaymentRequest, error) {
 	if payment == nil {
-		return "", fmt.Errorf("payment details cannot be nil")
+		return nil, fmt.Errorf("payment information is required")
 	}
-	if payment.ToUserID == "" || payment.ID == "" || payment.Currency == "" || payment.Amount <= 0 {
-		return "", fmt.Errorf("invalid payment fields: %+v", payment)
+	if payment.ToUserID == "" || payment.ID == "" || payment.Amount.Currency == "" || !payment.Amount.IsPositive() {
+		return nil, fmt.Errorf("invalid payment fields: %+v", payment)
 	}
 
-	endpoint := fmt.Sprintf("%s/api/request-payment", c.baseURL)
-
 	payload := url.Values{}
 	payload.Set("pattern_id", "p2p")
 	payload.Set("to", recipient)
-	payload.Set("amount", strconv.FormatFloat(payment.Amount, 'f', 2, 64))
+	payload.Set("amount", payment.Amount.String())
 	payload.Set("comment", payment.ID)
 	payload.Set("message", payment.ID)
 	payload.Set("label", payment.ID)
-	payload.Set("currency", payment.Currency)
+	payload.Set("currency", payment.Amount.Currency)
+
+	var result struct {
+		Status         string      `json:"status"`
+		Error          string      `json:"error"`
+		RequestID      string      `json:"request_id"`
+		ContractAmount json.Number `json:"contract_amount"`
+	}
+	if err := c.call(ctx, "request-payment", payload, &result); err != nil {
+		return nil, err
+	}
+
+	switch result.Status {
+	case "success":
+	case "refused":
+		return nil, newAPIError("request-payment", result.Error)
+	default:
+		return nil, fmt.Errorf("request-payment: unexpected status: %s", result.Status)
+	}
+	if result.RequestID == "" {
+		return nil, fmt.Errorf("request-payment: response missing request_id")
+	}
 
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(payload.Encode()))
+	request := &PaymentRequest{RequestID: result.RequestID, ContractAmount: payment.Amount}
+	if result.ContractAmount != "" {
+		amount, err := dto.RoundMoney(result.ContractAmount.String(), "RUB")
+		if err != nil {
+			return nil, fmt.Errorf("request-payment: invalid contract_amount: %w", err)
+		}
+		request.ContractAmount = amount
+	}
+	return request, nil
+}
+
+// ProcessPayment второй шаг: проведение перевода requestID. Повтор с тем же request_id безопасен,
+// ЮMoney вернёт результат уже проведённого перевода. ext_auth_required возвращается ошибкой ErrExtAuthRequired
+func (c *Client) ProcessPayment(ctx context.Context, requestID string) (*ProcessResult, error) {
+	if requestID == "" {
+		return nil, fmt.Errorf("request_id is required")
+	}
+
+	payload := url.Values{}
+	payload.Set("request_id", requestID)
+	payload.Set("money_source", "wallet")
+
+	var result struct {
+		Status    string `json:"status"`
+		Error     string `json:"error"`
+		PaymentID string `json:"payment_id"`
+		// NextRetry рекомендуемая пауза в миллисекундах
+		NextRetry int64 `json:"next_retry"`
+	}
+	if err := c.call(ctx, "process-payment", payload, &result); err != nil {
+		return nil, err
+	}
+
+	switch result.Status {
+	case "success":
+		return &ProcessResult{Status: result.Status, PaymentID: result.PaymentID}, nil
+	case "in_progress":
+		nextRetry := time.Duration(result.NextRetry) * time.Millisecond
+		if nextRetry <= 0 {
+			nextRetry = defaultNextRetry
+		}
+		return &ProcessResult{Status: result.Status, NextRetry: nextRetry}, nil
+	case "ext_auth_required":
+		return nil, newAPIError("process-payment", "ext_auth_required")
+	case "refused":
+		return nil, newAPIError("process-payment", result.Error)
+	default:
+		return nil, fmt.Errorf("process-payment: unexpected status: %s", result.Status)
+	}
+}
+
+// call POST-запрос к методу API method с разбором JSON-ответа в out
+func (c *Client) call(ctx context.Context, method string, payload url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/"+method, strings.NewReader(payload.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("could not create request: %w", err)
+		return fmt.Errorf("%s: could not create request: %w", method, err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
@@ -123,53 +213,47 @@ func (c *Client) InitiateTransfer(payment *dto.Payment, recipient string) (strin
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("API call failed: %w", err)
+		return fmt.Errorf("%s: API call failed: %w", method, err)
 	}
 	defer resp.Body.Close()
 
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("response read error: %w", err)
+		return fmt.Errorf("%s: response read error: %w", method, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned %s: %s", resp.Status, string(raw))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(raw, &result); err != nil {
-		return "", fmt.Errorf("response parsing error: %w", err)
-	}
-
-	status, ok := result["status"].(string)
-	if !ok {
-		return "", fmt.Errorf("response missing 'status'")
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return newAPIError(method, "invalid_token")
+	case http.StatusForbidden:
+		return newAPIError(method, "insufficient_scope")
+	default:
+		return fmt.Errorf("%s: API returned %s: %s", method, resp.Status, string(raw))
 	}
 
-	switch status {
-	case "success":
-		return "success", nil
-	case "refused":
-		msg, _ := result["error"].(string)
-		return "failed", fmt.Errorf("transfer refused: %s", msg)
-	default:
-		return "error", fmt.Errorf("unexpected status: %s", status)
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("%s: response parsing error: %w", method, err)
 	}
+	return nil
 }
 
 // GenerateQuickPayURL constructs a quick payment URL with optional parameters.
-func (c *Client) GenerateQuickPayURL(receiver, target, paymentType string, amount float64, formComment, label, comment, redirectURL string) (string, error) {
-	if receiver == "" || amount <= 0 {
-		return "", fmt.Errorf("receiver and amount must be valid")
+func (c *Client) GenerateQuickPayURL(receiver, target, paymentType string, amount dto.Money, formComment, label, comment, redirectURL string) (string, error) {
+	if receiver == "" {
+		return "", fmt.Errorf("receiver is required")
+	}
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("amount must be positive")
 	}
 
-	endpoint := "https://yoomoney.ru/quickpay/confirm?"
+	endpoint := fmt.Sprintf("%s/quickpay/confirm?", c.baseURL)
 
 	params := url.Values{}
 	params.Set("receiver", receiver)
 	params.Set("quickpay-form", "shop")
 	params.Set("paymentType", paymentType)
-	params.Set("sum", strconv.FormatFloat(amount, 'f', 2, 64))
+	params.Set("sum", amount.String())
 	params.Set("targets", target)
 
 	if formComment != "" {
@@ -187,7 +271,7 @@ func (c *Client) GenerateQuickPayURL(receiver, target, paymentType string, amoun
 
 	fullURL := endpoint + params.Encode()
 
-	resp, err := http.Get(fullURL)
+	resp, err := c.httpClient.Get(fullURL)
 	if err != nil {
 		return "", fmt.Errorf("URL validation failed: %w", err)
 	}
@@ -2,6 +2,7 @@ package yoomoney
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -91,8 +92,8 @@ func TestCheckPaymentStatus_Error(t *testing.T) {
 	assert.Contains(t, err.Error(), "API error")
 }
 
-func TestCreateTransfer_Success(t *testing.T) {
-	mockResponse := `{"status": "success"}`
+func TestRequestPayment_Success(t *testing.T) {
+	mockResponse := `{"status": "success", "request_id": "request-1", "contract_amount": 100.00}`
 	mockClient := createMockHTTPClient2(mockResponse, http.StatusOK, nil)
 
 	client := &Client{
@@ -104,25 +105,25 @@ func TestCreateTransfer_Success(t *testing.T) {
 
 	payment := &dto.Payment{
 		ID:       "payment-id",
-		Amount:   100.0,
-		Currency: "RUB",
+		Amount:   dto.Money{Minor: 10000, Currency: "RUB"},
 		ToUserID: "recipient-id",
 	}
 
-	status, err := client.InitiateTransfer(payment, "receiver-id")
+	request, err := client.RequestPayment(context.Background(), payment, "receiver-id")
 	assert.NoError(t, err)
-	assert.Equal(t, "success", status)
+	assert.Equal(t, "request-1", request.RequestID)
+	assert.Equal(t, dto.Money{Minor: 10000, Currency: "RUB"}, request.ContractAmount)
 }
 
-func TestCreateTransfer_InvalidPayment(t *testing.T) {
+func TestRequestPayment_InvalidPayment(t *testing.T) {
 	client := &Client{}
-	_, err := client.InitiateTransfer(nil, "receiver-id")
+	_, err := client.RequestPayment(context.Background(), nil, "receiver-id")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "payment information is required")
 }
 
-func TestCreateTransfer_Failure(t *testing.T) {
-	mockResponse := `{"status": "refused", "error": "insufficient funds"}`
+func TestRequestPayment_Failure(t *testing.T) {
+	mockResponse := `{"status": "refused", "error": "not_enough_funds"}`
 	mockClient := createMockHTTPClient2(mockResponse, http.StatusOK, nil)
 
 	client := &Client{
@@ -134,15 +135,64 @@ func TestCreateTransfer_Failure(t *testing.T) {
 
 	payment := &dto.Payment{
 		ID:       "payment-id",
-		Amount:   100.0,
-		Currency: "RUB",
+		Amount:   dto.Money{Minor: 10000, Currency: "RUB"},
 		ToUserID: "recipient-id",
 	}
 
-	status, err := client.InitiateTransfer(payment, "receiver-id")
-	assert.Error(t, err)
-	assert.Equal(t, "failed", status)
-	assert.Contains(t, err.Error(), "insufficient funds")
+	_, err := client.RequestPayment(context.Background(), payment, "receiver-id")
+	assert.ErrorIs(t, err, ErrNotEnoughFunds)
+	assert.Contains(t, err.Error(), "not_enough_funds")
+}
+
+func TestProcessPayment(t *testing.T) {
+	cases := []struct {
+		name      string
+		response  string
+		status    string
+		paymentID string
+		nextRetry time.Duration
+		err       error
+	}{
+		{name: "success", response: `{"status": "success", "payment_id": "payment-1"}`, status: "success", paymentID: "payment-1"},
+		{name: "in progress", response: `{"status": "in_progress", "next_retry": 1500}`, status: "in_progress", nextRetry: 1500 * time.Millisecond},
+		{name: "in progress without hint", response: `{"status": "in_progress"}`, status: "in_progress", nextRetry: defaultNextRetry},
+		{name: "ext auth", response: `{"status": "ext_auth_required", "acs_uri": "https://example.com"}`, err: ErrExtAuthRequired},
+		{name: "contract not found", response: `{"status": "refused", "error": "contract_not_found"}`, err: ErrContractNotFound},
+		{name: "illegal param", response: `{"status": "refused", "error": "illegal_param_csc"}`, err: ErrIllegalParam},
+		{name: "unknown code", response: `{"status": "refused", "error": "brand_new_error"}`, err: ErrUnknownAPIError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &Client{httpClient: createMockHTTPClient2(tc.response, http.StatusOK, nil), baseURL: "https://mock-yoomoney.ru"}
+
+			result, err := client.ProcessPayment(context.Background(), "request-1")
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, result.Status)
+			assert.Equal(t, tc.paymentID, result.PaymentID)
+			assert.Equal(t, tc.nextRetry, result.NextRetry)
+		})
+	}
+}
+
+func TestClient_AuthorizationErrors(t *testing.T) {
+	client := &Client{httpClient: createMockHTTPClient2("", http.StatusUnauthorized, nil), baseURL: "https://mock-yoomoney.ru"}
+	_, err := client.ProcessPayment(context.Background(), "request-1")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	client = &Client{httpClient: createMockHTTPClient2("", http.StatusForbidden, nil), baseURL: "https://mock-yoomoney.ru"}
+	_, err = client.ProcessPayment(context.Background(), "request-1")
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+}
+
+func TestAPIError_Rejected(t *testing.T) {
+	assert.True(t, newAPIError("request-payment", "payee_not_found").Rejected())
+	assert.True(t, newAPIError("request-payment", "illegal_param_to").Rejected())
+	assert.False(t, newAPIError("request-payment", "not_enough_funds").Rejected())
+	assert.False(t, newAPIError("process-payment", "technical_error").Rejected())
 }
 
 func TestQuickPayment_Success(t *testing.T) {
@@ -155,7 +205,7 @@ func TestQuickPayment_Success(t *testing.T) {
 		baseURL:    "https://mock-yoomoney.ru",
 	}
 
-	url, err := client.GenerateQuickPayURL("receiver-id", "targets", "PC", 100.0, "comment", "label", "additional-comment", "https://success.url")
+	url, err := client.GenerateQuickPayURL("receiver-id", "targets", "PC", dto.Money{Minor: 10000, Currency: "RUB"}, "comment", "label", "additional-comment", "https://success.url")
 	assert.NoError(t, err)
 	assert.Contains(t, url, "receiver=receiver-id")
 	assert.Contains(t, url, "sum=100.00")
@@ -163,7 +213,7 @@ func TestQuickPayment_Success(t *testing.T) {
 
 func TestQuickPayment_InvalidInput(t *testing.T) {
 	client := &Client{}
-	_, err := client.GenerateQuickPayURL("", "targets", "PC", 0, "", "", "", "")
+	_, err := client.GenerateQuickPayURL("", "targets", "PC", dto.Money{}, "", "", "", "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "receiver is required")
 }
@@ -4,20 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Server   Server   `yaml:"server" env-prefix:"SERVER_"`
-	Postgres Postgres `yaml:"postgres" env-prefix:"POSTGRES_"`
-	Redis    Redis    `yaml:"redis" env-prefix:"REDIS_"`
-	Forex    Forex    `yaml:"forex" env-prefix:"FOREX_"`
-	Yoomoney Yoomoney `yaml:"yoomoney" env-prefix:"YOOMONEY_"`
+	Server    Server    `yaml:"server" env-prefix:"SERVER_"`
+	Postgres  Postgres  `yaml:"postgres" env-prefix:"POSTGRES_"`
+	Redis     Redis     `yaml:"redis" env-prefix:"REDIS_"`
+	Forex     Forex     `yaml:"forex" env-prefix:"FOREX_"`
+	Yoomoney  Yoomoney  `yaml:"yoomoney" env-prefix:"YOOMONEY_"`
+	Queue     Queue     `yaml:"queue" env-prefix:"QUEUE_"`
+	Daemon    Daemon    `yaml:"daemon" env-prefix:"DAEMON_"`
+	Outbox    Outbox    `yaml:"outbox" env-prefix:"OUTBOX_"`
+	Provider  Provider  `yaml:"provider" env-prefix:"PROVIDER_"`
+	Auth      Auth      `yaml:"auth" env-prefix:"AUTH_"`
+	WebSocket WebSocket `yaml:"websocket" env-prefix:"WEBSOCKET_"`
 }
 
 type Server struct {
 	Port int `yaml:"Port" env:"PORT"`
+	// HTTPPort порт HTTP-листенера рядом с gRPC (уведомления провайдеров)
+	HTTPPort int `yaml:"HTTPPort" env:"HTTP_PORT" env-default:"8081"`
+	// ShutdownTimeout сколько ждать завершения начатых запросов и платежей после SIGTERM
+	ShutdownTimeout time.Duration `yaml:"ShutdownTimeout" env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
+	// IdempotencyTimeout срок обработки запроса с ключом идемпотентности; ключ занят чуть дольше
+	IdempotencyTimeout time.Duration `yaml:"IdempotencyTimeout" env:"IDEMPOTENCY_TIMEOUT" env-default:"30s"`
 }
 
 type Postgres struct {
@@ -33,14 +46,176 @@ type Redis struct {
 	URL string `yaml:"URL" env:"URL"`
 }
 
+// Forex курсы валют. Источники Sources опрашиваются по порядку: fastforex, cbr (ЦБ РФ), static (файл
+// StaticFile); источник с FailureThreshold ошибками подряд пропускается на Cooldown. Курс моложе RateTTL
+// отдаётся из кеша (память + Redis), более старый отдаётся с фоновым обновлением, пока ему не больше
+// MaxStale. Курсы между Currencies загружаются пачкой при старте и каждые RateTTL/2. Котировка суммы
+// платежа в валюте провайдера фиксируется за ссылкой на оплату на QuoteTTL. Курсы записываются в историю
+// каждые HistoryInterval; пропущенный день восполняется курсом записанного дня не дальше HistoryMaxGap
 type Forex struct {
-	Key string `yaml:"Key" env:"KEY"`
+	Sources          []string      `yaml:"Sources" env:"SOURCES" env-default:"fastforex,cbr"`
+	CBRURL           string        `yaml:"CBRURL" env:"CBR_URL" env-default:"https://www.cbr.ru/scripts/XML_daily.asp"`
+	StaticFile       string        `yaml:"StaticFile" env:"STATIC_FILE"`
+	FailureThreshold int           `yaml:"FailureThreshold" env:"FAILURE_THRESHOLD" env-default:"3"`
+	Cooldown         time.Duration `yaml:"Cooldown" env:"COOLDOWN" env-default:"1m"`
+
+	Key        string        `yaml:"Key" env:"KEY"`
+	BaseURL    string        `yaml:"BaseURL" env:"BASE_URL" env-default:"https://api.fastforex.io"`
+	Timeout    time.Duration `yaml:"Timeout" env:"TIMEOUT" env-default:"10s"`
+	RateTTL    time.Duration `yaml:"RateTTL" env:"RATE_TTL" env-default:"10m"`
+	MaxStale   time.Duration `yaml:"MaxStale" env:"MAX_STALE" env-default:"24h"`
+	Currencies []string      `yaml:"Currencies" env:"CURRENCIES" env-default:"RUB,USD,EUR"`
+	QuoteTTL   time.Duration `yaml:"QuoteTTL" env:"QUOTE_TTL" env-default:"15m"`
+
+	HistoryInterval time.Duration `yaml:"HistoryInterval" env:"HISTORY_INTERVAL" env-default:"1h"`
+	HistoryMaxGap   time.Duration `yaml:"HistoryMaxGap" env:"HISTORY_MAX_GAP" env-default:"168h"`
 }
 
 type Yoomoney struct {
 	Token    string `yaml:"Token" env:"TOKEN"`
 	ClientID string `yaml:"ClientID" env:"CLIENT_ID"`
 	Receiver int    `yaml:"Receiver" env:"RECEIVER"`
+	// NotificationSecret секрет HTTP-уведомлений из настроек кошелька; пустой отключает приём уведомлений
+	NotificationSecret string `yaml:"NotificationSecret" env:"NOTIFICATION_SECRET"`
+	NotificationPath   string `yaml:"NotificationPath" env:"NOTIFICATION_PATH" env-default:"/yoomoney/notifications"`
+	// BaseURL адрес API; для локальной разработки можно указать фейковый сервер (app/fakeyoomoney)
+	BaseURL string        `yaml:"BaseURL" env:"BASE_URL" env-default:"https://yoomoney.ru"`
+	Timeout time.Duration `yaml:"Timeout" env:"TIMEOUT" env-default:"10s"`
+}
+
+// Auth проверка bearer-токенов gRPC-запросов сервисом авторизации (ValidateToken).
+// Подтверждённый токен кешируется на CacheTTL, но не дольше срока его действия.
+// Rules задаёт для каждого RPC, кто может его вызвать: any, participant (плательщик или получатель),
+// payer, admin. Пользователю с ролью AdminRole доступны все RPC с правилом, с ролью ServiceRole
+// только ServiceMethods
+type Auth struct {
+	Enabled  bool          `yaml:"Enabled" env:"ENABLED" env-default:"true"`
+	CacheTTL time.Duration `yaml:"CacheTTL" env:"CACHE_TTL" env-default:"30s"`
+
+	Rules          map[string]string `yaml:"Rules" env:"RULES" env-default:"CreatePayment:payer,GetPayment:participant,GetPaymentByID:participant,RefundPayment:payer,GetPaymentHistory:payer,GetPaymentLink:payer,GetActivePayments:participant,GetExchangeRate:any,WatchPayment:participant,ListDeadLetters:admin,RequeueDeadLetter:admin"`
+	AdminRole      string            `yaml:"AdminRole" env:"ADMIN_ROLE" env-default:"admin"`
+	ServiceRole    string            `yaml:"ServiceRole" env:"SERVICE_ROLE" env-default:"service"`
+	ServiceMethods []string          `yaml:"ServiceMethods" env:"SERVICE_METHODS" env-default:"GetPayment,GetPaymentByID,GetExchangeRate"`
+
+	Client AuthClient `yaml:"Client" env-prefix:"CLIENT_"`
+	Users  AuthUsers  `yaml:"Users" env-prefix:"USERS_"`
+}
+
+// AuthUsers кеш получателей выплат из сервиса авторизации в Redis: данные свежи TTL, отсутствие
+// пользователя помнится NegativeTTL, при недоступном сервисе данные отдаются, пока им не больше MaxStale.
+// Id пользователей, опубликованные в канал InvalidationChannel, удаляются из кеша
+type AuthUsers struct {
+	TTL                 time.Duration `yaml:"TTL" env:"TTL" env-default:"10m"`
+	NegativeTTL         time.Duration `yaml:"NegativeTTL" env:"NEGATIVE_TTL" env-default:"1m"`
+	MaxStale            time.Duration `yaml:"MaxStale" env:"MAX_STALE" env-default:"24h"`
+	InvalidationChannel string        `yaml:"InvalidationChannel" env:"INVALIDATION_CHANNEL" env-default:"auth:users:invalidate"`
+}
+
+// AuthClient подключение к сервису авторизации. TLS включает проверку сертификата сервера по CAFile
+// (без него по системным корневым сертификатам), CertFile и KeyFile добавляют клиентский сертификат (mTLS).
+// Вызов вместе с повторами ограничен Timeout; ответ UNAVAILABLE повторяется до MaxAttempts раз
+// с задержкой от InitialBackoff до MaxBackoff. После BreakerThreshold сбоев подряд вызовы
+// отклоняются без обращения к сервису в течение BreakerCooldown
+type AuthClient struct {
+	Address    string `yaml:"Address" env:"ADDRESS" env-default:"localhost:8888"`
+	TLS        bool   `yaml:"TLS" env:"TLS" env-default:"false"`
+	CAFile     string `yaml:"CAFile" env:"CA_FILE"`
+	CertFile   string `yaml:"CertFile" env:"CERT_FILE"`
+	KeyFile    string `yaml:"KeyFile" env:"KEY_FILE"`
+	ServerName string `yaml:"ServerName" env:"SERVER_NAME"`
+
+	Timeout        time.Duration `yaml:"Timeout" env:"TIMEOUT" env-default:"3s"`
+	MaxAttempts    int           `yaml:"MaxAttempts" env:"MAX_ATTEMPTS" env-default:"3"`
+	InitialBackoff time.Duration `yaml:"InitialBackoff" env:"INITIAL_BACKOFF" env-default:"100ms"`
+	MaxBackoff     time.Duration `yaml:"MaxBackoff" env:"MAX_BACKOFF" env-default:"1s"`
+
+	// KeepaliveTime не меньше MinTime сервера (в grpc-go 5m), иначе сервер разрывает соединение
+	KeepaliveTime    time.Duration `yaml:"KeepaliveTime" env:"KEEPALIVE_TIME" env-default:"5m"`
+	KeepaliveTimeout time.Duration `yaml:"KeepaliveTimeout" env:"KEEPALIVE_TIMEOUT" env-default:"20s"`
+
+	BreakerThreshold int           `yaml:"BreakerThreshold" env:"BREAKER_THRESHOLD" env-default:"5"`
+	BreakerCooldown  time.Duration `yaml:"BreakerCooldown" env:"BREAKER_COOLDOWN" env-default:"30s"`
+}
+
+// Provider платёжные провайдеры: Enabled включённые ("yoomoney"), Default для платежей без явного провайдера
+type Provider struct {
+	Enabled []string `yaml:"Enabled" env:"ENABLED" env-default:"yoomoney"`
+	Default string   `yaml:"Default" env:"DEFAULT" env-default:"yoomoney"`
+}
+
+// Queue очередь платежей демона: "postgres" (по умолчанию) или "memory".
+// MaxDeliveries сколько раз подряд платёж выдаётся без ответа обработчика, прежде чем уйти в dead-letter
+type Queue struct {
+	Driver            string        `yaml:"Driver" env:"DRIVER" env-default:"postgres"`
+	VisibilityTimeout time.Duration `yaml:"VisibilityTimeout" env:"VISIBILITY_TIMEOUT" env-default:"1m"`
+	MaxDeliveries     int           `yaml:"MaxDeliveries" env:"MAX_DELIVERIES" env-default:"10"`
+}
+
+// Daemon повторы обработки платежей: экспоненциальная задержка с джиттером
+// между BaseBackoff и MaxBackoff, после MaxAttempts попыток или MaxAge платёж уходит в dead-letter.
+// Неоплаченная ссылка попыток не расходует и ждёт оплаты до MaxAge.
+// Workers воркеров читают общую очередь, ProviderLimits ограничивает одновременные вызовы
+// внешних сервисов ("yoomoney", "auth"), например "yoomoney:4,auth:8".
+// LockTTL аренда платежа воркером: продлевается, пока платёж обрабатывается, и истекает сама,
+// если реплика упала, не сняв её
+type Daemon struct {
+	Workers        int            `yaml:"Workers" env:"WORKERS" env-default:"4"`
+	ProviderLimits map[string]int `yaml:"ProviderLimits" env:"PROVIDER_LIMITS" env-default:"yoomoney:4,auth:8"`
+	MaxAttempts    int            `yaml:"MaxAttempts" env:"MAX_ATTEMPTS" env-default:"50"`
+	MaxAge         time.Duration  `yaml:"MaxAge" env:"MAX_AGE" env-default:"72h"`
+	BaseBackoff    time.Duration  `yaml:"BaseBackoff" env:"BASE_BACKOFF" env-default:"5s"`
+	MaxBackoff     time.Duration  `yaml:"MaxBackoff" env:"MAX_BACKOFF" env-default:"10m"`
+	PollInterval   time.Duration  `yaml:"PollInterval" env:"POLL_INTERVAL" env-default:"1s"`
+	LockTTL        time.Duration  `yaml:"LockTTL" env:"LOCK_TTL" env-default:"1m"`
+	Leader         Leader         `yaml:"Leader" env-prefix:"LEADER_"`
+}
+
+// Leader выборы реплики, которая запускает демон: advisory lock LockKey в Postgres.
+// Не лидеры пытаются взять блокировку каждые RetryInterval, лидер проверяет своё соединение
+// каждые CheckInterval. Enabled=false подходит только для одной реплики
+type Leader struct {
+	Enabled       bool          `yaml:"Enabled" env:"ENABLED" env-default:"true"`
+	LockKey       int64         `yaml:"LockKey" env:"LOCK_KEY" env-default:"7310425"`
+	RetryInterval time.Duration `yaml:"RetryInterval" env:"RETRY_INTERVAL" env-default:"5s"`
+	CheckInterval time.Duration `yaml:"CheckInterval" env:"CHECK_INTERVAL" env-default:"2s"`
+}
+
+// Outbox публикация событий payment_events: Sinks перечисляет получателей ("redis", "pubsub", "webhook").
+// Получатель "pubsub" передаёт события в PubSubChannel для подписок WatchPayment на всех репликах
+// и запускается всегда; если его нет в Sinks, он добавляется последним.
+// WatchBuffer сколько событий ждёт медленного подписчика, прежде чем он дочитает их из базы.
+// Для каждого получателя relay работает только на одной реплике: advisory lock LockKey+i,
+// где i позиция получателя в Sinks
+type Outbox struct {
+	Sinks          []string      `yaml:"Sinks" env:"SINKS" env-default:"redis,pubsub"`
+	BatchSize      int           `yaml:"BatchSize" env:"BATCH_SIZE" env-default:"100"`
+	PollInterval   time.Duration `yaml:"PollInterval" env:"POLL_INTERVAL" env-default:"1s"`
+	LockKey        int64         `yaml:"LockKey" env:"LOCK_KEY" env-default:"7310500"`
+	RedisStream    string        `yaml:"RedisStream" env:"REDIS_STREAM" env-default:"payment_events"`
+	RedisMaxLen    int64         `yaml:"RedisMaxLen" env:"REDIS_MAX_LEN" env-default:"100000"`
+	PubSubChannel  string        `yaml:"PubSubChannel" env:"PUBSUB_CHANNEL" env-default:"payment_events:live"`
+	WatchBuffer    int           `yaml:"WatchBuffer" env:"WATCH_BUFFER" env-default:"16"`
+	WebhookURL     string        `yaml:"WebhookURL" env:"WEBHOOK_URL"`
+	WebhookSecret  string        `yaml:"WebhookSecret" env:"WEBHOOK_SECRET"`
+	WebhookTimeout time.Duration `yaml:"WebhookTimeout" env:"WEBHOOK_TIMEOUT" env-default:"5s"`
+}
+
+// WebSocket шлюз статусов платежей для браузера на HTTP-листенере (Server.HTTPPort).
+// Сервер пингует клиента каждые PingInterval и закрывает соединение без ответа за PongTimeout
+// или если запись не прошла за WriteTimeout; SendBuffer сообщений ждут записи, MaxSubscriptions
+// платежей на соединение. AllowedOrigins страницы других доменов, которым разрешено подключение;
+// без них принимаются только запросы со страниц того же хоста. AllowQueryToken разрешает токен
+// в параметре access_token для клиентов без подпротоколов: URL с токеном попадает в журналы
+type WebSocket struct {
+	Enabled          bool          `yaml:"Enabled" env:"ENABLED" env-default:"true"`
+	Path             string        `yaml:"Path" env:"PATH" env-default:"/ws/payments"`
+	PingInterval     time.Duration `yaml:"PingInterval" env:"PING_INTERVAL" env-default:"25s"`
+	PongTimeout      time.Duration `yaml:"PongTimeout" env:"PONG_TIMEOUT" env-default:"60s"`
+	WriteTimeout     time.Duration `yaml:"WriteTimeout" env:"WRITE_TIMEOUT" env-default:"10s"`
+	SendBuffer       int           `yaml:"SendBuffer" env:"SEND_BUFFER" env-default:"32"`
+	MaxSubscriptions int           `yaml:"MaxSubscriptions" env:"MAX_SUBSCRIPTIONS" env-default:"20"`
+	AllowedOrigins   []string      `yaml:"AllowedOrigins" env:"ALLOWED_ORIGINS"`
+	AllowQueryToken  bool          `yaml:"AllowQueryToken" env:"ALLOW_QUERY_TOKEN" env-default:"false"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +27,11 @@ func TestLoadConfig_FromEnvironment(t *testing.T) {
 	assert.NotNil(t, config)
 
 	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, 30*time.Second, config.Server.ShutdownTimeout)
+	assert.Equal(t, 8081, config.Server.HTTPPort)
+	assert.Equal(t, "/yoomoney/notifications", config.Yoomoney.NotificationPath)
+	assert.Equal(t, "https://yoomoney.ru", config.Yoomoney.BaseURL)
+	assert.Equal(t, 10*time.Second, config.Yoomoney.Timeout)
 	assert.Equal(t, "localhost", config.Postgres.Host)
 	assert.Equal(t, 5432, config.Postgres.Port)
 	assert.Equal(t, "disable", config.Postgres.SSLMode)
@@ -34,9 +40,60 @@ func TestLoadConfig_FromEnvironment(t *testing.T) {
 	assert.Equal(t, "testpassword", config.Postgres.Password)
 	assert.Equal(t, "redis://localhost:6379", config.Redis.URL)
 	assert.Equal(t, "forexapikey", config.Forex.Key)
+	assert.Equal(t, "https://api.fastforex.io", config.Forex.BaseURL)
+	assert.Equal(t, 10*time.Second, config.Forex.Timeout)
+	assert.Equal(t, 10*time.Minute, config.Forex.RateTTL)
+	assert.Equal(t, 24*time.Hour, config.Forex.MaxStale)
+	assert.Equal(t, []string{"RUB", "USD", "EUR"}, config.Forex.Currencies)
+	assert.Equal(t, []string{"fastforex", "cbr"}, config.Forex.Sources)
+	assert.Equal(t, "https://www.cbr.ru/scripts/XML_daily.asp", config.Forex.CBRURL)
+	assert.Equal(t, 3, config.Forex.FailureThreshold)
+	assert.Equal(t, time.Minute, config.Forex.Cooldown)
+	assert.Equal(t, 15*time.Minute, config.Forex.QuoteTTL)
+	assert.Equal(t, time.Hour, config.Forex.HistoryInterval)
+	assert.Equal(t, 7*24*time.Hour, config.Forex.HistoryMaxGap)
 	assert.Equal(t, "yoomoneytoken", config.Yoomoney.Token)
 	assert.Equal(t, "yoomoneyclientid", config.Yoomoney.ClientID)
 	assert.Equal(t, 12345, config.Yoomoney.Receiver)
+	assert.Equal(t, "postgres", config.Queue.Driver)
+	assert.Equal(t, time.Minute, config.Queue.VisibilityTimeout)
+	assert.Equal(t, 4, config.Daemon.Workers)
+	assert.Equal(t, map[string]int{"yoomoney": 4, "auth": 8}, config.Daemon.ProviderLimits)
+	assert.Equal(t, time.Minute, config.Daemon.LockTTL)
+	assert.True(t, config.Daemon.Leader.Enabled)
+	assert.Equal(t, int64(7310425), config.Daemon.Leader.LockKey)
+	assert.Equal(t, 5*time.Second, config.Daemon.Leader.RetryInterval)
+	assert.Equal(t, 2*time.Second, config.Daemon.Leader.CheckInterval)
+	assert.Equal(t, []string{"redis", "pubsub"}, config.Outbox.Sinks)
+	assert.Equal(t, []string{"yoomoney"}, config.Provider.Enabled)
+	assert.Equal(t, "yoomoney", config.Provider.Default)
+	assert.Equal(t, 100, config.Outbox.BatchSize)
+	assert.Equal(t, "payment_events", config.Outbox.RedisStream)
+	assert.Equal(t, 5*time.Second, config.Outbox.WebhookTimeout)
+	assert.True(t, config.Auth.Enabled)
+	assert.Equal(t, 30*time.Second, config.Auth.CacheTTL)
+	assert.Equal(t, "payer", config.Auth.Rules["RefundPayment"])
+	assert.Equal(t, "participant", config.Auth.Rules["GetPaymentByID"])
+	assert.Equal(t, "admin", config.Auth.AdminRole)
+	assert.Equal(t, []string{"GetPayment", "GetPaymentByID", "GetExchangeRate"}, config.Auth.ServiceMethods)
+	assert.Equal(t, "localhost:8888", config.Auth.Client.Address)
+	assert.False(t, config.Auth.Client.TLS)
+	assert.Equal(t, 3*time.Second, config.Auth.Client.Timeout)
+	assert.Equal(t, 3, config.Auth.Client.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, config.Auth.Client.InitialBackoff)
+	assert.Equal(t, 5*time.Minute, config.Auth.Client.KeepaliveTime)
+	assert.Equal(t, 5, config.Auth.Client.BreakerThreshold)
+	assert.Equal(t, 30*time.Second, config.Auth.Client.BreakerCooldown)
+	assert.Equal(t, 10*time.Minute, config.Auth.Users.TTL)
+	assert.Equal(t, time.Minute, config.Auth.Users.NegativeTTL)
+	assert.Equal(t, 24*time.Hour, config.Auth.Users.MaxStale)
+	assert.Equal(t, "auth:users:invalidate", config.Auth.Users.InvalidationChannel)
+	assert.True(t, config.WebSocket.Enabled)
+	assert.Equal(t, "/ws/payments", config.WebSocket.Path)
+	assert.Equal(t, 25*time.Second, config.WebSocket.PingInterval)
+	assert.Equal(t, 60*time.Second, config.WebSocket.PongTimeout)
+	assert.Equal(t, 32, config.WebSocket.SendBuffer)
+	assert.Empty(t, config.WebSocket.AllowedOrigins)
 }
 
 func TestLoadConfig_InvalidFile(t *testing.T) {
@@ -0,0 +1,19 @@
+package dto
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeadLetterNotFound платежа нет в dead-letter
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter платёж, снятый с обработки демоном после исчерпания попыток
+type DeadLetter struct {
+	PaymentID  string    `json:"payment_id" db:"payment_id"`
+	Payment    Payment   `json:"payment" db:"payload"`
+	Attempts   int       `json:"attempts" db:"attempts"`
+	LastError  string    `json:"last_error" db:"last_error"`
+	EnqueuedAt time.Time `json:"enqueued_at" db:"enqueued_at"`
+	DeadAt     time.Time `json:"dead_at" db:"dead_at"`
+}
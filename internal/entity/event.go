@@ -0,0 +1,14 @@
+package dto
+
+import "time"
+
+// PaymentEvent событие outbox о смене статуса платежа; для созданного платежа From пустой
+type PaymentEvent struct {
+	ID        int64         `json:"id" db:"id"`
+	PaymentID string        `json:"payment_id" db:"payment_id"`
+	From      PaymentStatus `json:"from_status,omitempty" db:"from_status"`
+	To        PaymentStatus `json:"to_status" db:"to_status"`
+	Reason    string        `json:"reason" db:"reason"`
+	Amount    Money         `json:"amount" db:"amount"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdempotencyKeyLost резервация ключа истекла и ключ перезанят другим запросом
+var ErrIdempotencyKeyLost = errors.New("idempotency key reservation lost")
+
+// IdempotencyRecord сохранённый результат запроса с ключом идемпотентности.
+// Subject пользователь, выполнивший запрос (пустой без аутентификации); ключи разных пользователей
+// не пересекаются. Response пустой, пока исходный запрос ещё выполняется.
+type IdempotencyRecord struct {
+	Key         string    `json:"key" db:"key"`
+	Method      string    `json:"method" db:"method"`
+	Subject     string    `json:"subject" db:"subject"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	Response    []byte    `json:"response" db:"response"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,191 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidAmount   = errors.New("invalid amount")
+)
+
+// currencyExponents количество знаков после запятой для валют ISO-4217
+var currencyExponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"KZT": 2,
+	"BYN": 2,
+	"UAH": 2,
+	"TRY": 2,
+	"AED": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+// CurrencyExponent возвращает количество минимальных единиц валюты в виде степени 10
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Money точная денежная сумма в минимальных единицах валюты (копейки, центы)
+type Money struct {
+	Minor    int64  `json:"minor"`
+	Currency string `json:"currency"`
+}
+
+// NewMoney создание суммы из минимальных единиц валюты
+func NewMoney(minor int64, currency string) (Money, error) {
+	if _, err := CurrencyExponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// ParseMoney разбирает десятичную строку без потери точности.
+// Лишние знаки после запятой допускаются только если они нулевые.
+func ParseMoney(amount, currency string) (Money, error) {
+	r, exp, err := parseDecimal(amount, currency)
+	if err != nil {
+		return Money{}, err
+	}
+	minor := new(big.Rat).Mul(r, scale(exp))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places for %s", ErrInvalidAmount, amount, exp, currency)
+	}
+	return fromInt(minor.Num(), currency, amount)
+}
+
+// RoundMoney разбирает десятичную строку и округляет её до точности валюты
+// (половина округляется от нуля). Используется для результатов конвертации.
+func RoundMoney(amount, currency string) (Money, error) {
+	r, exp, err := parseDecimal(amount, currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return roundRat(new(big.Rat).Mul(r, scale(exp)), currency, amount)
+}
+
+// MoneyFromUnitsNanos собирает сумму из целой части и миллиардных долей
+func MoneyFromUnitsNanos(units int64, nanos int32, currency string) (Money, error) {
+	if nanos <= -1e9 || nanos >= 1e9 || (units > 0 && nanos < 0) || (units < 0 && nanos > 0) {
+		return Money{}, fmt.Errorf("%w: units=%d nanos=%d", ErrInvalidAmount, units, nanos)
+	}
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	r := new(big.Rat).SetFrac(big.NewInt(int64(nanos)), big.NewInt(1e9))
+	r.Add(r, new(big.Rat).SetInt64(units))
+	minor := r.Mul(r, scale(exp))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("%w: nanos=%d exceed %d decimal places for %s", ErrInvalidAmount, nanos, exp, currency)
+	}
+	return fromInt(minor.Num(), currency, fmt.Sprintf("%d.%09d", units, nanos))
+}
+
+// UnitsNanos раскладывает сумму на целую часть и миллиардные доли
+func (m Money) UnitsNanos() (int64, int32) {
+	exp := currencyExponents[m.Currency]
+	div := int64(1)
+	for i := 0; i < exp; i++ {
+		div *= 10
+	}
+	units := m.Minor / div
+	nanos := (m.Minor % div) * (1e9 / div)
+	return units, int32(nanos)
+}
+
+// IsPositive сумма больше нуля
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// IsZero пустая сумма
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// String десятичное представление суммы, например "1234567.89"
+func (m Money) String() string {
+	exp := currencyExponents[m.Currency]
+	neg := m.Minor < 0
+	digits := new(big.Int).Abs(big.NewInt(m.Minor)).String()
+	if exp > 0 {
+		if len(digits) <= exp {
+			digits = strings.Repeat("0", exp-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+	}
+	if neg {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Rat сумма в виде рационального числа в основных единицах валюты
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Minor), scale(currencyExponents[m.Currency]).Num())
+}
+
+// Convert переводит сумму в другую валюту по курсу, округляя до точности целевой валюты
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	minor := new(big.Rat).Mul(m.Rat(), rate)
+	minor.Mul(minor, scale(exp))
+	return roundRat(minor, currency, m.String())
+}
+
+func parseDecimal(amount, currency string) (*big.Rat, int, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return nil, 0, err
+	}
+	amount = strings.TrimSpace(amount)
+	if amount == "" || strings.Contains(amount, "/") {
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	return r, exp, nil
+}
+
+func roundRat(minor *big.Rat, currency, source string) (Money, error) {
+	num := new(big.Int).Abs(minor.Num())
+	q, rem := new(big.Int).QuoRem(num, minor.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(minor.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if minor.Sign() < 0 {
+		q.Neg(q)
+	}
+	return fromInt(q, currency, source)
+}
+
+func fromInt(minor *big.Int, currency, source string) (Money, error) {
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %q overflows", ErrInvalidAmount, source)
+	}
+	return Money{Minor: minor.Int64(), Currency: currency}, nil
+}
+
+func scale(exp int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+}
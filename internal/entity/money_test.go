@@ -0,0 +1,135 @@
+package dto
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney_RoundTrip(t *testing.T) {
+	cases := []struct {
+		amount   string
+		currency string
+		minor    int64
+		want     string
+	}{
+		{"1234567.89", "RUB", 123456789, "1234567.89"},
+		{"0.01", "USD", 1, "0.01"},
+		{"0.1", "EUR", 10, "0.10"},
+		{"92233720368547758.07", "RUB", 9223372036854775807, "92233720368547758.07"},
+		{"1234567.8900", "RUB", 123456789, "1234567.89"},
+		{"-50", "USD", -5000, "-50.00"},
+		{"1500", "JPY", 1500, "1500"},
+		{"12.345", "KWD", 12345, "12.345"},
+	}
+
+	for _, tc := range cases {
+		money, err := ParseMoney(tc.amount, tc.currency)
+		assert.NoError(t, err, tc.amount)
+		assert.Equal(t, tc.minor, money.Minor, tc.amount)
+		assert.Equal(t, tc.want, money.String(), tc.amount)
+
+		again, err := ParseMoney(money.String(), money.Currency)
+		assert.NoError(t, err)
+		assert.Equal(t, money, again)
+	}
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	_, err := ParseMoney("10.001", "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = ParseMoney("1.5", "JPY")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = ParseMoney("abc", "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = ParseMoney("1/3", "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = ParseMoney("92233720368547758.08", "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = ParseMoney("10", "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestRoundMoney(t *testing.T) {
+	money, err := RoundMoney("7612.345", "RUB")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(761235), money.Minor)
+
+	money, err = RoundMoney("7612.3449999", "RUB")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(761234), money.Minor)
+
+	money, err = RoundMoney("-0.005", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), money.Minor)
+
+	money, err = RoundMoney("7.6e3", "RUB")
+	assert.NoError(t, err)
+	assert.Equal(t, "7600.00", money.String())
+}
+
+func TestMoney_UnitsNanosRoundTrip(t *testing.T) {
+	cases := []Money{
+		{Minor: 123456789, Currency: "RUB"},
+		{Minor: 1, Currency: "USD"},
+		{Minor: -5001, Currency: "EUR"},
+		{Minor: 1500, Currency: "JPY"},
+		{Minor: 12345, Currency: "KWD"},
+		{Minor: 9223372036854775807, Currency: "RUB"},
+	}
+
+	for _, money := range cases {
+		units, nanos := money.UnitsNanos()
+		again, err := MoneyFromUnitsNanos(units, nanos, money.Currency)
+		assert.NoError(t, err)
+		assert.Equal(t, money, again)
+	}
+
+	units, nanos := Money{Minor: 123456789, Currency: "RUB"}.UnitsNanos()
+	assert.Equal(t, int64(1234567), units)
+	assert.Equal(t, int32(890000000), nanos)
+}
+
+func TestMoneyFromUnitsNanos_Invalid(t *testing.T) {
+	_, err := MoneyFromUnitsNanos(10, 1, "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = MoneyFromUnitsNanos(1, -10000000, "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = MoneyFromUnitsNanos(1, 1e9, "RUB")
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = MoneyFromUnitsNanos(1, 0, "")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	payment := Payment{ID: "payment-id", Amount: Money{Minor: 123456789, Currency: "RUB"}}
+
+	data, err := json.Marshal(payment)
+	assert.NoError(t, err)
+
+	var decoded Payment
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, payment.Amount, decoded.Amount)
+}
+
+func TestMoney_Convert(t *testing.T) {
+	usd := Money{Minor: 123456789, Currency: "USD"}
+	rate, _ := new(big.Rat).SetString("92.5134")
+
+	rub, err := usd.Convert(rate, "RUB")
+	assert.NoError(t, err)
+	assert.Equal(t, "114214073.03", rub.String())
+
+	_, err = usd.Convert(rate, "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
@@ -1,6 +1,17 @@
 package dto
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrPaymentLocked платёж уже обрабатывается другим воркером или репликой
+	ErrPaymentLocked = errors.New("payment is locked by another worker")
+	// ErrPaymentLeaseLost аренду платежа перехватил другой воркер или её не удалось продлить
+	ErrPaymentLeaseLost = errors.New("payment lease lost")
+)
 
 type PaymentStatus string
 
@@ -17,14 +28,20 @@ type Payment struct {
 	ID         string        `json:"id" db:"id"`
 	FromUserID string        `json:"user_from_id" db:"from_user_id"`
 	ToUserID   string        `json:"user_to_id" db:"to_user_id"`
-	Amount     float64       `json:"amount" db:"amount"`
-	Currency   string        `json:"currency" db:"currency"`
+	Amount     Money         `json:"amount" db:"amount"`
 	Status     PaymentStatus `json:"status" db:"status"`
-	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time     `json:"updated_at" db:"updated_at"`
+	// Provider эквайер, через который платёж оплачивается и выплачивается
+	Provider string `json:"provider" db:"provider"`
+	// PayoutRequestID запрос выплаты получателю у провайдера, PayoutID проведённая выплата;
+	// сохраняются после каждого шага, чтобы продолжить выплату после перезапуска без двойного перевода
+	PayoutRequestID string `json:"payout_request_id,omitempty" db:"payout_request_id"`
+	PayoutID        string `json:"payout_id,omitempty" db:"payout_id"`
+	// Quote котировка, по которой выставлена ссылка на оплату в валюте провайдера
+	Quote     *FXQuote  `json:"quote,omitempty"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type PaymentDetails struct {
-	Amount   float64 `json:"amount" db:"amount"`
-	Currency string  `json:"currency" db:"currency"`
+	Amount Money `json:"amount" db:"amount"`
 }
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"math/big"
 	"testing"
 	"time"
 
@@ -13,8 +14,7 @@ func TestPaymentInitialization(t *testing.T) {
 		ID:         "payment-id",
 		FromUserID: "user1",
 		ToUserID:   "user2",
-		Amount:     100.50,
-		Currency:   "RUB",
+		Amount:     Money{Minor: 10050, Currency: "RUB"},
 		Status:     StatusPending,
 		CreatedAt:  now,
 		UpdatedAt:  now,
@@ -23,8 +23,8 @@ func TestPaymentInitialization(t *testing.T) {
 	assert.Equal(t, "payment-id", payment.ID)
 	assert.Equal(t, "user1", payment.FromUserID)
 	assert.Equal(t, "user2", payment.ToUserID)
-	assert.Equal(t, 100.50, payment.Amount)
-	assert.Equal(t, "RUB", payment.Currency)
+	assert.Equal(t, "100.50", payment.Amount.String())
+	assert.Equal(t, "RUB", payment.Amount.Currency)
 	assert.Equal(t, StatusPending, payment.Status)
 	assert.Equal(t, now, payment.CreatedAt)
 	assert.Equal(t, now, payment.UpdatedAt)
@@ -47,8 +47,7 @@ func TestPaymentStatusTransitions(t *testing.T) {
 		ID:         "payment-id",
 		FromUserID: "user1",
 		ToUserID:   "user2",
-		Amount:     150.0,
-		Currency:   "USD",
+		Amount:     Money{Minor: 15000, Currency: "USD"},
 		Status:     StatusPending,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
@@ -72,19 +71,47 @@ func TestPaymentEdgeCases(t *testing.T) {
 		ID:         "zero-amount-id",
 		FromUserID: "user1",
 		ToUserID:   "user2",
-		Amount:     0.0,
-		Currency:   "USD",
+		Amount:     Money{Currency: "USD"},
 		Status:     StatusPending,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
-	assert.Equal(t, 0.0, payment.Amount)
+	assert.True(t, payment.Amount.IsZero())
 
-	payment.Amount = -50.0
-	assert.Equal(t, -50.0, payment.Amount)
+	payment.Amount = Money{Minor: -5000, Currency: "USD"}
+	assert.Equal(t, "-50.00", payment.Amount.String())
 
 	payment.FromUserID = ""
 	payment.ToUserID = ""
 	assert.Equal(t, "", payment.FromUserID)
 	assert.Equal(t, "", payment.ToUserID)
 }
+
+func TestFXQuote_Expired(t *testing.T) {
+	quotedAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	quote := FXQuote{QuotedAt: quotedAt, ExpiresAt: quotedAt.Add(15 * time.Minute)}
+
+	assert.False(t, quote.Expired(quotedAt))
+	assert.False(t, quote.Expired(quotedAt.Add(15*time.Minute-time.Second)))
+	assert.True(t, quote.Expired(quotedAt.Add(15*time.Minute)))
+}
+
+func TestQuoteRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want string
+	}{
+		{"76", "76"},
+		{"101.6797", "101.6797"},
+		{"10000/1016797", "0.0098348"},
+		{"2/3", "0.66666667"},
+	}
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		want, _ := new(big.Rat).SetString(tt.want)
+
+		rounded, text := QuoteRate(rate)
+		assert.Equal(t, tt.want, text, tt.rate)
+		assert.Equal(t, want, rounded, tt.rate)
+	}
+}
@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// FXQuoteDecimals знаков после запятой в зафиксированном курсе
+const FXQuoteDecimals = 8
+
+// FXQuote котировка пересчёта суммы платежа в валюту провайдера. Ссылка на оплату выставляется
+// на Amount, пока котировка действует; истёкшая котировка заменяется новой по текущему курсу
+type FXQuote struct {
+	// Amount сумма платежа в валюте провайдера: сумма платежа, умноженная на Rate
+	Amount Money `json:"amount"`
+	// Rate сколько единиц валюты Amount стоит единица валюты платежа, десятичная строка
+	Rate      string    `json:"rate"`
+	Source    string    `json:"source"`
+	QuotedAt  time.Time `json:"quoted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired котировка истекла к моменту now
+func (q *FXQuote) Expired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// QuoteRate округляет курс до FXQuoteDecimals знаков: по округлённому курсу считается сумма котировки,
+// чтобы её можно было проверить по сохранённому курсу
+func QuoteRate(rate *big.Rat) (*big.Rat, string) {
+	text := FormatRate(rate)
+	rounded, _ := new(big.Rat).SetString(text)
+	return rounded, text
+}
+
+// FormatRate курс десятичной строкой: FXQuoteDecimals знаков после запятой без незначащих нулей
+func FormatRate(rate *big.Rat) string {
+	return strings.TrimRight(strings.TrimRight(rate.FloatString(FXQuoteDecimals), "0"), ".")
+}
@@ -0,0 +1,20 @@
+package dto
+
+import "time"
+
+// FXRate курс Base -> Currency за день Date (UTC): сколько единиц Currency стоит единица Base
+type FXRate struct {
+	Base     string    `json:"base"`
+	Currency string    `json:"currency"`
+	Date     time.Time `json:"date"`
+	// Rate курс строкой big.Rat без потери точности
+	Rate      string    `json:"rate"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// RateDate календарный день t в UTC
+func RateDate(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal payment status transition")
+	ErrStatusConflict    = errors.New("payment status changed concurrently")
+)
+
+// paymentTransitions допустимые переходы статусов платежа:
+//
+//	PENDING  -> SUCCESS | FAILED     оплата подтверждена или отклонена
+//	FAILED   -> PENDING              выдана новая ссылка на оплату
+//	SUCCESS  -> COMPLETE | REFUNDED  средства переведены получателю или возвращены
+//	COMPLETE -> REFUNDED             возврат после перевода
+//
+// REFUNDED конечный статус.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:  {StatusSuccess, StatusFailed},
+	StatusFailed:   {StatusPending},
+	StatusSuccess:  {StatusComplete, StatusRefunded},
+	StatusComplete: {StatusRefunded},
+}
+
+// CanTransition проверяет, разрешён ли переход между статусами
+func CanTransition(from, to PaymentStatus) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal из статуса нет переходов
+func IsFinal(status PaymentStatus) bool {
+	return len(paymentTransitions[status]) == 0
+}
+
+// ValidateTransition возвращает *TransitionError, если переход запрещён
+func ValidateTransition(paymentID string, from, to PaymentStatus) error {
+	if CanTransition(from, to) {
+		return nil
+	}
+	return &TransitionError{PaymentID: paymentID, From: from, To: to, Err: ErrIllegalTransition}
+}
+
+// TransitionError ошибка смены статуса платежа.
+// Err равен ErrIllegalTransition или ErrStatusConflict, Actual заполнен при конфликте.
+type TransitionError struct {
+	PaymentID string
+	From      PaymentStatus
+	To        PaymentStatus
+	Actual    PaymentStatus
+	Err       error
+}
+
+func (e *TransitionError) Error() string {
+	if errors.Is(e.Err, ErrStatusConflict) {
+		return fmt.Sprintf("payment %s: cannot move %s -> %s, current status is %s: %v", e.PaymentID, e.From, e.To, e.Actual, e.Err)
+	}
+	return fmt.Sprintf("payment %s: %s -> %s: %v", e.PaymentID, e.From, e.To, e.Err)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// StatusTransition запись истории статусов платежа
+type StatusTransition struct {
+	PaymentID string        `json:"payment_id" db:"payment_id"`
+	From      PaymentStatus `json:"from_status" db:"from_status"`
+	To        PaymentStatus `json:"to_status" db:"to_status"`
+	Reason    string        `json:"reason" db:"reason"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	all := []PaymentStatus{StatusPending, StatusSuccess, StatusFailed, StatusRefunded, StatusComplete}
+	allowed := map[[2]PaymentStatus]bool{
+		{StatusPending, StatusSuccess}:   true,
+		{StatusPending, StatusFailed}:    true,
+		{StatusFailed, StatusPending}:    true,
+		{StatusSuccess, StatusComplete}:  true,
+		{StatusSuccess, StatusRefunded}:  true,
+		{StatusComplete, StatusRefunded}: true,
+	}
+
+	for _, from := range all {
+		for _, to := range all {
+			assert.Equal(t, allowed[[2]PaymentStatus{from, to}], CanTransition(from, to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	assert.True(t, IsFinal(StatusRefunded))
+	for _, status := range []PaymentStatus{StatusPending, StatusSuccess, StatusFailed, StatusComplete} {
+		assert.False(t, IsFinal(status), status)
+	}
+}
+
+func TestValidateTransition(t *testing.T) {
+	assert.NoError(t, ValidateTransition("payment-id", StatusSuccess, StatusComplete))
+
+	err := ValidateTransition("payment-id", StatusPending, StatusRefunded)
+	assert.ErrorIs(t, err, ErrIllegalTransition)
+
+	var transitionErr *TransitionError
+	assert.True(t, errors.As(err, &transitionErr))
+	assert.Equal(t, StatusPending, transitionErr.From)
+	assert.Equal(t, StatusRefunded, transitionErr.To)
+	assert.Contains(t, err.Error(), "PENDING -> REFUNDED")
+}
+
+func TestTransitionError_Conflict(t *testing.T) {
+	err := error(&TransitionError{
+		PaymentID: "payment-id",
+		From:      StatusPending,
+		To:        StatusSuccess,
+		Actual:    StatusFailed,
+		Err:       ErrStatusConflict,
+	})
+
+	assert.ErrorIs(t, err, ErrStatusConflict)
+	assert.NotErrorIs(t, err, ErrIllegalTransition)
+	assert.Contains(t, err.Error(), "current status is FAILED")
+}
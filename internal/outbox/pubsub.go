@@ -0,0 +1,215 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// ErrHubClosed Hub остановлен, новые события подписчикам не придут
+var ErrHubClosed = errors.New("payment event hub is closed")
+
+// PubSubSink публикует события в канал Redis Pub/Sub, откуда их раздают Hub всех реплик
+type PubSubSink struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewPubSubSink(client *redis.Client, channel string) *PubSubSink {
+	return &PubSubSink{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (s *PubSubSink) Name() string {
+	return "pubsub"
+}
+
+// Publish отправляет событие в канал; Pub/Sub не хранит сообщения, поэтому пропуски
+// подписчики восполняют из payment_events (см. Subscription.Resync)
+func (s *PubSubSink) Publish(ctx context.Context, event *entity.PaymentEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment event %d: %w", event.ID, err)
+	}
+	if err := s.client.Publish(ctx, s.channel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish payment event %d to channel %s: %w", event.ID, s.channel, err)
+	}
+	return nil
+}
+
+// Hub раздаёт события из канала Redis Pub/Sub подписчикам платежей на этой реплике
+type Hub struct {
+	client  *redis.Client
+	channel string
+	buffer  int
+	logger  *zap.Logger
+
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub(client *redis.Client, channel string, buffer int, logger *zap.Logger) *Hub {
+	return &Hub{
+		client:  client,
+		channel: channel,
+		buffer:  max(buffer, 1),
+		logger:  logger.With(zap.String("component", "payment_event_hub")),
+		subs:    make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription события одного платежа. События приходят в порядке id, но возможны повторы
+// и пропуски: после сигнала Resync подписчик дочитывает пропущенное из payment_events
+type Subscription struct {
+	hub       *Hub
+	paymentID string
+	events    chan *entity.PaymentEvent
+	resync    chan struct{}
+	once      sync.Once
+}
+
+// Events события платежа; канал закрывается при остановке Hub
+func (s *Subscription) Events() <-chan *entity.PaymentEvent {
+	return s.events
+}
+
+// Resync сигнал, что события могли быть пропущены: буфер подписчика переполнен
+// или соединение с Redis восстановлено после обрыва
+func (s *Subscription) Resync() <-chan struct{} {
+	return s.resync
+}
+
+// Close отписывает от событий платежа
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+func (s *Subscription) signalResync() {
+	select {
+	case s.resync <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.events) })
+}
+
+// Subscribe подписывает на события платежа paymentID до вызова Close
+func (h *Hub) Subscribe(paymentID string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	sub := &Subscription{
+		hub:       h,
+		paymentID: paymentID,
+		events:    make(chan *entity.PaymentEvent, h.buffer),
+		resync:    make(chan struct{}, 1),
+	}
+	if h.subs[paymentID] == nil {
+		h.subs[paymentID] = make(map[*Subscription]struct{})
+	}
+	h.subs[paymentID][sub] = struct{}{}
+	return sub, nil
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[sub.paymentID], sub)
+	if len(h.subs[sub.paymentID]) == 0 {
+		delete(h.subs, sub.paymentID)
+	}
+	sub.close()
+}
+
+// Run слушает канал до отмены ctx, затем закрывает подписки. go-redis переподключается сам
+// и заново подписывается на канал; каждое подтверждение подписки означает, что события
+// за время обрыва могли потеряться, и подписчики получают Resync
+func (h *Hub) Run(ctx context.Context) {
+	defer h.close()
+
+	pubsub := h.client.Subscribe(ctx, h.channel)
+	defer pubsub.Close()
+	// Receive не следит за ctx: закрытие подписки прерывает ожидание сообщения
+	stop := context.AfterFunc(ctx, func() { pubsub.Close() })
+	defer stop()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			h.logger.Warn("Payment event subscription interrupted", zap.Error(err))
+			h.resyncAll()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			h.resyncAll()
+		case *redis.Message:
+			h.dispatch(msg.Payload)
+		}
+	}
+}
+
+func (h *Hub) dispatch(payload string) {
+	var event entity.PaymentEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		h.logger.Warn("Failed to decode payment event", zap.Error(err))
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[event.PaymentID] {
+		select {
+		case sub.events <- &event:
+		default:
+			// Медленный подписчик не задерживает остальных: пропущенное он дочитает из базы
+			sub.signalResync()
+		}
+	}
+}
+
+func (h *Hub) resyncAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			sub.signalResync()
+		}
+	}
+}
+
+func (h *Hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for paymentID, subs := range h.subs {
+		for sub := range subs {
+			sub.close()
+		}
+		delete(h.subs, paymentID)
+	}
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	entity "paymentgo/internal/entity"
+)
+
+const testChannel = "payment_events:live"
+
+// runHub запускает Hub и ждёт подписки на канал: подтверждение приходит подписчику ready как Resync
+func runHub(t *testing.T, client *redis.Client, buffer int) (*Hub, context.CancelFunc, chan struct{}) {
+	t.Helper()
+	hub := NewHub(client, testChannel, buffer, zaptest.NewLogger(t))
+	ready, err := hub.Subscribe("ready")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-ready.Resync():
+	case <-time.After(time.Second):
+		t.Fatal("hub did not subscribe")
+	}
+	ready.Close()
+	return hub, cancel, done
+}
+
+func receive(t *testing.T, sub *Subscription) *entity.PaymentEvent {
+	t.Helper()
+	select {
+	case event := <-sub.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestHub_DeliversPublishedEvents(t *testing.T) {
+	mockRedis := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mockRedis.Addr()})
+	defer client.Close()
+
+	hub, cancel, _ := runHub(t, client, 4)
+	defer cancel()
+
+	p1, err := hub.Subscribe("p1")
+	require.NoError(t, err)
+	defer p1.Close()
+	p2, err := hub.Subscribe("p2")
+	require.NoError(t, err)
+	defer p2.Close()
+
+	sink := NewPubSubSink(client, testChannel)
+	require.NoError(t, sink.Publish(context.Background(), &entity.PaymentEvent{
+		ID: 1, PaymentID: "p1", From: entity.StatusPending, To: entity.StatusSuccess, Amount: entity.Money{Minor: 1050, Currency: "RUB"},
+	}))
+	require.NoError(t, sink.Publish(context.Background(), paymentEvent(2, "p2", entity.StatusPending)))
+
+	event := receive(t, p1)
+	assert.Equal(t, int64(1), event.ID)
+	assert.Equal(t, entity.StatusSuccess, event.To)
+	assert.Equal(t, entity.Money{Minor: 1050, Currency: "RUB"}, event.Amount)
+	assert.Equal(t, int64(2), receive(t, p2).ID)
+	assert.Empty(t, p1.Events())
+}
+
+func TestHub_SlowSubscriberIsResynced(t *testing.T) {
+	hub := NewHub(nil, testChannel, 1, zaptest.NewLogger(t))
+	sub, err := hub.Subscribe("p1")
+	require.NoError(t, err)
+
+	hub.dispatch(`{"id":1,"payment_id":"p1","to_status":"PENDING"}`)
+	hub.dispatch(`{"id":2,"payment_id":"p1","to_status":"SUCCESS"}`)
+
+	assert.Equal(t, int64(1), receive(t, sub).ID)
+	select {
+	case <-sub.Resync():
+	default:
+		t.Fatal("overflowed subscriber was not asked to resync")
+	}
+}
+
+func TestHub_StopClosesSubscriptions(t *testing.T) {
+	mockRedis := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mockRedis.Addr()})
+	defer client.Close()
+
+	hub, cancel, done := runHub(t, client, 4)
+	sub, err := hub.Subscribe("p1")
+	require.NoError(t, err)
+
+	cancel()
+	<-done
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	sub.Close()
+
+	_, err = hub.Subscribe("p1")
+	assert.ErrorIs(t, err, ErrHubClosed)
+}
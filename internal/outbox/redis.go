@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStreamSink публикует события в Redis Stream: поле data содержит JSON события,
+// event_id и payment_id продублированы для фильтрации без разбора JSON
+type RedisStreamSink struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamSink(client *redis.Client, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+func (s *RedisStreamSink) Name() string {
+	return "redis"
+}
+
+func (s *RedisStreamSink) Publish(ctx context.Context, event *entity.PaymentEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment event %d: %w", event.ID, err)
+	}
+
+	err = s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]interface{}{
+			"event_id":   strconv.FormatInt(event.ID, 10),
+			"payment_id": event.PaymentID,
+			"data":       data,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish payment event %d to stream %s: %w", event.ID, s.stream, err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	entity "paymentgo/internal/entity"
+)
+
+func TestRedisStreamSink_Publish(t *testing.T) {
+	mockRedis := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mockRedis.Addr()})
+	defer client.Close()
+
+	sink := NewRedisStreamSink(client, "payment_events", 1000)
+	event := &entity.PaymentEvent{
+		ID:        42,
+		PaymentID: "payment-1",
+		From:      entity.StatusPending,
+		To:        entity.StatusSuccess,
+		Amount:    entity.Money{Minor: 1050, Currency: "RUB"},
+	}
+	assert.NoError(t, sink.Publish(context.Background(), event))
+
+	messages, err := client.XRange(context.Background(), "payment_events", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "42", messages[0].Values["event_id"])
+	assert.Equal(t, "payment-1", messages[0].Values["payment_id"])
+
+	var decoded entity.PaymentEvent
+	assert.NoError(t, json.Unmarshal([]byte(messages[0].Values["data"].(string)), &decoded))
+	assert.Equal(t, event.To, decoded.To)
+	assert.Equal(t, event.Amount, decoded.Amount)
+}
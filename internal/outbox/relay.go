@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"paymentgo/utils/connector"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Relay переносит события из payment_events в Sink. Offset сдвигается только после успешной
+// публикации (at-least-once); если событие платежа не опубликовано, следующие события
+// этого платежа ждут повтора, чтобы сохранить порядок, а остальные платежи публикуются дальше
+type Relay struct {
+	events       repository.PaymentEventRepository
+	sink         Sink
+	elector      connector.LeaderElector
+	batchSize    int
+	pollInterval time.Duration
+	logger       *zap.Logger
+}
+
+func NewRelay(events repository.PaymentEventRepository, sink Sink, elector connector.LeaderElector, batchSize int, pollInterval time.Duration, logger *zap.Logger) *Relay {
+	return &Relay{
+		events:       events,
+		sink:         sink,
+		elector:      elector,
+		batchSize:    max(batchSize, 1),
+		pollInterval: pollInterval,
+		logger:       logger.With(zap.String("component", "outbox_relay"), zap.String("sink", sink.Name())),
+	}
+}
+
+// Run публикует события, пока реплика остаётся лидером, до отмены ctx
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		leaderCtx, resign, err := r.elector.Lead(ctx)
+		if err != nil {
+			return
+		}
+
+		r.relay(leaderCtx)
+		resign()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context) {
+	for {
+		if err := r.events.AdvanceWatermark(ctx, r.sink.Name()); err != nil && ctx.Err() == nil {
+			r.logger.Warn("failed to advance payment events watermark", zap.Error(err))
+		}
+
+		published := r.publishPending(ctx)
+		if published > 0 {
+			r.logger.Debug("payment events published", zap.Int("count", published))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// publishPending публикует пачки, пока они полные. Платежи, событие которых не удалось опубликовать,
+// исключаются из следующих выборок до очередного опроса: они не занимают пачку и не задерживают остальные
+func (r *Relay) publishPending(ctx context.Context) int {
+	blocked := make(map[string]bool)
+	total := 0
+	for {
+		published, full := r.publishBatch(ctx, blocked)
+		total += published
+		if !full {
+			return total
+		}
+	}
+}
+
+// publishBatch публикует одну пачку событий, кроме событий платежей из blocked, и добавляет в blocked
+// платежи с неопубликованным событием; full сообщает, что пачка была полной и стоит сразу читать следующую
+func (r *Relay) publishBatch(ctx context.Context, blocked map[string]bool) (published int, full bool) {
+	exclude := make([]string, 0, len(blocked))
+	for paymentID := range blocked {
+		exclude = append(exclude, paymentID)
+	}
+	events, err := r.events.Unpublished(ctx, r.sink.Name(), r.batchSize, exclude)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("failed to load payment events", zap.Error(err))
+		}
+		return 0, false
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return published, false
+		}
+		if blocked[event.PaymentID] {
+			continue
+		}
+
+		if err := r.publish(ctx, event); err != nil {
+			blocked[event.PaymentID] = true
+			continue
+		}
+		published++
+	}
+
+	return published, len(events) == r.batchSize
+}
+
+func (r *Relay) publish(ctx context.Context, event *entity.PaymentEvent) error {
+	if err := r.sink.Publish(ctx, event); err != nil {
+		r.logger.Warn("failed to publish payment event",
+			zap.Int64("event_id", event.ID),
+			zap.String("payment_id", event.PaymentID),
+			zap.Error(err))
+		return err
+	}
+
+	if err := r.events.MarkPublished(ctx, r.sink.Name(), event.PaymentID, event.ID); err != nil {
+		// Событие уйдёт повторно: получатели отбрасывают дубликаты по id
+		return err
+	}
+	return nil
+}
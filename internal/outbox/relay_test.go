@@ -0,0 +1,166 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	entity "paymentgo/internal/entity"
+	"paymentgo/utils/connector"
+)
+
+type memoryEventRepo struct {
+	mu      sync.Mutex
+	events  []*entity.PaymentEvent
+	offsets map[string]int64
+}
+
+func newMemoryEventRepo(events ...*entity.PaymentEvent) *memoryEventRepo {
+	return &memoryEventRepo{events: events, offsets: map[string]int64{}}
+}
+
+func (m *memoryEventRepo) Unpublished(ctx context.Context, sink string, limit int, exclude []string) ([]*entity.PaymentEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []*entity.PaymentEvent
+	for _, event := range m.events {
+		if event.ID > m.offsets[sink+event.PaymentID] && !slices.Contains(exclude, event.PaymentID) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryEventRepo) AdvanceWatermark(ctx context.Context, sink string) error {
+	return nil
+}
+
+func (m *memoryEventRepo) MarkPublished(ctx context.Context, sink, paymentID string, eventID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offsets[sink+paymentID] = max(m.offsets[sink+paymentID], eventID)
+	return nil
+}
+
+func (m *memoryEventRepo) PaymentEvents(ctx context.Context, paymentID string, afterID int64) ([]*entity.PaymentEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []*entity.PaymentEvent
+	for _, event := range m.events {
+		if event.PaymentID == paymentID && event.ID > afterID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// flakySink отказывает в публикации событий из failing
+type flakySink struct {
+	failing   map[int64]bool
+	published []int64
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Publish(ctx context.Context, event *entity.PaymentEvent) error {
+	if s.failing[event.ID] {
+		return errors.New("sink unavailable")
+	}
+	s.published = append(s.published, event.ID)
+	return nil
+}
+
+func paymentEvent(id int64, paymentID string, to entity.PaymentStatus) *entity.PaymentEvent {
+	return &entity.PaymentEvent{ID: id, PaymentID: paymentID, To: to}
+}
+
+func TestRelay_PublishesInOrder(t *testing.T) {
+	repo := newMemoryEventRepo(
+		paymentEvent(1, "p1", entity.StatusPending),
+		paymentEvent(2, "p2", entity.StatusPending),
+		paymentEvent(3, "p1", entity.StatusSuccess),
+	)
+	sink := NewChannelSink("channel", 10)
+	relay := NewRelay(repo, sink, connector.AlwaysLeader{}, 10, time.Second, zaptest.NewLogger(t))
+
+	published, full := relay.publishBatch(context.Background(), map[string]bool{})
+	assert.Equal(t, 3, published)
+	assert.False(t, full)
+
+	for _, want := range []int64{1, 2, 3} {
+		assert.Equal(t, want, (<-sink.Events()).ID)
+	}
+
+	published, _ = relay.publishBatch(context.Background(), map[string]bool{})
+	assert.Zero(t, published)
+}
+
+func TestRelay_FailureHoldsBackLaterEventsOfSamePayment(t *testing.T) {
+	repo := newMemoryEventRepo(
+		paymentEvent(1, "p1", entity.StatusPending),
+		paymentEvent(2, "p2", entity.StatusPending),
+		paymentEvent(3, "p1", entity.StatusSuccess),
+		paymentEvent(4, "p2", entity.StatusSuccess),
+	)
+	sink := &flakySink{failing: map[int64]bool{1: true}}
+	relay := NewRelay(repo, sink, connector.AlwaysLeader{}, 10, time.Second, zaptest.NewLogger(t))
+
+	published, _ := relay.publishBatch(context.Background(), map[string]bool{})
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []int64{2, 4}, sink.published)
+
+	// После восстановления получателя события p1 уходят в исходном порядке
+	sink.failing = nil
+	published, _ = relay.publishBatch(context.Background(), map[string]bool{})
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []int64{2, 4, 1, 3}, sink.published)
+}
+
+func TestRelay_BlockedPaymentsDoNotStarveOthers(t *testing.T) {
+	repo := newMemoryEventRepo(
+		paymentEvent(1, "p1", entity.StatusPending),
+		paymentEvent(2, "p2", entity.StatusPending),
+		paymentEvent(3, "p1", entity.StatusSuccess),
+		paymentEvent(4, "p2", entity.StatusSuccess),
+		paymentEvent(5, "p3", entity.StatusPending),
+		paymentEvent(6, "p4", entity.StatusPending),
+	)
+	sink := &flakySink{failing: map[int64]bool{1: true, 2: true}}
+	relay := NewRelay(repo, sink, connector.AlwaysLeader{}, 2, time.Second, zaptest.NewLogger(t))
+
+	// Первая пачка целиком из заблокированных платежей: следующие выборки их пропускают
+	assert.Equal(t, 2, relay.publishPending(context.Background()))
+	assert.Equal(t, []int64{5, 6}, sink.published)
+
+	sink.failing = nil
+	assert.Equal(t, 4, relay.publishPending(context.Background()))
+	assert.Equal(t, []int64{5, 6, 1, 2, 3, 4}, sink.published)
+}
+
+func TestRelay_RunStopsOnCancel(t *testing.T) {
+	repo := newMemoryEventRepo(paymentEvent(1, "p1", entity.StatusPending))
+	sink := NewChannelSink("channel", 1)
+	relay := NewRelay(repo, sink, connector.AlwaysLeader{}, 10, 10*time.Millisecond, zaptest.NewLogger(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	assert.Equal(t, int64(1), (<-sink.Events()).ID)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("relay did not stop after cancel")
+	}
+}
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+)
+
+// Sink получатель событий outbox. Доставка at-least-once: после сбоя событие
+// может прийти повторно, получатели отбрасывают дубликаты по PaymentEvent.ID
+type Sink interface {
+	// Name ключ, под которым хранятся опубликованные offsets получателя
+	Name() string
+	Publish(ctx context.Context, event *entity.PaymentEvent) error
+}
+
+// ChannelSink публикует события во внутренний канал процесса
+type ChannelSink struct {
+	name   string
+	events chan *entity.PaymentEvent
+}
+
+func NewChannelSink(name string, buffer int) *ChannelSink {
+	return &ChannelSink{
+		name:   name,
+		events: make(chan *entity.PaymentEvent, buffer),
+	}
+}
+
+func (s *ChannelSink) Name() string {
+	return s.name
+}
+
+// Publish ждёт места в канале: медленный читатель притормаживает relay, а не теряет события
+func (s *ChannelSink) Publish(ctx context.Context, event *entity.PaymentEvent) error {
+	select {
+	case s.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *ChannelSink) Events() <-chan *entity.PaymentEvent {
+	return s.events
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	entity "paymentgo/internal/entity"
+	"strconv"
+)
+
+// Заголовки запроса вебхука
+const (
+	webhookEventIDHeader   = "X-Payment-Event-Id"
+	webhookSignatureHeader = "X-Payment-Signature"
+)
+
+// WebhookSink отправляет каждое событие POST-запросом с JSON-телом.
+// Если задан secret, тело подписывается HMAC-SHA256 в заголовке X-Payment-Signature (hex)
+type WebhookSink struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+}
+
+func NewWebhookSink(url, secret string, httpClient *http.Client) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		secret:     []byte(secret),
+		httpClient: httpClient,
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event *entity.PaymentEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment event %d: %w", event.ID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventIDHeader, strconv.FormatInt(event.ID, 10))
+	if len(s.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, s.sign(body))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	entity "paymentgo/internal/entity"
+)
+
+func TestWebhookSink_SignsBody(t *testing.T) {
+	var (
+		body      []byte
+		signature string
+		eventID   string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		eventID = r.Header.Get(webhookEventIDHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "secret", server.Client())
+	err := sink.Publish(context.Background(), &entity.PaymentEvent{ID: 7, PaymentID: "payment-1", To: entity.StatusPending})
+	assert.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), signature)
+	assert.Equal(t, "7", eventID)
+}
+
+func TestWebhookSink_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "", server.Client())
+	err := sink.Publish(context.Background(), &entity.PaymentEvent{ID: 7, PaymentID: "payment-1"})
+	assert.ErrorContains(t, err, "502")
+}
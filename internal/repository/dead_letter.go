@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+)
+
+type DeadLetterRepository interface {
+	Add(ctx context.Context, letter *entity.DeadLetter) error
+	List(ctx context.Context, page, limit int) ([]*entity.DeadLetter, error)
+	// Remove удаляет платёж из dead-letter и возвращает его запись
+	Remove(ctx context.Context, paymentID string) (*entity.DeadLetter, error)
+}
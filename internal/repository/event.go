@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+)
+
+// PaymentEventRepository чтение outbox payment_events и учёт опубликованных событий по получателям
+type PaymentEventRepository interface {
+	// Unpublished события, ещё не опубликованные в sink, в порядке id, кроме событий платежей из exclude
+	Unpublished(ctx context.Context, sink string, limit int, exclude []string) ([]*entity.PaymentEvent, error)
+	// AdvanceWatermark сдвигает границу, до которой все события опубликованы в sink и не читаются Unpublished
+	AdvanceWatermark(ctx context.Context, sink string) error
+	// MarkPublished сдвигает offset платежа для sink до eventID
+	MarkPublished(ctx context.Context, sink, paymentID string, eventID int64) error
+	// PaymentEvents события платежа после afterID в порядке id
+	PaymentEvents(ctx context.Context, paymentID string, afterID int64) ([]*entity.PaymentEvent, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	// Reserve занимает ключ вызывающего subject под запрос на lockTTL и возвращает токен резервации.
+	// Если ключ уже занят, возвращает существующую запись и пустой токен.
+	Reserve(ctx context.Context, key, method, subject, fingerprint string, lockTTL time.Duration) (*entity.IdempotencyRecord, string, error)
+	// Complete и Release проходят только с токеном текущей резервации, иначе entity.ErrIdempotencyKeyLost
+	Complete(ctx context.Context, key, method, subject, token string, response []byte) error
+	Release(ctx context.Context, key, method, subject, token string) error
+}
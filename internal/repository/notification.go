@@ -0,0 +1,10 @@
+package repository
+
+import "context"
+
+// NotificationRepository журнал принятых уведомлений провайдера для защиты от повторов
+type NotificationRepository interface {
+	// Reserve отмечает операцию как принятую; false, если она уже была принята.
+	// Внутри WithinTx отметка фиксируется вместе с остальными записями транзакции
+	Reserve(ctx context.Context, operationID, paymentID string) (bool, error)
+}
@@ -3,13 +3,25 @@ package repository
 import (
 	"context"
 	entity "paymentgo/internal/entity"
+	"time"
 )
 
 type PaymentRepository interface {
-	CreatePayment(ctx context.Context, fromID, toID, currency string, amount float64) (string, error)
+	CreatePayment(ctx context.Context, fromID, toID string, amount entity.Money, provider string) (string, error)
 	GetPaymentByID(ctx context.Context, paymentID string) (*entity.Payment, error)
 	GetPaymentHistory(ctx context.Context, userID string, page, limit int) ([]*entity.Payment, error)
-	GetPaymentDetails(ctx context.Context, paymentID string) (float64, string, error)
-	UpdatePaymentStatus(ctx context.Context, paymentID string, paymentStatus entity.PaymentStatus) error
+	GetPaymentDetails(ctx context.Context, paymentID string) (entity.Money, error)
+	UpdatePaymentStatus(ctx context.Context, paymentID string, from, to entity.PaymentStatus, reason string) error
+	GetStatusHistory(ctx context.Context, paymentID string) ([]*entity.StatusTransition, error)
 	GetActivePayments(ctx context.Context, userID string) ([]*entity.Payment, error)
+	// SavePayout сохраняет идентификаторы выплаты получателю у провайдера (запрос и проведённый перевод)
+	SavePayout(ctx context.Context, paymentID, requestID, payoutID string) error
+	// SaveQuote фиксирует котировку, если у платежа нет действующей, и возвращает действующую котировку
+	SaveQuote(ctx context.Context, paymentID string, quote entity.FXQuote) (*entity.FXQuote, error)
+	// GetQuotes все котировки платежа в порядке выдачи, включая истёкшие
+	GetQuotes(ctx context.Context, paymentID string) ([]*entity.FXQuote, error)
+	// WithinTx выполняет fn в одной транзакции: записи репозиториев с ctx из fn фиксируются вместе
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// LockPayment арендует платёж на ttl на время обработки; ctx отменяется, если аренда потеряна
+	LockPayment(ctx context.Context, paymentID string, ttl time.Duration) (context.Context, func() error, error)
 }
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"paymentgo/utils/connector"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type DeadLetterRepository struct {
+	db     *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewDeadLetterRepository(db *pgxpool.Pool, logger *zap.Logger) repository.DeadLetterRepository {
+	return &DeadLetterRepository{
+		db:     db,
+		logger: logger.With(zap.String("component", "dead_letter_repository")),
+	}
+}
+
+func (dr *DeadLetterRepository) Add(ctx context.Context, letter *entity.DeadLetter) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	payload, err := json.Marshal(letter.Payment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead-lettered payment: %w", err)
+	}
+
+	query := `INSERT INTO payment_dead_letters (payment_id, payload, attempts, last_error, enqueued_at, dead_at)
+	VALUES ($1, $2, $3, $4, $5, NOW())
+	ON CONFLICT (payment_id) DO UPDATE
+	SET payload = EXCLUDED.payload, attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, dead_at = NOW()`
+
+	if _, err := dr.db.Exec(ctx, query, letter.PaymentID, payload, letter.Attempts, letter.LastError, letter.EnqueuedAt); err != nil {
+		dr.logger.Error("failed to dead-letter payment",
+			zap.String("payment_id", letter.PaymentID),
+			zap.Error(err))
+		return fmt.Errorf("failed to dead-letter payment: %w", err)
+	}
+	return nil
+}
+
+func (dr *DeadLetterRepository) List(ctx context.Context, page, limit int) ([]*entity.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	offset := (page - 1) * limit
+	query := `SELECT payment_id, payload, attempts, last_error, enqueued_at, dead_at
+	FROM payment_dead_letters
+	ORDER BY dead_at DESC
+	LIMIT $1 OFFSET $2`
+
+	rows, err := dr.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		dr.logger.Error("failed to query dead letters", zap.Error(err))
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []*entity.DeadLetter
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return letters, nil
+}
+
+func (dr *DeadLetterRepository) Remove(ctx context.Context, paymentID string) (*entity.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM payment_dead_letters WHERE payment_id = $1
+	RETURNING payment_id, payload, attempts, last_error, enqueued_at, dead_at`
+
+	letter, err := scanDeadLetter(connector.TxQuerier(ctx, dr.db).QueryRow(ctx, query, paymentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("payment %s: %w", paymentID, entity.ErrDeadLetterNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove dead letter %s: %w", paymentID, err)
+	}
+	return letter, nil
+}
+
+func scanDeadLetter(row rowScanner) (*entity.DeadLetter, error) {
+	var (
+		letter  entity.DeadLetter
+		payload []byte
+	)
+	if err := row.Scan(
+		&letter.PaymentID,
+		&payload,
+		&letter.Attempts,
+		&letter.LastError,
+		&letter.EnqueuedAt,
+		&letter.DeadAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(payload, &letter.Payment); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead-lettered payment %s: %w", letter.PaymentID, err)
+	}
+	return &letter, nil
+}
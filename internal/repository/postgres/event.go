@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type PaymentEventRepository struct {
+	db     *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewPaymentEventRepository(db *pgxpool.Pool, logger *zap.Logger) repository.PaymentEventRepository {
+	return &PaymentEventRepository{
+		db:     db,
+		logger: logger.With(zap.String("component", "payment_event_repository")),
+	}
+}
+
+// eventSettleHorizon через сколько после начала транзакции событие считается зафиксированным или
+// откатившимся. Транзакции смены статуса ограничены таймаутами в секунды, запас на порядок больше
+const eventSettleHorizon = time.Minute
+
+// Unpublished выбирает события после offset каждого платежа. Offset ведётся по платежу, а не глобально:
+// id событий одного платежа выдаются в порядке фиксации (строку платежа держит UPDATE),
+// а между разными платежами транзакции с меньшим id могут зафиксироваться позже.
+// Чтение начинается после watermark получателя (см. AdvanceWatermark); события платежей из exclude пропускаются
+func (er *PaymentEventRepository) Unpublished(ctx context.Context, sink string, limit int, exclude []string) ([]*entity.PaymentEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT e.id, e.payment_id, e.from_status, e.to_status, e.reason, e.amount::text, e.currency, e.created_at
+	FROM payment_events e
+	LEFT JOIN payment_event_offsets o ON o.sink = $1 AND o.payment_id = e.payment_id
+	WHERE e.id > COALESCE((SELECT event_id FROM payment_event_watermarks WHERE sink = $1), 0)
+	AND e.id > COALESCE(o.last_event_id, 0)
+	AND NOT (e.payment_id = ANY(COALESCE($3::uuid[], '{}')))
+	ORDER BY e.id
+	LIMIT $2`
+
+	rows, err := er.db.Query(ctx, query, sink, limit, exclude)
+	if err != nil {
+		er.logger.Error("failed to query unpublished payment events",
+			zap.String("sink", sink),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query unpublished payment events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*entity.PaymentEvent
+	for rows.Next() {
+		event, err := scanPaymentEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment event row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return events, nil
+}
+
+// AdvanceWatermark сдвигает watermark получателя до первого неопубликованного события. Граница не заходит
+// дальше событий старше eventSettleHorizon: событие с меньшим id, чья транзакция ещё не зафиксирована,
+// не должно оказаться под watermark
+func (er *PaymentEventRepository) AdvanceWatermark(ctx context.Context, sink string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `WITH mark AS (
+		SELECT COALESCE((SELECT event_id FROM payment_event_watermarks WHERE sink = $1), 0) AS event_id
+	), bounds AS (
+		SELECT m.event_id,
+			(SELECT max(id) FROM payment_events
+				WHERE id > m.event_id AND created_at < NOW() - $2 * interval '1 millisecond') AS settled,
+			(SELECT min(e.id) FROM payment_events e
+				LEFT JOIN payment_event_offsets o ON o.sink = $1 AND o.payment_id = e.payment_id
+				WHERE e.id > m.event_id AND e.id > COALESCE(o.last_event_id, 0)) AS unpublished
+		FROM mark m
+	)
+	INSERT INTO payment_event_watermarks (sink, event_id, updated_at)
+	SELECT $1, CASE WHEN settled IS NULL THEN event_id ELSE LEAST(settled, COALESCE(unpublished - 1, settled)) END, NOW()
+	FROM bounds
+	ON CONFLICT (sink) DO UPDATE
+	SET event_id = GREATEST(payment_event_watermarks.event_id, EXCLUDED.event_id), updated_at = NOW()`
+
+	if _, err := er.db.Exec(ctx, query, sink, eventSettleHorizon.Milliseconds()); err != nil {
+		er.logger.Error("failed to advance payment events watermark",
+			zap.String("sink", sink),
+			zap.Error(err))
+		return fmt.Errorf("failed to advance payment events watermark: %w", err)
+	}
+	return nil
+}
+
+func (er *PaymentEventRepository) MarkPublished(ctx context.Context, sink, paymentID string, eventID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO payment_event_offsets (sink, payment_id, last_event_id, updated_at)
+	VALUES ($1, $2, $3, NOW())
+	ON CONFLICT (sink, payment_id) DO UPDATE
+	SET last_event_id = GREATEST(payment_event_offsets.last_event_id, EXCLUDED.last_event_id), updated_at = NOW()`
+
+	if _, err := er.db.Exec(ctx, query, sink, paymentID, eventID); err != nil {
+		er.logger.Error("failed to save payment event offset",
+			zap.String("sink", sink),
+			zap.String("payment_id", paymentID),
+			zap.Int64("event_id", eventID),
+			zap.Error(err))
+		return fmt.Errorf("failed to save payment event offset: %w", err)
+	}
+	return nil
+}
+
+func (er *PaymentEventRepository) PaymentEvents(ctx context.Context, paymentID string, afterID int64) ([]*entity.PaymentEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, payment_id, from_status, to_status, reason, amount::text, currency, created_at
+	FROM payment_events
+	WHERE payment_id = $1 AND id > $2
+	ORDER BY id`
+
+	rows, err := er.db.Query(ctx, query, paymentID, afterID)
+	if err != nil {
+		er.logger.Error("failed to query payment events",
+			zap.String("payment_id", paymentID),
+			zap.Int64("after_id", afterID),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query payment events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*entity.PaymentEvent
+	for rows.Next() {
+		event, err := scanPaymentEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment event row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return events, nil
+}
+
+// insertPaymentEvent пишет событие outbox в транзакции смены статуса; сумма берётся из строки платежа
+func insertPaymentEvent(ctx context.Context, q pgx.Tx, paymentID string, from, to entity.PaymentStatus, reason string) error {
+	query := `INSERT INTO payment_events (payment_id, from_status, to_status, reason, amount, currency, created_at)
+	SELECT id, $2, $3, $4, amount, currency, NOW() FROM payments WHERE id = $1`
+
+	if _, err := q.Exec(ctx, query, paymentID, from, to, reason); err != nil {
+		return fmt.Errorf("failed to record payment event: %w", err)
+	}
+	return nil
+}
+
+func scanPaymentEvent(row rowScanner) (*entity.PaymentEvent, error) {
+	var (
+		event    entity.PaymentEvent
+		amount   string
+		currency string
+	)
+	if err := row.Scan(
+		&event.ID,
+		&event.PaymentID,
+		&event.From,
+		&event.To,
+		&event.Reason,
+		&amount,
+		&currency,
+		&event.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	money, err := entity.ParseMoney(amount, currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount stored for payment event %d: %w", event.ID, err)
+	}
+	event.Amount = money
+	return &event, nil
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// idempotencyKeyTTL сколько хранится ответ по ключу
+const idempotencyKeyTTL = 24 * time.Hour
+
+type IdempotencyRepository struct {
+	db     *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewIdempotencyRepository(db *pgxpool.Pool, logger *zap.Logger) repository.IdempotencyRepository {
+	return &IdempotencyRepository{
+		db:     db,
+		logger: logger.With(zap.String("component", "idempotency_repository")),
+	}
+}
+
+// Reserve занимает ключ на lockTTL: незавершённый запрос (например, упавший под) освобождает ключ по его истечении.
+// Токен резервации отличает исходный запрос от повтора, перезанявшего ключ после lockTTL
+func (ir *IdempotencyRepository) Reserve(ctx context.Context, key, method, subject, fingerprint string, lockTTL time.Duration) (*entity.IdempotencyRecord, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Просроченные ключи и брошенные незавершённые запросы перезанимаются
+	query := `INSERT INTO idempotency_keys (key, method, subject, fingerprint, response, created_at, token)
+	VALUES ($1, $2, $6, $3, NULL, NOW(), $7)
+	ON CONFLICT (key, method, subject) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, response = NULL, created_at = NOW(), token = EXCLUDED.token
+	WHERE idempotency_keys.created_at < NOW() - $4 * interval '1 second'
+	OR (idempotency_keys.response IS NULL AND idempotency_keys.created_at < NOW() - $5 * interval '1 millisecond')`
+
+	token := uuid.NewString()
+	tag, err := ir.db.Exec(ctx, query, key, method, fingerprint, int64(idempotencyKeyTTL.Seconds()), lockTTL.Milliseconds(), subject, token)
+	if err != nil {
+		ir.logger.Error("failed to reserve idempotency key",
+			zap.String("key", key),
+			zap.String("method", method),
+			zap.Error(err))
+		return nil, "", fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, token, nil
+	}
+
+	var record entity.IdempotencyRecord
+	err = ir.db.QueryRow(ctx, `SELECT key, method, subject, fingerprint, response, created_at
+	FROM idempotency_keys WHERE key = $1 AND method = $2 AND subject = $3`, key, method, subject).Scan(
+		&record.Key,
+		&record.Method,
+		&record.Subject,
+		&record.Fingerprint,
+		&record.Response,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch idempotency key %s: %w", key, err)
+	}
+
+	return &record, "", nil
+}
+
+func (ir *IdempotencyRepository) Complete(ctx context.Context, key, method, subject, token string, response []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE idempotency_keys SET response = $1
+	WHERE key = $2 AND method = $3 AND subject = $4 AND token = $5 AND response IS NULL`
+	tag, err := ir.db.Exec(ctx, query, response, key, method, subject, token)
+	if err != nil {
+		ir.logger.Error("failed to store idempotent response",
+			zap.String("key", key),
+			zap.String("method", method),
+			zap.Error(err))
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key %s: %w", key, entity.ErrIdempotencyKeyLost)
+	}
+	return nil
+}
+
+func (ir *IdempotencyRepository) Release(ctx context.Context, key, method, subject, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_keys
+	WHERE key = $1 AND method = $2 AND subject = $3 AND token = $4 AND response IS NULL`
+	tag, err := ir.db.Exec(ctx, query, key, method, subject, token)
+	if err != nil {
+		ir.logger.Error("failed to release idempotency key",
+			zap.String("key", key),
+			zap.String("method", method),
+			zap.Error(err))
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key %s: %w", key, entity.ErrIdempotencyKeyLost)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	entity "paymentgo/internal/entity"
+)
+
+func TestIdempotencyRepository_ReservationIsFencedByToken(t *testing.T) {
+	_, pool, _ := newTestPaymentRepository(t)
+	repo := NewIdempotencyRepository(pool, zaptest.NewLogger(t))
+	ctx := context.Background()
+	const method = "/payment.PaymentService/CreatePayment"
+
+	_, stale, err := repo.Reserve(ctx, "key-1", method, "user1", "fingerprint", 100*time.Millisecond)
+	require.NoError(t, err)
+	require.NotEmpty(t, stale)
+
+	// Пока резервация действует, ключ занят
+	record, token, err := repo.Reserve(ctx, "key-1", method, "user1", "fingerprint", 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+	require.NotNil(t, record)
+	assert.Nil(t, record.Response)
+
+	// Резервация истекла, повтор перезанимает ключ
+	time.Sleep(200 * time.Millisecond)
+	_, current, err := repo.Reserve(ctx, "key-1", method, "user1", "fingerprint", 100*time.Millisecond)
+	require.NoError(t, err)
+	require.NotEmpty(t, current)
+	assert.NotEqual(t, stale, current)
+
+	assert.ErrorIs(t, repo.Complete(ctx, "key-1", method, "user1", stale, []byte("stale")), entity.ErrIdempotencyKeyLost)
+	assert.ErrorIs(t, repo.Release(ctx, "key-1", method, "user1", stale), entity.ErrIdempotencyKeyLost)
+	require.NoError(t, repo.Complete(ctx, "key-1", method, "user1", current, []byte("current")))
+
+	record, token, err = repo.Reserve(ctx, "key-1", method, "user1", "fingerprint", 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+	assert.Equal(t, []byte("current"), record.Response)
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"paymentgo/internal/repository"
+	"paymentgo/utils/connector"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type NotificationRepository struct {
+	db     *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewNotificationRepository(db *pgxpool.Pool, logger *zap.Logger) repository.NotificationRepository {
+	return &NotificationRepository{
+		db:     db,
+		logger: logger.With(zap.String("component", "notification_repository")),
+	}
+}
+
+func (nr *NotificationRepository) Reserve(ctx context.Context, operationID, paymentID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO yoomoney_notifications (operation_id, payment_id, received_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (operation_id) DO NOTHING`
+
+	tag, err := connector.TxQuerier(ctx, nr.db).Exec(ctx, query, operationID, paymentID)
+	if err != nil {
+		nr.logger.Error("failed to reserve notification",
+			zap.String("operation_id", operationID),
+			zap.Error(err))
+		return false, fmt.Errorf("failed to reserve notification %s: %w", operationID, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
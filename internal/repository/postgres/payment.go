@@ -3,13 +3,16 @@ package postgres
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	entity "paymentgo/internal/entity"
 	"paymentgo/internal/repository"
+	"paymentgo/utils/connector"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
@@ -28,28 +31,49 @@ func NewPaymentRepository(db *pgxpool.Pool, redis *redis.Client, logger *zap.Log
 	}
 }
 
-func (pr *PaymentRepository) CreatePayment(ctx context.Context, fromID, toID, currency string, amount float64) (string, error) {
+func (pr *PaymentRepository) CreatePayment(ctx context.Context, fromID, toID string, amount entity.Money, provider string) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	id := uuid.New().String()
-	query := `INSERT INTO payment 
-	(id, user_from_id, user_to_id, status, currency, amount, created_at, updated_at) 
-	VALUES ($1, $2, $3, 'PENDING', $4, $5, NOW(), NOW()) 
+	query := `INSERT INTO payments 
+	(id, from_user_id, to_user_id, status, currency, amount, provider, created_at, updated_at) 
+	VALUES ($1, $2, $3, 'PENDING', $4, $5::numeric, $6, NOW(), NOW()) 
 	RETURNING id`
 
+	tx, err := pr.querier(ctx).Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	var paymentID string
-	err := pr.db.QueryRow(ctx, query, id, fromID, toID, currency, amount).Scan(&paymentID)
+	err = tx.QueryRow(ctx, query, id, fromID, toID, amount.Currency, amount.String(), provider).Scan(&paymentID)
 	if err != nil {
 		pr.logger.Error("failed to create payment",
 			zap.String("from_id", fromID),
 			zap.String("to_id", toID),
-			zap.String("currency", currency),
-			zap.Float64("amount", amount),
+			zap.String("provider", provider),
+			zap.String("currency", amount.Currency),
+			zap.Stringer("amount", amount),
 			zap.Error(err))
 		return "", fmt.Errorf("failed to create payment: %w", err)
 	}
 
+	if err := insertPaymentEvent(ctx, tx, paymentID, "", entity.StatusPending, "payment created"); err != nil {
+		pr.logger.Error("failed to record payment event",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// Новый платёж появляется в истории обоих участников
+	connector.AfterCommit(ctx, func(ctx context.Context) { pr.invalidateHistory(ctx, fromID, toID) })
+
 	return paymentID, nil
 }
 
@@ -59,30 +83,25 @@ func (pr *PaymentRepository) GetPaymentByID(ctx context.Context, paymentID strin
 
 	cacheKey := fmt.Sprintf("payment:%s", paymentID)
 
+	// Под арендой (LockPayment) платёж читается из БД: обработка продолжается по сохранённому
+	// состоянию, а не по кешу, который мог пропустить сброс
+	_, leased := ctx.Value(leaseKey{}).(*paymentLease)
+
 	// Try cache first
-	cachedPayment, err := pr.redis.Get(ctx, cacheKey).Result()
-	if err == nil {
-		var payment entity.Payment
-		if err := json.Unmarshal([]byte(cachedPayment), &payment); err == nil {
-			return &payment, nil
+	if !leased {
+		if cachedPayment, err := pr.redis.Get(ctx, cacheKey).Result(); err == nil {
+			var payment entity.Payment
+			if err := json.Unmarshal([]byte(cachedPayment), &payment); err == nil {
+				return &payment, nil
+			}
+			pr.logger.Warn("failed to unmarshal cached payment", zap.Error(err))
 		}
-		pr.logger.Warn("failed to unmarshal cached payment", zap.Error(err))
 	}
 
-	query := `SELECT id, user_from_id, user_to_id, status, currency, amount, created_at, updated_at
-	FROM payment WHERE id=$1`
-
-	var payment entity.Payment
-	err = pr.db.QueryRow(ctx, query, paymentID).Scan(
-		&payment.ID,
-		&payment.FromUserID,
-		&payment.ToUserID,
-		&payment.Status,
-		&payment.Currency,
-		&payment.Amount,
-		&payment.CreatedAt,
-		&payment.UpdatedAt,
-	)
+	payment, err := scanPayment(pr.querier(ctx).QueryRow(ctx, paymentByIDQuery, paymentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentNotFound)
+	}
 	if err != nil {
 		pr.logger.Error("failed to fetch payment by ID",
 			zap.String("payment_id", paymentID),
@@ -90,74 +109,326 @@ func (pr *PaymentRepository) GetPaymentByID(ctx context.Context, paymentID strin
 		return nil, fmt.Errorf("failed to fetch payment %s: %w", paymentID, err)
 	}
 
-	// Update cache
+	// Update cache: внутри WithinTx только после фиксации, платёж мог измениться в этой транзакции
 	if data, err := json.Marshal(payment); err == nil {
-		if err := pr.redis.Set(ctx, cacheKey, data, 10*time.Minute).Err(); err != nil {
-			pr.logger.Warn("failed to cache payment",
-				zap.String("payment_id", paymentID),
-				zap.Error(err))
-		}
+		connector.AfterCommit(ctx, func(ctx context.Context) {
+			if err := pr.redis.Set(ctx, cacheKey, data, 10*time.Minute).Err(); err != nil {
+				pr.logger.Warn("failed to cache payment",
+					zap.String("payment_id", paymentID),
+					zap.Error(err))
+			}
+		})
 	}
 
-	return &payment, nil
+	return payment, nil
 }
 
-func (pr *PaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID string, status entity.PaymentStatus) error {
+// UpdatePaymentStatus переводит платёж из статуса from в статус to.
+// Переход проверяется по таблице состояний, а сама запись делается только если
+// текущий статус в БД всё ещё равен from; каждый переход пишется в payment_status_history.
+func (pr *PaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID string, from, to entity.PaymentStatus, reason string) error {
+	if err := entity.ValidateTransition(paymentID, from, to); err != nil {
+		pr.logger.Warn("rejected payment status transition",
+			zap.String("payment_id", paymentID),
+			zap.String("from", string(from)),
+			zap.String("to", string(to)))
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := pr.db.Begin(ctx)
+	tx, err := pr.querier(ctx).Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	query := `UPDATE payment SET status = $1, updated_at = NOW() WHERE id = $2`
-	if _, err := tx.Exec(ctx, query, status, paymentID); err != nil {
+	query := `UPDATE payments SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3
+	RETURNING from_user_id, to_user_id`
+	var fromUserID, toUserID string
+	err = tx.QueryRow(ctx, query, to, paymentID, from).Scan(&fromUserID, &toUserID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		pr.logger.Error("failed to update payment status",
 			zap.String("payment_id", paymentID),
-			zap.String("status", string(status)),
+			zap.String("status", string(to)),
 			zap.Error(err))
 		return fmt.Errorf("failed to update payment status: %w", err)
 	}
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("payment:%s", paymentID)
-	if err := pr.redis.Del(ctx, cacheKey).Err(); err != nil {
-		pr.logger.Warn("failed to invalidate payment cache",
+	if errors.Is(err, pgx.ErrNoRows) {
+		var actual entity.PaymentStatus
+		if err := tx.QueryRow(ctx, `SELECT status FROM payments WHERE id = $1`, paymentID).Scan(&actual); err != nil {
+			return fmt.Errorf("failed to fetch payment %s: %w", paymentID, err)
+		}
+		return &entity.TransitionError{PaymentID: paymentID, From: from, To: to, Actual: actual, Err: entity.ErrStatusConflict}
+	}
+
+	historyQuery := `INSERT INTO payment_status_history (payment_id, from_status, to_status, reason, created_at)
+	VALUES ($1, $2, $3, $4, NOW())`
+	if _, err := tx.Exec(ctx, historyQuery, paymentID, from, to, reason); err != nil {
+		pr.logger.Error("failed to record payment status history",
 			zap.String("payment_id", paymentID),
 			zap.Error(err))
+		return fmt.Errorf("failed to record payment status history: %w", err)
+	}
+
+	// Событие outbox пишется в той же транзакции, relay опубликует его после фиксации
+	if err := insertPaymentEvent(ctx, tx, paymentID, from, to, reason); err != nil {
+		pr.logger.Error("failed to record payment event",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	// Внутри WithinTx кеш сбрасывается после фиксации: до неё читатели видят прежний статус
+	connector.AfterCommit(ctx, func(ctx context.Context) { pr.invalidatePayment(ctx, paymentID, fromUserID, toUserID) })
+
+	return nil
+}
+
+// SavePayout сохраняет состояние выплаты получателю: запрос перевода у провайдера и проведённый перевод.
+// Запись фиксируется сразу, до следующего шага выплаты. Под арендой (LockPayment) запись проходит,
+// только пока аренда принадлежит этой обработке, иначе вернётся entity.ErrPaymentLeaseLost
+func (pr *PaymentRepository) SavePayout(ctx context.Context, paymentID, requestID, payoutID string) error {
+	var owner string
+	if lease, ok := ctx.Value(leaseKey{}).(*paymentLease); ok {
+		owner = lease.owner
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE payments SET payout_request_id = $2, payout_id = $3, updated_at = NOW()
+	WHERE id = $1 AND ($4 = '' OR locked_by = $4)
+	RETURNING from_user_id, to_user_id`
+	var fromUserID, toUserID string
+	err := pr.db.QueryRow(ctx, query, paymentID, requestID, payoutID, owner).Scan(&fromUserID, &toUserID)
+	if errors.Is(err, pgx.ErrNoRows) && owner != "" {
+		return fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentLeaseLost)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentNotFound)
+	}
+	if err != nil {
+		pr.logger.Error("failed to save payment payout",
+			zap.String("payment_id", paymentID),
+			zap.String("payout_request_id", requestID),
+			zap.String("payout_id", payoutID),
+			zap.Error(err))
+		return fmt.Errorf("failed to save payment payout: %w", err)
+	}
+
+	pr.invalidatePayment(ctx, paymentID, fromUserID, toUserID)
 	return nil
 }
 
+// SaveQuote фиксирует котировку платежа, если у него нет котировки в валюте quote.Amount, действующей
+// на момент quote.QuotedAt, и добавляет её в payment_quotes. Возвращает действующую котировку: новую
+// или зафиксированную параллельным запросом
+func (pr *PaymentRepository) SaveQuote(ctx context.Context, paymentID string, quote entity.FXQuote) (*entity.FXQuote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Текущая котировка и запись в истории пишутся одним запросом
+	query := `WITH quoted AS (
+		UPDATE payments SET quote_amount = $2::numeric, quote_currency = $3, quote_rate = $4, quote_source = $5,
+			quoted_at = $6, quote_expires_at = $7, updated_at = NOW()
+		WHERE id = $1 AND (quote_expires_at IS NULL OR quote_expires_at <= $6 OR quote_currency <> $3)
+		RETURNING id, from_user_id, to_user_id
+	), recorded AS (
+		INSERT INTO payment_quotes (payment_id, amount, currency, rate, source, quoted_at, expires_at)
+		SELECT id, $2::numeric, $3, $4, $5, $6, $7 FROM quoted
+	)
+	SELECT from_user_id, to_user_id FROM quoted`
+	var fromUserID, toUserID string
+	err := pr.querier(ctx).QueryRow(ctx, query, paymentID, quote.Amount.String(), quote.Amount.Currency,
+		quote.Rate, quote.Source, quote.QuotedAt, quote.ExpiresAt).Scan(&fromUserID, &toUserID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		pr.logger.Error("failed to save payment quote",
+			zap.String("payment_id", paymentID),
+			zap.String("rate", quote.Rate),
+			zap.String("source", quote.Source),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to save payment quote: %w", err)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Платежа нет или котировку уже зафиксировал параллельный запрос
+		payment, err := scanPayment(pr.querier(ctx).QueryRow(ctx, paymentByIDQuery, paymentID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch payment %s: %w", paymentID, err)
+		}
+		if payment.Quote == nil {
+			return nil, fmt.Errorf("payment %s has no quote after conflicting update", paymentID)
+		}
+		return payment.Quote, nil
+	}
+
+	connector.AfterCommit(ctx, func(ctx context.Context) { pr.invalidatePayment(ctx, paymentID, fromUserID, toUserID) })
+	return &quote, nil
+}
+
+// GetQuotes все котировки платежа в порядке выдачи
+func (pr *PaymentRepository) GetQuotes(ctx context.Context, paymentID string) ([]*entity.FXQuote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT amount::text, currency, rate, source, quoted_at, expires_at
+	FROM payment_quotes WHERE payment_id = $1
+	ORDER BY quoted_at, id`
+
+	rows, err := pr.querier(ctx).Query(ctx, query, paymentID)
+	if err != nil {
+		pr.logger.Error("failed to query payment quotes",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query payment quotes: %w", err)
+	}
+	defer rows.Close()
+
+	var quotes []*entity.FXQuote
+	for rows.Next() {
+		var (
+			quote            entity.FXQuote
+			amount, currency string
+		)
+		if err := rows.Scan(&amount, &currency, &quote.Rate, &quote.Source, &quote.QuotedAt, &quote.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan payment quote row: %w", err)
+		}
+		quote.Amount, err = entity.ParseMoney(amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quote amount stored for payment %s: %w", paymentID, err)
+		}
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// WithinTx выполняет fn в одной транзакции: записи этого и других Postgres-репозиториев
+// с ctx из fn фиксируются или откатываются вместе
+func (pr *PaymentRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return connector.WithinTx(ctx, pr.db, fn)
+}
+
+// historyVersionTTL версия истории живёт дольше закешированных страниц: после её истечения
+// страниц со старой нумерацией версий в кеше уже нет
+const historyVersionTTL = 24 * time.Hour
+
+// invalidatePayment удаляет платёж из кеша и сбрасывает историю платежей его участников
+func (pr *PaymentRepository) invalidatePayment(ctx context.Context, paymentID string, userIDs ...string) {
+	if err := pr.redis.Del(ctx, fmt.Sprintf("payment:%s", paymentID), fmt.Sprintf("payment_details:%s", paymentID)).Err(); err != nil {
+		pr.logger.Warn("failed to invalidate payment cache",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+	}
+	pr.invalidateHistory(ctx, userIDs...)
+}
+
+// invalidateHistory сдвигает версию истории платежей пользователей: страницы истории кешируются
+// под ключом с версией, поэтому все закешированные страницы разом перестают читаться
+func (pr *PaymentRepository) invalidateHistory(ctx context.Context, userIDs ...string) {
+	for _, userID := range userIDs {
+		versionKey := historyVersionKey(userID)
+		pipe := pr.redis.TxPipeline()
+		pipe.Incr(ctx, versionKey)
+		pipe.Expire(ctx, versionKey, historyVersionTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			pr.logger.Warn("failed to invalidate payment history cache",
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+	}
+}
+
+func historyVersionKey(userID string) string {
+	return fmt.Sprintf("payment_history_version:%s", userID)
+}
+
+// GetStatusHistory история переходов статусов платежа в хронологическом порядке
+func (pr *PaymentRepository) GetStatusHistory(ctx context.Context, paymentID string) ([]*entity.StatusTransition, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `SELECT payment_id, from_status, to_status, reason, created_at
+	FROM payment_status_history WHERE payment_id = $1
+	ORDER BY created_at, id`
+
+	rows, err := pr.querier(ctx).Query(ctx, query, paymentID)
+	if err != nil {
+		pr.logger.Error("failed to query payment status history",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query payment status history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []*entity.StatusTransition
+	for rows.Next() {
+		var transition entity.StatusTransition
+		if err := rows.Scan(
+			&transition.PaymentID,
+			&transition.From,
+			&transition.To,
+			&transition.Reason,
+			&transition.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan status history row: %w", err)
+		}
+		history = append(history, &transition)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return history, nil
+}
+
 func (pr *PaymentRepository) GetPaymentHistory(ctx context.Context, userID string, page, limit int) ([]*entity.Payment, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	cacheKey := fmt.Sprintf("payment_history:%s:%d:%d", userID, page, limit)
+	// Версия читается до запроса в БД: страница, прочитанная до изменения платежа,
+	// попадёт в кеш под старой версией и читаться больше не будет. Без версии кеш не используется
+	version, err := pr.redis.Get(ctx, historyVersionKey(userID)).Int64()
+	cached := err == nil || errors.Is(err, redis.Nil)
+	if !cached {
+		pr.logger.Warn("failed to read payment history version", zap.String("user_id", userID), zap.Error(err))
+	}
+	cacheKey := fmt.Sprintf("payment_history:%s:%d:%d:%d", userID, version, page, limit)
 
 	// Try cache first
-	if cachedHistory, err := pr.redis.Get(ctx, cacheKey).Result(); err == nil {
-		var payments []*entity.Payment
-		if err := json.Unmarshal([]byte(cachedHistory), &payments); err == nil {
-			return payments, nil
+	if cached {
+		if cachedHistory, err := pr.redis.Get(ctx, cacheKey).Result(); err == nil {
+			var payments []*entity.Payment
+			if err := json.Unmarshal([]byte(cachedHistory), &payments); err == nil {
+				return payments, nil
+			}
+			pr.logger.Warn("failed to unmarshal cached payment history", zap.Error(err))
 		}
-		pr.logger.Warn("failed to unmarshal cached payment history", zap.Error(err))
 	}
 
 	offset := (page - 1) * limit
-	query := `SELECT id, user_from_id, user_to_id, status, currency, amount, created_at, updated_at 
-	FROM payment WHERE user_from_id = $1 OR user_to_id = $1
+	query := `SELECT id, from_user_id, to_user_id, status, currency, amount::text, provider, payout_request_id, payout_id,
+	quote_amount::text, quote_currency, quote_rate, quote_source, quoted_at, quote_expires_at, created_at, updated_at 
+	FROM payments WHERE from_user_id = $1 OR to_user_id = $1
 	ORDER BY created_at DESC
 	LIMIT $2 OFFSET $3`
 
-	rows, err := pr.db.Query(ctx, query, userID, limit, offset)
+	rows, err := pr.querier(ctx).Query(ctx, query, userID, limit, offset)
 	if err != nil {
 		pr.logger.Error("failed to query payment history",
 			zap.String("user_id", userID),
@@ -170,21 +441,12 @@ func (pr *PaymentRepository) GetPaymentHistory(ctx context.Context, userID strin
 
 	var payments []*entity.Payment
 	for rows.Next() {
-		var payment entity.Payment
-		if err := rows.Scan(
-			&payment.ID,
-			&payment.FromUserID,
-			&payment.ToUserID,
-			&payment.Status,
-			&payment.Currency,
-			&payment.Amount,
-			&payment.CreatedAt,
-			&payment.UpdatedAt,
-		); err != nil {
+		payment, err := scanPayment(rows)
+		if err != nil {
 			pr.logger.Error("failed to scan payment history row", zap.Error(err))
 			return nil, fmt.Errorf("failed to scan payment row: %w", err)
 		}
-		payments = append(payments, &payment)
+		payments = append(payments, payment)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -193,7 +455,7 @@ func (pr *PaymentRepository) GetPaymentHistory(ctx context.Context, userID strin
 	}
 
 	// Update cache
-	if data, err := json.Marshal(payments); err == nil {
+	if data, err := json.Marshal(payments); err == nil && cached {
 		if err := pr.redis.Set(ctx, cacheKey, data, 10*time.Minute).Err(); err != nil {
 			pr.logger.Warn("failed to cache payment history",
 				zap.String("user_id", userID),
@@ -208,13 +470,14 @@ func (pr *PaymentRepository) GetActivePayments(ctx context.Context, userID strin
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	query := `SELECT id, user_from_id, user_to_id, status, currency, amount, created_at, updated_at 
-	FROM payment 
-	WHERE (user_from_id = $1 OR user_to_id = $1) 
+	query := `SELECT id, from_user_id, to_user_id, status, currency, amount::text, provider, payout_request_id, payout_id,
+	quote_amount::text, quote_currency, quote_rate, quote_source, quoted_at, quote_expires_at, created_at, updated_at 
+	FROM payments 
+	WHERE (from_user_id = $1 OR to_user_id = $1) 
 	AND status IN ('PENDING', 'FAILED')
 	ORDER BY created_at DESC`
 
-	rows, err := pr.db.Query(ctx, query, userID)
+	rows, err := pr.querier(ctx).Query(ctx, query, userID)
 	if err != nil {
 		pr.logger.Error("failed to fetch active payments",
 			zap.String("user_id", userID),
@@ -225,21 +488,12 @@ func (pr *PaymentRepository) GetActivePayments(ctx context.Context, userID strin
 
 	var payments []*entity.Payment
 	for rows.Next() {
-		var payment entity.Payment
-		if err := rows.Scan(
-			&payment.ID,
-			&payment.FromUserID,
-			&payment.ToUserID,
-			&payment.Status,
-			&payment.Currency,
-			&payment.Amount,
-			&payment.CreatedAt,
-			&payment.UpdatedAt,
-		); err != nil {
+		payment, err := scanPayment(rows)
+		if err != nil {
 			pr.logger.Error("failed to scan active payment row", zap.Error(err))
 			return nil, fmt.Errorf("failed to scan payment row: %w", err)
 		}
-		payments = append(payments, &payment)
+		payments = append(payments, payment)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -250,7 +504,7 @@ func (pr *PaymentRepository) GetActivePayments(ctx context.Context, userID strin
 	return payments, nil
 }
 
-func (pr *PaymentRepository) GetPaymentDetails(ctx context.Context, paymentID string) (float64, string, error) {
+func (pr *PaymentRepository) GetPaymentDetails(ctx context.Context, paymentID string) (entity.Money, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -258,36 +512,35 @@ func (pr *PaymentRepository) GetPaymentDetails(ctx context.Context, paymentID st
 
 	// Try cache first
 	if cachedDetails, err := pr.redis.Get(ctx, cacheKey).Result(); err == nil {
-		var details struct {
-			Amount   float64 `json:"amount"`
-			Currency string  `json:"currency"`
-		}
+		var details entity.PaymentDetails
 		if err := json.Unmarshal([]byte(cachedDetails), &details); err == nil {
-			return details.Amount, details.Currency, nil
+			return details.Amount, nil
 		}
 		pr.logger.Warn("failed to unmarshal cached payment details",
 			zap.String("payment_id", paymentID),
 			zap.Error(err))
 	}
 
-	query := `SELECT amount, currency FROM payment WHERE id = $1`
+	query := `SELECT amount::text, currency FROM payments WHERE id = $1`
 	var (
-		amount   float64
+		amount   string
 		currency string
 	)
-	err := pr.db.QueryRow(ctx, query, paymentID).Scan(&amount, &currency)
+	err := pr.querier(ctx).QueryRow(ctx, query, paymentID).Scan(&amount, &currency)
 	if err != nil {
 		pr.logger.Error("failed to fetch payment details",
 			zap.String("payment_id", paymentID),
 			zap.Error(err))
-		return 0, "", fmt.Errorf("failed to get payment details for %s: %w", paymentID, err)
+		return entity.Money{}, fmt.Errorf("failed to get payment details for %s: %w", paymentID, err)
+	}
+
+	money, err := entity.ParseMoney(amount, currency)
+	if err != nil {
+		return entity.Money{}, fmt.Errorf("invalid amount stored for payment %s: %w", paymentID, err)
 	}
 
 	// Update cache
-	details := struct {
-		Amount   float64 `json:"amount"`
-		Currency string  `json:"currency"`
-	}{amount, currency}
+	details := entity.PaymentDetails{Amount: money}
 
 	if data, err := json.Marshal(details); err == nil {
 		if err := pr.redis.Set(ctx, cacheKey, data, 10*time.Minute).Err(); err != nil {
@@ -297,5 +550,200 @@ func (pr *PaymentRepository) GetPaymentDetails(ctx context.Context, paymentID st
 		}
 	}
 
-	return amount, currency, nil
+	return money, nil
+}
+
+// LockPayment берёт аренду платежа (locked_by, locked_until) на ttl на время обработки. Аренда не держит
+// ни транзакцию, ни соединение: каждая запись обработчика фиксируется сразу, а уведомления по платежу
+// не ждут окончания обработки. Пока платёж обрабатывается, аренда продлевается;
+// если реплика упала, аренда истекает сама. Возвращённый ctx отменяется с причиной entity.ErrPaymentLeaseLost,
+// если аренду не удалось продлить; unlock снимает аренду. Если платёж арендован другим воркером,
+// вернётся entity.ErrPaymentLocked
+func (pr *PaymentRepository) LockPayment(ctx context.Context, paymentID string, ttl time.Duration) (context.Context, func() error, error) {
+	lease := &paymentLease{paymentID: paymentID, owner: uuid.NewString()}
+
+	claimed, err := pr.extendLease(ctx, lease, ttl)
+	if err != nil {
+		pr.logger.Error("failed to lock payment",
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to lock payment %s: %w", paymentID, err)
+	}
+	if !claimed {
+		var exists bool
+		if err := pr.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM payments WHERE id = $1)`, paymentID).Scan(&exists); err != nil {
+			return nil, nil, fmt.Errorf("failed to lock payment %s: %w", paymentID, err)
+		}
+		if !exists {
+			return nil, nil, fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentNotFound)
+		}
+		return nil, nil, fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentLocked)
+	}
+
+	leaseCtx, cancel := context.WithCancelCause(context.WithValue(ctx, leaseKey{}, lease))
+	stop := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		pr.renewLease(leaseCtx, stop, lease, ttl, cancel)
+	}()
+
+	unlock := func() error {
+		close(stop)
+		<-renewed
+		lost := context.Cause(leaseCtx)
+		cancel(nil)
+		if errors.Is(lost, entity.ErrPaymentLeaseLost) {
+			return fmt.Errorf("payment %s: %w", paymentID, lost)
+		}
+
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelRelease()
+		query := `UPDATE payments SET locked_by = NULL, locked_until = NULL WHERE id = $1 AND locked_by = $2`
+		tag, err := pr.db.Exec(releaseCtx, query, paymentID, lease.owner)
+		if err != nil {
+			return fmt.Errorf("failed to release payment lease %s: %w", paymentID, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("payment %s: %w", paymentID, entity.ErrPaymentLeaseLost)
+		}
+		return nil
+	}
+
+	return leaseCtx, unlock, nil
+}
+
+// extendLease берёт свободную или истёкшую аренду платежа либо продлевает свою; false, если платёж
+// арендован другим воркером или не существует
+func (pr *PaymentRepository) extendLease(ctx context.Context, lease *paymentLease, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE payments SET locked_by = $2, locked_until = NOW() + $3 * interval '1 millisecond'
+	WHERE id = $1 AND (locked_by = $2 OR locked_until IS NULL OR locked_until <= NOW())`
+	tag, err := pr.db.Exec(ctx, query, lease.paymentID, lease.owner, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// renewLease продлевает аренду каждую треть ttl до закрытия stop. Если аренду перехватил другой воркер
+// или её не удаётся продлить дольше ttl, обработка отменяется через lose
+func (pr *PaymentRepository) renewLease(ctx context.Context, stop <-chan struct{}, lease *paymentLease, ttl time.Duration, lose context.CancelCauseFunc) {
+	ticker := time.NewTicker(max(ttl/3, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		extended, err := pr.extendLease(ctx, lease, ttl)
+		switch {
+		case err == nil && extended:
+			renewedAt = time.Now()
+			continue
+		case err == nil:
+			pr.logger.Warn("payment lease taken over by another worker", zap.String("payment_id", lease.paymentID))
+		case time.Since(renewedAt) < ttl:
+			pr.logger.Warn("failed to renew payment lease",
+				zap.String("payment_id", lease.paymentID),
+				zap.Error(err))
+			continue
+		default:
+			pr.logger.Error("payment lease expired while renewal was failing",
+				zap.String("payment_id", lease.paymentID),
+				zap.Error(err))
+		}
+		lose(entity.ErrPaymentLeaseLost)
+		return
+	}
+}
+
+// querier возвращает транзакцию WithinTx из ctx или пул
+func (pr *PaymentRepository) querier(ctx context.Context) connector.Querier {
+	return connector.TxQuerier(ctx, pr.db)
+}
+
+type leaseKey struct{}
+
+// paymentLease аренда платежа: owner отличает обработку, взявшую аренду, от следующих
+type paymentLease struct {
+	paymentID string
+	owner     string
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const paymentByIDQuery = `SELECT id, from_user_id, to_user_id, status, currency, amount::text, provider, payout_request_id, payout_id,
+	quote_amount::text, quote_currency, quote_rate, quote_source, quoted_at, quote_expires_at, created_at, updated_at
+	FROM payments WHERE id=$1`
+
+// scanPayment читает строку платежа; сумма выбирается как amount::text, чтобы не терять точность
+func scanPayment(row rowScanner) (*entity.Payment, error) {
+	var (
+		payment  entity.Payment
+		amount   string
+		currency string
+
+		quoteAmount, quoteCurrency, quoteRate, quoteSource *string
+		quotedAt, quoteExpiresAt                           *time.Time
+	)
+	if err := row.Scan(
+		&payment.ID,
+		&payment.FromUserID,
+		&payment.ToUserID,
+		&payment.Status,
+		&currency,
+		&amount,
+		&payment.Provider,
+		&payment.PayoutRequestID,
+		&payment.PayoutID,
+		&quoteAmount,
+		&quoteCurrency,
+		&quoteRate,
+		&quoteSource,
+		&quotedAt,
+		&quoteExpiresAt,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	money, err := entity.ParseMoney(amount, currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount stored for payment %s: %w", payment.ID, err)
+	}
+	payment.Amount = money
+
+	if quoteAmount != nil && quoteCurrency != nil && quotedAt != nil && quoteExpiresAt != nil {
+		converted, err := entity.ParseMoney(*quoteAmount, *quoteCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quote amount stored for payment %s: %w", payment.ID, err)
+		}
+		payment.Quote = &entity.FXQuote{
+			Amount:    converted,
+			Rate:      derefString(quoteRate),
+			Source:    derefString(quoteSource),
+			QuotedAt:  *quotedAt,
+			ExpiresAt: *quoteExpiresAt,
+		}
+	}
+	return &payment, nil
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
 }
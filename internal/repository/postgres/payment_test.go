@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	entity "paymentgo/internal/entity"
+	"paymentgo/utils/connector"
+)
+
+// testPostgresDSNEnv DSN базы для тестов репозиториев, как в тестах PostgresQueue
+const testPostgresDSNEnv = "PAYMENTGO_TEST_POSTGRES_DSN"
+
+// newTestPaymentRepository репозиторий поверх отдельной схемы с применёнными миграциями и miniredis;
+// схема удаляется после теста. Без PAYMENTGO_TEST_POSTGRES_DSN тест пропускается
+func newTestPaymentRepository(t *testing.T) (*PaymentRepository, *pgxpool.Pool, *miniredis.Miniredis) {
+	t.Helper()
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testPostgresDSNEnv)
+	}
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t)
+
+	admin, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("payment_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		assert.NoError(t, err)
+	})
+
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	require.NoError(t, err)
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	require.NoError(t, connector.MigratePostgres(ctx, pool, logger, os.DirFS("../../..")))
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &PaymentRepository{db: pool, redis: client, logger: logger}, pool, mr
+}
+
+func createTestPayment(t *testing.T, repo *PaymentRepository) string {
+	t.Helper()
+	paymentID, err := repo.CreatePayment(context.Background(), "payer", "payee", entity.Money{Minor: 150000, Currency: "RUB"}, "yoomoney")
+	require.NoError(t, err)
+	return paymentID
+}
+
+func TestPaymentRepository_UpdatePaymentStatusLosesCAS(t *testing.T) {
+	repo, _, _ := newTestPaymentRepository(t)
+	ctx := context.Background()
+	paymentID := createTestPayment(t, repo)
+
+	require.NoError(t, repo.UpdatePaymentStatus(ctx, paymentID, entity.StatusPending, entity.StatusSuccess, "paid"))
+
+	// Второй писатель прочитал PENDING до первого перехода
+	err := repo.UpdatePaymentStatus(ctx, paymentID, entity.StatusPending, entity.StatusFailed, "refused")
+	require.ErrorIs(t, err, entity.ErrStatusConflict)
+	var transitionErr *entity.TransitionError
+	require.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, entity.StatusSuccess, transitionErr.Actual)
+
+	payment, err := repo.GetPaymentByID(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.StatusSuccess, payment.Status)
+
+	// В истории только выигравший переход
+	history, err := repo.GetStatusHistory(ctx, paymentID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, entity.StatusPending, history[0].From)
+	assert.Equal(t, entity.StatusSuccess, history[0].To)
+	assert.Equal(t, "paid", history[0].Reason)
+}
+
+func TestPaymentRepository_RefundTxRollsBack(t *testing.T) {
+	repo, pool, _ := newTestPaymentRepository(t)
+	ctx := context.Background()
+	paymentID := createTestPayment(t, repo)
+	require.NoError(t, repo.UpdatePaymentStatus(ctx, paymentID, entity.StatusPending, entity.StatusSuccess, "paid"))
+
+	// Возврат как в RefundPayment: REFUNDED и встречный платёж, но транзакция не фиксируется
+	errAbort := errors.New("abort refund")
+	err := repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.UpdatePaymentStatus(ctx, paymentID, entity.StatusSuccess, entity.StatusRefunded, "refund requested"); err != nil {
+			return err
+		}
+		if _, err := repo.CreatePayment(ctx, "payee", "payer", entity.Money{Minor: 150000, Currency: "RUB"}, "yoomoney"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+
+	payment, err := repo.GetPaymentByID(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.StatusSuccess, payment.Status)
+
+	var payments, refundedTransitions int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM payments`).Scan(&payments))
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM payment_status_history WHERE to_status = 'REFUNDED'`).Scan(&refundedTransitions))
+	assert.Equal(t, 1, payments)
+	assert.Zero(t, refundedTransitions)
+}
+
+func TestPaymentRepository_StatusChangeInvalidatesCaches(t *testing.T) {
+	repo, _, mr := newTestPaymentRepository(t)
+	ctx := context.Background()
+	paymentID := createTestPayment(t, repo)
+
+	history, err := repo.GetPaymentHistory(ctx, "payee", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, entity.StatusPending, history[0].Status)
+	_, err = repo.GetPaymentDetails(ctx, paymentID)
+	require.NoError(t, err)
+	require.True(t, mr.Exists("payment_details:"+paymentID))
+
+	require.NoError(t, repo.UpdatePaymentStatus(ctx, paymentID, entity.StatusPending, entity.StatusSuccess, "paid"))
+
+	assert.False(t, mr.Exists("payment_details:"+paymentID))
+	history, err = repo.GetPaymentHistory(ctx, "payee", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, entity.StatusSuccess, history[0].Status)
+
+	// Новый платёж сбрасывает историю обоих участников
+	history, err = repo.GetPaymentHistory(ctx, "payer", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	createTestPayment(t, repo)
+	history, err = repo.GetPaymentHistory(ctx, "payer", 1, 10)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type RateRepository struct {
+	db     *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewRateRepository(db *pgxpool.Pool, logger *zap.Logger) repository.RateRepository {
+	return &RateRepository{
+		db:     db,
+		logger: logger.With(zap.String("component", "rate_repository")),
+	}
+}
+
+func (rr *RateRepository) SaveRates(ctx context.Context, rates []*entity.FXRate) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO fx_rates (base, currency, rate_date, rate, source, fetched_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (base, currency, rate_date) DO UPDATE
+	SET rate = EXCLUDED.rate, source = EXCLUDED.source, fetched_at = EXCLUDED.fetched_at
+	WHERE fx_rates.fetched_at <= EXCLUDED.fetched_at`
+
+	batch := &pgx.Batch{}
+	for _, rate := range rates {
+		batch.Queue(query, rate.Base, rate.Currency, entity.RateDate(rate.Date), rate.Rate, rate.Source, rate.FetchedAt)
+	}
+	if err := rr.db.SendBatch(ctx, batch).Close(); err != nil {
+		rr.logger.Error("failed to save rates", zap.Int("count", len(rates)), zap.Error(err))
+		return fmt.Errorf("failed to save rates: %w", err)
+	}
+	return nil
+}
+
+func (rr *RateRepository) RatesAround(ctx context.Context, base, currency string, date time.Time) (*entity.FXRate, *entity.FXRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	date = entity.RateDate(date)
+	before, err := rr.nearest(ctx, `SELECT base, currency, rate_date, rate, source, fetched_at FROM fx_rates
+	WHERE base = $1 AND currency = $2 AND rate_date <= $3
+	ORDER BY rate_date DESC LIMIT 1`, base, currency, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := rr.nearest(ctx, `SELECT base, currency, rate_date, rate, source, fetched_at FROM fx_rates
+	WHERE base = $1 AND currency = $2 AND rate_date > $3
+	ORDER BY rate_date ASC LIMIT 1`, base, currency, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func (rr *RateRepository) nearest(ctx context.Context, query, base, currency string, date time.Time) (*entity.FXRate, error) {
+	var rate entity.FXRate
+	err := rr.db.QueryRow(ctx, query, base, currency, date).Scan(
+		&rate.Base,
+		&rate.Currency,
+		&rate.Date,
+		&rate.Rate,
+		&rate.Source,
+		&rate.FetchedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		rr.logger.Error("failed to fetch rate",
+			zap.String("base", base),
+			zap.String("currency", currency),
+			zap.Time("date", date),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch %s/%s rate: %w", base, currency, err)
+	}
+	rate.Date = entity.RateDate(rate.Date)
+	return &rate, nil
+}
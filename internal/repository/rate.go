@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	entity "paymentgo/internal/entity"
+	"time"
+)
+
+type RateRepository interface {
+	// SaveRates сохраняет курсы; курс того же дня перезаписывается более поздним
+	SaveRates(ctx context.Context, rates []*entity.FXRate) error
+	// RatesAround ближайшие к дню date курсы base -> currency: before не позже date, after позже date.
+	// Отсутствующий курс возвращается как nil
+	RatesAround(ctx context.Context, base, currency string, date time.Time) (before, after *entity.FXRate, err error)
+}
@@ -0,0 +1,28 @@
+package server_demon
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff задержка перед попыткой attempt (начиная с 1): base*2^(attempt-1), не больше max,
+// со случайным джиттером в диапазоне [d/2, d], чтобы повторы разных платежей не совпадали
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
@@ -0,0 +1,37 @@
+package server_demon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff_Grows(t *testing.T) {
+	base, max := time.Second, time.Minute
+
+	cases := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+
+	for _, tc := range cases {
+		for i := 0; i < 50; i++ {
+			delay := backoff(tc.attempt, base, max)
+			assert.GreaterOrEqual(t, delay, tc.ceiling/2, "attempt %d", tc.attempt)
+			assert.LessOrEqual(t, delay, tc.ceiling, "attempt %d", tc.attempt)
+		}
+	}
+}
+
+func TestBackoff_Zero(t *testing.T) {
+	assert.Equal(t, time.Duration(0), backoff(3, 0, time.Minute))
+}
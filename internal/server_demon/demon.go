@@ -2,102 +2,395 @@ package server_demon
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"paymentgo/internal/cmd/auth"
-	"paymentgo/internal/cmd/yoomoney"
+	"paymentgo/internal/config"
 	dto "paymentgo/internal/entity"
 	"paymentgo/internal/repository"
+	"paymentgo/internal/usecase"
 	"paymentgo/internal/usecase/service"
 	"paymentgo/utils/connector"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// providerAuth имя сервиса авторизации для лимитов конкурентности config.Daemon.ProviderLimits,
+// платёжные провайдеры ограничиваются по своему имени (usecase.PaymentProvider.Name)
+const providerAuth = "auth"
+
 type Daemon struct {
 	paymentService service.PaymentService
 	storage        repository.PaymentRepository
-	yooClient      *yoomoney.Client
-	taskQueue      *connector.LockFreeQueue
-	authService    *auth.AuthClient
+	providers      *usecase.ProviderRegistry
+	taskQueue      *resolvingQueue
+	authService    *auth.UserCache
+	deadLetters    repository.DeadLetterRepository
+	elector        connector.LeaderElector
+	cfg            config.Daemon
+	locks          *paymentLocks
+	limiter        *providerLimiter
 	log            *zap.Logger
+
+	// workCtx живёт дольше ctx из Run: начатые платежи доделываются после сигнала остановки
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	done       chan struct{}
 }
 
-func NewDaemon(paymentService service.PaymentService, storage repository.PaymentRepository, yooClient *yoomoney.Client, taskQueue *connector.LockFreeQueue, log *zap.Logger, authService *auth.AuthClient) *Daemon {
+func NewDaemon(paymentService service.PaymentService, storage repository.PaymentRepository, providers *usecase.ProviderRegistry, taskQueue connector.Queue, log *zap.Logger, authService *auth.UserCache, deadLetters repository.DeadLetterRepository, elector connector.LeaderElector, cfg config.Daemon) *Daemon {
+	workCtx, cancelWork := context.WithCancel(context.Background())
 	return &Daemon{
 		paymentService: paymentService,
 		storage:        storage,
-		yooClient:      yooClient,
-		taskQueue:      taskQueue,
+		providers:      providers,
+		taskQueue:      newResolvingQueue(taskQueue),
 		log:            log,
 		authService:    authService,
+		deadLetters:    deadLetters,
+		elector:        elector,
+		cfg:            cfg,
+		locks:          newPaymentLocks(),
+		limiter:        newProviderLimiter(cfg.ProviderLimits),
+		workCtx:        workCtx,
+		cancelWork:     cancelWork,
+		done:           make(chan struct{}),
+	}
+}
+
+// Run ждёт лидерства и на время лидерства запускает пул воркеров.
+// При потере лидерства воркеры останавливаются, и реплика снова участвует в выборах.
+// Отмена ctx прекращает выборку новых задач, текущие платежи обрабатываются до конца
+func (d *Daemon) Run(ctx context.Context) {
+	defer close(d.done)
+	defer d.cancelWork()
+
+	for {
+		leaderCtx, resign, err := d.elector.Lead(ctx)
+		if err != nil {
+			break
+		}
+
+		d.runWorkers(leaderCtx)
+		resign()
+
+		if ctx.Err() != nil {
+			break
+		}
+		d.log.Warn("Payment daemon lost leadership, waiting for re-election")
 	}
+	log.Println("Payment daemon gracefully stopped.")
 }
 
-// Run запускает постоянную обработку платежей
-func (d Daemon) Run(ctx context.Context) {
+// runWorkers запускает воркеров, разбирающих общую очередь, и ждёт их остановки
+func (d *Daemon) runWorkers(ctx context.Context) {
+	workers := max(d.cfg.Workers, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	d.log.Info("Payment daemon started", zap.Int("workers", workers))
+
+	wg.Wait()
+}
+
+// Shutdown ждёт, пока воркеры доделают текущие платежи. Если ctx истекает раньше,
+// обработка прерывается, а незавершённые задачи возвращаются в очередь без штрафа за попытку
+func (d *Daemon) Shutdown(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.cancelWork()
+	<-d.done
+	return ctx.Err()
+}
+
+func (d *Daemon) work(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Payment daemon gracefully stopped.")
 			return
 		default:
-			d.processNext(ctx)
+		}
+
+		if !d.processNext(d.workCtx) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(d.cfg.PollInterval):
+			}
 		}
 	}
 }
 
-func (d Daemon) processNext(ctx context.Context) {
-	item, ok := d.taskQueue.Dequeue()
+// processNext обрабатывает одну задачу; false, если готовых задач в очереди нет
+func (d *Daemon) processNext(ctx context.Context) bool {
+	task, ok := d.taskQueue.Dequeue()
 	if !ok {
-		time.Sleep(time.Second)
-		return
+		return false
+	}
+
+	payment := task.Payment
+
+	// Дубликат платежа, который уже обрабатывает другой воркер, отбрасывается:
+	// исход решит текущая обработка, а в durable-очереди элемент остаётся скрытым до visibility timeout
+	if !d.locks.tryLock(payment.ID) {
+		d.log.Info("Payment is already being processed", zap.String("payment_id", payment.ID))
+		return true
 	}
+	defer d.locks.unlock(payment.ID)
+	defer d.taskQueue.forget(payment.ID)
 
-	payment := item
+	// Аренда платежа защищает от обработки тем же платежом на другой реплике,
+	// например, бывшим лидером, который доделывает начатые платежи
+	lockedCtx, unlock, err := d.storage.LockPayment(ctx, payment.ID, d.cfg.LockTTL)
+	if errors.Is(err, dto.ErrPaymentLocked) {
+		d.log.Info("Payment is locked by another replica", zap.String("payment_id", payment.ID))
+		d.taskQueue.Retry(task, d.cfg.BaseBackoff, err)
+		return true
+	}
+	if err != nil {
+		d.retry(ctx, task, err)
+		return true
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			// Аренда потеряна до конца обработки: платёж мог перехватить другой воркер. Записи уже зафиксированы,
+			// повтор сверит статус и состояние выплаты заново. Задача, уже получившая исход (Ack, dead-letter
+			// или Retry с задержкой провайдера), не откладывается повторно: это перезаписало бы исход
+			d.log.Error("Failed to release payment lease", zap.String("payment_id", payment.ID), zap.Error(err))
+			if !d.taskQueue.isResolved(payment.ID) {
+				d.taskQueue.Retry(task, d.cfg.BaseBackoff, err)
+			}
+		}
+	}()
+	ctx = lockedCtx
+
+	provider, err := d.providers.Get(payment.Provider)
+	if err != nil {
+		// Провайдер платежа выключен в конфигурации
+		d.deadLetter(ctx, task, err)
+		return true
+	}
 
+	release, err := d.limiter.acquire(ctx, provider.Name())
+	if err != nil {
+		d.taskQueue.Retry(task, 0, err)
+		return true
+	}
 	status, err := d.paymentService.GetPayment(ctx, payment.ID)
+	release()
 	if err != nil {
-		d.taskQueue.Enqueue(payment)
 		d.log.Error("Unable to fetch payment status", zap.String("payment_id", payment.ID), zap.Error(err))
-		return
+		d.retry(ctx, task, err)
+		return true
 	}
 
 	switch status {
 	case "success":
-		d.handleSuccess(ctx, payment)
-	case "pending", "failed":
-		d.taskQueue.Enqueue(payment)
+		d.handleSuccess(ctx, task, provider)
+	case "pending":
+		d.log.Info("Payment is not paid yet", zap.String("payment_id", payment.ID))
+		d.waitPayment(ctx, task)
+	case "failed":
 		d.log.Info("Payment returned to queue", zap.String("payment_id", payment.ID), zap.String("status", status))
-	case "complete":
-		d.log.Info("Payment already completed", zap.String("payment_id", payment.ID))
+		d.retry(ctx, task, fmt.Errorf("payment status is %s", status))
+	case "complete", "refunded":
+		d.taskQueue.Ack(payment.ID)
+		d.log.Info("Payment already settled", zap.String("payment_id", payment.ID), zap.String("status", status))
 	default:
-		d.taskQueue.Enqueue(payment)
 		d.log.Warn("Unknown status received", zap.String("payment_id", payment.ID), zap.String("status", status))
+		d.retry(ctx, task, fmt.Errorf("unknown payment status %q", status))
 	}
+	return true
 }
 
-func (d Daemon) handleSuccess(ctx context.Context, payment dto.Payment) {
+func (d *Daemon) handleSuccess(ctx context.Context, task connector.Task, provider usecase.PaymentProvider) {
+	paymentID := task.Payment.ID
+
+	// Повторы не помогут: провайдер не умеет выплачивать, платёж разбирает оператор
+	if !provider.Capabilities().Payouts {
+		d.deadLetter(ctx, task, fmt.Errorf("payouts via %s: %w", provider.Name(), usecase.ErrNotSupported))
+		return
+	}
+
+	// Состояние выплаты читается из БД: задача могла попасть в очередь до начала выплаты,
+	// а прерванную перезапуском выплату нужно продолжить, а не начать заново
+	payment, err := d.storage.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		d.log.Error("Unable to load payment for payout", zap.String("payment_id", paymentID), zap.Error(err))
+		d.retry(ctx, task, err)
+		return
+	}
+
+	release, err := d.limiter.acquire(ctx, providerAuth)
+	if err != nil {
+		d.taskQueue.Retry(task, 0, err)
+		return
+	}
 	user, err := d.authService.GetUserById(ctx, payment.ToUserID)
+	release()
+	if errors.Is(err, auth.ErrCircuitOpen) {
+		// Сервис авторизации лежит: попытка не засчитывается, задача ждёт его восстановления
+		d.log.Warn("Receiver lookup skipped", zap.String("user_id", payment.ToUserID), zap.Error(err))
+		d.taskQueue.Retry(task, d.cfg.BaseBackoff, err)
+		return
+	}
 	if err != nil {
-		d.taskQueue.Enqueue(payment)
 		d.log.Error("Receiver lookup failed", zap.String("user_id", payment.ToUserID), zap.Error(err))
+		d.retry(ctx, task, err)
 		return
 	}
 
-	if err := d.storage.UpdatePaymentStatus(ctx, payment.ID, dto.StatusComplete); err != nil {
-		d.taskQueue.Enqueue(payment)
-		d.log.Error("Failed to mark payment as complete", zap.String("payment_id", payment.ID), zap.Error(err))
+	if !d.payout(ctx, task, provider, payment, user.YoomoneyId) {
 		return
 	}
 
-	result, err := d.yooClient.InitiateTransfer(&payment, user.YoomoneyId)
-	if err != nil {
-		_ = d.storage.UpdatePaymentStatus(ctx, payment.ID, dto.StatusSuccess)
-		d.taskQueue.Enqueue(payment)
-		d.log.Error("Transfer initiation failed", zap.String("payment_id", payment.ID), zap.Error(err))
+	// Статус COMPLETE пишется только после проведённого перевода: откат COMPLETE -> SUCCESS запрещён таблицей переходов.
+	// Перевод уже отправлен, поэтому статус фиксируется даже при остановке сервиса
+	if err := d.storage.UpdatePaymentStatus(context.WithoutCancel(ctx), paymentID, dto.StatusSuccess, dto.StatusComplete, "transfer to recipient completed"); err != nil {
+		// Повтор безопасен: request_id перевода сохранён до его проведения, и провайдер
+		// проведёт тот же запрос повторно или вернёт сохранённый PayoutID, не регистрируя новый перевод
+		d.log.Error("Transfer sent but payment was not marked as complete", zap.String("payment_id", paymentID), zap.Error(err))
+		d.retry(ctx, task, err)
+		return
+	}
+
+	d.taskQueue.Ack(paymentID)
+	d.log.Info("Transfer completed successfully",
+		zap.String("payment_id", paymentID),
+		zap.String("provider", provider.Name()),
+		zap.String("payout_id", payment.PayoutID))
+}
+
+// maxPayoutSteps шагов выплаты за одну обработку: регистрация, проведение и повторная регистрация истёкшего запроса
+const maxPayoutSteps = 4
+
+// payout проводит выплату по шагам провайдера и сохраняет её состояние после каждого шага.
+// true, если перевод проведён; иначе задача уже отложена или перенесена в dead-letter
+func (d *Daemon) payout(ctx context.Context, task connector.Task, provider usecase.PaymentProvider, payment *dto.Payment, recipient string) bool {
+	for step := 0; step < maxPayoutSteps; step++ {
+		release, err := d.limiter.acquire(ctx, provider.Name())
+		if err != nil {
+			d.taskQueue.Retry(task, 0, err)
+			return false
+		}
+		result, err := provider.Payout(ctx, payment, recipient)
+		release()
+		if errors.Is(err, usecase.ErrPayoutRejected) {
+			// Кошелёк получателя мог смениться: после возврата из dead-letter он запрашивается заново
+			if invalidateErr := d.authService.Invalidate(ctx, payment.ToUserID); invalidateErr != nil {
+				d.log.Warn("Failed to invalidate recipient", zap.String("user_id", payment.ToUserID), zap.Error(invalidateErr))
+			}
+			d.deadLetter(ctx, task, err)
+			return false
+		}
+		if err != nil {
+			d.log.Error("Transfer step failed", zap.String("payment_id", payment.ID), zap.Error(err))
+			d.retry(ctx, task, err)
+			return false
+		}
+
+		if result.RequestID != payment.PayoutRequestID || result.PaymentID != payment.PayoutID {
+			// Состояние фиксируется в БД до следующего шага: без сохранённого request_id повтор
+			// зарегистрирует и проведёт новый перевод, поэтому при ошибке записи выплата не продолжается.
+			// Проведённый, но не сохранённый перевод повтор получит снова по уже сохранённому request_id
+			if err := d.storage.SavePayout(context.WithoutCancel(ctx), payment.ID, result.RequestID, result.PaymentID); err != nil {
+				d.log.Error("Failed to save payout state", zap.String("payment_id", payment.ID), zap.Error(err))
+				d.retry(ctx, task, err)
+				return false
+			}
+			payment.PayoutRequestID, payment.PayoutID = result.RequestID, result.PaymentID
+		}
+
+		switch result.Status {
+		case usecase.PayoutCompleted:
+			return true
+		case usecase.PayoutInProgress:
+			// Провайдер ещё проводит перевод: попытка не расходуется, пауза по подсказке провайдера
+			d.log.Info("Transfer is in progress",
+				zap.String("payment_id", payment.ID),
+				zap.Duration("next_retry", result.NextRetry))
+			d.taskQueue.Retry(task, result.NextRetry, fmt.Errorf("payout %s is in progress", result.RequestID))
+			return false
+		}
+	}
+
+	d.retry(ctx, task, fmt.Errorf("payout was not completed in %d steps", maxPayoutSteps))
+	return false
+}
+
+// retry откладывает задачу с экспоненциальной задержкой или переносит её в dead-letter,
+// если исчерпаны попытки или платёж слишком долго в очереди
+func (d *Daemon) retry(ctx context.Context, task connector.Task, cause error) {
+	if lost := context.Cause(ctx); errors.Is(lost, dto.ErrPaymentLeaseLost) {
+		// Аренду платежа перехватил другой воркер: попытка не засчитывается
+		d.taskQueue.Retry(task, d.cfg.BaseBackoff, lost)
+		return
+	}
+	if errors.Is(cause, context.Canceled) && ctx.Err() != nil {
+		// Обработку прервала остановка сервиса: задача возвращается в очередь как есть
+		d.taskQueue.Retry(task, 0, cause)
+		return
+	}
+
+	task.Attempts++
+
+	expired := d.cfg.MaxAge > 0 && !task.EnqueuedAt.IsZero() && time.Since(task.EnqueuedAt) > d.cfg.MaxAge
+	if task.Attempts < d.cfg.MaxAttempts && !expired {
+		d.taskQueue.Retry(task, backoff(task.Attempts, d.cfg.BaseBackoff, d.cfg.MaxBackoff), cause)
+		return
+	}
+
+	d.deadLetter(ctx, task, cause)
+}
+
+// waitPayment откладывает проверку неоплаченной ссылки, не засчитывая попытку: ссылку оплачивают
+// когда угодно в пределах MaxAge, после чего платёж уходит в dead-letter. Задержка растёт со временем
+// ожидания (десятая его часть) от BaseBackoff до MaxBackoff
+func (d *Daemon) waitPayment(ctx context.Context, task connector.Task) {
+	var waited time.Duration
+	if !task.EnqueuedAt.IsZero() {
+		waited = time.Since(task.EnqueuedAt)
+	}
+	if d.cfg.MaxAge > 0 && waited > d.cfg.MaxAge {
+		d.deadLetter(ctx, task, fmt.Errorf("payment was not paid in %s", d.cfg.MaxAge))
+		return
+	}
+
+	delay := min(max(waited/10, d.cfg.BaseBackoff), d.cfg.MaxBackoff)
+	d.taskQueue.Retry(task, delay, errors.New("payment status is pending"))
+}
+
+// deadLetter снимает платёж с обработки и переносит его в dead-letter
+func (d *Daemon) deadLetter(ctx context.Context, task connector.Task, cause error) {
+	letter := &dto.DeadLetter{
+		PaymentID:  task.Payment.ID,
+		Payment:    task.Payment,
+		Attempts:   task.Attempts,
+		LastError:  cause.Error(),
+		EnqueuedAt: task.EnqueuedAt,
+	}
+	if err := d.deadLetters.Add(ctx, letter); err != nil {
+		// Без записи в dead-letter платёж нельзя терять: пробуем позже
+		d.log.Error("Failed to dead-letter payment", zap.String("payment_id", task.Payment.ID), zap.Error(err))
+		d.taskQueue.Retry(task, d.cfg.MaxBackoff, cause)
 		return
 	}
 
-	d.log.Info("Transfer initiated successfully", zap.String("status", result))
+	d.taskQueue.Ack(task.Payment.ID)
+	d.log.Warn("Payment moved to dead-letter",
+		zap.String("payment_id", task.Payment.ID),
+		zap.Int("attempts", task.Attempts),
+		zap.Error(cause))
 }
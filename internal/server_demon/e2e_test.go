@@ -0,0 +1,551 @@
+package server_demon
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/cmd/convert"
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	"paymentgo/internal/cmd/yoomoney/fake"
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	pb "paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase"
+	"paymentgo/internal/usecase/service"
+	"paymentgo/utils/connector"
+)
+
+const e2eRecipientWallet = "41001000040"
+
+type memoryPaymentRepo struct {
+	repository.PaymentRepository
+	mu       sync.Mutex
+	payments map[string]*dto.Payment
+	// quotes история котировок платежей, как payment_quotes
+	quotes map[string][]*dto.FXQuote
+	// failSavePayout сколько следующих SavePayout завершатся ошибкой
+	failSavePayout int
+	// leased платежи под арендой LockPayment
+	leased map[string]bool
+	// leases сколько раз брали аренду платежа; loseLeases unlock сообщает о потерянной аренде
+	leases     map[string]int
+	loseLeases bool
+}
+
+func (m *memoryPaymentRepo) CreatePayment(ctx context.Context, fromID, toID string, amount dto.Money, provider string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := uuid.NewString()
+	m.payments[id] = &dto.Payment{
+		ID:         id,
+		FromUserID: fromID,
+		ToUserID:   toID,
+		Amount:     amount,
+		Status:     dto.StatusPending,
+		Provider:   provider,
+	}
+	return id, nil
+}
+
+func (m *memoryPaymentRepo) GetPaymentByID(ctx context.Context, paymentID string) (*dto.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.payments[paymentID]
+	if !ok {
+		return nil, dto.ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+func (m *memoryPaymentRepo) UpdatePaymentStatus(ctx context.Context, paymentID string, from, to dto.PaymentStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := dto.ValidateTransition(paymentID, from, to); err != nil {
+		return err
+	}
+	payment := m.payments[paymentID]
+	if payment.Status != from {
+		return &dto.TransitionError{PaymentID: paymentID, From: from, To: to, Actual: payment.Status, Err: dto.ErrStatusConflict}
+	}
+	payment.Status = to
+	return nil
+}
+
+func (m *memoryPaymentRepo) SavePayout(ctx context.Context, paymentID, requestID, payoutID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failSavePayout > 0 {
+		m.failSavePayout--
+		return errors.New("database is unavailable")
+	}
+	payment := m.payments[paymentID]
+	payment.PayoutRequestID, payment.PayoutID = requestID, payoutID
+	return nil
+}
+
+func (m *memoryPaymentRepo) SaveQuote(ctx context.Context, paymentID string, quote dto.FXQuote) (*dto.FXQuote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.payments[paymentID]
+	if !ok {
+		return nil, dto.ErrPaymentNotFound
+	}
+	if current := payment.Quote; current != nil && current.Amount.Currency == quote.Amount.Currency && !current.Expired(quote.QuotedAt) {
+		return current, nil
+	}
+	payment.Quote = &quote
+	m.quotes[paymentID] = append(m.quotes[paymentID], &quote)
+	return &quote, nil
+}
+
+func (m *memoryPaymentRepo) GetQuotes(ctx context.Context, paymentID string) ([]*dto.FXQuote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quotes[paymentID], nil
+}
+
+func (m *memoryPaymentRepo) expireQuote(paymentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payments[paymentID].Quote.ExpiresAt = time.Now().Add(-time.Second)
+}
+
+func (m *memoryPaymentRepo) LockPayment(ctx context.Context, paymentID string, ttl time.Duration) (context.Context, func() error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.payments[paymentID]; !ok {
+		return nil, nil, dto.ErrPaymentNotFound
+	}
+	if m.leased[paymentID] {
+		return nil, nil, dto.ErrPaymentLocked
+	}
+	m.leased[paymentID] = true
+	m.leases[paymentID]++
+	return ctx, func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.leased, paymentID)
+		if m.loseLeases {
+			return dto.ErrPaymentLeaseLost
+		}
+		return nil
+	}, nil
+}
+
+func (m *memoryPaymentRepo) status(paymentID string) dto.PaymentStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.payments[paymentID].Status
+}
+
+func (m *memoryPaymentRepo) get(paymentID string) dto.Payment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.payments[paymentID]
+}
+
+type memoryDeadLetters struct {
+	repository.DeadLetterRepository
+	mu      sync.Mutex
+	letters []*dto.DeadLetter
+}
+
+func (m *memoryDeadLetters) Add(ctx context.Context, letter *dto.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = append(m.letters, letter)
+	return nil
+}
+
+func (m *memoryDeadLetters) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.letters)
+}
+
+// e2eRates курсы валют к рублю, которые можно менять по ходу теста
+type e2eRates struct {
+	mu    sync.Mutex
+	toRUB map[string]*big.Rat
+}
+
+func (r *e2eRates) Name() string {
+	return "e2e"
+}
+
+func (r *e2eRates) Rates(ctx context.Context, base string, targets []string) (map[string]*big.Rat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rates := make(map[string]*big.Rat)
+	if rate, ok := r.toRUB[base]; ok && slices.Contains(targets, "RUB") {
+		rates["RUB"] = rate
+	}
+	return rates, nil
+}
+
+func (r *e2eRates) set(currency, rate string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toRUB[currency], _ = new(big.Rat).SetString(rate)
+}
+
+type e2eAuthServer struct {
+	pb.UnimplementedAuthServer
+}
+
+func (e2eAuthServer) GetUserById(ctx context.Context, req *pb.GetUserByIdRequest) (*pb.GetUserByIdResponse, error) {
+	return &pb.GetUserByIdResponse{YoomoneyId: e2eRecipientWallet}, nil
+}
+
+type e2eEnv struct {
+	yoomoney    *fake.Server
+	repo        *memoryPaymentRepo
+	rates       *e2eRates
+	deadLetters *memoryDeadLetters
+	service     *service.PaymentService
+	provider    usecase.PaymentProvider
+	queue       *connector.LockFreeQueue
+}
+
+// newE2E собирает PaymentService и Daemon поверх фейкового ЮMoney и запускает демон на время теста
+func newE2E(t *testing.T) *e2eEnv {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+
+	yoomoneyServer := fake.New()
+	httpServer := httptest.NewServer(yoomoneyServer)
+	t.Cleanup(httpServer.Close)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer()
+	pb.RegisterAuthServer(grpcServer, e2eAuthServer{})
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	authClient, err := auth.NewAuthClient(config.AuthClient{Address: listener.Addr().String(), Timeout: time.Second}, logger)
+	require.NoError(t, err)
+	t.Cleanup(authClient.Close)
+
+	cfg := &config.Config{}
+	cfg.Yoomoney.BaseURL = httpServer.URL
+	cfg.Yoomoney.Timeout = time.Second
+	// Курсы не кешируются, котировка ссылки действует минуту
+	cfg.Forex.Timeout = time.Second
+	cfg.Forex.QuoteTTL = time.Minute
+	provider := yoomoney.NewProvider(yoomoney.New(cfg), dto.CoreAccount)
+	providers, err := usecase.NewProviderRegistry(yoomoney.ProviderName, provider)
+	require.NoError(t, err)
+
+	repo := &memoryPaymentRepo{payments: make(map[string]*dto.Payment), quotes: make(map[string][]*dto.FXQuote), leased: make(map[string]bool), leases: make(map[string]int)}
+	deadLetters := &memoryDeadLetters{}
+	queue := connector.NewPaymentsQueue()
+	rates := &e2eRates{toRUB: make(map[string]*big.Rat)}
+	converter := convert.NewForexClient(cfg, []convert.RateSource{rates}, nil, logger)
+	paymentService := service.NewPaymentService(repo, logger, converter, providers, queue)
+
+	daemon := NewDaemon(*paymentService, repo, providers, queue, logger, auth.NewUserCache(authClient, nil, config.AuthUsers{}, logger), deadLetters, connector.AlwaysLeader{}, config.Daemon{
+		Workers:      2,
+		MaxAttempts:  5,
+		BaseBackoff:  10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go daemon.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		assert.NoError(t, daemon.Shutdown(shutdownCtx))
+	})
+
+	return &e2eEnv{yoomoney: yoomoneyServer, repo: repo, rates: rates, deadLetters: deadLetters, service: paymentService, provider: provider, queue: queue}
+}
+
+func (e *e2eEnv) createPayment(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	paymentID, err := e.service.CreatePayment(ctx, "payer", "payee", dto.Money{Minor: 150000, Currency: "RUB"}, "")
+	require.NoError(t, err)
+
+	link, err := e.service.GetPaymentLink(ctx, paymentID)
+	require.NoError(t, err)
+	require.Contains(t, link, paymentID)
+	return paymentID
+}
+
+func TestE2E_PaymentCompletesAfterPay(t *testing.T) {
+	env := newE2E(t)
+	// Первые запросы статуса упираются в сбои провайдера, демон их переживает ретраями
+	env.yoomoney.Script(fake.EndpointOperationHistory,
+		fake.Scenario{HTTPStatus: 503},
+		fake.Scenario{Status: fake.StatusInProgress},
+	)
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+
+	transfers := env.yoomoney.Transfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, e2eRecipientWallet, transfers[0].To)
+	assert.Equal(t, paymentID, transfers[0].Label)
+	assert.Equal(t, int64(150000), transfers[0].Amount.Minor)
+	assert.Equal(t, fake.StatusSuccess, transfers[0].Status)
+	assert.Zero(t, env.deadLetters.count())
+
+	payment := env.repo.get(paymentID)
+	assert.Equal(t, transfers[0].RequestID, payment.PayoutRequestID)
+	assert.Equal(t, transfers[0].PaymentID, payment.PayoutID)
+}
+
+func TestE2E_UnpaidLinkDoesNotUseAttempts(t *testing.T) {
+	env := newE2E(t)
+
+	paymentID := env.createPayment(t)
+	// За это время демон опрашивает неоплаченную ссылку больше MaxAttempts раз
+	time.Sleep(300 * time.Millisecond)
+	assert.Zero(t, env.deadLetters.count())
+
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, env.deadLetters.count())
+}
+
+func TestE2E_PayoutInProgressHonorsNextRetry(t *testing.T) {
+	env := newE2E(t)
+	env.yoomoney.Script(fake.EndpointProcessPayment,
+		fake.Scenario{Status: fake.StatusInProgress, NextRetry: 50 * time.Millisecond},
+		fake.Scenario{HTTPStatus: 503},
+		fake.Scenario{Status: fake.StatusInProgress, NextRetry: 50 * time.Millisecond},
+	)
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Повторы process-payment идут по тому же request_id и не создают новых переводов
+	transfers := env.yoomoney.Transfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, fake.StatusSuccess, transfers[0].Status)
+	// Оплата зачислила сумму на кошелёк, выплата списала её один раз
+	assert.Equal(t, int64(100000000), env.yoomoney.Balance().Minor)
+}
+
+func TestE2E_ResumesInterruptedPayout(t *testing.T) {
+	env := newE2E(t)
+	ctx := context.Background()
+
+	paymentID, err := env.service.CreatePayment(ctx, "payer", "payee", dto.Money{Minor: 150000, Currency: "RUB"}, "")
+	require.NoError(t, err)
+	require.NoError(t, env.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending, dto.StatusSuccess, "paid"))
+	payment := env.repo.get(paymentID)
+	_, err = env.provider.CreatePaymentLink(ctx, &payment, payment.Amount)
+	require.NoError(t, err)
+	_, err = env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	// Перевод зарегистрирован до перезапуска, но не проведён
+	payout, err := env.provider.Payout(ctx, &payment, e2eRecipientWallet)
+	require.NoError(t, err)
+	require.NoError(t, env.repo.SavePayout(ctx, paymentID, payout.RequestID, ""))
+
+	require.NoError(t, env.queue.Enqueue(ctx, payment))
+
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+
+	transfers := env.yoomoney.Transfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, payout.RequestID, transfers[0].RequestID)
+	assert.Equal(t, fake.StatusSuccess, transfers[0].Status)
+}
+
+func TestE2E_LostLeaseDoesNotRequeueSettledPayment(t *testing.T) {
+	env := newE2E(t)
+	ctx := context.Background()
+	env.repo.mu.Lock()
+	env.repo.loseLeases = true
+	env.repo.mu.Unlock()
+
+	paymentID, err := env.service.CreatePayment(ctx, "payer", "payee", dto.Money{Minor: 150000, Currency: "RUB"}, "")
+	require.NoError(t, err)
+	require.NoError(t, env.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending, dto.StatusSuccess, "paid"))
+	payment := env.repo.get(paymentID)
+	_, err = env.provider.CreatePaymentLink(ctx, &payment, payment.Amount)
+	require.NoError(t, err)
+	_, err = env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+	require.NoError(t, env.queue.Enqueue(ctx, payment))
+
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Задача подтверждена до снятия аренды: ошибка снятия не возвращает её в очередь
+	time.Sleep(100 * time.Millisecond)
+	env.repo.mu.Lock()
+	leases := env.repo.leases[paymentID]
+	env.repo.mu.Unlock()
+	assert.Equal(t, 1, leases)
+	require.Len(t, env.yoomoney.Transfers(), 1)
+}
+
+func TestE2E_UnsavedPayoutRequestIsNotProcessed(t *testing.T) {
+	env := newE2E(t)
+	env.repo.mu.Lock()
+	env.repo.failSavePayout = 1
+	env.repo.mu.Unlock()
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return env.repo.status(paymentID) == dto.StatusComplete
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Запрос, который не удалось сохранить, не проводится: повтор регистрирует новый и переводит один раз
+	transfers := env.yoomoney.Transfers()
+	require.Len(t, transfers, 2)
+	assert.NotEqual(t, fake.StatusSuccess, transfers[0].Status)
+	assert.Equal(t, fake.StatusSuccess, transfers[1].Status)
+	assert.Equal(t, transfers[1].RequestID, env.repo.get(paymentID).PayoutRequestID)
+	assert.Equal(t, int64(100000000), env.yoomoney.Balance().Minor)
+}
+
+func TestE2E_RefundDuringPayoutIsRejected(t *testing.T) {
+	env := newE2E(t)
+	ctx := context.Background()
+	// Провайдер проводит перевод долго: демон регистрирует запрос и откладывает задачу
+	env.yoomoney.Script(fake.EndpointProcessPayment, fake.Scenario{Status: fake.StatusInProgress, NextRetry: time.Hour})
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		payment := env.repo.get(paymentID)
+		return payment.Status == dto.StatusSuccess && payment.PayoutRequestID != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Пока платёж арендован, возврат не начинается
+	_, unlock, err := env.repo.LockPayment(ctx, paymentID, time.Minute)
+	require.NoError(t, err)
+	err = env.service.RefundPayment(ctx, paymentID)
+	assert.ErrorIs(t, err, service.ErrConflict)
+	require.NoError(t, unlock())
+
+	err = env.service.RefundPayment(ctx, paymentID)
+	assert.ErrorIs(t, err, service.ErrInvalidState)
+	var domainErr *service.Error
+	require.ErrorAs(t, err, &domainErr)
+	assert.Equal(t, service.ReasonPayoutInProgress, domainErr.Reason)
+
+	assert.Equal(t, dto.StatusSuccess, env.repo.status(paymentID))
+	env.repo.mu.Lock()
+	assert.Len(t, env.repo.payments, 1)
+	env.repo.mu.Unlock()
+}
+
+func TestE2E_RejectedPayoutIsDeadLettered(t *testing.T) {
+	env := newE2E(t)
+	env.yoomoney.Script(fake.EndpointRequestPayment, fake.Scenario{Error: "payee_not_found"})
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Pay(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return env.deadLetters.count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, dto.StatusSuccess, env.repo.status(paymentID))
+	assert.Empty(t, env.yoomoney.Transfers())
+}
+
+func TestE2E_RefusedPaymentIsDeadLettered(t *testing.T) {
+	env := newE2E(t)
+
+	paymentID := env.createPayment(t)
+	_, err := env.yoomoney.Refuse(paymentID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return env.deadLetters.count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, dto.StatusFailed, env.repo.status(paymentID))
+	assert.Empty(t, env.yoomoney.Transfers())
+}
+
+func TestE2E_ForeignCurrencyLinkUsesLockedQuote(t *testing.T) {
+	env := newE2E(t)
+	ctx := context.Background()
+	env.rates.set("USD", "76.5")
+
+	paymentID, err := env.service.CreatePayment(ctx, "payer", "payee", dto.Money{Minor: 1000, Currency: "USD"}, "")
+	require.NoError(t, err)
+	link, err := env.service.GetPaymentLink(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Contains(t, link, "sum=765.00")
+
+	payment, err := env.service.GetPaymentByID(ctx, paymentID)
+	require.NoError(t, err)
+	require.NotNil(t, payment.Quote)
+	assert.Equal(t, dto.Money{Minor: 1000, Currency: "USD"}, payment.Amount)
+	assert.Equal(t, dto.Money{Minor: 76500, Currency: "RUB"}, payment.Quote.Amount)
+	assert.Equal(t, "76.5", payment.Quote.Rate)
+	assert.Equal(t, "e2e", payment.Quote.Source)
+	assert.Equal(t, time.Minute, payment.Quote.ExpiresAt.Sub(payment.Quote.QuotedAt))
+
+	// Курс изменился, но повторная ссылка выставляется по зафиксированной котировке
+	env.rates.set("USD", "80")
+	link, err = env.service.GetPaymentLink(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Contains(t, link, "sum=765.00")
+	assert.Equal(t, payment.Quote, env.repo.get(paymentID).Quote)
+
+	// Истёкшая котировка заменяется новой по текущему курсу
+	env.repo.expireQuote(paymentID)
+	link, err = env.service.GetPaymentLink(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Contains(t, link, "sum=800.00")
+	assert.Equal(t, "80", env.repo.get(paymentID).Quote.Rate)
+
+	// Первую ссылку ещё могут оплатить: к оплате принимаются суммы обеих котировок
+	reissued := env.repo.get(paymentID)
+	amounts, err := env.service.ChargeAmounts(ctx, &reissued)
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Money{{Minor: 76500, Currency: "RUB"}, {Minor: 80000, Currency: "RUB"}}, amounts)
+}
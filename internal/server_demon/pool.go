@@ -0,0 +1,109 @@
+package server_demon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"paymentgo/utils/connector"
+)
+
+// paymentLocks гарантирует, что один платёж в процессе обрабатывает только один воркер
+type paymentLocks struct {
+	mu     sync.Mutex
+	locked map[string]struct{}
+}
+
+func newPaymentLocks() *paymentLocks {
+	return &paymentLocks{locked: make(map[string]struct{})}
+}
+
+// tryLock занимает платёж; false, если его уже обрабатывает другой воркер
+func (l *paymentLocks) tryLock(paymentID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, busy := l.locked[paymentID]; busy {
+		return false
+	}
+	l.locked[paymentID] = struct{}{}
+	return true
+}
+
+func (l *paymentLocks) unlock(paymentID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.locked, paymentID)
+}
+
+// resolvingQueue отмечает платежи, задачи которых уже получили исход: Ack (в том числе после
+// переноса в dead-letter) или Retry. Отметка читается до окончания обработки платежа
+type resolvingQueue struct {
+	connector.Queue
+	mu       sync.Mutex
+	resolved map[string]struct{}
+}
+
+func newResolvingQueue(queue connector.Queue) *resolvingQueue {
+	return &resolvingQueue{Queue: queue, resolved: make(map[string]struct{})}
+}
+
+func (q *resolvingQueue) Retry(task connector.Task, delay time.Duration, cause error) {
+	q.mark(task.Payment.ID)
+	q.Queue.Retry(task, delay, cause)
+}
+
+func (q *resolvingQueue) Ack(paymentID string) {
+	q.mark(paymentID)
+	q.Queue.Ack(paymentID)
+}
+
+func (q *resolvingQueue) mark(paymentID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.resolved[paymentID] = struct{}{}
+}
+
+// isResolved true, если задача платежа уже подтверждена или отложена
+func (q *resolvingQueue) isResolved(paymentID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.resolved[paymentID]
+	return ok
+}
+
+// forget снимает отметку по окончании обработки платежа
+func (q *resolvingQueue) forget(paymentID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.resolved, paymentID)
+}
+
+// providerLimiter ограничивает число одновременных вызовов каждого внешнего сервиса
+type providerLimiter struct {
+	slots map[string]chan struct{}
+}
+
+func newProviderLimiter(limits map[string]int) *providerLimiter {
+	slots := make(map[string]chan struct{}, len(limits))
+	for provider, limit := range limits {
+		if limit > 0 {
+			slots[provider] = make(chan struct{}, limit)
+		}
+	}
+	return &providerLimiter{slots: slots}
+}
+
+// acquire ждёт свободный слот провайдера; для провайдеров без лимита возвращается сразу
+func (l *providerLimiter) acquire(ctx context.Context, provider string) (func(), error) {
+	slot, ok := l.slots[provider]
+	if !ok {
+		return func() {}, nil
+	}
+
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
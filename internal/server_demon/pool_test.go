@@ -0,0 +1,75 @@
+package server_demon
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentLocks(t *testing.T) {
+	locks := newPaymentLocks()
+
+	assert.True(t, locks.tryLock("payment-1"))
+	assert.False(t, locks.tryLock("payment-1"))
+	assert.True(t, locks.tryLock("payment-2"))
+
+	locks.unlock("payment-1")
+	assert.True(t, locks.tryLock("payment-1"))
+}
+
+func TestProviderLimiter_LimitsConcurrency(t *testing.T) {
+	limiter := newProviderLimiter(map[string]int{"yoomoney": 2})
+
+	var (
+		wg      sync.WaitGroup
+		current int32
+		peak    int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.acquire(context.Background(), "yoomoney")
+			assert.NoError(t, err)
+			defer release()
+
+			now := atomic.AddInt32(&current, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak, int32(2))
+}
+
+func TestProviderLimiter_Unlimited(t *testing.T) {
+	limiter := newProviderLimiter(map[string]int{"yoomoney": 1})
+
+	release, err := limiter.acquire(context.Background(), "auth")
+	assert.NoError(t, err)
+	release()
+}
+
+func TestProviderLimiter_ContextCancelled(t *testing.T) {
+	limiter := newProviderLimiter(map[string]int{"yoomoney": 1})
+
+	release, err := limiter.acquire(context.Background(), "yoomoney")
+	assert.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx, "yoomoney")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -26,6 +26,8 @@ const (
 	PaymentService_GetPaymentHistory_FullMethodName = "/payment.PaymentService/GetPaymentHistory"
 	PaymentService_GetPaymentLink_FullMethodName    = "/payment.PaymentService/GetPaymentLink"
 	PaymentService_GetActivePayments_FullMethodName = "/payment.PaymentService/GetActivePayments"
+	PaymentService_GetExchangeRate_FullMethodName   = "/payment.PaymentService/GetExchangeRate"
+	PaymentService_WatchPayment_FullMethodName      = "/payment.PaymentService/WatchPayment"
 )
 
 // PaymentServiceClient is the client API for PaymentService service.
@@ -39,6 +41,9 @@ type PaymentServiceClient interface {
 	GetPaymentHistory(ctx context.Context, in *GetPaymentHistoryRequest, opts ...grpc.CallOption) (*GetPaymentHistoryResponse, error)
 	GetPaymentLink(ctx context.Context, in *GetPaymentLinkRequest, opts ...grpc.CallOption) (*GetPaymentLinkResponse, error)
 	GetActivePayments(ctx context.Context, in *GetActivePaymentsRequest, opts ...grpc.CallOption) (*GetActivePaymentsResponse, error)
+	GetExchangeRate(ctx context.Context, in *GetExchangeRateRequest, opts ...grpc.CallOption) (*GetExchangeRateResponse, error)
+	// WatchPayment текущее состояние платежа, затем каждая смена статуса
+	WatchPayment(ctx context.Context, in *WatchPaymentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PaymentEvent], error)
 }
 
 type paymentServiceClient struct {
@@ -119,6 +124,35 @@ func (c *paymentServiceClient) GetActivePayments(ctx context.Context, in *GetAct
 	return out, nil
 }
 
+func (c *paymentServiceClient) GetExchangeRate(ctx context.Context, in *GetExchangeRateRequest, opts ...grpc.CallOption) (*GetExchangeRateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetExchangeRateResponse)
+	err := c.cc.Invoke(ctx, PaymentService_GetExchangeRate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) WatchPayment(ctx context.Context, in *WatchPaymentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PaymentEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PaymentService_ServiceDesc.Streams[0], PaymentService_WatchPayment_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchPaymentRequest, PaymentEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PaymentService_WatchPaymentClient = grpc.ServerStreamingClient[PaymentEvent]
+
 // PaymentServiceServer is the server API for PaymentService service.
 // All implementations must embed UnimplementedPaymentServiceServer
 // for forward compatibility.
@@ -130,6 +164,9 @@ type PaymentServiceServer interface {
 	GetPaymentHistory(context.Context, *GetPaymentHistoryRequest) (*GetPaymentHistoryResponse, error)
 	GetPaymentLink(context.Context, *GetPaymentLinkRequest) (*GetPaymentLinkResponse, error)
 	GetActivePayments(context.Context, *GetActivePaymentsRequest) (*GetActivePaymentsResponse, error)
+	GetExchangeRate(context.Context, *GetExchangeRateRequest) (*GetExchangeRateResponse, error)
+	// WatchPayment текущее состояние платежа, затем каждая смена статуса
+	WatchPayment(*WatchPaymentRequest, grpc.ServerStreamingServer[PaymentEvent]) error
 	mustEmbedUnimplementedPaymentServiceServer()
 }
 
@@ -161,6 +198,12 @@ func (UnimplementedPaymentServiceServer) GetPaymentLink(context.Context, *GetPay
 func (UnimplementedPaymentServiceServer) GetActivePayments(context.Context, *GetActivePaymentsRequest) (*GetActivePaymentsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetActivePayments not implemented")
 }
+func (UnimplementedPaymentServiceServer) GetExchangeRate(context.Context, *GetExchangeRateRequest) (*GetExchangeRateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetExchangeRate not implemented")
+}
+func (UnimplementedPaymentServiceServer) WatchPayment(*WatchPaymentRequest, grpc.ServerStreamingServer[PaymentEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPayment not implemented")
+}
 func (UnimplementedPaymentServiceServer) mustEmbedUnimplementedPaymentServiceServer() {}
 func (UnimplementedPaymentServiceServer) testEmbeddedByValue()                        {}
 
@@ -308,6 +351,35 @@ func _PaymentService_GetActivePayments_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PaymentService_GetExchangeRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExchangeRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).GetExchangeRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_GetExchangeRate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).GetExchangeRate(ctx, req.(*GetExchangeRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_WatchPayment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPaymentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PaymentServiceServer).WatchPayment(m, &grpc.GenericServerStream[WatchPaymentRequest, PaymentEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PaymentService_WatchPaymentServer = grpc.ServerStreamingServer[PaymentEvent]
+
 // PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -343,6 +415,160 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetActivePayments",
 			Handler:    _PaymentService_GetActivePayments_Handler,
 		},
+		{
+			MethodName: "GetExchangeRate",
+			Handler:    _PaymentService_GetExchangeRate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPayment",
+			Handler:       _PaymentService_WatchPayment_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/payment.proto",
+}
+
+const (
+	PaymentAdminService_ListDeadLetters_FullMethodName   = "/payment.PaymentAdminService/ListDeadLetters"
+	PaymentAdminService_RequeueDeadLetter_FullMethodName = "/payment.PaymentAdminService/RequeueDeadLetter"
+)
+
+// PaymentAdminServiceClient is the client API for PaymentAdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PaymentAdminService операторские ручки демона оплат
+type PaymentAdminServiceClient interface {
+	ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error)
+	RequeueDeadLetter(ctx context.Context, in *RequeueDeadLetterRequest, opts ...grpc.CallOption) (*RequeueDeadLetterResponse, error)
+}
+
+type paymentAdminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPaymentAdminServiceClient(cc grpc.ClientConnInterface) PaymentAdminServiceClient {
+	return &paymentAdminServiceClient{cc}
+}
+
+func (c *paymentAdminServiceClient) ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (*ListDeadLettersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDeadLettersResponse)
+	err := c.cc.Invoke(ctx, PaymentAdminService_ListDeadLetters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentAdminServiceClient) RequeueDeadLetter(ctx context.Context, in *RequeueDeadLetterRequest, opts ...grpc.CallOption) (*RequeueDeadLetterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RequeueDeadLetterResponse)
+	err := c.cc.Invoke(ctx, PaymentAdminService_RequeueDeadLetter_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PaymentAdminServiceServer is the server API for PaymentAdminService service.
+// All implementations must embed UnimplementedPaymentAdminServiceServer
+// for forward compatibility.
+//
+// PaymentAdminService операторские ручки демона оплат
+type PaymentAdminServiceServer interface {
+	ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error)
+	RequeueDeadLetter(context.Context, *RequeueDeadLetterRequest) (*RequeueDeadLetterResponse, error)
+	mustEmbedUnimplementedPaymentAdminServiceServer()
+}
+
+// UnimplementedPaymentAdminServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPaymentAdminServiceServer struct{}
+
+func (UnimplementedPaymentAdminServiceServer) ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDeadLetters not implemented")
+}
+func (UnimplementedPaymentAdminServiceServer) RequeueDeadLetter(context.Context, *RequeueDeadLetterRequest) (*RequeueDeadLetterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequeueDeadLetter not implemented")
+}
+func (UnimplementedPaymentAdminServiceServer) mustEmbedUnimplementedPaymentAdminServiceServer() {}
+func (UnimplementedPaymentAdminServiceServer) testEmbeddedByValue()                             {}
+
+// UnsafePaymentAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PaymentAdminServiceServer will
+// result in compilation errors.
+type UnsafePaymentAdminServiceServer interface {
+	mustEmbedUnimplementedPaymentAdminServiceServer()
+}
+
+func RegisterPaymentAdminServiceServer(s grpc.ServiceRegistrar, srv PaymentAdminServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPaymentAdminServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PaymentAdminService_ServiceDesc, srv)
+}
+
+func _PaymentAdminService_ListDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentAdminServiceServer).ListDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentAdminService_ListDeadLetters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentAdminServiceServer).ListDeadLetters(ctx, req.(*ListDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentAdminService_RequeueDeadLetter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequeueDeadLetterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentAdminServiceServer).RequeueDeadLetter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentAdminService_RequeueDeadLetter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentAdminServiceServer).RequeueDeadLetter(ctx, req.(*RequeueDeadLetterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PaymentAdminService_ServiceDesc is the grpc.ServiceDesc for PaymentAdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PaymentAdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "payment.PaymentAdminService",
+	HandlerType: (*PaymentAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDeadLetters",
+			Handler:    _PaymentAdminService_ListDeadLetters_Handler,
+		},
+		{
+			MethodName: "RequeueDeadLetter",
+			Handler:    _PaymentAdminService_RequeueDeadLetter_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/payment.proto",
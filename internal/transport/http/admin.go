@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase/service"
+)
+
+type AdminHandler struct {
+	proto.UnimplementedPaymentAdminServiceServer
+	service *service.AdminService
+	policy  *auth.Policy
+	logger  *zap.Logger
+}
+
+// NewAdminHandler создание экземпляра операторских ручек
+func NewAdminHandler(service *service.AdminService, policy *auth.Policy, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{service: service, policy: policy, logger: logger}
+}
+
+// ListDeadLetters ручка получения платежей из dead-letter
+func (h *AdminHandler) ListDeadLetters(ctx context.Context, req *proto.ListDeadLettersRequest) (*proto.ListDeadLettersResponse, error) {
+	if err := authorize(ctx, h.policy, proto.PaymentAdminService_ListDeadLetters_FullMethodName, auth.Resource{}); err != nil {
+		return nil, err
+	}
+	letters, err := h.service.ListDeadLetters(ctx, int(req.Page), int(req.Limit))
+	if err != nil {
+		return nil, statusError(fmt.Errorf("error listing dead letters: %w", err))
+	}
+
+	var protoLetters []*proto.DeadLetter
+	for _, letter := range letters {
+		protoLetters = append(protoLetters, &proto.DeadLetter{
+			Payment:    toProtoPayment(&letter.Payment),
+			Attempts:   int32(letter.Attempts),
+			LastError:  letter.LastError,
+			EnqueuedAt: letter.EnqueuedAt.String(),
+			DeadAt:     letter.DeadAt.String(),
+		})
+	}
+
+	return &proto.ListDeadLettersResponse{
+		DeadLetters: protoLetters,
+	}, nil
+}
+
+// RequeueDeadLetter ручка возврата платежа в очередь демона
+func (h *AdminHandler) RequeueDeadLetter(ctx context.Context, req *proto.RequeueDeadLetterRequest) (*proto.RequeueDeadLetterResponse, error) {
+	if err := authorize(ctx, h.policy, proto.PaymentAdminService_RequeueDeadLetter_FullMethodName, auth.Resource{}); err != nil {
+		return nil, err
+	}
+	if err := h.service.RequeueDeadLetter(ctx, req.PaymentId); err != nil {
+		return nil, statusError(fmt.Errorf("error requeueing payment: %w", err))
+	}
+
+	return &proto.RequeueDeadLetterResponse{
+		Status: "requeued",
+	}, nil
+}
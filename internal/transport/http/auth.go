@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/cmd/auth"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+// NewAuthUnaryInterceptor проверяет токен из заголовка "authorization: Bearer <token>" и кладёт
+// вызывающего в контекст (auth.IdentityFromContext). Без токена или с отклонённым токеном
+// запрос отклоняется с codes.Unauthenticated, при недоступном сервисе авторизации с codes.Unavailable
+func NewAuthUnaryInterceptor(authenticator *auth.Authenticator, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, authenticator, info.FullMethod, logger)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewAuthStreamInterceptor то же для стримов: токен проверяется один раз при открытии стрима
+func NewAuthStreamInterceptor(authenticator *auth.Authenticator, logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), authenticator, info.FullMethod, logger)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, authenticator *auth.Authenticator, method string, logger *zap.Logger) (context.Context, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	identity, err := authenticator.Authenticate(ctx, token)
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		logger.Warn("Failed to validate token", zap.String("method", method), zap.Error(err))
+		return nil, status.Errorf(codes.Unavailable, "auth service unavailable: %v", err)
+	}
+	return auth.WithIdentity(ctx, identity), nil
+}
+
+// bearerToken токен из заголовка authorization; схема Bearer без учёта регистра
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, value := range md.Get(authorizationHeader) {
+		if token, ok := parseBearer(value); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// parseBearer токен из значения заголовка "Bearer <token>"
+func parseBearer(value string) (string, bool) {
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(value[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// authorize сверяет вызывающего с политикой доступа к RPC method над платежом resource.
+// Без вызывающего в контексте (проверка токенов выключена) ограничений нет
+func authorize(ctx context.Context, policy *auth.Policy, method string, resource auth.Resource) error {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if err := policy.Authorize(identity, method, resource); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/config"
+	"paymentgo/internal/transport/grpc/proto"
+)
+
+type stubValidator struct {
+	err error
+}
+
+func (v stubValidator) ValidateToken(ctx context.Context, token string) error {
+	return v.err
+}
+
+func userToken(userID string) string {
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"`+userID+`"}`)) + ".signature"
+}
+
+func withBearer(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/GetActivePayments"}
+	var caller auth.Identity
+	handler := func(ctx context.Context, req any) (any, error) {
+		caller, _ = auth.IdentityFromContext(ctx)
+		return "ok", nil
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		validator stubValidator
+		code      codes.Code
+	}{
+		{name: "valid token", ctx: withBearer(userToken("user1")), code: codes.OK},
+		{name: "no metadata", ctx: context.Background(), code: codes.Unauthenticated},
+		{name: "basic scheme", ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic dXNlcjE=")), code: codes.Unauthenticated},
+		{name: "malformed token", ctx: withBearer("opaque"), code: codes.Unauthenticated},
+		{name: "rejected token", ctx: withBearer(userToken("user1")), validator: stubValidator{err: auth.ErrInvalidToken}, code: codes.Unauthenticated},
+		{name: "auth service down", ctx: withBearer(userToken("user1")), validator: stubValidator{err: errors.New("connection refused")}, code: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller = auth.Identity{}
+			interceptor := NewAuthUnaryInterceptor(auth.NewAuthenticator(tt.validator, time.Minute), zaptest.NewLogger(t))
+
+			resp, err := interceptor(tt.ctx, nil, info, handler)
+
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.code == codes.OK {
+				assert.Equal(t, "ok", resp)
+				assert.Equal(t, "user1", caller.UserID)
+			}
+		})
+	}
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	interceptor := NewAuthStreamInterceptor(auth.NewAuthenticator(stubValidator{}, time.Minute), zaptest.NewLogger(t))
+	info := &grpc.StreamServerInfo{FullMethod: "/payment.PaymentService/WatchPayment"}
+
+	var caller auth.Identity
+	err := interceptor(nil, contextStream{ctx: withBearer(userToken("user1"))}, info, func(srv any, stream grpc.ServerStream) error {
+		caller, _ = auth.IdentityFromContext(stream.Context())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user1", caller.UserID)
+
+	err = interceptor(nil, contextStream{ctx: context.Background()}, info, func(srv any, stream grpc.ServerStream) error {
+		t.Fatal("handler called without token")
+		return nil
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func testPolicy(t *testing.T) *auth.Policy {
+	t.Helper()
+	policy, err := auth.NewPolicy(config.Auth{
+		Rules:     map[string]string{"CreatePayment": "payer", "GetPaymentHistory": "payer", "GetActivePayments": "participant", "ListDeadLetters": "admin"},
+		AdminRole: "admin",
+	})
+	require.NoError(t, err)
+	return policy
+}
+
+func TestPaymentHandler_CallerMustOwnRequest(t *testing.T) {
+	h := NewPaymentHandler(nil, nil, nil, testPolicy(t), zaptest.NewLogger(t))
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{UserID: "user2"})
+
+	_, err := h.CreatePayment(ctx, createPaymentRequest("", 100))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = h.GetPaymentHistory(ctx, &proto.GetPaymentHistoryRequest{FromUserId: "user1", Page: 1, Limit: 10})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = h.GetActivePayments(ctx, &proto.GetActivePaymentsRequest{UserId: "user1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAdminHandler_RequiresAdmin(t *testing.T) {
+	h := NewAdminHandler(nil, testPolicy(t), zaptest.NewLogger(t))
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{UserID: "user1"})
+
+	_, err := h.ListDeadLetters(ctx, &proto.ListDeadLettersRequest{Page: 1, Limit: 10})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Правила для RequeueDeadLetter в политике нет
+	ctx = auth.WithIdentity(context.Background(), auth.Identity{UserID: "operator", Roles: []string{"admin"}})
+	_, err = h.RequeueDeadLetter(ctx, &proto.RequeueDeadLetterRequest{PaymentId: "payment1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"paymentgo/internal/usecase/service"
+)
+
+// errorDomain домен причин ошибок в ErrorInfo
+const errorDomain = "paymentgo"
+
+// statusError переводит ошибку ручки в статус gRPC: вид доменной ошибки определяет код,
+// причина передаётся в ErrorInfo, нарушения в полях запроса в BadRequest.
+// Статусы, уже выставленные проверками доступа, возвращаются как есть
+func statusError(err error) error {
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	var domain *service.Error
+	if !errors.As(service.DomainError(err), &domain) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	st := status.New(statusCode(domain.Kind), err.Error())
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: domain.Reason, Domain: errorDomain}}
+	if len(domain.Violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, violation := range domain.Violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       violation.Field,
+				Description: violation.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	withDetails, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func statusCode(kind error) codes.Code {
+	switch kind {
+	case service.ErrNotFound:
+		return codes.NotFound
+	case service.ErrInvalidState:
+		return codes.FailedPrecondition
+	case service.ErrConflict:
+		return codes.Aborted
+	case service.ErrProviderUnavailable:
+		return codes.Unavailable
+	case service.ErrValidation:
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase"
+	"paymentgo/internal/usecase/service"
+)
+
+// rejectedError отказ провайдера в операции, как yoomoney.APIError с Rejected() == true
+type rejectedError struct{}
+
+func (rejectedError) Error() string  { return "payee_not_found" }
+func (rejectedError) Rejected() bool { return true }
+
+// errorDetails причина из ErrorInfo и поля из BadRequest статуса err
+func errorDetails(t *testing.T, err error) (string, []string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+
+	var (
+		reason string
+		fields []string
+	)
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			assert.Equal(t, errorDomain, detail.Domain)
+			reason = detail.Reason
+		case *errdetails.BadRequest:
+			for _, violation := range detail.FieldViolations {
+				fields = append(fields, violation.Field)
+			}
+		}
+	}
+	return reason, fields
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   codes.Code
+		reason string
+		fields []string
+	}{
+		{
+			name:   "payment not found",
+			err:    service.DomainError(fmt.Errorf("error fetching payment: %w", fmt.Errorf("payment p1: %w", dto.ErrPaymentNotFound))),
+			code:   codes.NotFound,
+			reason: service.ReasonPaymentNotFound,
+		},
+		{
+			name:   "refund of unpaid payment",
+			err:    fmt.Errorf("error refunding payment: %w", service.DomainError(dto.ValidateTransition("p1", dto.StatusPending, dto.StatusRefunded))),
+			code:   codes.FailedPrecondition,
+			reason: service.ReasonIllegalTransition,
+		},
+		{
+			name:   "not supported by provider",
+			err:    service.DomainError(fmt.Errorf("payment links via fake: %w", usecase.ErrNotSupported)),
+			code:   codes.FailedPrecondition,
+			reason: service.ReasonNotSupported,
+		},
+		{
+			name:   "concurrent status change",
+			err:    service.DomainError(dto.ErrStatusConflict),
+			code:   codes.Aborted,
+			reason: service.ReasonStatusConflict,
+		},
+		{
+			name:   "provider outage",
+			err:    service.Unavailable(service.ReasonProviderUnavailable, errors.New("dial tcp: connection refused")),
+			code:   codes.Unavailable,
+			reason: service.ReasonProviderUnavailable,
+		},
+		{
+			name:   "provider rejection",
+			err:    service.Unavailable(service.ReasonProviderUnavailable, fmt.Errorf("error refunding payment: %w", rejectedError{})),
+			code:   codes.FailedPrecondition,
+			reason: service.ReasonProviderRejected,
+		},
+		{
+			name:   "unknown provider",
+			err:    service.DomainError(fmt.Errorf("provider %q: %w", "stripe", usecase.ErrUnknownProvider)),
+			code:   codes.InvalidArgument,
+			reason: service.ReasonUnknownProvider,
+			fields: []string{"provider"},
+		},
+		{
+			name:   "field violations",
+			err:    service.NewValidationError(service.ReasonInvalidRequest, service.FieldViolation{Field: "page", Description: "must be at least 1"}, service.FieldViolation{Field: "limit", Description: "must be at least 1"}),
+			code:   codes.InvalidArgument,
+			reason: service.ReasonInvalidRequest,
+			fields: []string{"page", "limit"},
+		},
+		{
+			name: "unclassified",
+			err:  errors.New("connection reset by peer"),
+			code: codes.Internal,
+		},
+		{
+			name: "cancelled",
+			err:  fmt.Errorf("error getting payment: %w", context.Canceled),
+			code: codes.Canceled,
+		},
+		{
+			name: "status kept",
+			err:  status.Error(codes.PermissionDenied, "caller is not a participant"),
+			code: codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := statusError(tt.err)
+
+			assert.Equal(t, tt.code, status.Code(err))
+			if _, isStatus := status.FromError(tt.err); !isStatus {
+				assert.Equal(t, tt.err.Error(), status.Convert(err).Message())
+			}
+			reason, fields := errorDetails(t, err)
+			assert.Equal(t, tt.reason, reason)
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestPaymentHandler_InvalidArguments(t *testing.T) {
+	h := NewPaymentHandler(nil, nil, nil, testPolicy(t), zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	_, err := h.CreatePayment(ctx, &proto.CreatePaymentRequest{FromUserId: "user1", ToUserId: "user2", Amount: &proto.Money{CurrencyCode: "XYZ", Units: 100}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	reason, fields := errorDetails(t, err)
+	assert.Equal(t, service.ReasonUnknownCurrency, reason)
+	assert.Equal(t, []string{"amount.currency_code"}, fields)
+
+	_, err = h.GetExchangeRate(ctx, &proto.GetExchangeRateRequest{FromCurrency: "USD", ToCurrency: "RUB", Date: "10.01.2025"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, fields = errorDetails(t, err)
+	assert.Equal(t, []string{"date"}, fields)
+}
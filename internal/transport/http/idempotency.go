@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/repository"
+)
+
+const idempotencyKeyField protoreflect.Name = "idempotency_key"
+
+// idempotencyStoreMargin запас резервации сверх срока обработчика на запись ответа или освобождение ключа
+const idempotencyStoreMargin = 10 * time.Second
+
+type idempotentRequest interface {
+	protobuf.Message
+	GetIdempotencyKey() string
+}
+
+// NewIdempotencyInterceptor повторяет сохранённый ответ для запросов с тем же idempotency_key.
+// Ключ принадлежит вызывающему (auth.IdentityFromContext): ответ, сохранённый для одного пользователя,
+// не отдаётся другому в обход проверки доступа в ручке. Повтор с тем же ключом, но другим телом
+// запроса отклоняется с codes.AlreadyExists. Обработчик запроса с ключом ограничен timeout, а ключ
+// резервируется дольше него: повтор не перезаймёт ключ, пока исходный запрос ещё выполняется.
+func NewIdempotencyInterceptor(repo repository.IdempotencyRepository, timeout time.Duration, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	lockTTL := timeout + idempotencyStoreMargin
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		keyed, ok := req.(idempotentRequest)
+		if !ok || keyed.GetIdempotencyKey() == "" {
+			return handler(ctx, req)
+		}
+		key := keyed.GetIdempotencyKey()
+		subject := idempotencySubject(ctx)
+
+		fingerprint, err := requestFingerprint(keyed)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fingerprint request: %v", err)
+		}
+
+		record, token, err := repo.Reserve(ctx, key, info.FullMethod, subject, fingerprint, lockTTL)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "idempotency store unavailable: %v", err)
+		}
+
+		if token == "" {
+			if record.Fingerprint != fingerprint {
+				return nil, status.Error(codes.AlreadyExists, "idempotency key was already used with a different request")
+			}
+			if record.Response == nil {
+				return nil, status.Error(codes.Aborted, "request with this idempotency key is still in progress")
+			}
+
+			var cached anypb.Any
+			if err := protobuf.Unmarshal(record.Response, &cached); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to decode stored response: %v", err)
+			}
+			resp, err := cached.UnmarshalNew()
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to decode stored response: %v", err)
+			}
+			logger.Info("Replaying idempotent response", zap.String("method", info.FullMethod), zap.String("key", key))
+			return resp, nil
+		}
+
+		// Ключ должен освободиться или сохранить ответ, даже если клиент отменил запрос
+		storeCtx := context.WithoutCancel(ctx)
+
+		handlerCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := handler(handlerCtx, req)
+		if err != nil {
+			if releaseErr := repo.Release(storeCtx, key, info.FullMethod, subject, token); releaseErr != nil {
+				logger.Warn("Failed to release idempotency key", zap.String("key", key), zap.Error(releaseErr))
+			}
+			return nil, err
+		}
+
+		if err := storeResponse(storeCtx, repo, key, info.FullMethod, subject, token, resp); err != nil {
+			logger.Error("Failed to store idempotent response", zap.String("key", key), zap.Error(err))
+		}
+
+		return resp, nil
+	}
+}
+
+// idempotencySubject пользователь, которому принадлежит ключ; пустой, если аутентификация выключена
+func idempotencySubject(ctx context.Context) string {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return identity.UserID
+}
+
+// requestFingerprint хеш тела запроса без самого ключа идемпотентности
+func requestFingerprint(req protobuf.Message) (string, error) {
+	clone := protobuf.Clone(req)
+	if field := clone.ProtoReflect().Descriptor().Fields().ByName(idempotencyKeyField); field != nil {
+		clone.ProtoReflect().Clear(field)
+	}
+
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(clone)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func storeResponse(ctx context.Context, repo repository.IdempotencyRepository, key, method, subject, token string, resp any) error {
+	msg, ok := resp.(protobuf.Message)
+	if !ok {
+		return repo.Release(ctx, key, method, subject, token)
+	}
+
+	packed, err := anypb.New(msg)
+	if err != nil {
+		return err
+	}
+
+	data, err := protobuf.Marshal(packed)
+	if err != nil {
+		return err
+	}
+
+	return repo.Complete(ctx, key, method, subject, token, data)
+}
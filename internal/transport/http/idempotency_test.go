@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"paymentgo/internal/cmd/auth"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/transport/grpc/proto"
+)
+
+type memoryIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]*entity.IdempotencyRecord
+	// tokens токены текущих резерваций ключей
+	tokens map[string]string
+	// lockTTL последний срок резервации, переданный в Reserve
+	lockTTL time.Duration
+}
+
+func newMemoryIdempotencyRepo() *memoryIdempotencyRepo {
+	return &memoryIdempotencyRepo{records: map[string]*entity.IdempotencyRecord{}, tokens: map[string]string{}}
+}
+
+func (m *memoryIdempotencyRepo) Reserve(ctx context.Context, key, method, subject, fingerprint string, lockTTL time.Duration) (*entity.IdempotencyRecord, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lockTTL = lockTTL
+	if record, ok := m.records[method+subject+key]; ok && (record.Response != nil || time.Since(record.CreatedAt) < lockTTL) {
+		copied := *record
+		return &copied, "", nil
+	}
+	token := uuid.NewString()
+	m.records[method+subject+key] = &entity.IdempotencyRecord{Key: key, Method: method, Subject: subject, Fingerprint: fingerprint, CreatedAt: time.Now()}
+	m.tokens[method+subject+key] = token
+	return nil, token, nil
+}
+
+// expire делает все незавершённые резервации просроченными
+func (m *memoryIdempotencyRepo) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range m.records {
+		record.CreatedAt = time.Time{}
+	}
+}
+
+func (m *memoryIdempotencyRepo) Complete(ctx context.Context, key, method, subject, token string, response []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record := m.records[method+subject+key]
+	if record == nil || record.Response != nil || m.tokens[method+subject+key] != token {
+		return entity.ErrIdempotencyKeyLost
+	}
+	record.Response = response
+	return nil
+}
+
+func (m *memoryIdempotencyRepo) Release(ctx context.Context, key, method, subject, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record := m.records[method+subject+key]
+	if record == nil || record.Response != nil || m.tokens[method+subject+key] != token {
+		return entity.ErrIdempotencyKeyLost
+	}
+	delete(m.records, method+subject+key)
+	return nil
+}
+
+func createPaymentRequest(key string, units int64) *proto.CreatePaymentRequest {
+	return &proto.CreatePaymentRequest{
+		FromUserId:     "user1",
+		ToUserId:       "user2",
+		Amount:         &proto.Money{CurrencyCode: "RUB", Units: units},
+		IdempotencyKey: key,
+	}
+}
+
+func TestIdempotencyInterceptor_ReplaysResponse(t *testing.T) {
+	interceptor := NewIdempotencyInterceptor(newMemoryIdempotencyRepo(), time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return &proto.CreatePaymentResponse{PaymentId: "payment-1"}, nil
+	}
+
+	first, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+
+	second, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, protobuf.Equal(first.(protobuf.Message), second.(protobuf.Message)))
+}
+
+func TestIdempotencyInterceptor_DifferentBody(t *testing.T) {
+	interceptor := NewIdempotencyInterceptor(newMemoryIdempotencyRepo(), time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return &proto.CreatePaymentResponse{PaymentId: "payment-1"}, nil
+	}
+
+	_, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+
+	_, err = interceptor(context.Background(), createPaymentRequest("key-1", 200), info, handler)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestIdempotencyInterceptor_KeysAreScopedByCaller(t *testing.T) {
+	interceptor := NewIdempotencyInterceptor(newMemoryIdempotencyRepo(), time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+
+	var callers []string
+	handler := func(ctx context.Context, req any) (any, error) {
+		identity, _ := auth.IdentityFromContext(ctx)
+		callers = append(callers, identity.UserID)
+		return &proto.CreatePaymentResponse{PaymentId: "payment-" + identity.UserID}, nil
+	}
+
+	owner := auth.WithIdentity(context.Background(), auth.Identity{UserID: "user1"})
+	_, err := interceptor(owner, createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+
+	// Тот же ключ и тело от другого пользователя не получают чужой ответ, а выполняются заново
+	other := auth.WithIdentity(context.Background(), auth.Identity{UserID: "user3"})
+	resp, err := interceptor(other, createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "payment-user3", resp.(*proto.CreatePaymentResponse).PaymentId)
+
+	// Другое тело под чужим ключом не конфликтует
+	_, err = interceptor(other, createPaymentRequest("key-2", 200), info, handler)
+	assert.NoError(t, err)
+	_, err = interceptor(owner, createPaymentRequest("key-2", 100), info, handler)
+	assert.NoError(t, err)
+
+	resp, err = interceptor(owner, createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "payment-user1", resp.(*proto.CreatePaymentResponse).PaymentId)
+	assert.Equal(t, []string{"user1", "user3", "user3", "user1"}, callers)
+}
+
+func TestIdempotencyInterceptor_ReleasesKeyOnError(t *testing.T) {
+	interceptor := NewIdempotencyInterceptor(newMemoryIdempotencyRepo(), time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("database is down")
+		}
+		return &proto.CreatePaymentResponse{PaymentId: "payment-1"}, nil
+	}
+
+	_, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.Error(t, err)
+
+	resp, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "payment-1", resp.(*proto.CreatePaymentResponse).PaymentId)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyInterceptor_WithoutKey(t *testing.T) {
+	interceptor := NewIdempotencyInterceptor(newMemoryIdempotencyRepo(), time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+
+	calls := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		return &proto.CreatePaymentResponse{PaymentId: "payment-1"}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := interceptor(context.Background(), createPaymentRequest("", 100), info, handler)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyInterceptor_StaleReservationDoesNotOverwrite(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	interceptor := NewIdempotencyInterceptor(repo, time.Minute, zaptest.NewLogger(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/CreatePayment"}
+
+	calls := 0
+	var nested any
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+		if calls == 1 {
+			// Исходный запрос завис дольше резервации: повтор перезанимает ключ и завершает его сам
+			repo.expire()
+			var err error
+			nested, err = interceptor(context.Background(), createPaymentRequest("key-1", 100), info, func(ctx context.Context, req any) (any, error) {
+				calls++
+				return &proto.CreatePaymentResponse{PaymentId: "payment-retry"}, nil
+			})
+			assert.NoError(t, err)
+		}
+		return &proto.CreatePaymentResponse{PaymentId: "payment-stale"}, nil
+	}
+
+	_, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "payment-retry", nested.(*proto.CreatePaymentResponse).PaymentId)
+	// Резервация держится дольше срока обработчика
+	assert.Greater(t, repo.lockTTL, time.Minute)
+
+	// Ответ зависшего запроса не перезаписал ответ повтора
+	resp, err := interceptor(context.Background(), createPaymentRequest("key-1", 100), info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "payment-retry", resp.(*proto.CreatePaymentResponse).PaymentId)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/usecase/service"
+)
+
+// maxNotificationSize ограничение тела уведомления, реальные уведомления меньше килобайта
+const maxNotificationSize = 64 << 10
+
+// NotificationHandler HTTP-ручка уведомлений ЮMoney.
+// ЮMoney повторяет уведомление, пока не получит 200, поэтому 200 отдаётся и на уведомления,
+// которые обработать нельзя в принципе (чужой label, несовпадение суммы, повтор)
+type NotificationHandler struct {
+	service *service.NotificationService
+	secret  string
+	logger  *zap.Logger
+}
+
+// NewNotificationHandler создание экземпляра ручки уведомлений
+func NewNotificationHandler(service *service.NotificationService, secret string, logger *zap.Logger) *NotificationHandler {
+	return &NotificationHandler{service: service, secret: secret, logger: logger}
+}
+
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxNotificationSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed notification", http.StatusBadRequest)
+		return
+	}
+
+	notification, err := yoomoney.ParseNotification(r.PostForm)
+	if err != nil {
+		h.logger.Warn("Rejected malformed notification", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := notification.Verify(h.secret); err != nil {
+		h.logger.Warn("Rejected notification with invalid signature",
+			zap.String("operation_id", notification.OperationID),
+			zap.Error(err))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if notification.Test {
+		h.logger.Info("Test notification received", zap.String("operation_id", notification.OperationID))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err = h.service.HandleNotification(r.Context(), notification)
+	switch {
+	case err == nil:
+	case errors.Is(err, dto.ErrPaymentNotFound),
+		errors.Is(err, service.ErrNotificationMismatch),
+		errors.Is(err, service.ErrDuplicateNotification):
+		h.logger.Info("Notification ignored",
+			zap.String("operation_id", notification.OperationID),
+			zap.String("label", notification.Label),
+			zap.Error(err))
+	default:
+		h.logger.Error("Failed to process notification",
+			zap.String("operation_id", notification.OperationID),
+			zap.Error(err))
+		http.Error(w, "temporary failure", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"paymentgo/internal/usecase"
+	"paymentgo/internal/usecase/service"
+	db "paymentgo/utils/connector"
+)
+
+const (
+	testNotificationSecret = "01234567890ABCDEF01234567890"
+	testNotificationLabel  = "3f8a2c1e-5b7d-4e9a-8c6f-1a2b3c4d5e6f"
+)
+
+type memoryPaymentRepo struct {
+	repository.PaymentRepository
+	mu        sync.Mutex
+	payments  map[string]*entity.Payment
+	updateErr error
+	// failTo переход в этот статус завершается ошибкой
+	failTo entity.PaymentStatus
+	// quotes котировки, с которыми выдавались ссылки на оплату
+	quotes map[string][]*entity.FXQuote
+	// notifications откатываются вместе с платежами, как записи одной транзакции Postgres
+	notifications *memoryNotificationRepo
+}
+
+// WithinTx при ошибке fn возвращает платежи и отметки уведомлений к состоянию до вызова
+func (m *memoryPaymentRepo) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	payments := make(map[string]entity.Payment, len(m.payments))
+	for id, payment := range m.payments {
+		payments[id] = *payment
+	}
+	m.mu.Unlock()
+	var operations map[string]string
+	if m.notifications != nil {
+		operations = m.notifications.snapshot()
+	}
+
+	if err := fn(ctx); err != nil {
+		m.mu.Lock()
+		for id, payment := range payments {
+			*m.payments[id] = payment
+		}
+		m.mu.Unlock()
+		if m.notifications != nil {
+			m.notifications.restore(operations)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *memoryPaymentRepo) GetPaymentByID(ctx context.Context, paymentID string) (*entity.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.payments[paymentID]
+	if !ok {
+		return nil, entity.ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+func (m *memoryPaymentRepo) UpdatePaymentStatus(ctx context.Context, paymentID string, from, to entity.PaymentStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	if m.failTo != "" && to == m.failTo {
+		return errors.New("database is down")
+	}
+	if err := entity.ValidateTransition(paymentID, from, to); err != nil {
+		return err
+	}
+	payment := m.payments[paymentID]
+	if payment.Status != from {
+		return &entity.TransitionError{PaymentID: paymentID, From: from, To: to, Actual: payment.Status, Err: entity.ErrStatusConflict}
+	}
+	payment.Status = to
+	return nil
+}
+
+func (m *memoryPaymentRepo) GetQuotes(ctx context.Context, paymentID string) ([]*entity.FXQuote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quotes[paymentID], nil
+}
+
+func (m *memoryPaymentRepo) status(paymentID string) entity.PaymentStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.payments[paymentID].Status
+}
+
+type memoryNotificationRepo struct {
+	mu         sync.Mutex
+	operations map[string]string
+}
+
+func (m *memoryNotificationRepo) Reserve(ctx context.Context, operationID, paymentID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.operations[operationID]; ok {
+		return false, nil
+	}
+	m.operations[operationID] = paymentID
+	return true, nil
+}
+
+func (m *memoryNotificationRepo) snapshot() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	operations := make(map[string]string, len(m.operations))
+	for operationID, paymentID := range m.operations {
+		operations[operationID] = paymentID
+	}
+	return operations
+}
+
+func (m *memoryNotificationRepo) restore(operations map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operations = operations
+}
+
+func newNotificationFixture(t *testing.T, amount entity.Money) (*NotificationHandler, *memoryPaymentRepo, *db.LockFreeQueue) {
+	logger := zaptest.NewLogger(t)
+	repo := &memoryPaymentRepo{payments: map[string]*entity.Payment{
+		testNotificationLabel: {ID: testNotificationLabel, FromUserID: "user1", ToUserID: "user2", Amount: amount, Status: entity.StatusPending, Provider: yoomoney.ProviderName},
+	}}
+	queue := db.NewPaymentsQueue()
+	providers, err := usecase.NewProviderRegistry(yoomoney.ProviderName, yoomoney.NewProvider(nil, entity.CoreAccount))
+	require.NoError(t, err)
+	payments := service.NewPaymentService(repo, logger, nil, providers, queue)
+	repo.notifications = &memoryNotificationRepo{operations: map[string]string{}}
+	notifications := service.NewNotificationService(payments, repo, repo.notifications, queue, logger)
+	return NewNotificationHandler(notifications, testNotificationSecret, logger), repo, queue
+}
+
+func postNotification(t *testing.T, handler http.Handler, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/yoomoney/notifications", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func recordedNotification(t *testing.T, name string) string {
+	t.Helper()
+	body, err := os.ReadFile("../../cmd/yoomoney/testdata/" + name)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestNotificationHandler_ConfirmsPayment(t *testing.T) {
+	handler, repo, queue := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_p2p_incoming.txt")))
+	assert.Equal(t, entity.StatusSuccess, repo.status(testNotificationLabel))
+
+	task, ok := queue.Dequeue()
+	require.True(t, ok)
+	assert.Equal(t, testNotificationLabel, task.Payment.ID)
+}
+
+func TestNotificationHandler_ReplayIsIgnored(t *testing.T) {
+	handler, repo, queue := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+	body := recordedNotification(t, "notification_p2p_incoming.txt")
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, body))
+	queue.Drain()
+
+	// Платёж вернули в PENDING (например, ссылку выдали заново): повтор старого уведомления не должен его подтвердить
+	repo.payments[testNotificationLabel].Status = entity.StatusPending
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, body))
+	assert.Equal(t, entity.StatusPending, repo.status(testNotificationLabel))
+	_, ok := queue.Dequeue()
+	assert.False(t, ok)
+}
+
+func TestNotificationHandler_QuotedPayment(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 1316, Currency: "USD"})
+	// Ссылку оплатили по зафиксированной сумме, пока котировка действовала; уведомление пришло после её истечения
+	quotedAt := time.Now().Add(-time.Hour)
+	repo.payments[testNotificationLabel].Quote = &entity.FXQuote{
+		Amount:    entity.Money{Minor: 100000, Currency: "RUB"},
+		Rate:      "75.98784195",
+		Source:    "cbr",
+		QuotedAt:  quotedAt,
+		ExpiresAt: quotedAt.Add(15 * time.Minute),
+	}
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_p2p_incoming.txt")))
+	assert.Equal(t, entity.StatusSuccess, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_PaidWithEarlierQuote(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 1316, Currency: "USD"})
+	// Первую ссылку выдали по курсу 75.98784195, после истечения котировки выдали вторую; оплатили первую
+	firstQuotedAt := time.Now().Add(-time.Hour)
+	first := &entity.FXQuote{
+		Amount:    entity.Money{Minor: 100000, Currency: "RUB"},
+		Rate:      "75.98784195",
+		Source:    "cbr",
+		QuotedAt:  firstQuotedAt,
+		ExpiresAt: firstQuotedAt.Add(15 * time.Minute),
+	}
+	second := &entity.FXQuote{
+		Amount:    entity.Money{Minor: 105280, Currency: "RUB"},
+		Rate:      "80",
+		Source:    "cbr",
+		QuotedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+	}
+	repo.payments[testNotificationLabel].Quote = second
+	repo.quotes = map[string][]*entity.FXQuote{testNotificationLabel: {first, second}}
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_p2p_incoming.txt")))
+	assert.Equal(t, entity.StatusSuccess, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_InvalidSignature(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+	body := strings.Replace(recordedNotification(t, "notification_p2p_incoming.txt"), "withdraw_amount=1000.00&", "", 1)
+	body = strings.Replace(body, "amount=995.00", "amount=10.00", 1)
+
+	assert.Equal(t, http.StatusUnauthorized, postNotification(t, handler, body))
+	assert.Equal(t, entity.StatusPending, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_AmountMismatch(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 500000, Currency: "RUB"})
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_card_incoming.txt")))
+	assert.Equal(t, entity.StatusPending, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_TestNotification(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_test.txt")))
+	assert.Equal(t, entity.StatusPending, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_UnknownPayment(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+	delete(repo.payments, testNotificationLabel)
+
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, recordedNotification(t, "notification_p2p_incoming.txt")))
+}
+
+func TestNotificationHandler_RetryAfterFailure(t *testing.T) {
+	handler, repo, _ := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+	body := recordedNotification(t, "notification_p2p_incoming.txt")
+
+	repo.updateErr = errors.New("database is down")
+	assert.Equal(t, http.StatusInternalServerError, postNotification(t, handler, body))
+
+	repo.updateErr = nil
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, body))
+	assert.Equal(t, entity.StatusSuccess, repo.status(testNotificationLabel))
+}
+
+func TestNotificationHandler_FailedPaymentRollsBackOnError(t *testing.T) {
+	handler, repo, queue := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+	repo.payments[testNotificationLabel].Status = entity.StatusFailed
+	body := recordedNotification(t, "notification_p2p_incoming.txt")
+
+	// Переход в SUCCESS не удался: платёж не застревает в PENDING, а отметка уведомления снимается
+	repo.failTo = entity.StatusSuccess
+	assert.Equal(t, http.StatusInternalServerError, postNotification(t, handler, body))
+	assert.Equal(t, entity.StatusFailed, repo.status(testNotificationLabel))
+	assert.Empty(t, repo.notifications.snapshot())
+
+	repo.failTo = ""
+	assert.Equal(t, http.StatusOK, postNotification(t, handler, body))
+	assert.Equal(t, entity.StatusSuccess, repo.status(testNotificationLabel))
+	_, ok := queue.Dequeue()
+	assert.True(t, ok)
+}
+
+func TestNotificationHandler_MethodNotAllowed(t *testing.T) {
+	handler, _, _ := newNotificationFixture(t, entity.Money{Minor: 100000, Currency: "RUB"})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/yoomoney/notifications", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
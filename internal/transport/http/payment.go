@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/cmd/convert"
 	dto "paymentgo/internal/entity"
 	"paymentgo/internal/transport/grpc/proto"
 	"paymentgo/internal/usecase/service"
@@ -14,20 +19,26 @@ import (
 type PaymentHandler struct {
 	proto.UnimplementedPaymentServiceServer
 	service *service.PaymentService
+	watcher *service.WatchService
+	rates   *convert.RateHistory
+	policy  *auth.Policy
 	logger  *zap.Logger
 }
 
-// NewPaymentHandler создание экземпляра ручек оплаты
-func NewPaymentHandler(service *service.PaymentService, logger *zap.Logger) *PaymentHandler {
-	return &PaymentHandler{service: service, logger: logger}
+// NewPaymentHandler создание экземпляра ручек оплаты; доступ к платежам проверяется по policy
+func NewPaymentHandler(service *service.PaymentService, watcher *service.WatchService, rates *convert.RateHistory, policy *auth.Policy, logger *zap.Logger) *PaymentHandler {
+	return &PaymentHandler{service: service, watcher: watcher, rates: rates, policy: policy, logger: logger}
 }
 
 // GetPaymentLink ручка получение ссылки на оплату
 func (h *PaymentHandler) GetPaymentLink(ctx context.Context, req *proto.GetPaymentLinkRequest) (*proto.GetPaymentLinkResponse, error) {
+	if err := h.authorizePayment(ctx, proto.PaymentService_GetPaymentLink_FullMethodName, req.PaymentId); err != nil {
+		return nil, err
+	}
 	paymentLink, err := h.service.GetPaymentLink(ctx, req.PaymentId)
 
 	if err != nil {
-		return nil, fmt.Errorf("error generating link for payment: %w", err)
+		return nil, statusError(fmt.Errorf("error generating link for payment: %w", err))
 	}
 
 	return &proto.GetPaymentLinkResponse{
@@ -37,10 +48,13 @@ func (h *PaymentHandler) GetPaymentLink(ctx context.Context, req *proto.GetPayme
 
 // GetPayment ручка получения статуса оплаты
 func (h *PaymentHandler) GetPayment(ctx context.Context, req *proto.GetPaymentRequest) (*proto.GetPaymentResponse, error) {
+	if err := h.authorizePayment(ctx, proto.PaymentService_GetPayment_FullMethodName, req.PaymentId); err != nil {
+		return nil, err
+	}
 	paymentStatus, err := h.service.GetPayment(ctx, req.PaymentId)
 
 	if err != nil {
-		return nil, fmt.Errorf("error paying for payment: %w", err)
+		return nil, statusError(fmt.Errorf("error paying for payment: %w", err))
 	}
 
 	return &proto.GetPaymentResponse{
@@ -50,9 +64,17 @@ func (h *PaymentHandler) GetPayment(ctx context.Context, req *proto.GetPaymentRe
 
 // CreatePayment Ручка создания оплаты
 func (h *PaymentHandler) CreatePayment(ctx context.Context, req *proto.CreatePaymentRequest) (*proto.CreatePaymentResponse, error) {
-	paymentID, err := h.service.CreatePayment(ctx, req.FromUserId, req.ToUserId, float64(req.Amount), req.Currency)
+	if err := authorize(ctx, h.policy, proto.PaymentService_CreatePayment_FullMethodName, auth.Resource{PayerID: req.FromUserId}); err != nil {
+		return nil, err
+	}
+	amount, err := dto.MoneyFromUnitsNanos(req.GetAmount().GetUnits(), req.GetAmount().GetNanos(), req.GetAmount().GetCurrencyCode())
+	if err != nil {
+		return nil, invalidAmount(err)
+	}
+
+	paymentID, err := h.service.CreatePayment(ctx, req.FromUserId, req.ToUserId, amount, req.Provider)
 	if err != nil {
-		return nil, fmt.Errorf("error creating payment: %w", err)
+		return nil, statusError(fmt.Errorf("error creating payment: %w", err))
 	}
 
 	return &proto.CreatePaymentResponse{
@@ -62,9 +84,12 @@ func (h *PaymentHandler) CreatePayment(ctx context.Context, req *proto.CreatePay
 
 // RefundPayment Ручка создания возврата оплаты
 func (h *PaymentHandler) RefundPayment(ctx context.Context, req *proto.RefundPaymentRequest) (*proto.RefundPaymentResponse, error) {
+	if err := h.authorizePayment(ctx, proto.PaymentService_RefundPayment_FullMethodName, req.PaymentId); err != nil {
+		return nil, err
+	}
 	err := h.service.RefundPayment(ctx, req.PaymentId)
 	if err != nil {
-		return nil, fmt.Errorf("error refunding payment: %w", err)
+		return nil, statusError(fmt.Errorf("error refunding payment: %w", err))
 	}
 
 	return &proto.RefundPaymentResponse{
@@ -76,41 +101,36 @@ func (h *PaymentHandler) RefundPayment(ctx context.Context, req *proto.RefundPay
 func (h *PaymentHandler) GetPaymentByID(ctx context.Context, req *proto.GetPaymentByIDRequest) (*proto.GetPaymentByIDResponse, error) {
 	payment, err := h.service.GetPaymentByID(ctx, req.PaymentId)
 	if err != nil {
-		return nil, fmt.Errorf("error getting payment: %w", err)
+		return nil, statusError(fmt.Errorf("error getting payment: %w", err))
+	}
+	if err := authorize(ctx, h.policy, proto.PaymentService_GetPaymentByID_FullMethodName, paymentResource(payment)); err != nil {
+		return nil, err
 	}
 
 	return &proto.GetPaymentByIDResponse{
 		Id:         payment.ID,
 		FromUserId: payment.FromUserID,
 		ToUserId:   payment.ToUserID,
-		Amount:     float32(payment.Amount),
-		Currency:   payment.Currency,
+		Amount:     toProtoMoney(payment.Amount),
 		Status:     string(payment.Status),
 		CreatedAt:  payment.CreatedAt.String(),
 		UpdatedAt:  payment.UpdatedAt.String(),
+		Provider:   payment.Provider,
+		Quote:      toProtoQuote(payment.Quote),
 	}, nil
 }
 
 // GetPaymentHistory получение истории оплат
 func (h *PaymentHandler) GetPaymentHistory(ctx context.Context, req *proto.GetPaymentHistoryRequest) (*proto.GetPaymentHistoryResponse, error) {
+	if err := authorize(ctx, h.policy, proto.PaymentService_GetPaymentHistory_FullMethodName, auth.Resource{PayerID: req.FromUserId}); err != nil {
+		return nil, err
+	}
 	payments, err := h.service.GetPaymentHistory(ctx, req.FromUserId, int(req.Page), int(req.Limit))
 	if err != nil {
-		return nil, fmt.Errorf("error getting payment history: %w", err)
+		return nil, statusError(fmt.Errorf("error getting payment history: %w", err))
 	}
 
-	var protoPayments []*proto.Payment
-	for _, payment := range payments {
-		protoPayments = append(protoPayments, &proto.Payment{
-			Id:         payment.ID,
-			FromUserId: payment.FromUserID,
-			ToUserId:   payment.ToUserID,
-			Amount:     float32(payment.Amount),
-			Currency:   payment.Currency,
-			Status:     string(payment.Status),
-			CreatedAt:  payment.CreatedAt.String(),
-			UpdatedAt:  payment.UpdatedAt.String(),
-		})
-	}
+	protoPayments := toProtoPayments(payments)
 
 	return &proto.GetPaymentHistoryResponse{
 		Payment: protoPayments,
@@ -119,26 +139,183 @@ func (h *PaymentHandler) GetPaymentHistory(ctx context.Context, req *proto.GetPa
 
 // GetActivePayments получение активных счетов оплаты
 func (h *PaymentHandler) GetActivePayments(ctx context.Context, req *proto.GetActivePaymentsRequest) (*proto.GetActivePaymentsResponse, error) {
+	// Активные платежи пользователя, где он плательщик или получатель
+	if err := authorize(ctx, h.policy, proto.PaymentService_GetActivePayments_FullMethodName, auth.Resource{PayerID: req.UserId, PayeeID: req.UserId}); err != nil {
+		return nil, err
+	}
 	payments, err := h.service.GetActivePayments(ctx, req.UserId)
 	if err != nil {
-		return nil, fmt.Errorf("error getting active payments: %w", err)
+		return nil, statusError(fmt.Errorf("error getting active payments: %w", err))
 	}
 
-	var protoPayments []*proto.Payment
-	for _, payment := range payments {
-		protoPayments = append(protoPayments, &proto.Payment{
-			Id:         payment.ID,
-			FromUserId: payment.FromUserID,
-			ToUserId:   payment.ToUserID,
-			Amount:     float32(payment.Amount),
-			Currency:   payment.Currency,
-			Status:     string(payment.Status),
-			CreatedAt:  payment.CreatedAt.String(),
-			UpdatedAt:  payment.UpdatedAt.String(),
-		})
-	}
+	protoPayments := toProtoPayments(payments)
 
 	return &proto.GetActivePaymentsResponse{
 		Payments: protoPayments,
 	}, nil
 }
+
+// GetExchangeRate ручка текущего курса или курса на дату с пересчётом суммы
+func (h *PaymentHandler) GetExchangeRate(ctx context.Context, req *proto.GetExchangeRateRequest) (*proto.GetExchangeRateResponse, error) {
+	if err := authorize(ctx, h.policy, proto.PaymentService_GetExchangeRate_FullMethodName, auth.Resource{}); err != nil {
+		return nil, err
+	}
+	var date time.Time
+	if req.Date != "" {
+		parsed, err := time.Parse(time.DateOnly, req.Date)
+		if err != nil {
+			return nil, statusError(service.NewValidationError(service.ReasonInvalidRequest, service.FieldViolation{Field: "date", Description: fmt.Sprintf("expected YYYY-MM-DD, got %q", req.Date)}))
+		}
+		date = parsed
+	}
+
+	interpolation, err := fromProtoInterpolation(req.Interpolation)
+	if err != nil {
+		return nil, statusError(service.NewValidationError(service.ReasonInvalidRequest, service.FieldViolation{Field: "interpolation", Description: err.Error()}))
+	}
+
+	rate, err := h.rates.RateAt(ctx, req.FromCurrency, req.ToCurrency, date, interpolation)
+	if err != nil {
+		return nil, statusError(service.Unavailable(service.ReasonRatesUnavailable, fmt.Errorf("error getting exchange rate: %w", err)))
+	}
+
+	response := &proto.GetExchangeRateResponse{
+		FromCurrency: rate.From,
+		ToCurrency:   rate.To,
+		Date:         rate.Date.Format(time.DateOnly),
+		Rate:         dto.FormatRate(rate.Rate),
+		Source:       rate.Source,
+		Method:       string(rate.Method),
+	}
+	if req.Amount != nil {
+		amount, err := dto.MoneyFromUnitsNanos(req.Amount.GetUnits(), req.Amount.GetNanos(), req.Amount.GetCurrencyCode())
+		if err != nil {
+			return nil, invalidAmount(err)
+		}
+		if amount.Currency != rate.From {
+			return nil, statusError(service.NewValidationError(service.ReasonInvalidRequest, service.FieldViolation{
+				Field:       "amount.currency_code",
+				Description: fmt.Sprintf("amount currency %s does not match %s", amount.Currency, rate.From),
+			}))
+		}
+		converted, err := amount.Convert(rate.Rate, rate.To)
+		if err != nil {
+			return nil, statusError(fmt.Errorf("error converting amount: %w", err))
+		}
+		response.ConvertedAmount = toProtoMoney(converted)
+	}
+	return response, nil
+}
+
+// WatchPayment стрим текущего состояния платежа и смен статуса без запросов к провайдеру
+func (h *PaymentHandler) WatchPayment(req *proto.WatchPaymentRequest, stream grpc.ServerStreamingServer[proto.PaymentEvent]) error {
+	ctx := stream.Context()
+	if err := h.authorizePayment(ctx, proto.PaymentService_WatchPayment_FullMethodName, req.PaymentId); err != nil {
+		return err
+	}
+
+	err := h.watcher.WatchPayment(ctx, req.PaymentId, req.AfterEventId, func(event *dto.PaymentEvent, snapshot bool) error {
+		return stream.Send(toProtoPaymentEvent(event, snapshot))
+	})
+	if err != nil {
+		return statusError(fmt.Errorf("error watching payment: %w", err))
+	}
+	return nil
+}
+
+// authorizePayment проверяет доступ к RPC method над платежом paymentID
+func (h *PaymentHandler) authorizePayment(ctx context.Context, method, paymentID string) error {
+	return authorizePayment(ctx, h.service, h.policy, method, paymentID)
+}
+
+func authorizePayment(ctx context.Context, payments *service.PaymentService, policy *auth.Policy, method, paymentID string) error {
+	if _, ok := auth.IdentityFromContext(ctx); !ok {
+		return nil
+	}
+	payment, err := payments.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return statusError(fmt.Errorf("error getting payment: %w", err))
+	}
+	return authorize(ctx, policy, method, paymentResource(payment))
+}
+
+func paymentResource(payment *dto.Payment) auth.Resource {
+	return auth.Resource{PayerID: payment.FromUserID, PayeeID: payment.ToUserID}
+}
+
+// invalidAmount ошибка разбора поля amount запроса
+func invalidAmount(err error) error {
+	reason, field := service.ReasonInvalidAmount, "amount"
+	if errors.Is(err, dto.ErrUnknownCurrency) {
+		reason, field = service.ReasonUnknownCurrency, "amount.currency_code"
+	}
+	return statusError(service.NewValidationError(reason, service.FieldViolation{Field: field, Description: err.Error()}))
+}
+
+func fromProtoInterpolation(interpolation proto.RateInterpolation) (convert.Interpolation, error) {
+	switch interpolation {
+	case proto.RateInterpolation_RATE_INTERPOLATION_PREVIOUS:
+		return convert.InterpolationPrevious, nil
+	case proto.RateInterpolation_RATE_INTERPOLATION_LINEAR:
+		return convert.InterpolationLinear, nil
+	case proto.RateInterpolation_RATE_INTERPOLATION_NONE:
+		return convert.InterpolationNone, nil
+	}
+	return 0, fmt.Errorf("unknown rate interpolation %d", interpolation)
+}
+
+func toProtoMoney(amount dto.Money) *proto.Money {
+	units, nanos := amount.UnitsNanos()
+	return &proto.Money{
+		CurrencyCode: amount.Currency,
+		Units:        units,
+		Nanos:        nanos,
+	}
+}
+
+func toProtoQuote(quote *dto.FXQuote) *proto.FxQuote {
+	if quote == nil {
+		return nil
+	}
+	return &proto.FxQuote{
+		ConvertedAmount: toProtoMoney(quote.Amount),
+		Rate:            quote.Rate,
+		Source:          quote.Source,
+		QuotedAt:        quote.QuotedAt.String(),
+		ExpiresAt:       quote.ExpiresAt.String(),
+	}
+}
+
+func toProtoPayment(payment *dto.Payment) *proto.Payment {
+	return &proto.Payment{
+		Id:         payment.ID,
+		FromUserId: payment.FromUserID,
+		ToUserId:   payment.ToUserID,
+		Amount:     toProtoMoney(payment.Amount),
+		Status:     string(payment.Status),
+		CreatedAt:  payment.CreatedAt.String(),
+		UpdatedAt:  payment.UpdatedAt.String(),
+		Provider:   payment.Provider,
+	}
+}
+
+func toProtoPaymentEvent(event *dto.PaymentEvent, snapshot bool) *proto.PaymentEvent {
+	return &proto.PaymentEvent{
+		EventId:    event.ID,
+		PaymentId:  event.PaymentID,
+		FromStatus: string(event.From),
+		Status:     string(event.To),
+		Reason:     event.Reason,
+		Amount:     toProtoMoney(event.Amount),
+		CreatedAt:  event.CreatedAt.String(),
+		Snapshot:   snapshot,
+	}
+}
+
+func toProtoPayments(payments []*dto.Payment) []*proto.Payment {
+	var protoPayments []*proto.Payment
+	for _, payment := range payments {
+		protoPayments = append(protoPayments, toProtoPayment(payment))
+	}
+	return protoPayments
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/config"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/transport/validator"
+	"paymentgo/internal/usecase/service"
+)
+
+// Типы сообщений WebSocket-шлюза
+const (
+	socketSubscribe   = "subscribe"
+	socketUnsubscribe = "unsubscribe"
+	socketPing        = "ping"
+	socketPong        = "pong"
+	socketEvent       = "event"
+	socketError       = "error"
+)
+
+const (
+	// maxSocketMessageSize ограничение сообщения клиента, подписка занимает меньше 200 байт
+	maxSocketMessageSize = 4 << 10
+	// bearerSubprotocol подпротокол с токеном в Sec-WebSocket-Protocol: браузер не может передать
+	// заголовок authorization, но передаёт подпротоколы new WebSocket(url, ["bearer", token])
+	bearerSubprotocol = "bearer"
+	// accessTokenParam параметр запроса с токеном, только при AllowQueryToken: URL с токеном
+	// оседает в журналах прокси и истории браузера
+	accessTokenParam = "access_token"
+)
+
+// socketRequest сообщение клиента: подписка на платёж (after_event_id продолжает после
+// переподключения, как в WatchPayment), отписка или ping
+type socketRequest struct {
+	Type         string `json:"type"`
+	PaymentID    string `json:"payment_id"`
+	AfterEventID int64  `json:"after_event_id"`
+}
+
+// socketMessage сообщение сервера: событие платежа (Event в том же JSON, что публикует outbox),
+// ошибка подписки (Code код gRPC, Reason причина из ErrorInfo) или pong
+type socketMessage struct {
+	Type      string            `json:"type"`
+	PaymentID string            `json:"payment_id,omitempty"`
+	Event     *dto.PaymentEvent `json:"event,omitempty"`
+	Snapshot  bool              `json:"snapshot,omitempty"`
+	Code      string            `json:"code,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Message   string            `json:"message,omitempty"`
+}
+
+// PaymentSocket WebSocket-шлюз статусов платежей: клиент подписывается на свои платежи и получает
+// те же события, что и WatchPayment, с тем же правилом доступа. Доступ проверяется по тому же токену,
+// что и в gRPC: из заголовка authorization, подпротокола bearer или, если разрешено, параметра access_token.
+// Сообщения ждут записи в буфере SendBuffer; пока он полон, подписки не читают новые события,
+// а пропущенное потом дочитывают из payment_events. Клиент, который не принимает запись за
+// WriteTimeout или не отвечает на ping за PongTimeout, отключается и переподключается с курсорами
+type PaymentSocket struct {
+	authenticator *auth.Authenticator
+	payments      *service.PaymentService
+	watcher       *service.WatchService
+	policy        *auth.Policy
+	cfg           config.WebSocket
+	upgrader      websocket.Upgrader
+	done          chan struct{}
+	once          sync.Once
+	logger        *zap.Logger
+}
+
+// NewPaymentSocket создание экземпляра шлюза; без authenticator токен не проверяется,
+// как gRPC при выключенной аутентификации
+func NewPaymentSocket(authenticator *auth.Authenticator, payments *service.PaymentService, watcher *service.WatchService, policy *auth.Policy, cfg config.WebSocket, logger *zap.Logger) *PaymentSocket {
+	s := &PaymentSocket{
+		authenticator: authenticator,
+		payments:      payments,
+		watcher:       watcher,
+		policy:        policy,
+		cfg:           cfg,
+		done:          make(chan struct{}),
+		logger:        logger.With(zap.String("component", "payment_socket")),
+	}
+	// Сервер выбирает подпротокол bearer, сам токен клиенту не возвращается
+	s.upgrader.Subprotocols = []string{bearerSubprotocol}
+	if len(cfg.AllowedOrigins) > 0 {
+		s.upgrader.CheckOrigin = s.checkOrigin
+	}
+	return s
+}
+
+// Shutdown закрывает соединения с кодом 1001 (going away): клиенты переподключаются к другой реплике
+func (s *PaymentSocket) Shutdown() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *PaymentSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.authenticator != nil {
+		token, ok := s.requestToken(r)
+		if !ok {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		identity, err := s.authenticator.Authenticate(ctx, token)
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			s.logger.Warn("Failed to validate token", zap.Error(err))
+			http.Error(w, "auth service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		ctx = auth.WithIdentity(ctx, identity)
+
+		// Соединение живёт не дольше токена: клиент переподключится с новым
+		if !identity.ExpiresAt.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, identity.ExpiresAt)
+			defer cancel()
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту ошибкой
+		s.logger.Debug("WebSocket upgrade failed", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &socketConn{
+		socket: s,
+		conn:   conn,
+		out:    make(chan socketMessage, max(s.cfg.SendBuffer, 1)),
+		subs:   make(map[string]context.CancelFunc),
+	}
+
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		c.write(ctx, cancel)
+	}()
+
+	c.read(ctx)
+	cancel()
+	writer.Wait()
+	c.watches.Wait()
+}
+
+// requestToken токен из заголовка authorization, подпротокола bearer (Sec-WebSocket-Protocol: bearer, <token>)
+// или параметра access_token при AllowQueryToken
+func (s *PaymentSocket) requestToken(r *http.Request) (string, bool) {
+	if token, ok := parseBearer(r.Header.Get(authorizationHeader)); ok {
+		return token, true
+	}
+	if protocols := websocket.Subprotocols(r); len(protocols) == 2 && protocols[0] == bearerSubprotocol && protocols[1] != "" {
+		return protocols[1], true
+	}
+	if !s.cfg.AllowQueryToken {
+		return "", false
+	}
+	token := r.URL.Query().Get(accessTokenParam)
+	return token, token != ""
+}
+
+// checkOrigin разрешает клиентов без Origin, страницы того же хоста и AllowedOrigins
+func (s *PaymentSocket) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(s.cfg.AllowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// socketConn одно соединение: читатель разбирает сообщения клиента, писатель единственный пишет
+// в соединение, каждая подписка работает в своей горутине
+type socketConn struct {
+	socket  *PaymentSocket
+	conn    *websocket.Conn
+	out     chan socketMessage
+	mu      sync.Mutex
+	subs    map[string]context.CancelFunc
+	watches sync.WaitGroup
+}
+
+func (c *socketConn) read(ctx context.Context) {
+	cfg := c.socket.cfg
+	c.conn.SetReadLimit(maxSocketMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && ctx.Err() == nil {
+				c.socket.logger.Debug("WebSocket connection lost", zap.Error(err))
+			}
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
+
+		var req socketRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.fail(ctx, "", status.Error(codes.InvalidArgument, "malformed message"))
+			continue
+		}
+
+		switch req.Type {
+		case socketSubscribe:
+			c.subscribe(ctx, req)
+		case socketUnsubscribe:
+			c.unsubscribe(req.PaymentID)
+		case socketPing:
+			c.pong()
+		default:
+			c.fail(ctx, req.PaymentID, status.Errorf(codes.InvalidArgument, "unknown message type %q", req.Type))
+		}
+	}
+}
+
+func (c *socketConn) write(ctx context.Context, cancel context.CancelFunc) {
+	// Закрытие соединения прерывает ожидание сообщения клиента в read
+	defer c.conn.Close()
+	defer cancel()
+
+	cfg := c.socket.cfg
+	ticker := time.NewTicker(max(cfg.PingInterval, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-c.out:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.socket.logger.Debug("WebSocket write failed", zap.Error(err))
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout)); err != nil {
+				return
+			}
+		case <-c.socket.done:
+			c.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				c.close(websocket.ClosePolicyViolation, "token expired")
+			} else {
+				c.close(websocket.CloseNormalClosure, "")
+			}
+			return
+		}
+	}
+}
+
+func (c *socketConn) close(code int, text string) {
+	message := websocket.FormatCloseMessage(code, text)
+	_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.socket.cfg.WriteTimeout))
+}
+
+// send ждёт места в буфере записи: медленный клиент притормаживает подписки, а не теряет события
+func (c *socketConn) send(ctx context.Context, msg socketMessage) error {
+	// Отменённая подписка не отправляет события, даже если в буфере есть место
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case c.out <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pong отвечает на ping клиента, не дожидаясь места в буфере записи: иначе чтение встаёт вместе
+// с подписками и клиент не может отписаться. При полном буфере ответ теряется, клиент повторит ping
+func (c *socketConn) pong() {
+	select {
+	case c.out <- socketMessage{Type: socketPong}:
+	default:
+	}
+}
+
+// fail сообщает клиенту об ошибке подписки на платёж paymentID
+func (c *socketConn) fail(ctx context.Context, paymentID string, err error) {
+	st := status.Convert(statusError(err))
+	msg := socketMessage{Type: socketError, PaymentID: paymentID, Code: st.Code().String(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			msg.Reason = info.Reason
+		}
+	}
+	_ = c.send(ctx, msg)
+}
+
+// subscribe запускает подписку на платёж; повторная подписка на тот же платёж заменяет прежнюю
+func (c *socketConn) subscribe(ctx context.Context, req socketRequest) {
+	watch := &proto.WatchPaymentRequest{PaymentId: req.PaymentID, AfterEventId: req.AfterEventID}
+	if violations := validator.Validate(watch); len(violations) > 0 {
+		c.fail(ctx, req.PaymentID, service.NewValidationError(service.ReasonInvalidRequest, violations...))
+		return
+	}
+
+	c.mu.Lock()
+	if cancel, ok := c.subs[req.PaymentID]; ok {
+		cancel()
+	} else if len(c.subs) >= c.socket.cfg.MaxSubscriptions {
+		c.mu.Unlock()
+		c.fail(ctx, req.PaymentID, status.Errorf(codes.ResourceExhausted, "at most %d subscriptions per connection", c.socket.cfg.MaxSubscriptions))
+		return
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	c.subs[req.PaymentID] = cancel
+	c.watches.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.watches.Done()
+		err := c.watch(subCtx, req)
+		if err != nil && subCtx.Err() == nil {
+			c.fail(ctx, req.PaymentID, err)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// Подписку могли заменить повторным subscribe
+		if subCtx.Err() == nil {
+			delete(c.subs, req.PaymentID)
+		}
+		cancel()
+	}()
+}
+
+func (c *socketConn) watch(ctx context.Context, req socketRequest) error {
+	s := c.socket
+	if err := authorizePayment(ctx, s.payments, s.policy, proto.PaymentService_WatchPayment_FullMethodName, req.PaymentID); err != nil {
+		return err
+	}
+	return s.watcher.WatchPayment(ctx, req.PaymentID, req.AfterEventID, func(event *dto.PaymentEvent, snapshot bool) error {
+		return c.send(ctx, socketMessage{Type: socketEvent, PaymentID: event.PaymentID, Event: event, Snapshot: snapshot})
+	})
+}
+
+func (c *socketConn) unsubscribe(paymentID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.subs[paymentID]; ok {
+		cancel()
+		delete(c.subs, paymentID)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"paymentgo/internal/cmd/auth"
+	"paymentgo/internal/config"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/usecase/service"
+)
+
+func testSocketConfig() config.WebSocket {
+	return config.WebSocket{
+		Path:             "/ws/payments",
+		PingInterval:     time.Minute,
+		PongTimeout:      time.Minute,
+		WriteTimeout:     time.Second,
+		SendBuffer:       4,
+		MaxSubscriptions: 2,
+	}
+}
+
+// newSocketServer шлюз поверх watchFixture с проверкой токенов stubValidator
+func newSocketServer(t *testing.T, f *watchFixture, cfg config.WebSocket) (*PaymentSocket, *httptest.Server) {
+	t.Helper()
+	authenticator := auth.NewAuthenticator(stubValidator{}, time.Minute)
+	socket := NewPaymentSocket(authenticator, f.payments, f.watcher, f.policy, cfg, zaptest.NewLogger(t))
+	server := httptest.NewServer(socket)
+	t.Cleanup(server.Close)
+	return socket, server
+}
+
+func dialSocket(t *testing.T, server *httptest.Server, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func dialAs(t *testing.T, server *httptest.Server, userID string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := dialSocket(t, server, "", http.Header{"Authorization": {"Bearer " + userToken(userID)}})
+	require.NoError(t, err)
+	return conn
+}
+
+func readSocket(t *testing.T, conn *websocket.Conn) socketMessage {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	var msg socketMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestPaymentSocket_SubscribeAndResume(t *testing.T) {
+	f := newWatchFixture(t,
+		watchEvent(1, "", entity.StatusPending),
+		watchEvent(2, entity.StatusPending, entity.StatusSuccess),
+	)
+	_, server := newSocketServer(t, f, testSocketConfig())
+
+	conn := dialAs(t, server, "user1")
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment}))
+
+	snapshot := readSocket(t, conn)
+	assert.Equal(t, socketEvent, snapshot.Type)
+	assert.Equal(t, testWatchPayment, snapshot.PaymentID)
+	assert.True(t, snapshot.Snapshot)
+	require.NotNil(t, snapshot.Event)
+	assert.Equal(t, int64(2), snapshot.Event.ID)
+	assert.Equal(t, entity.StatusSuccess, snapshot.Event.To)
+
+	f.publish(t, watchEvent(3, entity.StatusSuccess, entity.StatusComplete))
+	complete := readSocket(t, conn)
+	assert.False(t, complete.Snapshot)
+	assert.Equal(t, int64(3), complete.Event.ID)
+	conn.Close()
+
+	// После переподключения клиент продолжает с последнего полученного события
+	conn = dialAs(t, server, "user2")
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment, AfterEventID: 1}))
+	resumed := readSocket(t, conn)
+	assert.False(t, resumed.Snapshot)
+	assert.Equal(t, int64(2), resumed.Event.ID)
+}
+
+func TestPaymentSocket_Authentication(t *testing.T) {
+	f := newWatchFixture(t, watchEvent(1, "", entity.StatusPending))
+	_, server := newSocketServer(t, f, testSocketConfig())
+
+	_, resp, err := dialSocket(t, server, "", nil)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Без AllowQueryToken параметр access_token не принимается
+	_, resp, err = dialSocket(t, server, "?access_token="+userToken("user3"), nil)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Браузер передаёт токен подпротоколом, сервер выбирает bearer
+	conn, resp, err := dialSocket(t, server, "", http.Header{"Sec-WebSocket-Protocol": {"bearer, " + userToken("user3")}})
+	require.NoError(t, err)
+	assert.Equal(t, bearerSubprotocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment}))
+	denied := readSocket(t, conn)
+	assert.Equal(t, socketError, denied.Type)
+	assert.Equal(t, testWatchPayment, denied.PaymentID)
+	assert.Equal(t, "PermissionDenied", denied.Code)
+}
+
+func TestPaymentSocket_QueryTokenAllowed(t *testing.T) {
+	f := newWatchFixture(t, watchEvent(1, "", entity.StatusPending))
+	cfg := testSocketConfig()
+	cfg.AllowQueryToken = true
+	_, server := newSocketServer(t, f, cfg)
+
+	conn, _, err := dialSocket(t, server, "?access_token="+userToken("user1"), nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment}))
+	assert.True(t, readSocket(t, conn).Snapshot)
+}
+
+func TestSocketConn_PongDoesNotBlockOnFullBuffer(t *testing.T) {
+	c := &socketConn{out: make(chan socketMessage, 1)}
+	c.out <- socketMessage{Type: socketEvent}
+
+	done := make(chan struct{})
+	go func() {
+		c.pong()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pong blocked on a full send buffer")
+	}
+	assert.Equal(t, socketEvent, (<-c.out).Type)
+}
+
+func TestPaymentSocket_InvalidRequests(t *testing.T) {
+	f := newWatchFixture(t, watchEvent(1, "", entity.StatusPending))
+	_, server := newSocketServer(t, f, testSocketConfig())
+	conn := dialAs(t, server, "user1")
+
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: "p1"}))
+	invalid := readSocket(t, conn)
+	assert.Equal(t, socketError, invalid.Type)
+	assert.Equal(t, "InvalidArgument", invalid.Code)
+	assert.Equal(t, service.ReasonInvalidRequest, invalid.Reason)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("{")))
+	assert.Equal(t, "InvalidArgument", readSocket(t, conn).Code)
+
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketPing}))
+	assert.Equal(t, socketPong, readSocket(t, conn).Type)
+}
+
+func TestPaymentSocket_SubscriptionLimit(t *testing.T) {
+	f := newWatchFixture(t, watchEvent(1, "", entity.StatusPending))
+	cfg := testSocketConfig()
+	cfg.MaxSubscriptions = 1
+	_, server := newSocketServer(t, f, cfg)
+	conn := dialAs(t, server, "user1")
+
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment}))
+	assert.True(t, readSocket(t, conn).Snapshot)
+
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: "0b8f6a2e-3c4d-4e5f-8a9b-1c2d3e4f5a6b"}))
+	assert.Equal(t, "ResourceExhausted", readSocket(t, conn).Code)
+
+	// Отписка освобождает место, повторная подписка снова начинается с текущего состояния
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketUnsubscribe, PaymentID: testWatchPayment}))
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketSubscribe, PaymentID: testWatchPayment}))
+	assert.True(t, readSocket(t, conn).Snapshot)
+}
+
+func TestPaymentSocket_Heartbeat(t *testing.T) {
+	f := newWatchFixture(t)
+	cfg := testSocketConfig()
+	cfg.PingInterval = 20 * time.Millisecond
+	cfg.PongTimeout = 200 * time.Millisecond
+	_, server := newSocketServer(t, f, cfg)
+
+	// Клиент отвечает на ping при чтении и остаётся подключённым дольше PongTimeout
+	alive := dialAs(t, server, "user1")
+	pings := make(chan struct{}, 100)
+	alive.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return alive.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := alive.ReadMessage()
+		done <- err
+	}()
+
+	// Клиент без ответов на ping отключается
+	silent := dialAs(t, server, "user1")
+	silent.SetPingHandler(func(string) error { return nil })
+	require.NoError(t, silent.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, _, err := silent.ReadMessage()
+	require.Error(t, err)
+
+	select {
+	case err := <-done:
+		t.Fatalf("responsive client was disconnected: %v", err)
+	default:
+	}
+	assert.NotEmpty(t, pings)
+}
+
+func TestPaymentSocket_ShutdownClosesConnections(t *testing.T) {
+	f := newWatchFixture(t)
+	socket, server := newSocketServer(t, f, testSocketConfig())
+	conn := dialAs(t, server, "user1")
+
+	// Соединение установлено: ping проходит
+	require.NoError(t, conn.WriteJSON(socketRequest{Type: socketPing}))
+	assert.Equal(t, socketPong, readSocket(t, conn).Type)
+
+	socket.Shutdown()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+}
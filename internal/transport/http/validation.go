@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"paymentgo/internal/transport/validator"
+	"paymentgo/internal/usecase/service"
+)
+
+// NewValidationInterceptor отклоняет запросы, нарушающие правила validator, с codes.InvalidArgument
+// и нарушениями по полям в errdetails.BadRequest
+func NewValidationInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewValidationStreamInterceptor то же для сообщений, полученных стримом
+func NewValidationStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: stream})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+func validate(req any) error {
+	msg, ok := req.(protobuf.Message)
+	if !ok {
+		return nil
+	}
+	if violations := validator.Validate(msg); len(violations) > 0 {
+		return statusError(service.NewValidationError(service.ReasonInvalidRequest, violations...))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase/service"
+)
+
+func TestValidationInterceptor(t *testing.T) {
+	interceptor := NewValidationInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: proto.PaymentService_CreatePayment_FullMethodName}
+
+	called := false
+	handler := func(ctx context.Context, req any) (any, error) {
+		called = true
+		return &proto.CreatePaymentResponse{PaymentId: "p1"}, nil
+	}
+
+	_, err := interceptor(context.Background(), &proto.CreatePaymentRequest{FromUserId: "u1", Amount: &proto.Money{CurrencyCode: "RUB"}}, info, handler)
+	require.Error(t, err)
+	assert.False(t, called, "invalid request must not reach the handler")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	reason, fields := errorDetails(t, err)
+	assert.Equal(t, service.ReasonInvalidRequest, reason)
+	assert.Equal(t, []string{"from_user_id", "to_user_id", "amount"}, fields)
+
+	resp, err := interceptor(context.Background(), &proto.CreatePaymentRequest{
+		FromUserId: "3f2b6c1e-8a4d-4e2b-9c1a-5d6e7f8a9b0c",
+		ToUserId:   "7a1e2d3c-4b5a-4c6d-8e9f-0a1b2c3d4e5f",
+		Amount:     &proto.Money{CurrencyCode: "RUB", Units: 100},
+	}, info, handler)
+	require.NoError(t, err)
+	assert.True(t, called)
+	assert.Equal(t, "p1", resp.(*proto.CreatePaymentResponse).PaymentId)
+}
+
+// recvStream стрим, отдающий одно сообщение msg
+type recvStream struct {
+	grpc.ServerStream
+	msg *proto.GetPaymentRequest
+}
+
+func (s *recvStream) RecvMsg(m any) error {
+	m.(*proto.GetPaymentRequest).PaymentId = s.msg.PaymentId
+	return nil
+}
+
+func TestValidationStreamInterceptor(t *testing.T) {
+	interceptor := NewValidationStreamInterceptor()
+	handler := func(srv any, stream grpc.ServerStream) error {
+		return stream.RecvMsg(&proto.GetPaymentRequest{})
+	}
+
+	err := interceptor(nil, &recvStream{msg: &proto.GetPaymentRequest{PaymentId: "p1"}}, &grpc.StreamServerInfo{}, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, fields := errorDetails(t, err)
+	assert.Equal(t, []string{"payment_id"}, fields)
+
+	err = interceptor(nil, &recvStream{msg: &proto.GetPaymentRequest{PaymentId: "3f2b6c1e-8a4d-4e2b-9c1a-5d6e7f8a9b0c"}}, &grpc.StreamServerInfo{}, handler)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"paymentgo/internal/cmd/auth"
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	"paymentgo/internal/config"
+	entity "paymentgo/internal/entity"
+	"paymentgo/internal/outbox"
+	"paymentgo/internal/repository"
+	"paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase"
+	"paymentgo/internal/usecase/service"
+	db "paymentgo/utils/connector"
+)
+
+const (
+	testWatchPayment = "5c0e9a43-2b1f-4d8e-a6c7-9f3b2e1d0a4c"
+	testWatchChannel = "payment_events:live"
+)
+
+type memoryEventRepo struct {
+	repository.PaymentEventRepository
+	events []*entity.PaymentEvent
+}
+
+func (m *memoryEventRepo) PaymentEvents(ctx context.Context, paymentID string, afterID int64) ([]*entity.PaymentEvent, error) {
+	var events []*entity.PaymentEvent
+	for _, event := range m.events {
+		if event.PaymentID == paymentID && event.ID > afterID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// eventStream серверный стрим WatchPayment, отправленные события попадают в sent
+type eventStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *proto.PaymentEvent
+}
+
+func (s *eventStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *eventStream) Send(event *proto.PaymentEvent) error {
+	s.sent <- event
+	return nil
+}
+
+type watchFixture struct {
+	handler  *PaymentHandler
+	repo     *memoryPaymentRepo
+	payments *service.PaymentService
+	watcher  *service.WatchService
+	policy   *auth.Policy
+	sink     *outbox.PubSubSink
+}
+
+// newWatchFixture ручки с Hub на miniredis; события платежа testWatchPayment из events уже записаны
+func newWatchFixture(t *testing.T, events ...*entity.PaymentEvent) *watchFixture {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	hub := outbox.NewHub(client, testWatchChannel, 4, logger)
+	ready, err := hub.Subscribe("ready")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	select {
+	case <-ready.Resync():
+	case <-time.After(time.Second):
+		t.Fatal("hub did not subscribe")
+	}
+	ready.Close()
+
+	repo := &memoryPaymentRepo{payments: map[string]*entity.Payment{
+		testWatchPayment: {ID: testWatchPayment, FromUserID: "user1", ToUserID: "user2", Amount: entity.Money{Minor: 1050, Currency: "RUB"}, Status: entity.StatusSuccess},
+	}}
+	providers, err := usecase.NewProviderRegistry(yoomoney.ProviderName, yoomoney.NewProvider(nil, entity.CoreAccount))
+	require.NoError(t, err)
+	payments := service.NewPaymentService(repo, logger, nil, providers, db.NewPaymentsQueue())
+	watcher := service.NewWatchService(repo, &memoryEventRepo{events: events}, hub, logger)
+
+	policy, err := auth.NewPolicy(config.Auth{Rules: map[string]string{"WatchPayment": "participant"}, AdminRole: "admin"})
+	require.NoError(t, err)
+
+	return &watchFixture{
+		handler:  NewPaymentHandler(payments, watcher, nil, policy, logger),
+		repo:     repo,
+		payments: payments,
+		watcher:  watcher,
+		policy:   policy,
+		sink:     outbox.NewPubSubSink(client, testWatchChannel),
+	}
+}
+
+// watch запускает WatchPayment; результат вызова приходит в возвращаемый канал
+func (f *watchFixture) watch(ctx context.Context, afterEventID int64) (*eventStream, <-chan error) {
+	stream := &eventStream{ctx: ctx, sent: make(chan *proto.PaymentEvent, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- f.handler.WatchPayment(&proto.WatchPaymentRequest{PaymentId: testWatchPayment, AfterEventId: afterEventID}, stream)
+	}()
+	return stream, done
+}
+
+func (f *watchFixture) publish(t *testing.T, events ...*entity.PaymentEvent) {
+	t.Helper()
+	for _, event := range events {
+		require.NoError(t, f.sink.Publish(context.Background(), event))
+	}
+}
+
+func nextEvent(t *testing.T, stream *eventStream) *proto.PaymentEvent {
+	t.Helper()
+	select {
+	case event := <-stream.sent:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no payment event sent")
+		return nil
+	}
+}
+
+func watchEvent(id int64, from, to entity.PaymentStatus) *entity.PaymentEvent {
+	return &entity.PaymentEvent{ID: id, PaymentID: testWatchPayment, From: from, To: to, Amount: entity.Money{Minor: 1050, Currency: "RUB"}}
+}
+
+func TestWatchPayment_SnapshotThenTransitions(t *testing.T) {
+	created := watchEvent(1, "", entity.StatusPending)
+	paid := watchEvent(2, entity.StatusPending, entity.StatusSuccess)
+	f := newWatchFixture(t, created, paid)
+
+	stream, done := f.watch(context.Background(), 0)
+	snapshot := nextEvent(t, stream)
+	assert.True(t, snapshot.Snapshot)
+	assert.Equal(t, int64(2), snapshot.EventId)
+	assert.Equal(t, string(entity.StatusSuccess), snapshot.Status)
+	assert.Equal(t, &proto.Money{CurrencyCode: "RUB", Units: 10, Nanos: 500000000}, snapshot.Amount)
+
+	// Повтор уже переданного события от outbox отбрасывается
+	f.publish(t, paid, watchEvent(3, entity.StatusSuccess, entity.StatusComplete), watchEvent(4, entity.StatusComplete, entity.StatusRefunded))
+
+	complete := nextEvent(t, stream)
+	assert.False(t, complete.Snapshot)
+	assert.Equal(t, int64(3), complete.EventId)
+	assert.Equal(t, string(entity.StatusSuccess), complete.FromStatus)
+	assert.Equal(t, string(entity.StatusComplete), complete.Status)
+	assert.Equal(t, int64(4), nextEvent(t, stream).EventId)
+
+	// После конечного статуса стрим завершается
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("watch did not finish after final status")
+	}
+}
+
+func TestWatchPayment_ResumesAfterEvent(t *testing.T) {
+	f := newWatchFixture(t,
+		watchEvent(1, "", entity.StatusPending),
+		watchEvent(2, entity.StatusPending, entity.StatusFailed),
+		watchEvent(3, entity.StatusFailed, entity.StatusPending),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, done := f.watch(ctx, 1)
+	for _, want := range []int64{2, 3} {
+		event := nextEvent(t, stream)
+		assert.False(t, event.Snapshot)
+		assert.Equal(t, want, event.EventId)
+	}
+
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-done))
+}
+
+func TestWatchPayment_ResumeAtFinalEventFinishes(t *testing.T) {
+	f := newWatchFixture(t,
+		watchEvent(1, "", entity.StatusPending),
+		watchEvent(2, entity.StatusPending, entity.StatusSuccess),
+		watchEvent(3, entity.StatusSuccess, entity.StatusRefunded),
+	)
+	f.repo.payments[testWatchPayment].Status = entity.StatusRefunded
+
+	for _, after := range []int64{3, 5} {
+		stream, done := f.watch(context.Background(), after)
+		select {
+		case err := <-done:
+			assert.NoError(t, err, after)
+		case <-time.After(time.Second):
+			t.Fatalf("watch after event %d did not finish for a final payment", after)
+		}
+		assert.Empty(t, stream.sent, after)
+	}
+}
+
+func TestWatchPayment_PaymentWithoutEvents(t *testing.T) {
+	f := newWatchFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, _ := f.watch(ctx, 0)
+
+	snapshot := nextEvent(t, stream)
+	assert.True(t, snapshot.Snapshot)
+	assert.Zero(t, snapshot.EventId)
+	assert.Equal(t, string(entity.StatusSuccess), snapshot.Status)
+
+	f.publish(t, watchEvent(7, entity.StatusSuccess, entity.StatusComplete))
+	assert.Equal(t, int64(7), nextEvent(t, stream).EventId)
+}
+
+func TestWatchPayment_Access(t *testing.T) {
+	f := newWatchFixture(t, watchEvent(1, "", entity.StatusPending))
+
+	_, done := f.watch(auth.WithIdentity(context.Background(), auth.Identity{UserID: "user3"}), 0)
+	assert.Equal(t, codes.PermissionDenied, status.Code(<-done))
+
+	ctx, cancel := context.WithCancel(auth.WithIdentity(context.Background(), auth.Identity{UserID: "user2"}))
+	defer cancel()
+	stream, _ := f.watch(ctx, 0)
+	assert.True(t, nextEvent(t, stream).Snapshot)
+}
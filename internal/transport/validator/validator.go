@@ -0,0 +1,253 @@
+// Package validator проверка запросов gRPC по правилам, объявленным для каждого сообщения payment.proto
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	dto "paymentgo/internal/entity"
+	pb "paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase/service"
+)
+
+// maxIdempotencyKeyLength длина колонки idempotency_keys.key
+const maxIdempotencyKeyLength = 255
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Check проверка значения поля; пустое описание означает, что значение допустимо
+type Check func(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string
+
+// Field проверки поля сообщения; выполняются по порядку до первого нарушения
+type Field struct {
+	Name   protoreflect.Name
+	Checks []Check
+}
+
+// Rule проверка, связывающая несколько полей сообщения
+type Rule func(msg protoreflect.Message) []service.FieldViolation
+
+// Message правила сообщения
+type Message struct {
+	Fields []Field
+	Rules  []Rule
+}
+
+// messages правила запросов payment.proto по полному имени сообщения
+var messages = map[protoreflect.FullName]Message{
+	name(&pb.CreatePaymentRequest{}): {
+		Fields: []Field{
+			{Name: "from_user_id", Checks: []Check{Required, UUID}},
+			{Name: "to_user_id", Checks: []Check{Required, UUID}},
+			{Name: "amount", Checks: []Check{Required, PositiveMoney}},
+			{Name: "idempotency_key", Checks: []Check{MaxLength(maxIdempotencyKeyLength)}},
+		},
+		Rules: []Rule{NotEqual("to_user_id", "from_user_id", "payee must differ from payer")},
+	},
+	name(&pb.GetPaymentRequest{}):     paymentIDRequest(),
+	name(&pb.GetPaymentByIDRequest{}): paymentIDRequest(),
+	name(&pb.GetPaymentLinkRequest{}): paymentIDRequest(
+		Field{Name: "idempotency_key", Checks: []Check{MaxLength(maxIdempotencyKeyLength)}},
+	),
+	name(&pb.RefundPaymentRequest{}): paymentIDRequest(
+		Field{Name: "idempotency_key", Checks: []Check{MaxLength(maxIdempotencyKeyLength)}},
+	),
+	name(&pb.RequeueDeadLetterRequest{}): paymentIDRequest(),
+	name(&pb.WatchPaymentRequest{}): paymentIDRequest(
+		Field{Name: "after_event_id", Checks: []Check{Min(0)}},
+	),
+	name(&pb.GetPaymentHistoryRequest{}): {
+		Fields: []Field{
+			{Name: "from_user_id", Checks: []Check{Required, UUID}},
+			{Name: "page", Checks: []Check{Min(1)}},
+			{Name: "limit", Checks: []Check{Min(1)}},
+		},
+	},
+	name(&pb.GetActivePaymentsRequest{}): {
+		Fields: []Field{
+			{Name: "user_id", Checks: []Check{Required, UUID}},
+		},
+	},
+	name(&pb.ListDeadLettersRequest{}): {
+		Fields: []Field{
+			{Name: "page", Checks: []Check{Min(1)}},
+			{Name: "limit", Checks: []Check{Min(1)}},
+		},
+	},
+	name(&pb.GetExchangeRateRequest{}): {
+		Fields: []Field{
+			{Name: "from_currency", Checks: []Check{Required, Currency}},
+			{Name: "to_currency", Checks: []Check{Required, Currency}},
+			{Name: "date", Checks: []Check{Optional(Date)}},
+			{Name: "interpolation", Checks: []Check{DefinedEnum}},
+			{Name: "amount", Checks: []Check{Optional(PositiveMoney)}},
+		},
+		Rules: []Rule{SameCurrency("amount", "from_currency")},
+	},
+}
+
+func name(msg proto.Message) protoreflect.FullName {
+	return msg.ProtoReflect().Descriptor().FullName()
+}
+
+// paymentIDRequest правила запроса по id платежа
+func paymentIDRequest(fields ...Field) Message {
+	return Message{Fields: append([]Field{{Name: "payment_id", Checks: []Check{Required, UUID}}}, fields...)}
+}
+
+// Validate нарушения правил в запросе msg; сообщения без правил считаются корректными
+func Validate(msg proto.Message) []service.FieldViolation {
+	reflected := msg.ProtoReflect()
+	message, ok := messages[reflected.Descriptor().FullName()]
+	if !ok {
+		return nil
+	}
+
+	var violations []service.FieldViolation
+	for _, field := range message.Fields {
+		fd := reflected.Descriptor().Fields().ByName(field.Name)
+		if fd == nil {
+			violations = append(violations, service.FieldViolation{Field: string(field.Name), Description: "unknown field"})
+			continue
+		}
+		for _, check := range field.Checks {
+			if description := check(reflected, fd); description != "" {
+				violations = append(violations, service.FieldViolation{Field: string(field.Name), Description: description})
+				break
+			}
+		}
+	}
+	// Проверки между полями имеют смысл, только если сами поля корректны
+	if len(violations) == 0 {
+		for _, rule := range message.Rules {
+			violations = append(violations, rule(reflected)...)
+		}
+	}
+	return violations
+}
+
+// Required поле заполнено
+func Required(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	if !msg.Has(fd) {
+		return "is required"
+	}
+	return ""
+}
+
+// Optional проверки выполняются, только если поле заполнено
+func Optional(checks ...Check) Check {
+	return func(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+		if !msg.Has(fd) {
+			return ""
+		}
+		for _, check := range checks {
+			if description := check(msg, fd); description != "" {
+				return description
+			}
+		}
+		return ""
+	}
+}
+
+// UUID строка в формате UUID
+func UUID(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	if !uuidPattern.MatchString(msg.Get(fd).String()) {
+		return "must be a UUID"
+	}
+	return ""
+}
+
+// Currency известный код валюты ISO 4217
+func Currency(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	if _, err := dto.CurrencyExponent(msg.Get(fd).String()); err != nil {
+		return fmt.Sprintf("unknown currency %q", msg.Get(fd).String())
+	}
+	return ""
+}
+
+// Date дата в формате YYYY-MM-DD
+func Date(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	if _, err := time.Parse(time.DateOnly, msg.Get(fd).String()); err != nil {
+		return "must be a date in YYYY-MM-DD format"
+	}
+	return ""
+}
+
+// DefinedEnum значение перечисления объявлено в proto
+func DefinedEnum(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	if fd.Enum().Values().ByNumber(msg.Get(fd).Enum()) == nil {
+		return fmt.Sprintf("unknown value %d", msg.Get(fd).Enum())
+	}
+	return ""
+}
+
+// Min целое не меньше min
+func Min(min int64) Check {
+	return func(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+		if msg.Get(fd).Int() < min {
+			return fmt.Sprintf("must be at least %d", min)
+		}
+		return ""
+	}
+}
+
+// MaxLength строка не длиннее max байт
+func MaxLength(max int) Check {
+	return func(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+		if len(msg.Get(fd).String()) > max {
+			return fmt.Sprintf("must be at most %d bytes", max)
+		}
+		return ""
+	}
+}
+
+// PositiveMoney сумма Money в известной валюте больше нуля
+func PositiveMoney(msg protoreflect.Message, fd protoreflect.FieldDescriptor) string {
+	money, ok := msg.Get(fd).Message().Interface().(*pb.Money)
+	if !ok {
+		return "must be Money"
+	}
+	amount, err := dto.MoneyFromUnitsNanos(money.GetUnits(), money.GetNanos(), money.GetCurrencyCode())
+	if err != nil {
+		return err.Error()
+	}
+	if amount.Minor <= 0 {
+		return "must be greater than zero"
+	}
+	return ""
+}
+
+// NotEqual строковое поле field не совпадает с полем other
+func NotEqual(field, other protoreflect.Name, description string) Rule {
+	return func(msg protoreflect.Message) []service.FieldViolation {
+		fields := msg.Descriptor().Fields()
+		if msg.Get(fields.ByName(field)).String() == msg.Get(fields.ByName(other)).String() {
+			return []service.FieldViolation{{Field: string(field), Description: description}}
+		}
+		return nil
+	}
+}
+
+// SameCurrency валюта суммы в поле money, если она указана, совпадает с кодом валюты в поле currency
+func SameCurrency(money, currency protoreflect.Name) Rule {
+	return func(msg protoreflect.Message) []service.FieldViolation {
+		fields := msg.Descriptor().Fields()
+		moneyField := fields.ByName(money)
+		if !msg.Has(moneyField) {
+			return nil
+		}
+		amount, ok := msg.Get(moneyField).Message().Interface().(*pb.Money)
+		expected := msg.Get(fields.ByName(currency)).String()
+		if ok && amount.GetCurrencyCode() != expected {
+			return []service.FieldViolation{{
+				Field:       string(money) + ".currency_code",
+				Description: fmt.Sprintf("must match %s %s", currency, expected),
+			}}
+		}
+		return nil
+	}
+}
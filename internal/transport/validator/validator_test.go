@@ -0,0 +1,151 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	pb "paymentgo/internal/transport/grpc/proto"
+	"paymentgo/internal/usecase/service"
+)
+
+const (
+	payer = "3f2b6c1e-8a4d-4e2b-9c1a-5d6e7f8a9b0c"
+	payee = "7a1e2d3c-4b5a-4c6d-8e9f-0a1b2c3d4e5f"
+)
+
+func rub(units int64, nanos int32) *pb.Money {
+	return &pb.Money{CurrencyCode: "RUB", Units: units, Nanos: nanos}
+}
+
+func fields(violations []service.FieldViolation) []string {
+	var result []string
+	for _, violation := range violations {
+		result = append(result, violation.Field)
+	}
+	return result
+}
+
+func TestValidate_CoversEveryRequest(t *testing.T) {
+	services := pb.File_proto_payment_proto.Services()
+	for i := 0; i < services.Len(); i++ {
+		methods := services.Get(i).Methods()
+		for j := 0; j < methods.Len(); j++ {
+			input := methods.Get(j).Input()
+			message, ok := messages[input.FullName()]
+			if !assert.True(t, ok, "no validation rules for %s", input.FullName()) {
+				continue
+			}
+			for _, field := range message.Fields {
+				assert.NotNil(t, input.Fields().ByName(field.Name), "%s has no field %s", input.FullName(), field.Name)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    proto.Message
+		fields []string
+	}{
+		{
+			name: "valid payment",
+			msg:  &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payee, Amount: rub(100, 0), IdempotencyKey: "key"},
+		},
+		{
+			name:   "empty payment",
+			msg:    &pb.CreatePaymentRequest{},
+			fields: []string{"from_user_id", "to_user_id", "amount"},
+		},
+		{
+			name:   "malformed ids",
+			msg:    &pb.CreatePaymentRequest{FromUserId: "user-1", ToUserId: payee + "0", Amount: rub(100, 0)},
+			fields: []string{"from_user_id", "to_user_id"},
+		},
+		{
+			name:   "zero amount",
+			msg:    &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payee, Amount: rub(0, 0)},
+			fields: []string{"amount"},
+		},
+		{
+			name:   "negative amount",
+			msg:    &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payee, Amount: rub(-1, -500000000)},
+			fields: []string{"amount"},
+		},
+		{
+			name:   "unknown currency",
+			msg:    &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payee, Amount: &pb.Money{CurrencyCode: "XXX", Units: 1}},
+			fields: []string{"amount"},
+		},
+		{
+			name:   "payment to self",
+			msg:    &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payer, Amount: rub(100, 0)},
+			fields: []string{"to_user_id"},
+		},
+		{
+			name:   "long idempotency key",
+			msg:    &pb.CreatePaymentRequest{FromUserId: payer, ToUserId: payee, Amount: rub(100, 0), IdempotencyKey: strings.Repeat("k", maxIdempotencyKeyLength+1)},
+			fields: []string{"idempotency_key"},
+		},
+		{
+			name: "payment by id",
+			msg:  &pb.GetPaymentByIDRequest{PaymentId: payer},
+		},
+		{
+			name:   "refund without payment id",
+			msg:    &pb.RefundPaymentRequest{},
+			fields: []string{"payment_id"},
+		},
+		{
+			name:   "requeue malformed payment id",
+			msg:    &pb.RequeueDeadLetterRequest{PaymentId: "p1"},
+			fields: []string{"payment_id"},
+		},
+		{
+			name: "history",
+			msg:  &pb.GetPaymentHistoryRequest{FromUserId: payer, Page: 1, Limit: 20},
+		},
+		{
+			name:   "history without page and limit",
+			msg:    &pb.GetPaymentHistoryRequest{FromUserId: payer},
+			fields: []string{"page", "limit"},
+		},
+		{
+			name:   "dead letters negative page",
+			msg:    &pb.ListDeadLettersRequest{Page: -1, Limit: 10},
+			fields: []string{"page"},
+		},
+		{
+			name:   "active payments malformed user",
+			msg:    &pb.GetActivePaymentsRequest{UserId: "u1"},
+			fields: []string{"user_id"},
+		},
+		{
+			name: "exchange rate with amount",
+			msg:  &pb.GetExchangeRateRequest{FromCurrency: "RUB", ToCurrency: "USD", Date: "2024-03-01", Amount: rub(10, 0)},
+		},
+		{
+			name:   "exchange rate unknown currency and bad date",
+			msg:    &pb.GetExchangeRateRequest{FromCurrency: "RUB", ToCurrency: "ZZZ", Date: "01.03.2024"},
+			fields: []string{"to_currency", "date"},
+		},
+		{
+			name:   "exchange rate unknown interpolation",
+			msg:    &pb.GetExchangeRateRequest{FromCurrency: "RUB", ToCurrency: "USD", Interpolation: pb.RateInterpolation(42)},
+			fields: []string{"interpolation"},
+		},
+		{
+			name:   "exchange rate amount in other currency",
+			msg:    &pb.GetExchangeRateRequest{FromCurrency: "USD", ToCurrency: "EUR", Amount: rub(10, 0)},
+			fields: []string{"amount.currency_code"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.fields, fields(Validate(tt.msg)))
+		})
+	}
+}
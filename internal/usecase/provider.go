@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	entity "paymentgo/internal/entity"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	// ErrNotSupported операция не входит в возможности провайдера (см. ProviderCapabilities)
+	ErrNotSupported = errors.New("operation is not supported by payment provider")
+	// ErrPayoutRejected провайдер окончательно отказал в выплате, повтор с теми же данными не поможет
+	ErrPayoutRejected = errors.New("payout rejected by payment provider")
+)
+
+// ProviderStatus состояние оплаты на стороне провайдера
+type ProviderStatus string
+
+const (
+	ProviderStatusPending   ProviderStatus = "pending"
+	ProviderStatusSucceeded ProviderStatus = "success"
+	ProviderStatusFailed    ProviderStatus = "failed"
+)
+
+// PayoutStatus состояние выплаты получателю на стороне провайдера
+type PayoutStatus string
+
+const (
+	// PayoutRequested перевод зарегистрирован у провайдера, но ещё не проведён
+	PayoutRequested PayoutStatus = "requested"
+	// PayoutInProgress провайдер проводит перевод, следующий шаг не раньше NextRetry
+	PayoutInProgress PayoutStatus = "in_progress"
+	PayoutCompleted  PayoutStatus = "completed"
+)
+
+// Payout результат шага выплаты. RequestID и PaymentID сохраняются в платеже
+// (PayoutRequestID, PayoutID), по ним следующий шаг продолжает ту же выплату
+type Payout struct {
+	Status    PayoutStatus
+	RequestID string
+	PaymentID string
+	NextRetry time.Duration
+}
+
+// ProviderCapabilities что провайдер умеет; вызов неподдерживаемой операции возвращает ErrNotSupported
+type ProviderCapabilities struct {
+	PaymentLinks bool
+	StatusLookup bool
+	Payouts      bool
+	Refunds      bool
+	// Currency валюта, в которой провайдер принимает оплату; сумма платежа в другой валюте конвертируется
+	Currency string
+}
+
+// PaymentProvider эквайер: приём оплаты по ссылке, проверка статуса, выплата получателю и возврат
+type PaymentProvider interface {
+	// Name ключ провайдера, сохраняемый в платеже
+	Name() string
+	Capabilities() ProviderCapabilities
+	// CreatePaymentLink ссылка на оплату платежа на сумму amount в валюте провайдера
+	CreatePaymentLink(ctx context.Context, payment *entity.Payment, amount entity.Money) (string, error)
+	PaymentStatus(ctx context.Context, payment *entity.Payment) (ProviderStatus, error)
+	// Payout выполняет очередной шаг перевода суммы платежа получателю recipient (идентификатор счёта у провайдера),
+	// продолжая выплату по payment.PayoutRequestID и payment.PayoutID. Вызывающий сохраняет результат
+	// и повторяет вызов, пока статус не станет PayoutCompleted; окончательный отказ оборачивает ErrPayoutRejected
+	Payout(ctx context.Context, payment *entity.Payment, recipient string) (Payout, error)
+	// Refund возвращает оплату плательщику. Повтор с тем же idempotencyKey не создаёт второй возврат,
+	// провайдер вернёт результат первого
+	Refund(ctx context.Context, payment *entity.Payment, idempotencyKey string) error
+}
+
+// ProviderRegistry провайдеры, включённые в конфигурации
+type ProviderRegistry struct {
+	providers   map[string]PaymentProvider
+	defaultName string
+}
+
+func NewProviderRegistry(defaultName string, providers ...PaymentProvider) (*ProviderRegistry, error) {
+	registry := &ProviderRegistry{
+		providers:   make(map[string]PaymentProvider, len(providers)),
+		defaultName: defaultName,
+	}
+	for _, provider := range providers {
+		if _, ok := registry.providers[provider.Name()]; ok {
+			return nil, fmt.Errorf("payment provider %s registered twice", provider.Name())
+		}
+		registry.providers[provider.Name()] = provider
+	}
+
+	if _, ok := registry.providers[defaultName]; !ok {
+		return nil, fmt.Errorf("default payment provider %s: %w", defaultName, ErrUnknownProvider)
+	}
+	return registry, nil
+}
+
+// Get провайдер по имени; пустое имя означает провайдера по умолчанию
+func (r *ProviderRegistry) Get(name string) (PaymentProvider, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownProvider)
+	}
+	return provider, nil
+}
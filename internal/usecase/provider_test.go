@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	entity "paymentgo/internal/entity"
+)
+
+type stubProvider struct {
+	name string
+}
+
+func (p stubProvider) Name() string                       { return p.name }
+func (p stubProvider) Capabilities() ProviderCapabilities { return ProviderCapabilities{} }
+
+func (p stubProvider) CreatePaymentLink(ctx context.Context, payment *entity.Payment, amount entity.Money) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (p stubProvider) PaymentStatus(ctx context.Context, payment *entity.Payment) (ProviderStatus, error) {
+	return "", ErrNotSupported
+}
+
+func (p stubProvider) Payout(ctx context.Context, payment *entity.Payment, recipient string) (Payout, error) {
+	return Payout{}, ErrNotSupported
+}
+
+func (p stubProvider) Refund(ctx context.Context, payment *entity.Payment, idempotencyKey string) error {
+	return ErrNotSupported
+}
+
+func TestProviderRegistry_Get(t *testing.T) {
+	registry, err := NewProviderRegistry("yoomoney", stubProvider{"yoomoney"}, stubProvider{"fake"})
+	require.NoError(t, err)
+
+	provider, err := registry.Get("")
+	assert.NoError(t, err)
+	assert.Equal(t, "yoomoney", provider.Name())
+
+	provider, err = registry.Get("fake")
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name())
+
+	_, err = registry.Get("stripe")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestNewProviderRegistry_Invalid(t *testing.T) {
+	_, err := NewProviderRegistry("stripe", stubProvider{"yoomoney"})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, err = NewProviderRegistry("yoomoney", stubProvider{"yoomoney"}, stubProvider{"yoomoney"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"paymentgo/internal/repository"
+
+	"go.uber.org/zap"
+
+	dto "paymentgo/internal/entity"
+	db "paymentgo/utils/connector"
+)
+
+// AdminService операторские действия над очередью демона
+type AdminService struct {
+	deadLetters   repository.DeadLetterRepository
+	repo          repository.PaymentRepository
+	paymentsQueue db.Queue
+	logger        *zap.Logger
+}
+
+// NewAdminService создание экземпляра сервиса
+func NewAdminService(deadLetters repository.DeadLetterRepository, repo repository.PaymentRepository, paymentsQueue db.Queue, logger *zap.Logger) *AdminService {
+	return &AdminService{
+		deadLetters:   deadLetters,
+		repo:          repo,
+		paymentsQueue: paymentsQueue,
+		logger:        logger,
+	}
+}
+
+// ListDeadLetters платежи, снятые демоном с обработки
+func (s *AdminService) ListDeadLetters(ctx context.Context, page, limit int) ([]*dto.DeadLetter, error) {
+	s.logger.Info("Listing dead letters", zap.Int("page", page), zap.Int("limit", limit))
+
+	letters, err := s.deadLetters.List(ctx, page, limit)
+	if err != nil {
+		return nil, DomainError(fmt.Errorf("failed to list dead letters: %w", err))
+	}
+	return letters, nil
+}
+
+// RequeueDeadLetter возвращает платёж из dead-letter в очередь демона с обнулённым счётчиком попыток.
+// Dead letter удаляется в одной транзакции с постановкой в очередь: при ошибке платёж остаётся в dead-letter
+func (s *AdminService) RequeueDeadLetter(ctx context.Context, paymentID string) error {
+	s.logger.Info("Requeueing dead letter", zap.String("payment_id", paymentID))
+
+	err := s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		letter, err := s.deadLetters.Remove(ctx, paymentID)
+		if err != nil {
+			return fmt.Errorf("failed to remove dead letter: %w", err)
+		}
+
+		payment := &letter.Payment
+		if fresh, err := s.repo.GetPaymentByID(ctx, paymentID); err == nil {
+			payment = fresh
+		} else {
+			s.logger.Warn("Requeueing dead-lettered snapshot of payment", zap.String("payment_id", paymentID), zap.Error(err))
+		}
+
+		if err := s.paymentsQueue.Enqueue(ctx, *payment); err != nil {
+			return fmt.Errorf("failed to requeue payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return DomainError(err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	convert "paymentgo/internal/cmd/convert"
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/outbox"
+	"paymentgo/internal/usecase"
+)
+
+// Виды доменных ошибок; транспорт переводит их в коды ответа
+var (
+	// ErrNotFound платёж или другой запрошенный объект не существует
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidState операция недопустима в текущем состоянии платежа или не поддерживается провайдером
+	ErrInvalidState = errors.New("invalid state")
+	// ErrConflict платёж одновременно меняет другой запрос, повтор может пройти
+	ErrConflict = errors.New("conflict")
+	// ErrProviderUnavailable платёжный провайдер, источник курсов или поток событий недоступен
+	ErrProviderUnavailable = errors.New("provider unavailable")
+	// ErrValidation запрос некорректен, повтор с теми же данными не пройдёт
+	ErrValidation = errors.New("validation failed")
+)
+
+// Машиночитаемые причины ошибок (ErrorInfo.reason)
+const (
+	ReasonPaymentNotFound     = "PAYMENT_NOT_FOUND"
+	ReasonDeadLetterNotFound  = "DEAD_LETTER_NOT_FOUND"
+	ReasonRateNotFound        = "RATE_NOT_FOUND"
+	ReasonIllegalTransition   = "ILLEGAL_STATUS_TRANSITION"
+	ReasonNotSupported        = "NOT_SUPPORTED_BY_PROVIDER"
+	ReasonProviderRejected    = "PROVIDER_REJECTED"
+	ReasonStatusConflict      = "PAYMENT_STATUS_CONFLICT"
+	ReasonPaymentLocked       = "PAYMENT_LOCKED"
+	ReasonPayoutInProgress    = "PAYOUT_IN_PROGRESS"
+	ReasonProviderUnavailable = "PROVIDER_UNAVAILABLE"
+	ReasonRatesUnavailable    = "RATES_UNAVAILABLE"
+	ReasonEventsUnavailable   = "EVENTS_UNAVAILABLE"
+	ReasonInvalidRequest      = "INVALID_REQUEST"
+	ReasonInvalidAmount       = "INVALID_AMOUNT"
+	ReasonUnknownCurrency     = "UNKNOWN_CURRENCY"
+	ReasonUnknownProvider     = "UNKNOWN_PROVIDER"
+	ReasonFutureDate          = "FUTURE_RATE_DATE"
+)
+
+// FieldViolation нарушение в поле запроса; Field путь к полю, например "amount.currency_code"
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error доменная ошибка: Kind один из видов ErrNotFound, ErrInvalidState..., Reason причина
+// из Reason*, Violations нарушения в полях запроса для ErrValidation
+type Error struct {
+	Kind       error
+	Reason     string
+	Violations []FieldViolation
+	err        error
+}
+
+// NewError доменная ошибка вида kind с причиной reason; err исходная ошибка
+func NewError(kind error, reason string, err error) *Error {
+	return &Error{Kind: kind, Reason: reason, err: err}
+}
+
+// NewValidationError ошибка ErrValidation с нарушениями в полях запроса
+func NewValidationError(reason string, violations ...FieldViolation) *Error {
+	err := &Error{Kind: ErrValidation, Reason: reason, Violations: violations}
+	if len(violations) == 1 {
+		err.err = errors.New(violations[0].Field + ": " + violations[0].Description)
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	if e.err == nil {
+		return e.Kind.Error()
+	}
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.err}
+}
+
+// DomainError определяет вид ошибки по известным ошибкам слоёв ниже; неизвестные ошибки
+// и ошибки контекста возвращаются как есть
+func DomainError(err error) error {
+	if domain, ok := classify(err); ok {
+		return domain
+	}
+	return err
+}
+
+func classify(err error) (*Error, bool) {
+	var domain *Error
+	switch {
+	case err == nil:
+		return nil, false
+	case errors.As(err, &domain):
+		// Сообщение сохраняет контекст, добавленный поверх доменной ошибки
+		return &Error{Kind: domain.Kind, Reason: domain.Reason, Violations: domain.Violations, err: err}, true
+	case errors.Is(err, dto.ErrPaymentNotFound):
+		return NewError(ErrNotFound, ReasonPaymentNotFound, err), true
+	case errors.Is(err, dto.ErrDeadLetterNotFound):
+		return NewError(ErrNotFound, ReasonDeadLetterNotFound, err), true
+	case errors.Is(err, convert.ErrRateNotFound):
+		return NewError(ErrNotFound, ReasonRateNotFound, err), true
+	case errors.Is(err, dto.ErrIllegalTransition):
+		return NewError(ErrInvalidState, ReasonIllegalTransition, err), true
+	case errors.Is(err, usecase.ErrNotSupported):
+		return NewError(ErrInvalidState, ReasonNotSupported, err), true
+	case errors.Is(err, usecase.ErrPayoutRejected):
+		return NewError(ErrInvalidState, ReasonProviderRejected, err), true
+	case errors.Is(err, dto.ErrStatusConflict):
+		return NewError(ErrConflict, ReasonStatusConflict, err), true
+	case errors.Is(err, dto.ErrPaymentLocked):
+		return NewError(ErrConflict, ReasonPaymentLocked, err), true
+	case errors.Is(err, outbox.ErrHubClosed):
+		return NewError(ErrProviderUnavailable, ReasonEventsUnavailable, err), true
+	case errors.Is(err, dto.ErrInvalidAmount):
+		return violation(ReasonInvalidAmount, "amount", err), true
+	case errors.Is(err, dto.ErrUnknownCurrency):
+		return violation(ReasonUnknownCurrency, "currency", err), true
+	case errors.Is(err, usecase.ErrUnknownProvider):
+		return violation(ReasonUnknownProvider, "provider", err), true
+	case errors.Is(err, convert.ErrFutureDate):
+		return violation(ReasonFutureDate, "date", err), true
+	}
+	return nil, false
+}
+
+// Unavailable ошибка вызова внешнего сервиса: известные ошибки классифицируются DomainError,
+// отказ провайдера в операции это ErrInvalidState, остальное недоступность с причиной reason
+func Unavailable(reason string, err error) error {
+	if domain, ok := classify(err); ok {
+		return domain
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var rejection interface{ Rejected() bool }
+	if errors.As(err, &rejection) && rejection.Rejected() {
+		return NewError(ErrInvalidState, ReasonProviderRejected, err)
+	}
+	return NewError(ErrProviderUnavailable, reason, err)
+}
+
+func violation(reason, field string, err error) *Error {
+	return &Error{Kind: ErrValidation, Reason: reason, Violations: []FieldViolation{{Field: field, Description: err.Error()}}, err: err}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paymentgo/internal/repository"
+	"slices"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	yoomoney "paymentgo/internal/cmd/yoomoney"
+	dto "paymentgo/internal/entity"
+	db "paymentgo/utils/connector"
+)
+
+var (
+	// ErrNotificationMismatch сумма или валюта уведомления не совпадает с платежом
+	ErrNotificationMismatch = errors.New("notification does not match payment")
+	// ErrDuplicateNotification уведомление с этим operation_id уже обработано
+	ErrDuplicateNotification = errors.New("notification already processed")
+)
+
+// NotificationService обработка уведомлений ЮMoney о входящих переводах
+type NotificationService struct {
+	payments      *PaymentService
+	repo          repository.PaymentRepository
+	notifications repository.NotificationRepository
+	paymentsQueue db.Queue
+	logger        *zap.Logger
+}
+
+// NewNotificationService создание экземпляра сервиса
+func NewNotificationService(payments *PaymentService, repo repository.PaymentRepository, notifications repository.NotificationRepository, paymentsQueue db.Queue, logger *zap.Logger) *NotificationService {
+	return &NotificationService{
+		payments:      payments,
+		repo:          repo,
+		notifications: notifications,
+		paymentsQueue: paymentsQueue,
+		logger:        logger,
+	}
+}
+
+// HandleNotification сверяет уведомление с платежом из label и переводит платёж в SUCCESS.
+// Подпись проверяется до вызова. Повтор того же operation_id возвращает ErrDuplicateNotification.
+// Отметка операции, смена статуса и постановка в очередь фиксируются одной транзакцией: при ошибке
+// или падении пода не остаётся отметки без подтверждённого платежа, и ЮMoney пришлёт уведомление снова
+func (s *NotificationService) HandleNotification(ctx context.Context, notification *yoomoney.Notification) error {
+	if _, err := uuid.Parse(notification.Label); err != nil {
+		return fmt.Errorf("label %q: %w", notification.Label, dto.ErrPaymentNotFound)
+	}
+
+	payment, err := s.repo.GetPaymentByID(ctx, notification.Label)
+	if err != nil {
+		return fmt.Errorf("error fetching payment: %w", err)
+	}
+
+	// Перевод ещё не зачислен: отметку не ставим, подтверждение придёт позже (или его найдёт опрос демона)
+	if notification.Unaccepted {
+		s.logger.Info("Notification for unaccepted transfer, waiting for acceptance",
+			zap.String("payment_id", payment.ID),
+			zap.String("operation_id", notification.OperationID))
+		return nil
+	}
+
+	var confirmed bool
+	var mismatch error
+	err = s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		reserved, err := s.notifications.Reserve(ctx, notification.OperationID, payment.ID)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			return fmt.Errorf("operation %s: %w", notification.OperationID, ErrDuplicateNotification)
+		}
+
+		confirmed, err = s.applyNotification(ctx, payment, notification)
+		// Несовпадение суммы при повторе не исправится: отметка такого уведомления фиксируется
+		if errors.Is(err, ErrNotificationMismatch) {
+			mismatch = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if mismatch != nil {
+		return mismatch
+	}
+
+	if confirmed {
+		s.logger.Info("Payment confirmed by notification",
+			zap.String("payment_id", payment.ID),
+			zap.String("operation_id", notification.OperationID))
+	}
+	return nil
+}
+
+// applyNotification переводит платёж в SUCCESS в транзакции из ctx; false, если платёж уже подтверждён
+func (s *NotificationService) applyNotification(ctx context.Context, payment *dto.Payment, notification *yoomoney.Notification) (bool, error) {
+	// Уведомления ЮMoney подтверждают только платежи, выставленные через ЮMoney
+	if payment.Provider != yoomoney.ProviderName {
+		return false, fmt.Errorf("%w: payment is served by %s", ErrNotificationMismatch, payment.Provider)
+	}
+
+	expected, err := s.payments.ChargeAmounts(ctx, payment)
+	if err != nil {
+		return false, err
+	}
+
+	// Ссылка на оплату выставляет сумму списания (sum), зачисленная сумма меньше на комиссию
+	if !slices.Contains(expected, notification.WithdrawAmount) {
+		s.logger.Warn("Notification amount mismatch",
+			zap.String("payment_id", payment.ID),
+			zap.String("operation_id", notification.OperationID),
+			zap.Stringers("expected", expected),
+			zap.Stringer("received", notification.WithdrawAmount))
+		return false, fmt.Errorf("%w: expected one of %v %s, received %s %s", ErrNotificationMismatch,
+			expected, expected[0].Currency, notification.WithdrawAmount, notification.WithdrawAmount.Currency)
+	}
+
+	// FAILED -> PENDING -> SUCCESS в одной транзакции: промежуточный PENDING не фиксируется отдельно
+	reason := fmt.Sprintf("yoomoney notification %s", notification.OperationID)
+	switch payment.Status {
+	case dto.StatusFailed:
+		if err := s.repo.UpdatePaymentStatus(ctx, payment.ID, dto.StatusFailed, dto.StatusPending, reason); err != nil {
+			return false, fmt.Errorf("error changing payment status to pending: %w", err)
+		}
+		fallthrough
+	case dto.StatusPending:
+		if err := s.repo.UpdatePaymentStatus(ctx, payment.ID, dto.StatusPending, dto.StatusSuccess, reason); err != nil {
+			return false, fmt.Errorf("error changing payment status to success: %w", err)
+		}
+		payment.Status = dto.StatusSuccess
+	default:
+		s.logger.Info("Payment already confirmed", zap.String("payment_id", payment.ID), zap.String("status", string(payment.Status)))
+		return false, nil
+	}
+
+	// Демон переведёт деньги получателю, не дожидаясь очередного опроса. PostgresQueue пишет задачу
+	// в той же транзакции, поэтому ошибка постановки откатывает подтверждение до повтора уведомления
+	if err := s.paymentsQueue.Enqueue(ctx, *payment); err != nil {
+		return false, fmt.Errorf("error enqueueing confirmed payment: %w", err)
+	}
+	return true, nil
+}
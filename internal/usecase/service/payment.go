@@ -4,12 +4,13 @@ import (
 	"context"
 	"fmt"
 	"paymentgo/internal/repository"
+	"time"
 
 	"go.uber.org/zap"
 
 	convert "paymentgo/internal/cmd/convert"
-	yoomoney "paymentgo/internal/cmd/yoomoney"
 	dto "paymentgo/internal/entity"
+	"paymentgo/internal/usecase"
 	db "paymentgo/utils/connector"
 )
 
@@ -18,17 +19,17 @@ type PaymentService struct {
 	repo          repository.PaymentRepository
 	logger        *zap.Logger
 	converter     *convert.ForexClient
-	paymentClient *yoomoney.YooMoneyClient
-	paymentsQueue *db.LockFreeQueue
+	providers     *usecase.ProviderRegistry
+	paymentsQueue db.Queue
 }
 
 // NewPaymentService создание экземпляра сервиса
-func NewPaymentService(repo repository.PaymentRepository, logger *zap.Logger, converter *convert.ForexClient, paymentClient *yoomoney.YooMoneyClient, paymentsQueue *db.LockFreeQueue) *PaymentService {
+func NewPaymentService(repo repository.PaymentRepository, logger *zap.Logger, converter *convert.ForexClient, providers *usecase.ProviderRegistry, paymentsQueue db.Queue) *PaymentService {
 	return &PaymentService{
 		repo:          repo,
 		logger:        logger,
 		converter:     converter,
-		paymentClient: paymentClient,
+		providers:     providers,
 		paymentsQueue: paymentsQueue,
 	}
 }
@@ -37,114 +38,291 @@ func NewPaymentService(repo repository.PaymentRepository, logger *zap.Logger, co
 func (s *PaymentService) GetPaymentLink(ctx context.Context, paymentID string) (string, error) {
 	s.logger.Info("Getting payment link", zap.String("payment_id", paymentID))
 
-	amount, currency, err := s.repo.GetPaymentDetails(ctx, paymentID)
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get payment details: %w", err)
+		s.logger.Error("Failed to fetch payment by ID", zap.String("payment_id", paymentID), zap.Error(err))
+		return "", DomainError(fmt.Errorf("error fetching payment: %w", err))
 	}
 
-	convertedAmount, err := s.converter.ConvertToRub(amount, currency)
+	provider, err := s.providers.Get(payment.Provider)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert amount: %w", err)
+		return "", DomainError(err)
+	}
+	if !provider.Capabilities().PaymentLinks {
+		return "", DomainError(fmt.Errorf("payment links via %s: %w", provider.Name(), usecase.ErrNotSupported))
 	}
 
-	err = s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending)
+	convertedAmount, err := s.lockChargeAmount(ctx, payment, provider.Capabilities().Currency)
 	if err != nil {
-		return "", fmt.Errorf("error changing payment status to pending: %w", err)
+		return "", DomainError(err)
 	}
 
-	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
-	if err != nil {
-		s.logger.Error("Failed to fetch payment by ID", zap.String("payment_id", paymentID), zap.Error(err))
-		return "", fmt.Errorf("error fetching payment: %w", err)
+	if payment.Status != dto.StatusPending {
+		err = s.repo.UpdatePaymentStatus(ctx, paymentID, payment.Status, dto.StatusPending, "payment link reissued")
+		if err != nil {
+			return "", DomainError(fmt.Errorf("error changing payment status to pending: %w", err))
+		}
+		payment.Status = dto.StatusPending
 	}
 
-	link, err := s.paymentClient.QuickPayment(dto.CoreAccount, paymentID, "AC", convertedAmount, paymentID, paymentID, paymentID, "")
+	link, err := provider.CreatePaymentLink(ctx, payment, convertedAmount)
 	if err != nil {
 		s.logger.Error("Failed to create payment link", zap.String("payment_id", paymentID), zap.Error(err))
-		return "", fmt.Errorf("error creating payment link: %w", err)
+		return "", Unavailable(ReasonProviderUnavailable, fmt.Errorf("error creating payment link: %w", err))
 	}
 
-	s.paymentsQueue.Enqueue(*payment)
+	if err := s.paymentsQueue.Enqueue(ctx, *payment); err != nil {
+		return "", DomainError(fmt.Errorf("error enqueueing payment: %w", err))
+	}
 
 	return link, nil
 }
 
+// lockChargeAmount сумма ссылки на оплату в валюте провайдера по действующей котировке платежа.
+// Без котировки или по истечении она запрашивается заново и фиксируется за платежом
+func (s *PaymentService) lockChargeAmount(ctx context.Context, payment *dto.Payment, currency string) (dto.Money, error) {
+	if currency == "" || payment.Amount.Currency == currency {
+		return payment.Amount, nil
+	}
+	if quote := payment.Quote; quote != nil && quote.Amount.Currency == currency && !quote.Expired(time.Now()) {
+		return quote.Amount, nil
+	}
+
+	quote, err := s.converter.Quote(ctx, payment.Amount, currency)
+	if err != nil {
+		return dto.Money{}, Unavailable(ReasonRatesUnavailable, fmt.Errorf("failed to quote amount: %w", err))
+	}
+	locked, err := s.repo.SaveQuote(ctx, payment.ID, quote)
+	if err != nil {
+		return dto.Money{}, fmt.Errorf("error saving quote: %w", err)
+	}
+
+	s.logger.Info("Payment amount quoted",
+		zap.String("payment_id", payment.ID),
+		zap.Stringer("amount", locked.Amount),
+		zap.String("currency", locked.Amount.Currency),
+		zap.String("rate", locked.Rate),
+		zap.String("source", locked.Source),
+		zap.Time("expires_at", locked.ExpiresAt))
+	payment.Quote = locked
+	return locked.Amount, nil
+}
+
+// ChargeAmounts суммы, которые принимаются в оплату в валюте провайдера платежа: по каждой котировке,
+// с которой выдавалась ссылка, даже истёкшей (старую ссылку могли оплатить после выдачи новой),
+// а для платежей без котировок по текущему курсу
+func (s *PaymentService) ChargeAmounts(ctx context.Context, payment *dto.Payment) ([]dto.Money, error) {
+	provider, err := s.providers.Get(payment.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := provider.Capabilities().Currency
+	if currency == "" || payment.Amount.Currency == currency {
+		return []dto.Money{payment.Amount}, nil
+	}
+
+	quotes, err := s.repo.GetQuotes(ctx, payment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment quotes: %w", err)
+	}
+	var amounts []dto.Money
+	for _, quote := range quotes {
+		if quote.Amount.Currency == currency {
+			amounts = append(amounts, quote.Amount)
+		}
+	}
+	if len(amounts) > 0 {
+		return amounts, nil
+	}
+	if payment.Quote != nil && payment.Quote.Amount.Currency == currency {
+		return []dto.Money{payment.Quote.Amount}, nil
+	}
+
+	converted, err := s.converter.ConvertCurrency(ctx, payment.Amount, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert amount: %w", err)
+	}
+	return []dto.Money{converted}, nil
+}
+
+// GetPayment сверяет платёж с провайдером и возвращает статус оплаты:
+// "success", "pending", "failed" или "complete"/"refunded" для завершённых платежей
 func (s *PaymentService) GetPayment(ctx context.Context, paymentID string) (string, error) {
 	s.logger.Info("Getting payment", zap.String("payment_id", paymentID))
 
-	status, err := s.paymentClient.CheckPaymentStatus(paymentID)
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return "error", DomainError(fmt.Errorf("error fetching payment: %w", err))
+	}
+
+	switch payment.Status {
+	case dto.StatusComplete:
+		return "complete", nil
+	case dto.StatusRefunded:
+		return "refunded", nil
+	}
+
+	provider, err := s.providers.Get(payment.Provider)
+	if err != nil {
+		return "error", DomainError(err)
+	}
+	if !provider.Capabilities().StatusLookup {
+		return "error", DomainError(fmt.Errorf("status lookup via %s: %w", provider.Name(), usecase.ErrNotSupported))
+	}
+
+	status, err := provider.PaymentStatus(ctx, payment)
 	if err != nil {
 		s.logger.Error("Failed to check payment status", zap.String("payment_id", paymentID), zap.Error(err))
-		return "error", fmt.Errorf("error getting payment status: %w", err)
+		return "error", Unavailable(ReasonProviderUnavailable, fmt.Errorf("error getting payment status: %w", err))
 	}
 
 	switch status {
-	case "success":
-		payment, err := s.repo.GetPaymentByID(ctx, paymentID)
-		if err != nil {
-			return "error", fmt.Errorf("error fetching payment: %w", err)
-		}
-		if payment.Status != "COMPLETE" {
-			err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusSuccess)
+	case usecase.ProviderStatusSucceeded:
+		switch payment.Status {
+		case dto.StatusFailed:
+			// FAILED -> PENDING -> SUCCESS в одной транзакции, как при подтверждении уведомлением:
+			// промежуточный PENDING не фиксируется отдельно
+			err := s.repo.WithinTx(ctx, func(ctx context.Context) error {
+				if err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusFailed, dto.StatusPending, "payment confirmed by provider"); err != nil {
+					return fmt.Errorf("error changing payment status to pending: %w", err)
+				}
+				if err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending, dto.StatusSuccess, "payment confirmed by provider"); err != nil {
+					return fmt.Errorf("error changing payment status to success: %w", err)
+				}
+				return nil
+			})
 			if err != nil {
-				return "error", fmt.Errorf("error changing payment status to success: %w", err)
+				return "error", DomainError(err)
+			}
+		case dto.StatusPending:
+			err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending, dto.StatusSuccess, "payment confirmed by provider")
+			if err != nil {
+				return "error", DomainError(fmt.Errorf("error changing payment status to success: %w", err))
 			}
-		} else {
-			return "complete", nil
-		}
-	case "pending":
-		err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending)
-		if err != nil {
-			return "pending", nil
 		}
-	case "failed":
-		err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusFailed)
-		if err != nil {
-			return "error", fmt.Errorf("error changing payment status to failed: %w", err)
+	case usecase.ProviderStatusFailed:
+		switch payment.Status {
+		case dto.StatusPending:
+			err := s.repo.UpdatePaymentStatus(ctx, paymentID, dto.StatusPending, dto.StatusFailed, "payment refused by provider")
+			if err != nil {
+				return "error", DomainError(fmt.Errorf("error changing payment status to failed: %w", err))
+			}
+		case dto.StatusSuccess:
+			// Подтверждённый платёж не откатывается: таблица переходов запрещает SUCCESS -> FAILED,
+			// поэтому расхождение с провайдером только логируется, а вызывающий получает сохранённый статус
+			s.logger.Warn("Provider reports failure for a confirmed payment",
+				zap.String("payment_id", paymentID),
+				zap.String("status", string(payment.Status)))
+			status = usecase.ProviderStatusSucceeded
 		}
 	}
 
-	s.logger.Info("GetPayment: ", zap.String("payment_status", status))
-	return status, nil
+	s.logger.Info("GetPayment: ", zap.String("payment_status", string(status)))
+	return string(status), nil
 }
 
-func (s *PaymentService) CreatePayment(ctx context.Context, fromUserID, toUserID string, amount float64, currency string) (string, error) {
-	s.logger.Info("Creating payment", zap.String("user_id", fromUserID), zap.Float64("amount", amount), zap.String("currency", currency))
+// CreatePayment создаёт платёж через провайдера providerName (пустое имя провайдер по умолчанию)
+func (s *PaymentService) CreatePayment(ctx context.Context, fromUserID, toUserID string, amount dto.Money, providerName string) (string, error) {
+	s.logger.Info("Creating payment", zap.String("user_id", fromUserID), zap.Stringer("amount", amount), zap.String("currency", amount.Currency))
+
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return "", DomainError(err)
+	}
 
-	paymentID, err := s.repo.CreatePayment(ctx, fromUserID, toUserID, currency, amount)
+	paymentID, err := s.repo.CreatePayment(ctx, fromUserID, toUserID, amount, provider.Name())
 	if err != nil {
 		s.logger.Error("Failed to create payment", zap.Error(err))
-		return "", err
+		return "", DomainError(err)
 	}
 
 	s.logger.Info("Payment created successfully", zap.String("payment_id", paymentID))
 	return paymentID, nil
 }
 
+// refundLockTTL аренда платежа на время возврата; продлевается, пока возврат не завершён
+const refundLockTTL = time.Minute
+
+// RefundPayment возвращает оплату плательщику. Возврат берёт ту же аренду платежа, что и демон,
+// поэтому не идёт одновременно с выплатой получателю
 func (s *PaymentService) RefundPayment(ctx context.Context, paymentID string) error {
 	s.logger.Info("Refunding payment", zap.String("payment_id", paymentID))
 
+	lockedCtx, unlock, err := s.repo.LockPayment(ctx, paymentID, refundLockTTL)
+	if err != nil {
+		s.logger.Warn("Failed to lock payment for refund", zap.String("payment_id", paymentID), zap.Error(err))
+		return DomainError(fmt.Errorf("error locking payment: %w", err))
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			s.logger.Error("Failed to release payment lease", zap.String("payment_id", paymentID), zap.Error(err))
+		}
+	}()
+	ctx = lockedCtx
+
+	// Под арендой платёж читается из БД, а не из кеша
 	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
 	if err != nil {
 		s.logger.Error("Failed to get payment by ID", zap.String("payment_id", paymentID), zap.Error(err))
-		return fmt.Errorf("error fetching payment by ID: %w", err)
+		return DomainError(fmt.Errorf("error fetching payment by ID: %w", err))
+	}
+
+	// Таблица переходов разрешает возврат только оплаченных платежей (SUCCESS, COMPLETE)
+	if err := dto.ValidateTransition(paymentID, payment.Status, dto.StatusRefunded); err != nil {
+		return DomainError(fmt.Errorf("error updating payment status: %w", err))
 	}
 
-	if payment.Status != "COMPLETE" {
-		err = s.repo.UpdatePaymentStatus(ctx, paymentID, "REFUNDED")
+	// Перевод получателю уже зарегистрирован у провайдера и может быть проведён в любой момент:
+	// возврат дождётся COMPLETE и пройдёт встречным платежом
+	if payment.Status == dto.StatusSuccess && payment.PayoutRequestID != "" {
+		return NewError(ErrInvalidState, ReasonPayoutInProgress, fmt.Errorf("payment %s has a payout in progress", paymentID))
+	}
+
+	provider, err := s.providers.Get(payment.Provider)
+	if err != nil {
+		return DomainError(err)
+	}
+
+	// Провайдер с возвратами возвращает деньги сам, иначе создаётся встречный платёж получателя плательщику.
+	// Провайдер вызывается под арендой платежа, ключ идемпотентности возврата это ID платежа
+	if provider.Capabilities().Refunds {
+		if err := provider.Refund(ctx, payment, paymentID); err != nil {
+			s.logger.Error("Provider refund failed", zap.String("payment_id", paymentID), zap.Error(err))
+			return Unavailable(ReasonProviderUnavailable, fmt.Errorf("error refunding payment via %s: %w", provider.Name(), err))
+		}
+
+		// Деньги уже возвращены, поэтому статус фиксируется даже при отмене запроса.
+		// Повтор безопасен: провайдер не проведёт второй возврат по тому же ключу
+		err = s.repo.UpdatePaymentStatus(context.WithoutCancel(ctx), paymentID, payment.Status, dto.StatusRefunded, "refunded by provider")
 		if err != nil {
+			s.logger.Error("Refund sent but payment was not marked as refunded", zap.String("payment_id", paymentID), zap.Error(err))
+			return DomainError(fmt.Errorf("error updating payment status: %w", err))
+		}
+		s.logger.Info("Payment refunded by provider", zap.String("payment_id", paymentID))
+		return nil
+	}
+
+	// Статус REFUNDED и встречный платёж пишутся в одной транзакции: возврат без встречного платежа невозможен
+	var newPaymentID string
+	err = s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdatePaymentStatus(ctx, paymentID, payment.Status, dto.StatusRefunded, "refund requested"); err != nil {
 			return fmt.Errorf("error updating payment status: %w", err)
 		}
-		newPaymentID, err := s.repo.CreatePayment(ctx, payment.ToUserID, payment.FromUserID, payment.Currency, payment.Amount)
+		var err error
+		newPaymentID, err = s.repo.CreatePayment(ctx, payment.ToUserID, payment.FromUserID, payment.Amount, payment.Provider)
 		if err != nil {
-			s.logger.Error("Failed to create new payment", zap.String("payment_id", newPaymentID), zap.Error(err))
+			s.logger.Error("Failed to create reverse payment", zap.String("payment_id", paymentID), zap.Error(err))
 			return fmt.Errorf("error creating payment: %w", err)
 		}
-
-		s.logger.Info("Payment refund process initiated successfully", zap.String("new_payment_id", newPaymentID))
 		return nil
+	})
+	if err != nil {
+		return DomainError(err)
 	}
-	return fmt.Errorf("payment has not been paid")
+
+	s.logger.Info("Payment refund process initiated successfully", zap.String("new_payment_id", newPaymentID))
+	return nil
 }
 
 func (s *PaymentService) GetPaymentByID(ctx context.Context, paymentID string) (*dto.Payment, error) {
@@ -153,7 +331,7 @@ func (s *PaymentService) GetPaymentByID(ctx context.Context, paymentID string) (
 	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
 	if err != nil {
 		s.logger.Error("Failed to get payment", zap.String("payment_id", paymentID), zap.Error(err))
-		return nil, err
+		return nil, DomainError(err)
 	}
 
 	s.logger.Info("Payment retrieved", zap.String("payment_id", paymentID))
@@ -166,20 +344,26 @@ func (s *PaymentService) GetPaymentHistory(ctx context.Context, userID string, p
 	payments, err := s.repo.GetPaymentHistory(ctx, userID, page, limit)
 	if err != nil {
 		s.logger.Error("Failed to get payment history", zap.String("user_id", userID), zap.Error(err))
-		return nil, err
+		return nil, DomainError(err)
 	}
 
 	s.logger.Info("Payment history retrieved", zap.String("user_id", userID))
 	return payments, nil
 }
 
+// UpdatePaymentStatus переводит платёж из текущего статуса в status по таблице переходов
 func (s *PaymentService) UpdatePaymentStatus(ctx context.Context, paymentID string, status dto.PaymentStatus) error {
 	s.logger.Info("Updating payment status", zap.String("payment_id", paymentID), zap.String("status", string(status)))
 
-	err := s.repo.UpdatePaymentStatus(ctx, paymentID, status)
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return DomainError(fmt.Errorf("error fetching payment: %w", err))
+	}
+
+	err = s.repo.UpdatePaymentStatus(ctx, paymentID, payment.Status, status, "status update requested")
 	if err != nil {
 		s.logger.Error("Failed to update payment status", zap.String("payment_id", paymentID), zap.String("status", string(status)), zap.Error(err))
-		return err
+		return DomainError(err)
 	}
 
 	s.logger.Info("Payment status updated successfully", zap.String("payment_id", paymentID), zap.String("status", string(status)))
@@ -192,7 +376,7 @@ func (s *PaymentService) GetActivePayments(ctx context.Context, userID string) (
 
 	activePayments, err := s.repo.GetActivePayments(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get active payments: %w", err)
+		return nil, DomainError(fmt.Errorf("failed to get active payments: %w", err))
 	}
 
 	return activePayments, nil
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/repository"
+	"paymentgo/internal/usecase"
+	db "paymentgo/utils/connector"
+)
+
+const testProviderName = "fake"
+
+type memoryPaymentRepo struct {
+	repository.PaymentRepository
+	mu       sync.Mutex
+	payments map[string]*dto.Payment
+	// leased платежи под арендой LockPayment
+	leased map[string]bool
+	// failTo сколько следующих переходов в статус завершатся ошибкой
+	failTo map[dto.PaymentStatus]int
+	// failCreate CreatePayment завершается ошибкой
+	failCreate bool
+}
+
+func newMemoryPaymentRepo() *memoryPaymentRepo {
+	return &memoryPaymentRepo{
+		payments: make(map[string]*dto.Payment),
+		leased:   make(map[string]bool),
+		failTo:   make(map[dto.PaymentStatus]int),
+	}
+}
+
+// WithinTx при ошибке fn возвращает платежи к состоянию до вызова
+func (m *memoryPaymentRepo) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	payments := make(map[string]dto.Payment, len(m.payments))
+	for id, payment := range m.payments {
+		payments[id] = *payment
+	}
+	m.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		m.mu.Lock()
+		for id := range m.payments {
+			if _, ok := payments[id]; !ok {
+				delete(m.payments, id)
+			}
+		}
+		for id, payment := range payments {
+			*m.payments[id] = payment
+		}
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *memoryPaymentRepo) CreatePayment(ctx context.Context, fromID, toID string, amount dto.Money, provider string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failCreate {
+		return "", errors.New("database is down")
+	}
+	id := uuid.NewString()
+	m.payments[id] = &dto.Payment{ID: id, FromUserID: fromID, ToUserID: toID, Amount: amount, Status: dto.StatusPending, Provider: provider}
+	return id, nil
+}
+
+func (m *memoryPaymentRepo) GetPaymentByID(ctx context.Context, paymentID string) (*dto.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.payments[paymentID]
+	if !ok {
+		return nil, dto.ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+func (m *memoryPaymentRepo) UpdatePaymentStatus(ctx context.Context, paymentID string, from, to dto.PaymentStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failTo[to] > 0 {
+		m.failTo[to]--
+		return errors.New("database is down")
+	}
+	if err := dto.ValidateTransition(paymentID, from, to); err != nil {
+		return err
+	}
+	payment := m.payments[paymentID]
+	if payment.Status != from {
+		return &dto.TransitionError{PaymentID: paymentID, From: from, To: to, Actual: payment.Status, Err: dto.ErrStatusConflict}
+	}
+	payment.Status = to
+	return nil
+}
+
+func (m *memoryPaymentRepo) LockPayment(ctx context.Context, paymentID string, ttl time.Duration) (context.Context, func() error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.payments[paymentID]; !ok {
+		return nil, nil, dto.ErrPaymentNotFound
+	}
+	if m.leased[paymentID] {
+		return nil, nil, dto.ErrPaymentLocked
+	}
+	m.leased[paymentID] = true
+	return ctx, func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.leased, paymentID)
+		return nil
+	}, nil
+}
+
+func (m *memoryPaymentRepo) add(status dto.PaymentStatus) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := uuid.NewString()
+	m.payments[id] = &dto.Payment{ID: id, FromUserID: "payer", ToUserID: "payee", Amount: dto.Money{Minor: 150000, Currency: "RUB"}, Status: status, Provider: testProviderName}
+	return id
+}
+
+func (m *memoryPaymentRepo) status(paymentID string) dto.PaymentStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.payments[paymentID].Status
+}
+
+func (m *memoryPaymentRepo) isLeased(paymentID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leased[paymentID]
+}
+
+// fakeProvider провайдер с возвратами; записывает ключи возвратов и была ли аренда во время вызова
+type fakeProvider struct {
+	repo      *memoryPaymentRepo
+	refunds   bool
+	refundErr error
+	status    usecase.ProviderStatus
+
+	mu         sync.Mutex
+	refundKeys []string
+	leased     []bool
+}
+
+func (p *fakeProvider) Name() string { return testProviderName }
+
+func (p *fakeProvider) Capabilities() usecase.ProviderCapabilities {
+	return usecase.ProviderCapabilities{StatusLookup: true, Refunds: p.refunds, Currency: "RUB"}
+}
+
+func (p *fakeProvider) CreatePaymentLink(ctx context.Context, payment *dto.Payment, amount dto.Money) (string, error) {
+	return "", usecase.ErrNotSupported
+}
+
+func (p *fakeProvider) PaymentStatus(ctx context.Context, payment *dto.Payment) (usecase.ProviderStatus, error) {
+	return p.status, nil
+}
+
+func (p *fakeProvider) Payout(ctx context.Context, payment *dto.Payment, recipient string) (usecase.Payout, error) {
+	return usecase.Payout{}, usecase.ErrNotSupported
+}
+
+func (p *fakeProvider) Refund(ctx context.Context, payment *dto.Payment, idempotencyKey string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refundKeys = append(p.refundKeys, idempotencyKey)
+	p.leased = append(p.leased, p.repo.isLeased(payment.ID))
+	return p.refundErr
+}
+
+func newPaymentFixture(t *testing.T, refunds bool) (*PaymentService, *memoryPaymentRepo, *fakeProvider) {
+	t.Helper()
+	repo := newMemoryPaymentRepo()
+	provider := &fakeProvider{repo: repo, refunds: refunds}
+	providers, err := usecase.NewProviderRegistry(testProviderName, provider)
+	require.NoError(t, err)
+	return NewPaymentService(repo, zaptest.NewLogger(t), nil, providers, db.NewPaymentsQueue()), repo, provider
+}
+
+func TestRefundPayment_ProviderRefundUnderLease(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, true)
+	paymentID := repo.add(dto.StatusSuccess)
+
+	require.NoError(t, payments.RefundPayment(context.Background(), paymentID))
+	assert.Equal(t, dto.StatusRefunded, repo.status(paymentID))
+	assert.Equal(t, []string{paymentID}, provider.refundKeys)
+	assert.Equal(t, []bool{true}, provider.leased)
+	assert.False(t, repo.isLeased(paymentID))
+
+	// Повторный возврат не доходит до провайдера
+	err := payments.RefundPayment(context.Background(), paymentID)
+	assert.ErrorIs(t, err, ErrInvalidState)
+	assert.Len(t, provider.refundKeys, 1)
+}
+
+func TestRefundPayment_ProviderFailureKeepsPayment(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, true)
+	provider.refundErr = errors.New("provider is down")
+	paymentID := repo.add(dto.StatusSuccess)
+
+	err := payments.RefundPayment(context.Background(), paymentID)
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Equal(t, dto.StatusSuccess, repo.status(paymentID))
+	assert.False(t, repo.isLeased(paymentID))
+}
+
+func TestRefundPayment_RetryAfterStatusFailureReusesKey(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, true)
+	paymentID := repo.add(dto.StatusSuccess)
+	repo.failTo[dto.StatusRefunded] = 1
+
+	require.Error(t, payments.RefundPayment(context.Background(), paymentID))
+	assert.Equal(t, dto.StatusSuccess, repo.status(paymentID))
+
+	require.NoError(t, payments.RefundPayment(context.Background(), paymentID))
+	assert.Equal(t, dto.StatusRefunded, repo.status(paymentID))
+	assert.Equal(t, []string{paymentID, paymentID}, provider.refundKeys)
+}
+
+func TestRefundPayment_LockedPaymentIsConflict(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, true)
+	paymentID := repo.add(dto.StatusSuccess)
+	_, unlock, err := repo.LockPayment(context.Background(), paymentID, time.Minute)
+	require.NoError(t, err)
+	defer unlock()
+
+	err = payments.RefundPayment(context.Background(), paymentID)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Empty(t, provider.refundKeys)
+	assert.Equal(t, dto.StatusSuccess, repo.status(paymentID))
+}
+
+func TestGetPayment_SuccessRevivesFailedPaymentInOneTx(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, false)
+	provider.status = usecase.ProviderStatusSucceeded
+	paymentID := repo.add(dto.StatusFailed)
+
+	// Запись SUCCESS не прошла: промежуточный PENDING откатывается вместе с ней
+	repo.failTo[dto.StatusSuccess] = 1
+	_, err := payments.GetPayment(context.Background(), paymentID)
+	require.Error(t, err)
+	assert.Equal(t, dto.StatusFailed, repo.status(paymentID))
+
+	status, err := payments.GetPayment(context.Background(), paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, "success", status)
+	assert.Equal(t, dto.StatusSuccess, repo.status(paymentID))
+}
+
+func TestGetPayment_FailureDoesNotDowngradeConfirmedPayment(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, false)
+	provider.status = usecase.ProviderStatusFailed
+	paymentID := repo.add(dto.StatusSuccess)
+
+	status, err := payments.GetPayment(context.Background(), paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, "success", status)
+	assert.Equal(t, dto.StatusSuccess, repo.status(paymentID))
+}
+
+func TestGetPayment_FailureMarksPendingPaymentFailed(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, false)
+	provider.status = usecase.ProviderStatusFailed
+	paymentID := repo.add(dto.StatusPending)
+
+	status, err := payments.GetPayment(context.Background(), paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", status)
+	assert.Equal(t, dto.StatusFailed, repo.status(paymentID))
+}
+
+func TestRefundPayment_ReversePaymentIsCreatedWithStatus(t *testing.T) {
+	payments, repo, provider := newPaymentFixture(t, false)
+	paymentID := repo.add(dto.StatusComplete)
+
+	// Встречный платёж не создан: REFUNDED откатывается вместе с ним
+	repo.failCreate = true
+	require.Error(t, payments.RefundPayment(context.Background(), paymentID))
+	assert.Equal(t, dto.StatusComplete, repo.status(paymentID))
+	assert.Len(t, repo.payments, 1)
+	assert.False(t, repo.isLeased(paymentID))
+
+	repo.failCreate = false
+	require.NoError(t, payments.RefundPayment(context.Background(), paymentID))
+	assert.Equal(t, dto.StatusRefunded, repo.status(paymentID))
+	require.Len(t, repo.payments, 2)
+	for id, payment := range repo.payments {
+		if id != paymentID {
+			assert.Equal(t, "payee", payment.FromUserID)
+			assert.Equal(t, "payer", payment.ToUserID)
+			assert.Equal(t, dto.StatusPending, payment.Status)
+		}
+	}
+	assert.Empty(t, provider.refundKeys)
+}
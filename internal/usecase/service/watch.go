@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"paymentgo/internal/repository"
+
+	"go.uber.org/zap"
+
+	dto "paymentgo/internal/entity"
+	"paymentgo/internal/outbox"
+)
+
+// WatchService подписка на смену статуса платежа: события outbox payment_events
+// приходят через Hub, пропущенные дочитываются из базы
+type WatchService struct {
+	repo   repository.PaymentRepository
+	events repository.PaymentEventRepository
+	hub    *outbox.Hub
+	logger *zap.Logger
+}
+
+// NewWatchService создание экземпляра сервиса
+func NewWatchService(repo repository.PaymentRepository, events repository.PaymentEventRepository, hub *outbox.Hub, logger *zap.Logger) *WatchService {
+	return &WatchService{
+		repo:   repo,
+		events: events,
+		hub:    hub,
+		logger: logger,
+	}
+}
+
+// WatchPayment передаёт в send события платежа с id больше afterEventID, а при afterEventID == 0
+// текущее состояние (snapshot), затем каждую смену статуса. Каждое событие передаётся один раз
+// в порядке id; подписка завершается после конечного статуса, отмены ctx или ошибки send
+func (s *WatchService) WatchPayment(ctx context.Context, paymentID string, afterEventID int64, send func(event *dto.PaymentEvent, snapshot bool) error) error {
+	s.logger.Info("Watching payment", zap.String("payment_id", paymentID), zap.Int64("after_event_id", afterEventID))
+
+	// Подписка до чтения базы: событие, записанное между чтением и подпиской, не потеряется
+	sub, err := s.hub.Subscribe(paymentID)
+	if err != nil {
+		return DomainError(err)
+	}
+	defer sub.Close()
+
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return DomainError(fmt.Errorf("error fetching payment: %w", err))
+	}
+
+	w := &paymentWatch{service: s, paymentID: paymentID, last: afterEventID, send: send}
+	if afterEventID == 0 {
+		err = w.snapshot(ctx, payment)
+	} else {
+		err = w.catchUp(ctx)
+		// События платежа пишутся вместе со статусом: после дочитывания платёж в конечном статусе
+		// уже передан полностью, даже если afterEventID указывал на конечное событие или дальше
+		w.final = w.final || dto.IsFinal(payment.Status)
+	}
+	if err != nil || w.final {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return DomainError(fmt.Errorf("watching payment %s: %w", paymentID, outbox.ErrHubClosed))
+			}
+			if err := w.deliver(event, false); err != nil {
+				return err
+			}
+		case <-sub.Resync():
+			if err := w.catchUp(ctx); err != nil {
+				return err
+			}
+		}
+		if w.final {
+			return nil
+		}
+	}
+}
+
+// paymentWatch состояние одной подписки: last id последнего переданного события
+type paymentWatch struct {
+	service   *WatchService
+	paymentID string
+	last      int64
+	final     bool
+	send      func(event *dto.PaymentEvent, snapshot bool) error
+}
+
+// snapshot передаёт последнее событие платежа как текущее состояние; для платежа без событий
+// состояние собирается из самого платежа
+func (w *paymentWatch) snapshot(ctx context.Context, payment *dto.Payment) error {
+	events, err := w.load(ctx)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return w.deliver(&dto.PaymentEvent{
+			PaymentID: payment.ID,
+			To:        payment.Status,
+			Amount:    payment.Amount,
+			CreatedAt: payment.UpdatedAt,
+		}, true)
+	}
+	return w.deliver(events[len(events)-1], true)
+}
+
+// catchUp передаёт события, записанные после последнего переданного
+func (w *paymentWatch) catchUp(ctx context.Context) error {
+	events, err := w.load(ctx)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := w.deliver(event, false); err != nil {
+			return err
+		}
+		if w.final {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (w *paymentWatch) load(ctx context.Context) ([]*dto.PaymentEvent, error) {
+	events, err := w.service.events.PaymentEvents(ctx, w.paymentID, w.last)
+	if err != nil {
+		return nil, DomainError(fmt.Errorf("error loading payment events: %w", err))
+	}
+	return events, nil
+}
+
+// deliver передаёт событие, если оно новее последнего переданного; повторы от outbox отбрасываются
+func (w *paymentWatch) deliver(event *dto.PaymentEvent, snapshot bool) error {
+	if !snapshot && event.ID <= w.last {
+		return nil
+	}
+	if err := w.send(event, snapshot); err != nil {
+		return err
+	}
+	w.last = max(w.last, event.ID)
+	w.final = dto.IsFinal(event.To)
+	return nil
+}
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE payments
+	ALTER COLUMN amount TYPE numeric(20, 4) USING round(amount::numeric, 4);
+
+-- +goose Down
+ALTER TABLE payments
+	ALTER COLUMN amount TYPE double precision USING amount::double precision;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE payment_status_history (
+	id bigserial PRIMARY KEY,
+	payment_id uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+	from_status varchar(20) NOT NULL,
+	to_status varchar(20) NOT NULL,
+	reason text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payment_status_history_payment_id_idx ON payment_status_history (payment_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_status_history;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE idempotency_keys (
+	key varchar(255) NOT NULL,
+	method varchar(255) NOT NULL,
+	fingerprint char(64) NOT NULL,
+	response bytea,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (key, method)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE payment_queue (
+	payment_id uuid PRIMARY KEY,
+	payload jsonb NOT NULL,
+	visible_at timestamptz NOT NULL DEFAULT NOW(),
+	delivery_count integer NOT NULL DEFAULT 0,
+	enqueued_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payment_queue_visible_at_idx ON payment_queue (visible_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_queue;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE payment_queue
+	ADD COLUMN attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN last_error text NOT NULL DEFAULT '';
+
+CREATE TABLE payment_dead_letters (
+	payment_id uuid PRIMARY KEY,
+	payload jsonb NOT NULL,
+	attempts integer NOT NULL,
+	last_error text NOT NULL DEFAULT '',
+	enqueued_at timestamptz NOT NULL,
+	dead_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payment_dead_letters_dead_at_idx ON payment_dead_letters (dead_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_dead_letters;
+
+ALTER TABLE payment_queue
+	DROP COLUMN IF EXISTS attempts,
+	DROP COLUMN IF EXISTS last_error;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE payment_events (
+	id bigserial PRIMARY KEY,
+	payment_id uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+	from_status varchar(20) NOT NULL DEFAULT '',
+	to_status varchar(20) NOT NULL,
+	reason text NOT NULL DEFAULT '',
+	amount numeric(20,4) NOT NULL,
+	currency varchar(3) NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payment_events_payment_id_idx ON payment_events (payment_id, id);
+
+-- Последнее опубликованное событие платежа для каждого получателя (sink)
+CREATE TABLE payment_event_offsets (
+	sink varchar(64) NOT NULL,
+	payment_id uuid NOT NULL,
+	last_event_id bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (sink, payment_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_event_offsets;
+DROP TABLE IF EXISTS payment_events;
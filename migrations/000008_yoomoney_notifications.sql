@@ -0,0 +1,10 @@
+-- +goose Up
+-- Принятые уведомления ЮMoney: повтор с тем же operation_id не обрабатывается
+CREATE TABLE yoomoney_notifications (
+	operation_id varchar(64) PRIMARY KEY,
+	payment_id uuid NOT NULL,
+	received_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS yoomoney_notifications;
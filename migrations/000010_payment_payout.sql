@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE payments ADD COLUMN payout_request_id varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN payout_id varchar(64) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS payout_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS payout_request_id;
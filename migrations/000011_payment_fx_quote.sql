@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE payments
+	ADD COLUMN quote_amount numeric(20, 4),
+	ADD COLUMN quote_currency varchar(3),
+	ADD COLUMN quote_rate varchar(64),
+	ADD COLUMN quote_source varchar(32),
+	ADD COLUMN quoted_at timestamptz,
+	ADD COLUMN quote_expires_at timestamptz;
+
+-- +goose Down
+ALTER TABLE payments
+	DROP COLUMN IF EXISTS quote_expires_at,
+	DROP COLUMN IF EXISTS quoted_at,
+	DROP COLUMN IF EXISTS quote_source,
+	DROP COLUMN IF EXISTS quote_rate,
+	DROP COLUMN IF EXISTS quote_currency,
+	DROP COLUMN IF EXISTS quote_amount;
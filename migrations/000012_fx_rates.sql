@@ -0,0 +1,14 @@
+-- +goose Up
+-- История курсов: один курс base -> currency на календарный день (UTC), последний полученный за день
+CREATE TABLE fx_rates (
+	base varchar(3) NOT NULL,
+	currency varchar(3) NOT NULL,
+	rate_date date NOT NULL,
+	rate varchar(64) NOT NULL,
+	source varchar(32) NOT NULL DEFAULT '',
+	fetched_at timestamptz NOT NULL,
+	PRIMARY KEY (base, currency, rate_date)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS fx_rates;
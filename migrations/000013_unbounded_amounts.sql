@@ -0,0 +1,17 @@
+-- +goose Up
+-- Money хранит int64 минимальных единиц: в numeric(20, 4) не помещаются крупные суммы в валютах
+-- без дробной части (JPY, KRW), поэтому точность и масштаб не ограничиваются
+ALTER TABLE payments
+	ALTER COLUMN amount TYPE numeric,
+	ALTER COLUMN quote_amount TYPE numeric;
+
+ALTER TABLE payment_events
+	ALTER COLUMN amount TYPE numeric;
+
+-- +goose Down
+ALTER TABLE payment_events
+	ALTER COLUMN amount TYPE numeric(20, 4);
+
+ALTER TABLE payments
+	ALTER COLUMN quote_amount TYPE numeric(20, 4),
+	ALTER COLUMN amount TYPE numeric(20, 4);
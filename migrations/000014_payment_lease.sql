@@ -0,0 +1,10 @@
+-- +goose Up
+-- Аренда платежа воркером демона вместо row-level блокировки на всё время обработки
+ALTER TABLE payments
+	ADD COLUMN locked_by varchar(64),
+	ADD COLUMN locked_until timestamptz;
+
+-- +goose Down
+ALTER TABLE payments
+	DROP COLUMN IF EXISTS locked_until,
+	DROP COLUMN IF EXISTS locked_by;
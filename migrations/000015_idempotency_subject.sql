@@ -0,0 +1,15 @@
+-- +goose Up
+-- Ключ идемпотентности принадлежит вызывающему: одинаковые ключи разных пользователей не пересекаются,
+-- и сохранённый ответ отдаётся только тому, кто выполнил исходный запрос
+ALTER TABLE idempotency_keys
+	ADD COLUMN subject varchar(255) NOT NULL DEFAULT '',
+	DROP CONSTRAINT idempotency_keys_pkey,
+	ADD PRIMARY KEY (key, method, subject);
+
+-- +goose Down
+DELETE FROM idempotency_keys WHERE subject <> '';
+
+ALTER TABLE idempotency_keys
+	DROP CONSTRAINT idempotency_keys_pkey,
+	DROP COLUMN IF EXISTS subject,
+	ADD PRIMARY KEY (key, method);
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Все котировки, по которым выдавались ссылки на оплату: ссылку, выданную по истёкшей котировке,
+-- могут оплатить после выдачи новой, и уведомление сверяется с любой из них
+CREATE TABLE payment_quotes (
+	id bigserial PRIMARY KEY,
+	payment_id uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+	amount numeric NOT NULL,
+	currency varchar(3) NOT NULL,
+	rate varchar(64) NOT NULL,
+	source varchar(32) NOT NULL,
+	quoted_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX payment_quotes_payment_id_idx ON payment_quotes (payment_id, quoted_at);
+
+INSERT INTO payment_quotes (payment_id, amount, currency, rate, source, quoted_at, expires_at)
+SELECT id, quote_amount, quote_currency, COALESCE(quote_rate, ''), COALESCE(quote_source, ''), quoted_at, quote_expires_at
+FROM payments
+WHERE quote_amount IS NOT NULL AND quote_currency IS NOT NULL AND quoted_at IS NOT NULL AND quote_expires_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_quotes;
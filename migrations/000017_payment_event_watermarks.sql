@@ -0,0 +1,11 @@
+-- +goose Up
+-- Нижняя граница outbox для получателя: все события с id не больше event_id уже опубликованы,
+-- и выборка неопубликованных читает payment_events только после неё
+CREATE TABLE payment_event_watermarks (
+	sink varchar(64) PRIMARY KEY,
+	event_id bigint NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_event_watermarks;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Резервирование ключа получает токен: завершить или освободить ключ может только запрос, который его занял,
+-- а не запрос, чью просроченную резервацию уже перезанял повтор
+ALTER TABLE idempotency_keys ADD COLUMN token uuid;
+
+-- +goose Down
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS token;
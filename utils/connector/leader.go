@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// LeaderElector решает, какая из реплик выполняет фоновую работу
+type LeaderElector interface {
+	// Lead блокируется, пока реплика не станет лидером (или не отменят ctx).
+	// Возвращённый контекст отменяется при потере лидерства, resign отказывается от него
+	Lead(ctx context.Context) (leaderCtx context.Context, resign func(), err error)
+}
+
+// AlwaysLeader выборы для единственной реплики: лидерство выдаётся сразу
+type AlwaysLeader struct{}
+
+func (AlwaysLeader) Lead(ctx context.Context) (context.Context, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	leaderCtx, cancel := context.WithCancel(ctx)
+	return leaderCtx, cancel, nil
+}
+
+// PostgresLeaderElector выборы на сессионном advisory lock.
+// Лидер держит блокировку на выделенном соединении и периодически проверяет его:
+// если соединение или процесс умирают, Postgres снимает блокировку и её забирает следующая реплика
+type PostgresLeaderElector struct {
+	db            *pgxpool.Pool
+	logger        *zap.Logger
+	lockKey       int64
+	retryInterval time.Duration
+	checkInterval time.Duration
+}
+
+func NewPostgresLeaderElector(db *pgxpool.Pool, logger *zap.Logger, lockKey int64, retryInterval, checkInterval time.Duration) *PostgresLeaderElector {
+	return &PostgresLeaderElector{
+		db:            db,
+		logger:        logger.With(zap.String("component", "leader_elector")),
+		lockKey:       lockKey,
+		retryInterval: retryInterval,
+		checkInterval: checkInterval,
+	}
+}
+
+func (e *PostgresLeaderElector) Lead(ctx context.Context) (context.Context, func(), error) {
+	for {
+		conn, acquired, err := e.tryLock(ctx)
+		if err != nil {
+			e.logger.Warn("leader election attempt failed", zap.Error(err))
+		}
+		if acquired {
+			e.logger.Info("acquired leadership", zap.Int64("lock_key", e.lockKey))
+			return e.hold(ctx, conn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(e.retryInterval):
+		}
+	}
+}
+
+func (e *PostgresLeaderElector) tryLock(ctx context.Context) (*pgxpool.Conn, bool, error) {
+	conn, err := e.db.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, e.lockKey).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to try advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+	return conn, true, nil
+}
+
+// hold следит за соединением с блокировкой, пока реплика не откажется от лидерства
+func (e *PostgresLeaderElector) hold(ctx context.Context, conn *pgxpool.Conn) (context.Context, func(), error) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(e.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			checkCtx, checkCancel := context.WithTimeout(leaderCtx, e.checkInterval)
+			err := conn.Ping(checkCtx)
+			checkCancel()
+			if err != nil && leaderCtx.Err() == nil {
+				e.logger.Error("lost leadership: lock connection is broken", zap.Error(err))
+				cancel()
+				return
+			}
+		}
+	}()
+
+	resign := func() {
+		cancel()
+		<-stopped
+
+		unlockCtx, unlockCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer unlockCancel()
+
+		if _, err := conn.Exec(unlockCtx, `SELECT pg_advisory_unlock($1)`, e.lockKey); err != nil {
+			// Закрытие сессии гарантированно снимает блокировку
+			e.logger.Warn("failed to release advisory lock, closing connection", zap.Error(err))
+			if err := conn.Hijack().Close(unlockCtx); err != nil {
+				e.logger.Warn("failed to close lock connection", zap.Error(err))
+			}
+			return
+		}
+		conn.Release()
+		e.logger.Info("resigned leadership", zap.Int64("lock_key", e.lockKey))
+	}
+
+	return leaderCtx, resign, nil
+}
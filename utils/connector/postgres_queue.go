@@ -0,0 +1,229 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	dto "paymentgo/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// PostgresQueue durable-очередь платежей в таблице payment_queue.
+// Dequeue не удаляет строку, а скрывает её на visibilityTimeout: если обработчик
+// не вызвал Ack или Enqueue за это время (например, процесс упал), платёж будет выдан повторно.
+// Выборка идёт через FOR UPDATE SKIP LOCKED, поэтому очередь можно читать из нескольких реплик.
+// Платёж, который maxDeliveries раз подряд выдан без Ack, Retry или Enqueue (например, обработчик
+// каждый раз падает на нём), и платёж с нечитаемым payload переносятся в payment_dead_letters
+type PostgresQueue struct {
+	db                *pgxpool.Pool
+	logger            *zap.Logger
+	visibilityTimeout time.Duration
+	maxDeliveries     int
+}
+
+// NewPostgresQueue очередь поверх payment_queue; maxDeliveries 0 не ограничивает повторные выдачи
+func NewPostgresQueue(db *pgxpool.Pool, logger *zap.Logger, visibilityTimeout time.Duration, maxDeliveries int) *PostgresQueue {
+	return &PostgresQueue{
+		db:                db,
+		logger:            logger.With(zap.String("component", "payment_queue")),
+		visibilityTimeout: visibilityTimeout,
+		maxDeliveries:     maxDeliveries,
+	}
+}
+
+// Enqueue добавляет платёж или возвращает уже выданный платёж в очередь (nack).
+// Внутри WithinTx платёж появится в очереди вместе с остальными записями транзакции
+func (q *PostgresQueue) Enqueue(ctx context.Context, element dto.Payment) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	payload, err := json.Marshal(element)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queued payment %s: %w", element.ID, err)
+	}
+
+	query := `INSERT INTO payment_queue (payment_id, payload, visible_at, enqueued_at)
+	VALUES ($1, $2, NOW(), NOW())
+	ON CONFLICT (payment_id) DO UPDATE SET payload = EXCLUDED.payload, visible_at = NOW(), delivery_count = 0`
+	if _, err := TxQuerier(ctx, q.db).Exec(ctx, query, element.ID, payload); err != nil {
+		q.logger.Error("failed to enqueue payment", zap.String("payment_id", element.ID), zap.Error(err))
+		return fmt.Errorf("failed to enqueue payment %s: %w", element.ID, err)
+	}
+	return nil
+}
+
+func (q *PostgresQueue) EnqueueList(ctx context.Context, data []dto.Payment) error {
+	for _, element := range data {
+		if err := q.Enqueue(ctx, element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dequeue выдаёт первый видимый платёж и скрывает его на visibilityTimeout.
+// Платежи, которые нельзя выдать, переносятся в dead-letter, и выдаётся следующий
+func (q *PostgresQueue) Dequeue() (Task, bool) {
+	for {
+		task, deliverable, ok := q.dequeue()
+		if !ok {
+			return Task{}, false
+		}
+		if deliverable {
+			return task, true
+		}
+	}
+}
+
+// dequeue выдаёт первый видимый платёж; deliverable false, если платёж перенесён в dead-letter
+func (q *PostgresQueue) dequeue() (task Task, deliverable, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE payment_queue
+	SET visible_at = NOW() + $1 * interval '1 millisecond', delivery_count = delivery_count + 1
+	WHERE payment_id = (
+		SELECT payment_id FROM payment_queue
+		WHERE visible_at <= NOW()
+		ORDER BY visible_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING payment_id, payload, attempts, last_error, enqueued_at, delivery_count`
+
+	var (
+		paymentID     string
+		payload       []byte
+		deliveryCount int
+	)
+	err := q.db.QueryRow(ctx, query, q.visibilityTimeout.Milliseconds()).Scan(&paymentID, &payload, &task.Attempts, &task.LastError, &task.EnqueuedAt, &deliveryCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Task{}, false, false
+	}
+	if err != nil {
+		q.logger.Error("failed to dequeue payment", zap.Error(err))
+		return Task{}, false, false
+	}
+
+	// Нечитаемый payload не станет читаемым при повторе: без переноса строка выдавалась бы бесконечно
+	if err := json.Unmarshal(payload, &task.Payment); err != nil {
+		q.logger.Error("failed to unmarshal queued payment", zap.String("payment_id", paymentID), zap.Error(err))
+		q.deadLetter(ctx, paymentID, fmt.Sprintf("invalid queued payload %s: %v", payload, err), true)
+		return Task{}, false, true
+	}
+
+	if q.maxDeliveries > 0 && deliveryCount > q.maxDeliveries {
+		q.logger.Error("payment was delivered too many times without ack",
+			zap.String("payment_id", paymentID),
+			zap.Int("delivery_count", deliveryCount-1))
+		q.deadLetter(ctx, paymentID, fmt.Sprintf("delivered %d times without ack or retry, last error: %s", deliveryCount-1, task.LastError), false)
+		return Task{}, false, true
+	}
+
+	if deliveryCount > 1 {
+		q.logger.Info("redelivering payment after visibility timeout", zap.String("payment_id", task.Payment.ID), zap.Int("delivery_count", deliveryCount))
+	}
+
+	return task, true, true
+}
+
+// deadLetter переносит строку очереди в payment_dead_letters одним запросом. Нечитаемый payload
+// заменяется платежом с одним ID, чтобы запись читалась списком dead-letter; исходный payload остаётся в lastError
+func (q *PostgresQueue) deadLetter(ctx context.Context, paymentID, lastError string, invalidPayload bool) {
+	query := `WITH moved AS (
+		DELETE FROM payment_queue WHERE payment_id = $1
+		RETURNING payment_id, payload, attempts, enqueued_at
+	)
+	INSERT INTO payment_dead_letters (payment_id, payload, attempts, last_error, enqueued_at, dead_at)
+	SELECT payment_id, CASE WHEN $3::boolean THEN jsonb_build_object('id', payment_id) ELSE payload END, attempts, $2, enqueued_at, NOW()
+	FROM moved
+	ON CONFLICT (payment_id) DO UPDATE
+	SET payload = EXCLUDED.payload, attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, dead_at = NOW()`
+	if _, err := q.db.Exec(ctx, query, paymentID, lastError, invalidPayload); err != nil {
+		// Строка осталась в очереди и после visibility timeout попадёт сюда снова
+		q.logger.Error("failed to dead-letter queued payment", zap.String("payment_id", paymentID), zap.Error(err))
+	}
+}
+
+// SaveTasks сохраняет задачи in-memory очереди вместе со счётчиком попыток, последней ошибкой,
+// временем постановки и следующей попытки. Задачи пишутся в одной транзакции: при ошибке не сохраняется ни одна
+func (q *PostgresQueue) SaveTasks(ctx context.Context, tasks []Task) error {
+	query := `INSERT INTO payment_queue (payment_id, payload, attempts, last_error, enqueued_at, visible_at)
+	VALUES ($1, $2, $3, $4, $5, GREATEST($6, NOW()))
+	ON CONFLICT (payment_id) DO UPDATE
+	SET payload = EXCLUDED.payload, attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error,
+		enqueued_at = EXCLUDED.enqueued_at, visible_at = EXCLUDED.visible_at`
+
+	return WithinTx(ctx, q.db, func(ctx context.Context) error {
+		for _, task := range tasks {
+			payload, err := json.Marshal(task.Payment)
+			if err != nil {
+				return fmt.Errorf("failed to marshal queued payment %s: %w", task.Payment.ID, err)
+			}
+			if _, err := TxQuerier(ctx, q.db).Exec(ctx, query, task.Payment.ID, payload, task.Attempts, task.LastError, task.EnqueuedAt, task.NextAttemptAt); err != nil {
+				return fmt.Errorf("failed to save queued payment %s: %w", task.Payment.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// TakeTasks забирает из таблицы все задачи, например чтобы продолжить их в in-memory очереди
+func (q *PostgresQueue) TakeTasks(ctx context.Context) ([]Task, error) {
+	query := `DELETE FROM payment_queue
+	RETURNING payload, attempts, last_error, enqueued_at, visible_at`
+
+	rows, err := TxQuerier(ctx, q.db).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take queued payments: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		var (
+			task    Task
+			payload []byte
+		)
+		if err := rows.Scan(&payload, &task.Attempts, &task.LastError, &task.EnqueuedAt, &task.NextAttemptAt); err != nil {
+			return nil, fmt.Errorf("failed to scan queued payment: %w", err)
+		}
+		if err := json.Unmarshal(payload, &task.Payment); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queued payment: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return tasks, nil
+}
+
+// Retry делает платёж снова видимым через delay и сохраняет счётчик попыток; счётчик выдач без ответа сбрасывается
+func (q *PostgresQueue) Retry(task Task, delay time.Duration, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE payment_queue
+	SET attempts = $2, last_error = $3, visible_at = NOW() + $4 * interval '1 millisecond', delivery_count = 0
+	WHERE payment_id = $1`
+	if _, err := q.db.Exec(ctx, query, task.Payment.ID, task.Attempts, errorText(cause), delay.Milliseconds()); err != nil {
+		q.logger.Error("failed to reschedule payment", zap.String("payment_id", task.Payment.ID), zap.Error(err))
+	}
+}
+
+// Ack окончательно удаляет платёж из очереди
+func (q *PostgresQueue) Ack(paymentID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := q.db.Exec(ctx, `DELETE FROM payment_queue WHERE payment_id = $1`, paymentID); err != nil {
+		q.logger.Error("failed to ack payment", zap.String("payment_id", paymentID), zap.Error(err))
+	}
+}
@@ -0,0 +1,297 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "paymentgo/internal/entity"
+
+	"github.com/google/uuid"
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap/zaptest"
+)
+
+// testPostgresDSNEnv DSN базы для тестов PostgresQueue, например
+// "host=localhost port=5432 user=postgres password=postgres dbname=paymentgo sslmode=disable"
+const testPostgresDSNEnv = "PAYMENTGO_TEST_POSTGRES_DSN"
+
+// newTestPostgresQueue очередь поверх отдельной схемы с применёнными миграциями; схема удаляется после теста.
+// Без PAYMENTGO_TEST_POSTGRES_DSN тест пропускается
+func newTestPostgresQueue(t *testing.T, visibilityTimeout time.Duration, maxDeliveries int) (*PostgresQueue, *pgxpool.Pool) {
+	t.Helper()
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testPostgresDSNEnv)
+	}
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t)
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to Postgres: %v", err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("queue_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop schema: %v", err)
+		}
+	})
+
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse DSN: %v", err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatalf("failed to connect to Postgres: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := MigratePostgres(ctx, pool, logger, os.DirFS("../..")); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	return NewPostgresQueue(pool, logger, visibilityTimeout, maxDeliveries), pool
+}
+
+func TestPostgresQueue_ConcurrentDequeueDeliversEachPaymentOnce(t *testing.T) {
+	queue, _ := newTestPostgresQueue(t, time.Minute, 0)
+	ctx := context.Background()
+
+	const payments = 20
+	for i := 0; i < payments; i++ {
+		if err := queue.Enqueue(ctx, dto.Payment{ID: uuid.NewString()}); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		delivered = make(map[string]int)
+		wg        sync.WaitGroup
+	)
+	for worker := 0; worker < 5; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := queue.Dequeue()
+				if !ok {
+					return
+				}
+				mu.Lock()
+				delivered[task.Payment.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(delivered) != payments {
+		t.Fatalf("Delivered %d payments, expected %d", len(delivered), payments)
+	}
+	for paymentID, count := range delivered {
+		if count != 1 {
+			t.Errorf("Payment %s delivered %d times during visibility timeout", paymentID, count)
+		}
+	}
+}
+
+func TestPostgresQueue_RedeliversAfterVisibilityTimeout(t *testing.T) {
+	queue, _ := newTestPostgresQueue(t, 200*time.Millisecond, 0)
+	ctx := context.Background()
+	payment := dto.Payment{ID: uuid.NewString()}
+	if err := queue.Enqueue(ctx, payment); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	if _, ok := queue.Dequeue(); !ok {
+		t.Fatalf("Dequeue returned false, expected true")
+	}
+	// Обработчик не подтвердил платёж: до visibility timeout он скрыт
+	if _, ok := queue.Dequeue(); ok {
+		t.Fatalf("Dequeue returned a payment hidden by visibility timeout")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	task, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Payment was not redelivered after visibility timeout")
+	}
+	if task.Payment.ID != payment.ID || task.Attempts != 0 {
+		t.Errorf("Unexpected redelivered task %+v", task)
+	}
+}
+
+func TestPostgresQueue_RetryAndAck(t *testing.T) {
+	queue, pool := newTestPostgresQueue(t, time.Minute, 0)
+	ctx := context.Background()
+	payment := dto.Payment{ID: uuid.NewString(), Amount: dto.Money{Minor: 10000, Currency: "RUB"}}
+	if err := queue.Enqueue(ctx, payment); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	task, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Dequeue returned false, expected true")
+	}
+	task.Attempts++
+	queue.Retry(task, time.Hour, errors.New("provider unavailable"))
+	if _, ok := queue.Dequeue(); ok {
+		t.Fatalf("Dequeue returned a payment retried in the future")
+	}
+
+	queue.Retry(task, 0, errors.New("provider unavailable"))
+	retried, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Dequeue returned false for a due payment")
+	}
+	if retried.Attempts != 1 || retried.LastError != "provider unavailable" || retried.Payment.Amount != payment.Amount {
+		t.Errorf("Unexpected retried task %+v", retried)
+	}
+
+	queue.Ack(payment.ID)
+	var rows int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM payment_queue WHERE payment_id = $1`, payment.ID).Scan(&rows); err != nil {
+		t.Fatalf("failed to count queued payments: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("Payment is still queued after Ack")
+	}
+}
+
+func TestPostgresQueue_SaveAndTakeTasks(t *testing.T) {
+	queue, _ := newTestPostgresQueue(t, time.Minute, 0)
+	ctx := context.Background()
+	enqueuedAt := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	task := Task{
+		Payment:       dto.Payment{ID: uuid.NewString()},
+		Attempts:      3,
+		LastError:     "provider unavailable",
+		EnqueuedAt:    enqueuedAt,
+		NextAttemptAt: time.Now().Add(time.Hour),
+	}
+	if err := queue.SaveTasks(ctx, []Task{task}); err != nil {
+		t.Fatalf("SaveTasks failed: %v", err)
+	}
+
+	tasks, err := queue.TakeTasks(ctx)
+	if err != nil {
+		t.Fatalf("TakeTasks failed: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("TakeTasks returned %d tasks, expected 1", len(tasks))
+	}
+	taken := tasks[0]
+	if taken.Payment.ID != task.Payment.ID || taken.Attempts != 3 || taken.LastError != task.LastError || !taken.EnqueuedAt.Equal(enqueuedAt) {
+		t.Errorf("Unexpected taken task %+v", taken)
+	}
+	if _, ok := queue.Dequeue(); ok {
+		t.Errorf("Payment is still queued after TakeTasks")
+	}
+}
+
+func TestPostgresQueue_SaveTasksIsAllOrNothing(t *testing.T) {
+	queue, pool := newTestPostgresQueue(t, time.Minute, 0)
+	ctx := context.Background()
+	tasks := []Task{
+		{Payment: dto.Payment{ID: uuid.NewString()}, EnqueuedAt: time.Now(), NextAttemptAt: time.Now()},
+		// payment_id не UUID: запись задачи отклоняется базой
+		{Payment: dto.Payment{ID: "not-a-uuid"}, EnqueuedAt: time.Now(), NextAttemptAt: time.Now()},
+	}
+	if err := queue.SaveTasks(ctx, tasks); err == nil {
+		t.Fatalf("SaveTasks succeeded with an invalid payment ID")
+	}
+
+	var rows int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM payment_queue`).Scan(&rows); err != nil {
+		t.Fatalf("failed to count queued payments: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("SaveTasks saved %d tasks of a failed batch", rows)
+	}
+}
+
+func TestPostgresQueue_InvalidPayloadIsDeadLettered(t *testing.T) {
+	queue, pool := newTestPostgresQueue(t, time.Minute, 0)
+	ctx := context.Background()
+	broken := uuid.NewString()
+	if _, err := pool.Exec(ctx, `INSERT INTO payment_queue (payment_id, payload, visible_at) VALUES ($1, '"garbage"', NOW() - interval '1 minute')`, broken); err != nil {
+		t.Fatalf("failed to insert broken payload: %v", err)
+	}
+	payment := dto.Payment{ID: uuid.NewString()}
+	if err := queue.Enqueue(ctx, payment); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	// Нечитаемая строка уходит в dead-letter, выдаётся следующий платёж
+	task, ok := queue.Dequeue()
+	if !ok || task.Payment.ID != payment.ID {
+		t.Fatalf("Dequeue returned %+v, %v, expected payment %s", task, ok, payment.ID)
+	}
+
+	var (
+		payloadID string
+		lastError string
+		queued    int
+	)
+	if err := pool.QueryRow(ctx, `SELECT payload->>'id', last_error FROM payment_dead_letters WHERE payment_id = $1`, broken).Scan(&payloadID, &lastError); err != nil {
+		t.Fatalf("broken payment was not dead-lettered: %v", err)
+	}
+	if payloadID != broken || !strings.Contains(lastError, "garbage") {
+		t.Errorf("Unexpected dead letter payload id %q, last error %q", payloadID, lastError)
+	}
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM payment_queue WHERE payment_id = $1`, broken).Scan(&queued); err != nil {
+		t.Fatalf("failed to count queued payments: %v", err)
+	}
+	if queued != 0 {
+		t.Errorf("Broken payment is still queued")
+	}
+}
+
+func TestPostgresQueue_DeadLettersAfterMaxDeliveries(t *testing.T) {
+	queue, pool := newTestPostgresQueue(t, 100*time.Millisecond, 2)
+	ctx := context.Background()
+	payment := dto.Payment{ID: uuid.NewString()}
+	if err := queue.Enqueue(ctx, payment); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	// Retry это ответ обработчика: счётчик выдач без ответа начинается заново
+	task, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Dequeue returned false, expected true")
+	}
+	queue.Retry(task, 0, errors.New("provider unavailable"))
+
+	// Дальше обработчик дважды падает, не ответив
+	for delivery := 1; delivery <= 2; delivery++ {
+		if _, ok := queue.Dequeue(); !ok {
+			t.Fatalf("Delivery %d after retry did not happen", delivery)
+		}
+		time.Sleep(150 * time.Millisecond)
+	}
+
+	if _, ok := queue.Dequeue(); ok {
+		t.Fatalf("Payment was delivered beyond the delivery cap")
+	}
+	var lastError string
+	if err := pool.QueryRow(ctx, `SELECT last_error FROM payment_dead_letters WHERE payment_id = $1`, payment.ID).Scan(&lastError); err != nil {
+		t.Fatalf("payment was not dead-lettered: %v", err)
+	}
+	if !strings.Contains(lastError, "provider unavailable") {
+		t.Errorf("Dead letter lost the last error: %q", lastError)
+	}
+}
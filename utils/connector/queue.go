@@ -1,19 +1,36 @@
 package connector
 
 import (
+	"context"
 	dto "paymentgo/internal/entity"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
+// Queue очередь платежей, ожидающих подтверждения оплаты.
+// Повторный Enqueue уже выданного платежа возвращает его в очередь, Retry откладывает
+// следующую попытку, Ack удаляет платёж окончательно. Durable-очередь добавляет платёж
+// в транзакции WithinTx из ctx, если она есть.
 type Queue interface {
-	Enqueue(element dto.Payment)
-	EnqueueList(data []dto.Payment)
-	Dequeue() (dto.Payment, bool)
+	Enqueue(ctx context.Context, element dto.Payment) error
+	EnqueueList(ctx context.Context, data []dto.Payment) error
+	Dequeue() (Task, bool)
+	Retry(task Task, delay time.Duration, cause error)
+	Ack(paymentID string)
+}
+
+// Task платёж в очереди вместе со счётчиком попыток
+type Task struct {
+	Payment       dto.Payment
+	Attempts      int
+	LastError     string
+	EnqueuedAt    time.Time
+	NextAttemptAt time.Time
 }
 
 type QueueNode struct {
-	expression dto.Payment
+	expression Task
 	next       unsafe.Pointer
 }
 
@@ -30,8 +47,13 @@ func NewPaymentsQueue() *LockFreeQueue {
 	}
 }
 
-func (q *LockFreeQueue) Enqueue(element dto.Payment) {
-	newNode := &QueueNode{expression: element}
+func (q *LockFreeQueue) Enqueue(ctx context.Context, element dto.Payment) error {
+	q.push(Task{Payment: element, EnqueuedAt: time.Now()})
+	return nil
+}
+
+func (q *LockFreeQueue) push(task Task) {
+	newNode := &QueueNode{expression: task}
 
 	for {
 		tail := atomic.LoadPointer(&q.tail)
@@ -50,20 +72,45 @@ func (q *LockFreeQueue) Enqueue(element dto.Payment) {
 	}
 }
 
-func (q *LockFreeQueue) EnqueueList(data []dto.Payment) {
+func (q *LockFreeQueue) EnqueueList(ctx context.Context, data []dto.Payment) error {
 	for _, expr := range data {
-		q.Enqueue(expr)
+		if err := q.Enqueue(ctx, expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dequeue выдаёт первый платёж, попытка которого уже наступила. Отложенные платежи
+// перекладываются в конец очереди; обход заканчивается, когда очередь прокрутилась целиком.
+func (q *LockFreeQueue) Dequeue() (Task, bool) {
+	var firstDeferred string
+	for {
+		task, ok := q.pop()
+		if !ok {
+			return Task{}, false
+		}
+		if !time.Now().Before(task.NextAttemptAt) {
+			return task, true
+		}
+		q.push(task)
+		if firstDeferred == task.Payment.ID {
+			return Task{}, false
+		}
+		if firstDeferred == "" {
+			firstDeferred = task.Payment.ID
+		}
 	}
 }
 
-func (q *LockFreeQueue) Dequeue() (dto.Payment, bool) {
+func (q *LockFreeQueue) pop() (Task, bool) {
 	for {
 		head := atomic.LoadPointer(&q.head)
 		next := atomic.LoadPointer(&((*QueueNode)(head)).next)
 
 		if head == atomic.LoadPointer(&q.head) {
 			if next == nil {
-				return dto.Payment{}, false
+				return Task{}, false
 			}
 			if atomic.CompareAndSwapPointer(&q.head, head, next) {
 				return (*QueueNode)(next).expression, true
@@ -71,3 +118,40 @@ func (q *LockFreeQueue) Dequeue() (dto.Payment, bool) {
 		}
 	}
 }
+
+// Drain забирает из очереди все задачи вместе со счётчиками попыток, например чтобы сохранить их
+// при остановке сервиса (см. PostgresQueue.SaveTasks)
+func (q *LockFreeQueue) Drain() []Task {
+	var tasks []Task
+	for {
+		task, ok := q.pop()
+		if !ok {
+			return tasks
+		}
+		tasks = append(tasks, task)
+	}
+}
+
+// Restore возвращает в очередь задачи, сохранённые при прошлой остановке, как есть
+func (q *LockFreeQueue) Restore(tasks []Task) {
+	for _, task := range tasks {
+		q.push(task)
+	}
+}
+
+// Retry возвращает задачу в очередь не раньше чем через delay
+func (q *LockFreeQueue) Retry(task Task, delay time.Duration, cause error) {
+	task.NextAttemptAt = time.Now().Add(delay)
+	task.LastError = errorText(cause)
+	q.push(task)
+}
+
+// Ack ничего не делает: Dequeue уже удалил элемент из памяти
+func (q *LockFreeQueue) Ack(paymentID string) {}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -1,58 +1,126 @@
 package connector
 
 import (
+	"context"
+	"errors"
 	dto "paymentgo/internal/entity"
 	"testing"
+	"time"
 )
 
 func TestLockFreeQueue_EnqueueDequeue(t *testing.T) {
 	queue := NewPaymentsQueue()
 	payment := dto.Payment{
 		ID:     "1234",
-		Amount: 100.0,
+		Amount: dto.Money{Minor: 10000, Currency: "RUB"},
 	}
-	queue.Enqueue(payment)
-	dequeuedPayment, ok := queue.Dequeue()
+	queue.Enqueue(context.Background(), payment)
+	task, ok := queue.Dequeue()
 	if !ok {
 		t.Errorf("Dequeue returned false, expected true")
 	}
+	dequeuedPayment := task.Payment
 	if dequeuedPayment.ID != payment.ID {
 		t.Errorf("Expected payment ID %s, but got %s", payment.ID, dequeuedPayment.ID)
 	}
 	if dequeuedPayment.Amount != payment.Amount {
-		t.Errorf("Expected payment amount %f, but got %f", payment.Amount, dequeuedPayment.Amount)
+		t.Errorf("Expected payment amount %s, but got %s", payment.Amount, dequeuedPayment.Amount)
 	}
 }
 
 func TestLockFreeQueue_EnqueueListDequeue(t *testing.T) {
 	queue := NewPaymentsQueue()
 	payments := []dto.Payment{
-		{ID: "1234", Amount: 100.0},
-		{ID: "5678", Amount: 200.0},
-		{ID: "9101", Amount: 300.0},
+		{ID: "1234", Amount: dto.Money{Minor: 10000, Currency: "RUB"}},
+		{ID: "5678", Amount: dto.Money{Minor: 20000, Currency: "RUB"}},
+		{ID: "9101", Amount: dto.Money{Minor: 30000, Currency: "RUB"}},
 	}
-	queue.EnqueueList(payments)
+	queue.EnqueueList(context.Background(), payments)
 	for _, payment := range payments {
-		dequeuedPayment, ok := queue.Dequeue()
+		task, ok := queue.Dequeue()
 		if !ok {
 			t.Errorf("Dequeue returned false, expected true")
 		}
+		dequeuedPayment := task.Payment
 		if dequeuedPayment.ID != payment.ID {
 			t.Errorf("Expected payment ID %s, but got %s", payment.ID, dequeuedPayment.ID)
 		}
 		if dequeuedPayment.Amount != payment.Amount {
-			t.Errorf("Expected payment amount %f, but got %f", payment.Amount, dequeuedPayment.Amount)
+			t.Errorf("Expected payment amount %s, but got %s", payment.Amount, dequeuedPayment.Amount)
 		}
 	}
 }
 
 func TestLockFreeQueue_DequeueFromEmptyQueue(t *testing.T) {
 	queue := NewPaymentsQueue()
-	dequeuedPayment, ok := queue.Dequeue()
+	task, ok := queue.Dequeue()
 	if ok {
 		t.Errorf("Dequeue returned true, expected false when queue is empty")
 	}
-	if dequeuedPayment != (dto.Payment{}) {
-		t.Errorf("Expected empty payment, but got %+v", dequeuedPayment)
+	if task != (Task{}) {
+		t.Errorf("Expected empty task, but got %+v", task)
+	}
+}
+
+func TestLockFreeQueue_RetryDelaysTask(t *testing.T) {
+	queue := NewPaymentsQueue()
+	queue.Enqueue(context.Background(), dto.Payment{ID: "1234"})
+
+	task, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Dequeue returned false, expected true")
+	}
+	task.Attempts++
+	queue.Retry(task, time.Hour, errors.New("provider unavailable"))
+
+	if _, ok := queue.Dequeue(); ok {
+		t.Errorf("Dequeue returned a task scheduled in the future")
+	}
+
+	queue.Retry(task, 0, errors.New("provider unavailable"))
+	retried, ok := queue.Dequeue()
+	if !ok {
+		t.Fatalf("Dequeue returned false for a due task")
+	}
+	if retried.Attempts != 1 || retried.LastError != "provider unavailable" {
+		t.Errorf("Unexpected retried task %+v", retried)
+	}
+}
+
+func TestLockFreeQueue_DrainIncludesDeferredTasks(t *testing.T) {
+	queue := NewPaymentsQueue()
+	queue.EnqueueList(context.Background(), []dto.Payment{{ID: "1"}, {ID: "2"}})
+
+	task, _ := queue.Dequeue()
+	queue.Retry(task, time.Hour, errors.New("provider unavailable"))
+
+	drained := queue.Drain()
+	if len(drained) != 2 {
+		t.Fatalf("Drain returned %d payments, expected 2", len(drained))
+	}
+	if _, ok := queue.Dequeue(); ok {
+		t.Errorf("Queue is not empty after Drain")
+	}
+}
+
+func TestLockFreeQueue_RestoreKeepsTaskState(t *testing.T) {
+	queue := NewPaymentsQueue()
+	queue.Enqueue(context.Background(), dto.Payment{ID: "1234"})
+	task, _ := queue.Dequeue()
+	task.Attempts = 3
+	queue.Retry(task, time.Hour, errors.New("provider unavailable"))
+
+	restored := NewPaymentsQueue()
+	restored.Restore(queue.Drain())
+
+	if _, ok := restored.Dequeue(); ok {
+		t.Errorf("Restored task was due before its next attempt")
+	}
+	tasks := restored.Drain()
+	if len(tasks) != 1 {
+		t.Fatalf("Drain returned %d tasks, expected 1", len(tasks))
+	}
+	if tasks[0].Attempts != 3 || tasks[0].LastError != "provider unavailable" || tasks[0].EnqueuedAt != task.EnqueuedAt {
+		t.Errorf("Unexpected restored task %+v", tasks[0])
 	}
 }
@@ -0,0 +1,72 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier общий интерфейс пула и транзакции
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type txKey struct{}
+
+// txState транзакция WithinTx и действия, которые ждут её фиксации
+type txState struct {
+	tx          pgx.Tx
+	afterCommit []func(ctx context.Context)
+}
+
+// WithinTx выполняет fn в одной транзакции: репозитории и PostgresQueue, вызванные с ctx из fn,
+// пишут через неё (см. TxQuerier). Ошибка fn откатывает транзакцию; вложенный вызов
+// выполняется во внешней транзакции
+func WithinTx(ctx context.Context, db *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, action := range state.afterCommit {
+		action(ctx)
+	}
+	return nil
+}
+
+// TxQuerier транзакция WithinTx из ctx или пул db
+func TxQuerier(ctx context.Context, db *pgxpool.Pool) Querier {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db
+}
+
+// AfterCommit выполняет action после фиксации транзакции WithinTx из ctx, а вне транзакции сразу.
+// Так сбрасывается кеш: до фиксации другие читатели ещё видят старые данные
+func AfterCommit(ctx context.Context, action func(ctx context.Context)) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.afterCommit = append(state.afterCommit, action)
+		return
+	}
+	action(ctx)
+}